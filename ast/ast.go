@@ -1,7 +1,10 @@
 package ast
 
+import "github.com/LaH-DeV/veles/source"
+
 type Node interface {
 	String() string
+	Location() source.Span
 }
 
 type Stmt interface {
@@ -14,6 +17,12 @@ type Expr interface {
 	expr()
 }
 
+// Pattern is the left side of a match arm.
+type Pattern interface {
+	Node
+	pattern()
+}
+
 type Type interface {
 	_type()
 }
@@ -5,9 +5,11 @@ import (
 	"strconv"
 
 	"github.com/LaH-DeV/veles/lexer"
+	"github.com/LaH-DeV/veles/source"
 )
 
 type BinaryExpr struct {
+	source.Span
 	Left     Expr
 	Operator lexer.Token
 	Right    Expr
@@ -19,6 +21,7 @@ func (n BinaryExpr) String() string {
 }
 
 type SymbolExpr struct {
+	source.Span
 	Value string
 }
 
@@ -28,34 +31,41 @@ func (n SymbolExpr) String() string {
 }
 
 type IntegerExpr struct {
-	Value int64
+	source.Span
+	Value  uint64 // negative numbers are negated literals
+	Suffix string // the type suffix, like "i64" in 10i64, or ""
 }
 
 func (n IntegerExpr) expr() {}
 func (n IntegerExpr) String() string {
-	return fmt.Sprintf("%d", n.Value)
+	return fmt.Sprintf("%d%s", n.Value, n.Suffix)
 }
 
 type FloatExpr struct {
-	Value float64
+	source.Span
+	Value  float64
+	Suffix string
 }
 
 func (n FloatExpr) expr() {}
 func (n FloatExpr) String() string {
-	return strconv.FormatFloat(n.Value, 'f', -1, 64)
+	return strconv.FormatFloat(n.Value, 'g', -1, 64) + n.Suffix
 }
 
 type AssignmentExpr struct {
+	source.Span
 	Assigne       Expr
+	Operator      lexer.Token // "=" or a compound assignment like "+="
 	AssignedValue Expr
 }
 
 func (n AssignmentExpr) expr() {}
 func (n AssignmentExpr) String() string {
-	return n.Assigne.String() + " = " + n.Assigne.String()
+	return n.Assigne.String() + " " + n.Operator.Value + " " + n.AssignedValue.String()
 }
 
 type PrefixExpr struct {
+	source.Span
 	Operator lexer.Token
 	Right    Expr
 }
@@ -66,6 +76,7 @@ func (n PrefixExpr) String() string {
 }
 
 type CallExpr struct {
+	source.Span
 	Callee    Expr
 	Arguments []Expr
 }
@@ -85,8 +96,10 @@ func (n CallExpr) String() string {
 }
 
 type MemberExpr struct {
-	Container Expr
-	Member    string
+	source.Span
+	Container  Expr
+	Member     string
+	MemberSpan source.Span
 }
 
 func (n MemberExpr) expr() {}
@@ -94,7 +107,18 @@ func (n MemberExpr) String() string {
 	return fmt.Sprintf("%s::%s", n.Container.String(), n.Member)
 }
 
+type StringExpr struct {
+	source.Span
+	Value string // the value with escape sequences resolved
+}
+
+func (n StringExpr) expr() {}
+func (n StringExpr) String() string {
+	return strconv.Quote(n.Value)
+}
+
 type BooleanExpr struct {
+	source.Span
 	Value bool
 }
 
@@ -102,3 +126,169 @@ func (n BooleanExpr) expr() {}
 func (n BooleanExpr) String() string {
 	return fmt.Sprintf("%v", n.Value)
 }
+
+// FieldExpr reads a field of a struct: Object.Field.
+type FieldExpr struct {
+	source.Span
+	Object    Expr
+	Field     string
+	FieldSpan source.Span
+}
+
+func (n FieldExpr) expr() {}
+func (n FieldExpr) String() string {
+	return n.Object.String() + "." + n.Field
+}
+
+// StructLiteralExpr creates a struct value: Type { field: value, ... }.
+type StructLiteralExpr struct {
+	source.Span
+	Type   Expr // a SymbolExpr or a MemberExpr naming the struct
+	Fields []FieldValue
+}
+
+type FieldValue struct {
+	source.Span
+	Name     string
+	NameSpan source.Span
+	Value    Expr
+}
+
+func (n StructLiteralExpr) expr() {}
+func (n StructLiteralExpr) String() string {
+	str := n.Type.String() + " { "
+	for i, field := range n.Fields {
+		if i > 0 {
+			str += ", "
+		}
+		str += field.Name + ": " + field.Value.String()
+	}
+	return str + " }"
+}
+
+// MatchExpr selects the first arm whose pattern matches the value.
+type MatchExpr struct {
+	source.Span
+	Value Expr
+	Arms  []MatchArm
+}
+
+type MatchArm struct {
+	source.Span
+	Pattern Pattern
+	Body    Expr
+}
+
+func (n MatchExpr) expr() {}
+func (n MatchExpr) String() string {
+	str := "match " + n.Value.String() + " {"
+	for i, arm := range n.Arms {
+		if i > 0 {
+			str += ","
+		}
+		str += " " + arm.Pattern.String() + " => " + arm.Body.String()
+	}
+	return str + " }"
+}
+
+// IndexExpr reads an element of an array or a slice: Object[Index].
+type IndexExpr struct {
+	source.Span
+	Object Expr
+	Index  Expr
+}
+
+func (n IndexExpr) expr() {}
+func (n IndexExpr) String() string {
+	return n.Object.String() + "[" + n.Index.String() + "]"
+}
+
+// ArrayLiteralExpr creates an array from its elements: [a, b, c].
+type ArrayLiteralExpr struct {
+	source.Span
+	Elements []Expr
+}
+
+func (n ArrayLiteralExpr) expr() {}
+func (n ArrayLiteralExpr) String() string {
+	str := "["
+	for i, element := range n.Elements {
+		if i > 0 {
+			str += ", "
+		}
+		str += element.String()
+	}
+	return str + "]"
+}
+
+// FunctionExpr creates an anonymous function, which can use the local
+// variables of the functions around it: fn(i32 x) -> i32 { return x + n }.
+type FunctionExpr struct {
+	source.Span
+	Params     []FunctionParameter
+	ReturnType string
+	Body       []Stmt
+}
+
+func (n FunctionExpr) expr() {}
+func (n FunctionExpr) String() string {
+	str := "fn("
+	for i, param := range n.Params {
+		if i > 0 {
+			str += ", "
+		}
+		str += param.String()
+	}
+	str += ")"
+	if n.ReturnType != "" {
+		str += " -> " + n.ReturnType
+	}
+	return str + " { ... }"
+}
+
+// BlockExpr runs its statements in a scope of their own. When the last
+// statement is an expression, its value is the value of the block.
+type BlockExpr struct {
+	source.Span
+	Body []Stmt
+}
+
+func (n BlockExpr) expr() {}
+func (n BlockExpr) String() string {
+	if len(n.Body) == 0 {
+		return "{}"
+	}
+	return "{ ... }"
+}
+
+// IfExpr runs Then when the condition holds and Else otherwise. Else is nil,
+// a *BlockExpr or the *IfExpr of an "else if". With an else, the value of
+// the if is the value of the branch that ran.
+type IfExpr struct {
+	source.Span
+	Condition Expr
+	Then      *BlockExpr
+	Else      Expr
+}
+
+func (n IfExpr) expr() {}
+func (n IfExpr) String() string {
+	str := "if " + n.Condition.String() + " " + n.Then.String()
+	if n.Else != nil {
+		str += " else " + n.Else.String()
+	}
+	return str
+}
+
+// CastExpr converts a value to another type: x as f64.
+type CastExpr struct {
+	source.Span
+	Value    Expr
+	Type     string
+	TypeSpan source.Span
+}
+
+func (n CastExpr) expr() {}
+func (n CastExpr) String() string {
+	return n.Value.String() + " as " + n.Type
+}
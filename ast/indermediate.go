@@ -1,10 +1,44 @@
 package ast
 
+import (
+	"strings"
+
+	"github.com/LaH-DeV/veles/source"
+)
+
 type FunctionParameter struct {
+	source.Span
 	ParamName string
 	ParamType string
+	NameSpan  source.Span
 }
 
 func (n FunctionParameter) String() string {
 	return n.ParamType + " " + n.ParamName
 }
+
+type StructField struct {
+	source.Span
+	FieldType string
+	FieldName string
+	NameSpan  source.Span
+}
+
+func (n StructField) String() string {
+	return n.FieldType + " " + n.FieldName
+}
+
+type EnumVariant struct {
+	source.Span
+	Name       string
+	NameSpan   source.Span
+	Fields     []string // the types of the values carried by the variant
+	FieldSpans []source.Span
+}
+
+func (n EnumVariant) String() string {
+	if len(n.Fields) == 0 {
+		return n.Name
+	}
+	return n.Name + "(" + strings.Join(n.Fields, ", ") + ")"
+}
@@ -0,0 +1,58 @@
+package ast
+
+import (
+	"strings"
+
+	"github.com/LaH-DeV/veles/source"
+)
+
+// WildcardPattern, written _, matches any value.
+type WildcardPattern struct {
+	source.Span
+}
+
+func (n WildcardPattern) pattern() {}
+func (n WildcardPattern) String() string {
+	return "_"
+}
+
+// LiteralPattern matches a value equal to a literal, like 1, -1 or true.
+type LiteralPattern struct {
+	source.Span
+	Value Expr // an IntegerExpr, a FloatExpr or a BooleanExpr, possibly negated
+}
+
+func (n LiteralPattern) pattern() {}
+func (n LiteralPattern) String() string {
+	return n.Value.String()
+}
+
+// VariantPattern matches a variant of an enum, like Shape::Rect(w, h), and
+// binds the values it carries to names.
+type VariantPattern struct {
+	source.Span
+	Variant  Expr // a SymbolExpr or a MemberExpr naming the variant
+	Bindings []PatternBinding
+	Parens   bool // whether the bindings are enclosed in parentheses
+}
+
+type PatternBinding struct {
+	source.Span
+	Name string // the bound name, or "_" to ignore the value
+}
+
+func (n PatternBinding) String() string {
+	return n.Name
+}
+
+func (n VariantPattern) pattern() {}
+func (n VariantPattern) String() string {
+	if !n.Parens {
+		return n.Variant.String()
+	}
+	names := make([]string, len(n.Bindings))
+	for i, binding := range n.Bindings {
+		names[i] = binding.Name
+	}
+	return n.Variant.String() + "(" + strings.Join(names, ", ") + ")"
+}
@@ -1,8 +1,15 @@
 package ast
 
-import "github.com/LaH-DeV/veles/lexer"
+import (
+	"strconv"
+	"strings"
+
+	"github.com/LaH-DeV/veles/lexer"
+	"github.com/LaH-DeV/veles/source"
+)
 
 type Program struct {
+	source.Span
 	Statements []Stmt
 
 	Filetype lexer.Filetype
@@ -19,6 +26,7 @@ func (n *Program) String() string {
 }
 
 type ExpressionStmt struct {
+	source.Span
 	Expression Expr
 }
 
@@ -28,8 +36,10 @@ func (n ExpressionStmt) String() string {
 }
 
 type FunctionStmt struct {
+	source.Span
 	Exported   bool
 	Identifier string
+	NameSpan   source.Span
 	Params     []FunctionParameter
 	ReturnType string // TODO
 	Body       []Stmt
@@ -65,10 +75,13 @@ func (n FunctionStmt) String() string {
 }
 
 type VariableDeclarationStmt struct {
+	source.Span
 	Exported bool
-	VarType  string
+	Mutable  bool
+	VarType  string // empty when the type is inferred from Value
 	VarName  string
-	Value    Expr
+	NameSpan source.Span
+	Value    Expr // nil without an initializer: the variable starts as the zero value of its type
 }
 
 func (n VariableDeclarationStmt) stmt() {}
@@ -78,15 +91,21 @@ func (n VariableDeclarationStmt) String() string {
 		str += "pub "
 	}
 	str += "let "
-	if n.Value == nil {
-		str += n.VarType + " " + n.VarName
-	} else {
-		str += n.VarType + " " + n.VarName + " = " + n.Value.String()
+	if n.Mutable {
+		str += "mut "
+	}
+	if n.VarType != "" {
+		str += n.VarType + " "
+	}
+	str += n.VarName
+	if n.Value != nil {
+		str += " = " + n.Value.String()
 	}
 	return str
 }
 
 type ReturnStmt struct {
+	source.Span
 	Value Expr
 }
 
@@ -100,9 +119,14 @@ func (n *ReturnStmt) String() string {
 }
 
 type UseStmt struct {
+	source.Span
 	Module   string
 	Alias    string
 	Segments []string
+
+	ModuleSpan   source.Span
+	AliasSpan    source.Span
+	SegmentSpans []source.Span
 }
 
 func (n *UseStmt) stmt() {}
@@ -119,19 +143,51 @@ func (n *UseStmt) String() string {
 	return str
 }
 
+// ExternStmt declares a function imported from the host. Module and Field
+// name the import, as in extern "env" "log" fn :: log(i32 value), and are
+// empty when left out.
 type ExternStmt struct {
+	source.Span
+	Module    string
+	Field     string
 	Statement Stmt
+
+	ModuleSpan source.Span
+	FieldSpan  source.Span
+}
+
+// Import returns the host module and the field the declaration is imported
+// from: "env" and the name of the function unless they are written.
+func (n *ExternStmt) Import() (module, field string) {
+	module, field = n.Module, n.Field
+	if n.ModuleSpan == (source.Span{}) {
+		module = "env"
+	}
+	if decl, ok := n.Statement.(*FunctionDeclaration); ok && n.FieldSpan == (source.Span{}) {
+		field = decl.Identifier
+	}
+	return module, field
 }
 
 func (n *ExternStmt) stmt() {}
 func (n *ExternStmt) String() string {
-	return n.Statement.String()
+	str := n.Statement.String()
+	if n.ModuleSpan == (source.Span{}) {
+		return str
+	}
+	names := strconv.Quote(n.Module)
+	if n.FieldSpan != (source.Span{}) {
+		names += " " + strconv.Quote(n.Field)
+	}
+	return "extern " + names + " " + strings.TrimPrefix(str, "extern ")
 }
 
 type FunctionDeclaration struct {
+	source.Span
 	Extern     bool
 	Exported   bool
 	Identifier string
+	NameSpan   source.Span
 	Params     []FunctionParameter
 	ReturnType string // TODO
 }
@@ -159,18 +215,52 @@ func (n *FunctionDeclaration) String() string {
 	return str
 }
 
-type IfStmt struct {
-	Condition Expr // must evaluate to BooleanExpr
-	Then      []Stmt
-	// Else TODO
+type StructStmt struct {
+	source.Span
+	Exported   bool
+	Identifier string
+	NameSpan   source.Span
+	Fields     []StructField
 }
 
-func (n *IfStmt) stmt() {}
-func (n *IfStmt) String() string {
-	str := "if " + n.Condition.String() + " {\n"
-	for _, stmt := range n.Then {
-		str += "\t" + stmt.String()
+// EnumStmt declares an enum, a type whose values are one of its variants. A
+// variant may carry values, which makes the enum a tagged union.
+type EnumStmt struct {
+	source.Span
+	Exported   bool
+	Identifier string
+	NameSpan   source.Span
+	Variants   []EnumVariant
+}
+
+func (n *EnumStmt) stmt() {}
+func (n *EnumStmt) String() string {
+	var str string
+	if n.Exported {
+		str += "pub "
 	}
-	str += "\n}"
-	return str
+	str += "enum " + n.Identifier + " {"
+	for i, variant := range n.Variants {
+		if i > 0 {
+			str += ","
+		}
+		str += " " + variant.String()
+	}
+	return str + " }"
+}
+
+func (n *StructStmt) stmt() {}
+func (n *StructStmt) String() string {
+	var str string
+	if n.Exported {
+		str += "pub "
+	}
+	str += "struct " + n.Identifier + " {"
+	for i, field := range n.Fields {
+		if i > 0 {
+			str += ","
+		}
+		str += " " + field.String()
+	}
+	return str + " }"
 }
@@ -0,0 +1,98 @@
+package ast
+
+// Inspect traverses the tree rooted at node in depth-first order, calling f for
+// every node. When f returns false the children of that node are skipped.
+func Inspect(node Node, f func(Node) bool) {
+	if node == nil || !f(node) {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		inspectStmts(n.Statements, f)
+	case *ExpressionStmt:
+		Inspect(n.Expression, f)
+	case *FunctionStmt:
+		for i := range n.Params {
+			Inspect(&n.Params[i], f)
+		}
+		inspectStmts(n.Body, f)
+	case *FunctionDeclaration:
+		for i := range n.Params {
+			Inspect(&n.Params[i], f)
+		}
+	case *VariableDeclarationStmt:
+		if n.Value != nil {
+			Inspect(n.Value, f)
+		}
+	case *ReturnStmt:
+		if n.Value != nil {
+			Inspect(n.Value, f)
+		}
+	case *ExternStmt:
+		Inspect(n.Statement, f)
+	case *BinaryExpr:
+		Inspect(n.Left, f)
+		Inspect(n.Right, f)
+	case *PrefixExpr:
+		Inspect(n.Right, f)
+	case *AssignmentExpr:
+		Inspect(n.Assigne, f)
+		Inspect(n.AssignedValue, f)
+	case *CallExpr:
+		Inspect(n.Callee, f)
+		for _, arg := range n.Arguments {
+			Inspect(arg, f)
+		}
+	case *MemberExpr:
+		Inspect(n.Container, f)
+	case *FieldExpr:
+		Inspect(n.Object, f)
+	case *StructLiteralExpr:
+		Inspect(n.Type, f)
+		for _, field := range n.Fields {
+			Inspect(field.Value, f)
+		}
+	case *IndexExpr:
+		Inspect(n.Object, f)
+		Inspect(n.Index, f)
+	case *ArrayLiteralExpr:
+		for _, element := range n.Elements {
+			Inspect(element, f)
+		}
+	case *FunctionExpr:
+		for i := range n.Params {
+			Inspect(&n.Params[i], f)
+		}
+		inspectStmts(n.Body, f)
+	case *CastExpr:
+		Inspect(n.Value, f)
+	case *BlockExpr:
+		inspectStmts(n.Body, f)
+	case *IfExpr:
+		Inspect(n.Condition, f)
+		Inspect(n.Then, f)
+		if n.Else != nil {
+			Inspect(n.Else, f)
+		}
+	case *MatchExpr:
+		Inspect(n.Value, f)
+		for _, arm := range n.Arms {
+			Inspect(arm.Pattern, f)
+			Inspect(arm.Body, f)
+		}
+	case *LiteralPattern:
+		Inspect(n.Value, f)
+	case *VariantPattern:
+		Inspect(n.Variant, f)
+		for i := range n.Bindings {
+			Inspect(&n.Bindings[i], f)
+		}
+	}
+}
+
+func inspectStmts(stmts []Stmt, f func(Node) bool) {
+	for _, stmt := range stmts {
+		Inspect(stmt, f)
+	}
+}
@@ -0,0 +1,239 @@
+package cfg
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/LaH-DeV/veles/ast"
+)
+
+// Graph is the control-flow graph of a function body. Its blocks run their
+// nodes in order and continue with one of their successors. Function
+// expressions in the body are not part of the graph, they get graphs of their
+// own.
+type Graph struct {
+	Entry  *Block
+	Exit   *Block   // the block every return and the end of the body lead to
+	Blocks []*Block // in the order they were created, Entry first and Exit last
+
+	// Unreachable lists the statements that never run, only the first one of
+	// every run of them.
+	Unreachable []Unreachable
+
+	end *Block // the block running at the end of the body
+}
+
+// Block is a basic block: a straight sequence of nodes with a single entry.
+//
+// Statements are placed in the block where they complete. A statement
+// containing an if, a match or a block is split: the condition or the matched
+// value ends the block before the branches, every branch gets blocks of its
+// own, and the statement is placed in the block where the branches join. The
+// operators && and || do not split blocks.
+type Block struct {
+	Index     int
+	Nodes     []ast.Node
+	Succs     []*Block
+	Preds     []*Block
+	Reachable bool // whether any path from the entry leads to the block
+}
+
+// Unreachable is a statement that never runs, because the statement before
+// it returns on every path.
+type Unreachable struct {
+	Stmt  ast.Stmt
+	After ast.Stmt
+}
+
+// FallsOffEnd reports whether a path reaches the end of the body without a
+// return statement.
+func (g *Graph) FallsOffEnd() bool {
+	return g.end.Reachable
+}
+
+// String renders the blocks of the graph, one per line with their successors,
+// followed by their nodes.
+func (g *Graph) String() string {
+	var out strings.Builder
+	for _, block := range g.Blocks {
+		succs := make([]string, 0, len(block.Succs))
+		for _, succ := range block.Succs {
+			succs = append(succs, fmt.Sprintf("b%d", succ.Index))
+		}
+		name := fmt.Sprintf("b%d", block.Index)
+		switch block {
+		case g.Entry:
+			name += " (entry)"
+		case g.Exit:
+			name += " (exit)"
+		}
+		if !block.Reachable {
+			name += " (unreachable)"
+		}
+		fmt.Fprintf(&out, "%s -> [%s]\n", name, strings.Join(succs, " "))
+		for _, node := range block.Nodes {
+			fmt.Fprintf(&out, "  %s\n", node.String())
+		}
+	}
+	return out.String()
+}
+
+// Build constructs the control-flow graph of a function body.
+func Build(body []ast.Stmt) *Graph {
+	b := &builder{graph: &Graph{}}
+	b.graph.Entry = b.newBlock()
+	b.current = b.graph.Entry
+	b.stmts(body)
+	b.graph.end = b.current
+
+	b.graph.Exit = b.newBlock()
+	b.edge(b.current, b.graph.Exit)
+	for _, block := range b.returns {
+		b.edge(block, b.graph.Exit)
+	}
+	b.graph.Entry.mark()
+
+	for _, run := range b.runs {
+		for i := 1; i < len(run); i++ {
+			if !run[i].start.Reachable && run[i-1].start.Reachable {
+				b.graph.Unreachable = append(b.graph.Unreachable, Unreachable{Stmt: run[i].stmt, After: run[i-1].stmt})
+			}
+		}
+	}
+	return b.graph
+}
+
+// mark marks the blocks reachable from b.
+func (b *Block) mark() {
+	if b.Reachable {
+		return
+	}
+	b.Reachable = true
+	for _, succ := range b.Succs {
+		succ.mark()
+	}
+}
+
+type builder struct {
+	graph   *Graph
+	current *Block
+	returns []*Block // the blocks ending with a return
+
+	// the statement lists of the body, with the block every statement starts in
+	runs [][]started
+}
+
+type started struct {
+	stmt  ast.Stmt
+	start *Block
+}
+
+func (b *builder) newBlock() *Block {
+	block := &Block{Index: len(b.graph.Blocks)}
+	b.graph.Blocks = append(b.graph.Blocks, block)
+	return block
+}
+
+func (b *builder) edge(from, to *Block) {
+	from.Succs = append(from.Succs, to)
+	to.Preds = append(to.Preds, from)
+}
+
+func (b *builder) stmts(stmts []ast.Stmt) {
+	run := make([]started, 0, len(stmts))
+	for _, stmt := range stmts {
+		run = append(run, started{stmt, b.current})
+		b.stmt(stmt)
+	}
+	b.runs = append(b.runs, run)
+}
+
+func (b *builder) stmt(stmt ast.Stmt) {
+	switch stmt := stmt.(type) {
+	case *ast.ExpressionStmt:
+		b.expr(stmt.Expression)
+	case *ast.VariableDeclarationStmt:
+		if stmt.Value != nil {
+			b.expr(stmt.Value)
+		}
+	case *ast.ReturnStmt:
+		if stmt.Value != nil {
+			b.expr(stmt.Value)
+		}
+		b.current.Nodes = append(b.current.Nodes, stmt)
+		b.returns = append(b.returns, b.current)
+		// whatever follows starts a block without predecessors
+		b.current = b.newBlock()
+		return
+	}
+	b.current.Nodes = append(b.current.Nodes, stmt)
+}
+
+// expr splits the current block at the ifs, matches and blocks of an
+// expression, in the order they are evaluated.
+func (b *builder) expr(expr ast.Expr) {
+	ast.Inspect(expr, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.IfExpr:
+			b.ifExpr(node)
+			return false
+		case *ast.MatchExpr:
+			b.match(node)
+			return false
+		case *ast.BlockExpr:
+			b.stmts(node.Body)
+			return false
+		case *ast.FunctionExpr:
+			return false
+		}
+		return true
+	})
+}
+
+func (b *builder) ifExpr(expr *ast.IfExpr) {
+	b.expr(expr.Condition)
+	b.current.Nodes = append(b.current.Nodes, expr.Condition)
+	branch := b.current
+	join := &Block{}
+
+	b.current = b.newBlock()
+	b.edge(branch, b.current)
+	b.expr(expr.Then)
+	b.edge(b.current, join)
+
+	if expr.Else != nil {
+		b.current = b.newBlock()
+		b.edge(branch, b.current)
+		b.expr(expr.Else)
+		b.edge(b.current, join)
+	} else {
+		b.edge(branch, join)
+	}
+	b.place(join)
+}
+
+func (b *builder) match(expr *ast.MatchExpr) {
+	b.expr(expr.Value)
+	b.current.Nodes = append(b.current.Nodes, expr.Value)
+	branch := b.current
+	join := &Block{}
+	for _, arm := range expr.Arms {
+		b.current = b.newBlock()
+		b.edge(branch, b.current)
+		b.current.Nodes = append(b.current.Nodes, arm.Pattern)
+		b.expr(arm.Body)
+		b.edge(b.current, join)
+	}
+	if len(expr.Arms) == 0 {
+		b.edge(branch, join)
+	}
+	b.place(join)
+}
+
+// place adds a join block, created before the branches leading to it, to the
+// graph after them.
+func (b *builder) place(join *Block) {
+	join.Index = len(b.graph.Blocks)
+	b.graph.Blocks = append(b.graph.Blocks, join)
+	b.current = join
+}
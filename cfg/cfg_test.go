@@ -0,0 +1,94 @@
+package cfg
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/LaH-DeV/veles/ast"
+	"github.com/LaH-DeV/veles/lexer"
+	"github.com/LaH-DeV/veles/parser"
+)
+
+// build parses the body of a function and builds its graph.
+func build(t *testing.T, body string) *Graph {
+	t.Helper()
+	lex := lexer.NewLexer(lexer.Vs)
+	tokens := lex.Tokenize("fn :: f(bool a, bool b, i32 n) {\n" + body + "\n}")
+	par := parser.NewParser(lexer.Vs)
+	program := par.ParseFile(tokens, "test.vs")
+	if len(lex.Diagnostics)+len(par.Diagnostics) > 0 {
+		t.Fatalf("syntax errors in %q", body)
+	}
+	return Build(program.Statements[0].(*ast.FunctionStmt).Body)
+}
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		fallsOff    bool
+		unreachable []string // the first statements of unreachable runs
+	}{
+		{"empty", "", true, nil},
+		{"return", "return", false, nil},
+		{"statements then return", "let i32 x = 1\nreturn", false, nil},
+		{"if without else", "if a {\n    return\n}", true, nil},
+		{"if and else return", "if a {\n    return\n} else {\n    return\n}", false, nil},
+		{"else if chain", "if a {\n    return\n} else if b {\n    return\n} else {\n    return\n}", false, nil},
+		{"else if without else", "if a {\n    return\n} else if b {\n    return\n}", true, nil},
+		{"block returns", "{\n    return\n}", false, nil},
+		{"match returns on every arm", "match n {\n    0 => { return },\n    _ => { return },\n}", false, nil},
+		{"match with a value arm", "match n {\n    0 => { return },\n    _ => 1,\n}", true, nil},
+		{"after a return", "return\nlet i32 x = 1\nlet i32 y = 2", false, []string{"let i32 x = 1"}},
+		{"after both branches return", "if a {\n    return\n} else {\n    return\n}\nn = 1", false, []string{"n = 1"}},
+		{"inside a branch", "if a {\n    return\n    n = 1\n}", true, []string{"n = 1"}},
+		{"return in a condition", "if { return } {\n    n = 1\n}\nn = 2", false, []string{"n = 2"}},
+		{"logical operators do not return", "let bool c = a && b || a\nreturn", false, nil},
+		{"function expressions have their own graph", "let g = fn() { return }\nn = 1", true, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			graph := build(t, test.body)
+			if graph.FallsOffEnd() != test.fallsOff {
+				t.Errorf("FallsOffEnd() = %t, want %t\n%s", graph.FallsOffEnd(), test.fallsOff, graph)
+			}
+			unreachable := make([]string, 0)
+			for _, u := range graph.Unreachable {
+				unreachable = append(unreachable, u.Stmt.String())
+			}
+			if !slices.Equal(unreachable, test.unreachable) {
+				t.Errorf("got unreachable %q, want %q\n%s", unreachable, test.unreachable, graph)
+			}
+		})
+	}
+}
+
+func TestGraphString(t *testing.T) {
+	// b3 is the empty block the else branch would continue in after its return
+	graph := build(t, "if a {\n    n = 1\n} else {\n    return\n}\nn = 2")
+	want := `b0 (entry) -> [b1 b2]
+  a
+b1 -> [b4]
+  n = 1
+b2 -> [b5]
+  return
+b3 (unreachable) -> [b4]
+b4 -> [b5]
+  if a { ... } else { ... }
+  n = 2
+b5 (exit) -> []
+`
+	if got := graph.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	if graph.Entry != graph.Blocks[0] || graph.Exit != graph.Blocks[len(graph.Blocks)-1] {
+		t.Error("the entry and the exit are not the first and the last block")
+	}
+	for _, block := range graph.Blocks {
+		for _, succ := range block.Succs {
+			if !slices.Contains(succ.Preds, block) {
+				t.Errorf("b%d is not a predecessor of b%d", block.Index, succ.Index)
+			}
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package checker
+
+import (
+	"math"
+
+	"github.com/LaH-DeV/veles/ast"
+	"github.com/LaH-DeV/veles/diagnostics"
+	"github.com/LaH-DeV/veles/lexer"
+	"github.com/LaH-DeV/veles/types"
+)
+
+// exprFor checks an expression whose value is stored in a location of type
+// target, like a variable or a parameter. Array literals take their element
+// type from the target, so that [1, 2] can initialize a []f32.
+func (c *checker) exprFor(expr ast.Expr, target types.Type) types.Type {
+	literal, ok := expr.(*ast.ArrayLiteralExpr)
+	if !ok {
+		return c.expr(expr)
+	}
+	t := c.arrayLiteral(literal, target)
+	c.module.Info.Types[expr] = t
+	return t
+}
+
+// arrayLiteral checks the elements of an array literal against the element
+// type of target, or against the type of the first element when target is not
+// an array or a slice.
+func (c *checker) arrayLiteral(expr *ast.ArrayLiteralExpr, target types.Type) types.Type {
+	var elem types.Type
+	switch target := target.(type) {
+	case *types.Array:
+		elem = target.Elem
+	case *types.Slice:
+		elem = target.Elem
+	}
+
+	for _, element := range expr.Elements {
+		t := c.exprFor(element, elem)
+		if elem != nil {
+			c.expectAssignable(t, elem, element)
+			continue
+		}
+		if t == types.Void {
+			c.errorf(diagnostics.NoValue, element.Location(), "%s does not produce a value", element.String())
+			t = types.Invalid
+		}
+		elem = t
+	}
+	if elem == nil {
+		c.report(diagnostics.Errorf(diagnostics.InvalidArrayLiteral, expr.Span, "cannot infer the element type of an empty array literal").
+			WithNote("use the literal where an array or a slice type is expected, like \"let []i32 empty = []\""))
+		return types.Invalid
+	}
+	if types.IsInvalid(elem) {
+		return types.Invalid
+	}
+	return &types.Array{Elem: elem, Len: len(expr.Elements)}
+}
+
+// indexExpr checks an index into an array or a slice. Constant indices into
+// arrays are checked against the length of the array here, every other index
+// is checked when the program runs.
+func (c *checker) indexExpr(expr *ast.IndexExpr) types.Type {
+	object := c.expr(expr.Object)
+	index := c.expr(expr.Index)
+	if !types.IsInvalid(index) && !types.IsInteger(index) {
+		c.errorf(diagnostics.InvalidIndex, expr.Index.Location(), "index %s must be an integer, not %s", expr.Index.String(), index)
+	}
+
+	value, constant := constantIndex(expr.Index)
+	switch object := object.(type) {
+	case *types.Array:
+		if constant && (value < 0 || value >= int64(object.Len)) {
+			c.report(diagnostics.Errorf(diagnostics.InvalidIndex, expr.Index.Location(), "index %d is out of range for %s", value, object).
+				WithNote("the indices of %s are 0 to %d", expr.Object.String(), object.Len-1))
+		}
+		return object.Elem
+	case *types.Slice:
+		if constant && value < 0 {
+			c.errorf(diagnostics.InvalidIndex, expr.Index.Location(), "index %d is negative", value)
+		}
+		return object.Elem
+	}
+	if !types.IsInvalid(object) {
+		c.errorf(diagnostics.InvalidIndex, expr.Span, "cannot index %s of type %s", expr.Object.String(), object)
+	}
+	return types.Invalid
+}
+
+// constantIndex returns the value of an index written as a literal, possibly
+// negated.
+func constantIndex(expr ast.Expr) (int64, bool) {
+	sign := int64(1)
+	if prefix, ok := expr.(*ast.PrefixExpr); ok && prefix.Operator.Kind == lexer.DASH {
+		sign, expr = -1, prefix.Right
+	}
+	literal, ok := expr.(*ast.IntegerExpr)
+	if !ok || literal.Value > math.MaxInt64 {
+		return 0, false
+	}
+	return sign * int64(literal.Value), true
+}
+
+// builtin returns the builtin function called by a call expression, or nil
+// when the callee is not the name of a builtin or a declaration shadows it.
+func (c *checker) builtin(expr *ast.CallExpr) *Symbol {
+	callee, ok := expr.Callee.(*ast.SymbolExpr)
+	if !ok || c.scope.Lookup(callee.Value) != nil {
+		return nil
+	}
+	return builtins[callee.Value]
+}
+
+// builtinCall checks a call to a builtin function.
+func (c *checker) builtinCall(expr *ast.CallExpr, builtin *Symbol) types.Type {
+	c.module.Info.Uses[expr.Callee] = builtin
+	args := make([]types.Type, 0, len(expr.Arguments))
+	for _, arg := range expr.Arguments {
+		args = append(args, c.expr(arg))
+	}
+	if len(args) != 1 {
+		c.errorf(diagnostics.WrongArgumentCount, expr.Span, "wrong number of arguments in call to %s: have %d, want 1", builtin.Name, len(args))
+		return types.I32
+	}
+
+	// len is the only builtin: the number of elements of an array or a slice,
+	// or the number of bytes of a string
+	switch arg := args[0]; {
+	case types.IsInvalid(arg), types.IsArray(arg), types.IsSlice(arg), arg == types.Str:
+	default:
+		c.errorf(diagnostics.InvalidOperation, expr.Arguments[0].Location(), "invalid argument %s (%s) for len: not an array, a slice or a string", expr.Arguments[0].String(), arg)
+	}
+	return types.I32
+}
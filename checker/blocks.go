@@ -0,0 +1,109 @@
+package checker
+
+import (
+	"github.com/LaH-DeV/veles/ast"
+	"github.com/LaH-DeV/veles/diagnostics"
+	"github.com/LaH-DeV/veles/types"
+)
+
+// exprUsed checks an expression whose value is used, or discarded like the
+// value of an expression statement. A discarded block or if has no value, so
+// its branches do not need to agree on a type.
+func (c *checker) exprUsed(expr ast.Expr, used bool) types.Type {
+	var t types.Type
+	switch expr := expr.(type) {
+	case *ast.BlockExpr:
+		t = c.blockExpr(expr, used)
+	case *ast.IfExpr:
+		t = c.ifExpr(expr, used)
+	default:
+		return c.expr(expr)
+	}
+	c.module.Info.Types[expr] = t
+	return t
+}
+
+// blockExpr checks the statements of a block in a scope of their own. The
+// value of a used block is the value of its last statement, when that is an
+// expression.
+func (c *checker) blockExpr(expr *ast.BlockExpr, used bool) types.Type {
+	c.openScope(expr.Span)
+	defer c.closeScope()
+	body := expr.Body
+	if !used || len(body) == 0 {
+		c.stmts(body)
+		return types.Void
+	}
+	c.stmts(body[:len(body)-1])
+	last, ok := body[len(body)-1].(*ast.ExpressionStmt)
+	if !ok {
+		c.stmt(body[len(body)-1])
+		return types.Void
+	}
+	return c.exprUsed(last.Expression, true)
+}
+
+// ifExpr checks an if. The value of a used if with an else is the value of
+// its branches, which must have the same type, unless one of them returns
+// from the function.
+func (c *checker) ifExpr(expr *ast.IfExpr, used bool) types.Type {
+	c.expectType(c.expr(expr.Condition), types.Bool, expr.Condition)
+	then := c.exprUsed(expr.Then, used)
+	if expr.Else == nil {
+		if used && then != types.Void && !types.IsInvalid(then) {
+			c.report(diagnostics.Errorf(diagnostics.NoValue, expr.Span, "if without else does not produce a value").
+				WithNote("add an else branch producing a value of type %s", then))
+			return types.Invalid
+		}
+		return types.Void
+	}
+	otherwise := c.exprUsed(expr.Else, used)
+	if !used {
+		return types.Void
+	}
+
+	switch {
+	case diverges(expr.Else), types.IsInvalid(otherwise):
+		return then
+	case diverges(expr.Then), types.IsInvalid(then):
+		return otherwise
+	case assignable(otherwise, then), c.adaptLiteral(expr.Else, then):
+		return then
+	case c.adaptLiteral(expr.Then, otherwise):
+		return otherwise
+	}
+	c.report(diagnostics.Errorf(diagnostics.MismatchedTypes, branchValue(expr.Else).Location(), "if branches have different types: %s and %s", then, otherwise).
+		WithLabel(branchValue(expr.Then).Location(), "%s", then))
+	return types.Invalid
+}
+
+// branchValue returns the expression producing the value of a branch, or the
+// block itself when it ends with a statement.
+func branchValue(expr ast.Expr) ast.Expr {
+	if block, ok := expr.(*ast.BlockExpr); ok {
+		if value := blockValue(block); value != nil {
+			return branchValue(value)
+		}
+	}
+	return expr
+}
+
+// diverges reports whether a block or an if always returns from the function
+// before it ends.
+func diverges(expr ast.Expr) bool {
+	switch expr := expr.(type) {
+	case *ast.BlockExpr:
+		if len(expr.Body) == 0 {
+			return false
+		}
+		switch last := expr.Body[len(expr.Body)-1].(type) {
+		case *ast.ReturnStmt:
+			return true
+		case *ast.ExpressionStmt:
+			return diverges(last.Expression)
+		}
+	case *ast.IfExpr:
+		return expr.Else != nil && diverges(expr.Then) && diverges(expr.Else)
+	}
+	return false
+}
@@ -0,0 +1,301 @@
+package checker
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/LaH-DeV/veles/ast"
+	"github.com/LaH-DeV/veles/diagnostics"
+	"github.com/LaH-DeV/veles/source"
+	"github.com/LaH-DeV/veles/types"
+)
+
+// Importer loads the module named by the segments of a use statement,
+// e.g. ["math", "constants"] for "use math::constants".
+type Importer interface {
+	Import(path []string) (*Module, error)
+}
+
+// Info records what the checker learned about the nodes of a module.
+type Info struct {
+	Types map[ast.Expr]types.Type // the type of every checked expression
+	Defs  map[ast.Node]*Symbol    // declaring nodes and the symbols they declare
+	Uses  map[ast.Expr]*Symbol    // symbol and member expressions and the symbols they refer to
+
+	// Imports maps use statements importing a single member, like
+	// "use math::constants::PI", to the imported symbol.
+	Imports map[*ast.UseStmt]*Symbol
+
+	// Captures lists the local variables and parameters of enclosing
+	// functions that each function expression uses, in the order of their
+	// first use.
+	Captures map[*ast.FunctionExpr][]*Symbol
+}
+
+// Module is a checked source file.
+type Module struct {
+	Name    string // the module path as written in use statements, e.g. "math::constants"
+	Program *ast.Program
+	Scope   *Scope
+	Info    *Info
+
+	Diagnostics []diagnostics.Diagnostic
+}
+
+// Member returns the top-level symbol declared by the module under name.
+func (m *Module) Member(name string) *Symbol {
+	symbol, exists := m.Scope.Symbols[name]
+	if !exists || symbol.Module != m {
+		return nil
+	}
+	return symbol
+}
+
+// Exports returns the exported top-level symbols of the module.
+func (m *Module) Exports() []*Symbol {
+	result := make([]*Symbol, 0)
+	for _, symbol := range m.Scope.Visible(m.Scope.Span.End.Offset) {
+		if symbol.Exported && symbol.Module == m {
+			result = append(result, symbol)
+		}
+	}
+	return result
+}
+
+// SymbolAt returns the symbol declared or referenced at the offset together
+// with the span of the name found there.
+func (m *Module) SymbolAt(offset int) (*Symbol, source.Span) {
+	for expr, symbol := range m.Info.Uses {
+		span := expr.Location()
+		if member, ok := expr.(*ast.MemberExpr); ok {
+			span = member.MemberSpan
+		}
+		if span.Contains(offset) {
+			return symbol, span
+		}
+	}
+	for _, symbol := range m.Info.Defs {
+		if symbol.Span.Contains(offset) {
+			return symbol, symbol.Span
+		}
+	}
+	return nil, source.Span{}
+}
+
+type checker struct {
+	module   *Module
+	importer Importer
+	scope    *Scope
+	function *types.Signature // the function whose body is being checked
+	closures []*closure       // the function expressions being checked, innermost last
+
+	inferring map[*Symbol]bool // globals whose type is being inferred from their initializer
+}
+
+// Check resolves the names of a parsed program and computes the types of its
+// expressions. Problems are reported in the Diagnostics of the returned module.
+func Check(program *ast.Program, name string, importer Importer) *Module {
+	module := &Module{
+		Name:    name,
+		Program: program,
+		Scope:   NewScope(nil, program.Span),
+		Info: &Info{
+			Types: make(map[ast.Expr]types.Type),
+			Defs:  make(map[ast.Node]*Symbol),
+			Uses:  make(map[ast.Expr]*Symbol),
+
+			Imports:  make(map[*ast.UseStmt]*Symbol),
+			Captures: make(map[*ast.FunctionExpr][]*Symbol),
+		},
+		Diagnostics: make([]diagnostics.Diagnostic, 0),
+	}
+
+	c := &checker{
+		module:    module,
+		importer:  importer,
+		scope:     module.Scope,
+		inferring: make(map[*Symbol]bool),
+	}
+
+	// imports and struct names come first, so that any signature or field can
+	// refer to them
+	for _, stmt := range program.Statements {
+		c.declareTypes(stmt)
+	}
+	for _, stmt := range program.Statements {
+		c.declareTopLevel(stmt)
+	}
+	c.checkRecursiveStructs()
+	// globals declared without a type take the type of their initializer
+	// before any function body uses them
+	for _, stmt := range program.Statements {
+		if decl, ok := stmt.(*ast.VariableDeclarationStmt); ok && decl.VarType == "" {
+			c.inferGlobal(c.module.Info.Defs[decl], nil)
+		}
+	}
+	for _, stmt := range program.Statements {
+		c.checkTopLevel(stmt)
+	}
+	c.checkInitialization()
+	c.checkControlFlow()
+
+	return module
+}
+
+func (c *checker) errorf(code *diagnostics.Code, span source.Span, format string, args ...any) {
+	c.report(diagnostics.Errorf(code, span, format, args...))
+}
+
+func (c *checker) report(diagnostic diagnostics.Diagnostic) {
+	c.module.Diagnostics = append(c.module.Diagnostics, diagnostic)
+}
+
+// declaredHere labels the declaration of symbol when it is in the module being
+// checked, or notes the declaring module otherwise.
+func (c *checker) declaredHere(d diagnostics.Diagnostic, symbol *Symbol) diagnostics.Diagnostic {
+	if symbol.Module == c.module {
+		return d.WithLabel(symbol.Span, "%s declared here", symbol.Name)
+	}
+	if symbol.Module != nil {
+		return d.WithNote("%s is declared in module %s", symbol.Name, symbol.Module.Name)
+	}
+	return d
+}
+
+func (c *checker) openScope(span source.Span) {
+	c.scope = NewScope(c.scope, span)
+}
+
+func (c *checker) closeScope() {
+	c.scope = c.scope.Parent
+}
+
+// declare adds the symbol to the current scope, reporting redeclarations.
+func (c *checker) declare(symbol *Symbol) {
+	if previous, exists := c.scope.Symbols[symbol.Name]; exists {
+		c.report(diagnostics.Errorf(diagnostics.Redeclared, symbol.Span, "%s redeclared in this scope", symbol.Name).
+			WithLabel(previous.Span, "previous declaration of %s", previous.Name))
+		return
+	}
+	c.scope.Symbols[symbol.Name] = symbol
+	if symbol.Decl != nil {
+		c.module.Info.Defs[symbol.Decl] = symbol
+	}
+}
+
+// resolveType returns the type spelled by name, reporting unknown types. Besides
+// the builtin types, a name can refer to a struct in scope or, qualified like
+// geo::Vec2, to a struct exported by an imported module. Enums are resolved
+// the same way. Array and slice types, like [4]i32 and []geo::Vec2, resolve
+// their element type, and function types their parameters and result.
+func (c *checker) resolveType(name string, span source.Span) types.Type {
+	if name == "" {
+		return types.Void
+	}
+	if t := types.Lookup(name); t != nil {
+		return t
+	}
+	if strings.HasPrefix(name, "fn(") {
+		params, result := splitFunctionType(name)
+		sig := &types.Signature{
+			Params:     make([]types.Type, 0, len(params)),
+			ParamNames: make([]string, 0, len(params)),
+			Result:     c.resolveType(result, span),
+		}
+		valid := !types.IsInvalid(sig.Result)
+		for _, param := range params {
+			t := c.resolveType(param, span)
+			valid = valid && !types.IsInvalid(t)
+			sig.Params = append(sig.Params, t)
+			sig.ParamNames = append(sig.ParamNames, "")
+		}
+		if !valid {
+			return types.Invalid
+		}
+		return sig
+	}
+	if strings.HasPrefix(name, "[") {
+		end := strings.Index(name, "]")
+		elem := c.resolveType(name[end+1:], span)
+		if types.IsInvalid(elem) {
+			return types.Invalid
+		}
+		if end == 1 {
+			return &types.Slice{Elem: elem}
+		}
+		length, err := strconv.ParseInt(name[1:end], 10, 32)
+		if err != nil {
+			c.errorf(diagnostics.UnknownType, span, "invalid array type %s: length %s is too large", name, name[1:end])
+			return types.Invalid
+		}
+		return &types.Array{Elem: elem, Len: int(length)}
+	}
+
+	path := strings.Split(name, "::")
+	symbol := c.scope.Lookup(path[0])
+	for i := 1; i < len(path) && symbol != nil; i++ {
+		if symbol.Kind != ModuleSymbol {
+			c.errorf(diagnostics.ModuleMisuse, span, "%s is not a module", strings.Join(path[:i], "::"))
+			return types.Invalid
+		}
+		module := symbol.Target
+		if symbol = module.Member(path[i]); symbol == nil {
+			c.errorf(diagnostics.NoMember, span, "module %s has no member %s", module.Name, path[i])
+			return types.Invalid
+		}
+		if !symbol.Exported {
+			c.report(diagnostics.Errorf(diagnostics.NotExported, span, "%s is not exported by module %s", path[i], module.Name).
+				WithNote("declare %s with \"pub\" in module %s to export it", path[i], module.Name))
+			return types.Invalid
+		}
+	}
+	if symbol == nil {
+		c.errorf(diagnostics.UnknownType, span, "unknown type %s", name)
+		return types.Invalid
+	}
+	if symbol.Kind != StructSymbol && symbol.Kind != EnumSymbol {
+		c.report(c.declaredHere(diagnostics.Errorf(diagnostics.UnknownType, span, "%s is not a type", name), symbol))
+		return types.Invalid
+	}
+	return symbol.Type
+}
+
+// splitFunctionType returns the parameter types and the result type of a
+// function type written like fn(i32, fn(i32) -> i32) -> i32.
+func splitFunctionType(name string) (params []string, result string) {
+	depth, start := 0, len("fn(")
+	for i := start; i < len(name); i++ {
+		switch name[i] {
+		case '(':
+			depth++
+		case ',':
+			if depth == 0 {
+				params = append(params, strings.TrimSpace(name[start:i]))
+				start = i + 1
+			}
+		case ')':
+			if depth > 0 {
+				depth--
+				continue
+			}
+			if param := strings.TrimSpace(name[start:i]); param != "" {
+				params = append(params, param)
+			}
+			return params, strings.TrimPrefix(name[i+1:], " -> ")
+		}
+	}
+	return params, ""
+}
+
+func (c *checker) signature(params []ast.FunctionParameter, returnType string, span source.Span) *types.Signature {
+	sig := &types.Signature{
+		Params:     make([]types.Type, 0, len(params)),
+		ParamNames: make([]string, 0, len(params)),
+		Result:     c.resolveType(returnType, span),
+	}
+	for _, param := range params {
+		sig.Params = append(sig.Params, c.resolveType(param.ParamType, param.Span))
+		sig.ParamNames = append(sig.ParamNames, param.ParamName)
+	}
+	return sig
+}
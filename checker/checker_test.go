@@ -0,0 +1,414 @@
+package checker
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/LaH-DeV/veles/diagnostics"
+	"github.com/LaH-DeV/veles/lexer"
+	"github.com/LaH-DeV/veles/parser"
+)
+
+// sources is a program held in memory, mapping module names like
+// "math::constants" to their text. It imports its modules itself.
+type sources struct {
+	t       *testing.T
+	texts   map[string]string
+	modules map[string]*Module
+}
+
+func (s *sources) Import(path []string) (*Module, error) {
+	name := strings.Join(path, "::")
+	if module, ok := s.modules[name]; ok {
+		return module, nil
+	}
+	text, ok := s.texts[name]
+	if !ok {
+		return nil, fmt.Errorf("no module %s", name)
+	}
+	module := s.check(name, text)
+	s.modules[name] = module
+	return module, nil
+}
+
+func (s *sources) check(name, text string) *Module {
+	s.t.Helper()
+	lex := lexer.NewLexer(lexer.Vs)
+	tokens := lex.Tokenize(text)
+	par := parser.NewParser(lexer.Vs)
+	program := par.ParseFile(tokens, name+".vs")
+	if errors := append(lex.Diagnostics, par.Diagnostics...); diagnostics.HasErrors(errors) {
+		s.t.Fatalf("syntax errors in %s: %s", name, errors[0].Message)
+	}
+	return Check(program, name, s)
+}
+
+// check checks the module main of a program, which may import the other
+// modules.
+func check(t *testing.T, main string, others map[string]string) *Module {
+	t.Helper()
+	s := &sources{t: t, texts: others, modules: map[string]*Module{}}
+	return s.check("main", main)
+}
+
+// codes returns the codes of the diagnostics of a module, in source order.
+func codes(module *Module) []string {
+	diags := slices.Clone(module.Diagnostics)
+	sort.SliceStable(diags, func(i, j int) bool { return diags[i].Span.Start.Offset < diags[j].Span.Start.Offset })
+	result := make([]string, 0, len(diags))
+	for _, d := range diags {
+		result = append(result, d.Code.ID)
+	}
+	return result
+}
+
+type diagnosticTest struct {
+	name  string
+	src   string
+	codes []string // the codes of the diagnostics, in source order
+}
+
+func runDiagnosticTests(t *testing.T, tests []diagnosticTest) {
+	t.Helper()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			module := check(t, test.src, nil)
+			got := codes(module)
+			if !slices.Equal(got, test.codes) {
+				for _, d := range module.Diagnostics {
+					t.Log(d.Message)
+				}
+				t.Errorf("got %v, want %v", got, test.codes)
+			}
+		})
+	}
+}
+
+func TestInitialization(t *testing.T) {
+	runDiagnosticTests(t, []diagnosticTest{
+		{"assigned before the read", "fn i32 :: f() {\n    let mut i32 x\n    x = 1\n    return x\n}", nil},
+		{"read before any assignment", "fn i32 :: f() {\n    let i32 x\n    return x\n}", []string{"E0323"}},
+		{"assigned on one branch", "fn i32 :: f(bool b) {\n    let mut i32 x\n    if b {\n        x = 1\n    }\n    return x\n}", []string{"E0323"}},
+		{"assigned on both branches", "fn i32 :: f(bool b) {\n    let mut i32 x\n    if b {\n        x = 1\n    } else {\n        x = 2\n    }\n    return x\n}", nil},
+		{"other branch returns", "fn i32 :: f(bool b) {\n    let mut i32 x\n    if b {\n        x = 1\n    } else {\n        return 0\n    }\n    return x\n}", nil},
+		{"captured before the assignment", "fn fn() -> i32 :: f() {\n    let mut i32 x\n    let g = fn() -> i32 { return x }\n    x = 1\n    return g\n}", []string{"E0323"}},
+		{"warned once", "fn i32 :: f() {\n    let i32 x\n    return x + x\n}", []string{"E0323"}},
+		{"globals are not followed", "let i32 count\n\nfn i32 :: f() {\n    return count\n}", nil},
+	})
+}
+
+func TestInitializationInvalidType(t *testing.T) {
+	// the parser reports the missing type and initializer
+	lex := lexer.NewLexer(lexer.Vs)
+	par := parser.NewParser(lexer.Vs)
+	program := par.ParseFile(lex.Tokenize("fn :: f() {\n    let x\n    let i32 y = x\n}"), "main.vs")
+	if len(par.Diagnostics) != 1 {
+		t.Fatalf("got %d parser diagnostics", len(par.Diagnostics))
+	}
+	if module := Check(program, "main", nil); len(module.Diagnostics) != 0 {
+		t.Errorf("got %v, want no diagnostics for a variable without a type", codes(module))
+	}
+}
+
+func TestNumericLiterals(t *testing.T) {
+	runDiagnosticTests(t, []diagnosticTest{
+		{"hexadecimal", "let i32 x = 0x7fff_ffff", nil},
+		{"binary", "let u8 x = 0b1111_1111", nil},
+		{"suffix gives the type", "let x = 10i64\nlet i64 y = x", nil},
+		{"suffix against the declared type", "let i32 x = 10i64", []string{"E0300"}},
+		{"float suffix", "let f32 x = 1f32", nil},
+		{"too large for i32", "let i32 x = 0x8000_0000", []string{"E0310"}},
+		{"too large for the suffix", "let x = 256u8", []string{"E0310"}},
+		{"negative minimum", "let i8 x = -128", nil},
+		{"float too large for f32", "let f32 x = 1e39", []string{"E0310"}},
+	})
+}
+
+func TestBitwiseOperators(t *testing.T) {
+	runDiagnosticTests(t, []diagnosticTest{
+		{"integers", "fn i32 :: f(i32 a, i32 b) {\n    return (a & b) | (a ^ ~b) << 2 >> 1 >>> 3\n}", nil},
+		{"unsigned", "fn u64 :: f(u64 a) {\n    return a >> 1 & 0xff\n}", nil},
+		{"floats", "fn f32 :: f(f32 a) {\n    return a & 1.0\n}", []string{"E0302"}},
+		{"complement of a float", "fn f64 :: f(f64 a) {\n    return ~a\n}", []string{"E0302"}},
+		{"bools", "fn bool :: f(bool a, bool b) {\n    return a | b\n}", []string{"E0302"}},
+		{"mixed widths", "fn i64 :: f(i64 a, i32 b) {\n    return a << b\n}", []string{"E0300"}},
+	})
+}
+
+func TestMutability(t *testing.T) {
+	runDiagnosticTests(t, []diagnosticTest{
+		{"mutable local", "fn i32 :: f() {\n    let mut i32 x = 1\n    x = 2\n    x += 3\n    x <<= 1\n    return x\n}", nil},
+		{"immutable local", "fn :: f() {\n    let i32 x = 1\n    x = 2\n}", []string{"E0311"}},
+		{"compound on an immutable local", "fn :: f() {\n    let i32 x = 1\n    x *= 2\n}", []string{"E0311"}},
+		{"parameter", "fn :: f(i32 x) {\n    x += 1\n}", []string{"E0311"}},
+		{"mutable global", "let mut i32 count = 0\n\nfn :: f() {\n    count += 1\n}", nil},
+		{"immutable global", "let i32 count = 0\n\nfn :: f() {\n    count -= 1\n}", []string{"E0311"}},
+		{"function", "fn :: g() {}\n\nfn :: f() {\n    g = f\n}", []string{"E0305"}},
+		{"literal", "fn :: f() {\n    1 = 2\n}", []string{"E0305"}},
+		{"compound on a bool", "fn :: f() {\n    let mut bool b = true\n    b += true\n}", []string{"E0302"}},
+		{"compound with a float", "fn :: f() {\n    let mut i32 x = 1\n    x += 1.5\n}", []string{"E0300"}},
+		{"bitwise compound on a float", "fn :: f() {\n    let mut f32 x = 1.0\n    x |= 1.0\n}", []string{"E0302"}},
+		{"chained assignment", "fn :: f() {\n    let mut i32 x = 1\n    let mut i32 y = 2\n    x = y = 3\n}", nil},
+	})
+
+	module := check(t, "use config\n\nfn :: f() {\n    config::level = 2\n}", map[string]string{"config": "pub let mut i32 level = 1"})
+	if got := codes(module); !slices.Equal(got, []string{"E0311"}) {
+		t.Errorf("assignment to an imported global: got %v, want [E0311]", got)
+	}
+}
+
+func TestStructs(t *testing.T) {
+	const vec = "struct Vec2 { f32 x, f32 y }\n\n"
+	runDiagnosticTests(t, []diagnosticTest{
+		{"literal and fields", vec + "fn f32 :: f() {\n    let v = Vec2 { y: 2.0, x: 1.0 }\n    return v.x + v.y\n}", nil},
+		{"field of a mutable variable", vec + "fn :: f() {\n    let mut Vec2 v = Vec2 { x: 1.0, y: 2.0 }\n    v.x = 3.0\n}", nil},
+		{"field of an immutable variable", vec + "fn :: f() {\n    let Vec2 v = Vec2 { x: 1.0, y: 2.0 }\n    v.x = 3.0\n}", []string{"E0311"}},
+		{"nested structs", vec + "struct Line { Vec2 from, Vec2 to }\n\nfn f32 :: f(Line l) {\n    return l.to.x - l.from.x\n}", nil},
+		{"unknown field", vec + "fn f32 :: f(Vec2 v) {\n    return v.z\n}", []string{"E0313"}},
+		{"field of a number", "fn i32 :: f(i32 n) {\n    return n.x\n}", []string{"E0313"}},
+		{"unknown field in a literal", vec + "fn :: f() {\n    let v = Vec2 { x: 1.0, y: 2.0, z: 3.0 }\n}", []string{"E0313"}},
+		{"field given twice", vec + "fn :: f() {\n    let v = Vec2 { x: 1.0, x: 2.0, y: 3.0 }\n}", []string{"E0314"}},
+		{"missing field", vec + "fn :: f() {\n    let v = Vec2 { x: 1.0 }\n}", []string{"E0314"}},
+		{"field of the wrong type", vec + "fn :: f() {\n    let v = Vec2 { x: 1.0, y: true }\n}", []string{"E0300"}},
+		{"recursive struct", "struct Node { i32 value, Node next }", []string{"E0312"}},
+		{"mutually recursive structs", "struct A { B b }\n\nstruct B { A a }", []string{"E0312"}},
+		{"unknown field type", "struct S { Missing m }", []string{"E0301"}},
+	})
+}
+
+func TestMatch(t *testing.T) {
+	const enums = "enum C { R, G, B }\n\nenum Shape { Circle(f32), Rect(f32, f32), Empty }\n\n"
+	match := func(value, arms string) string {
+		return enums + "fn i32 :: f(C c, Shape s, bool b, i32 n) {\n    return match " + value + " {\n        " + arms + "\n    }\n}"
+	}
+	runDiagnosticTests(t, []diagnosticTest{
+		{"every variant", match("c", "C::R => 1, C::G => 2, C::B => 3"), nil},
+		{"missing variant", match("c", "C::R => 1, C::G => 2"), []string{"E0316"}},
+		{"wildcard", match("c", "C::R => 1, _ => 2"), nil},
+		{"both bools", match("b", "true => 1, false => 0"), nil},
+		{"missing bool", match("b", "true => 1"), []string{"E0316"}},
+		{"integers need a wildcard", match("n", "0 => 1, 1 => 2"), []string{"E0316"}},
+		{"integers with a wildcard", match("n", "0 => 1, -1 => 2, _ => 3"), nil},
+		{"variant bindings", match("s", "Shape::Circle(r) => r as i32, Shape::Rect(w, _) => w as i32, Shape::Empty => 0"), nil},
+		{"repeated variant", match("c", "C::R => 1, C::R => 2, _ => 3"), []string{"E0318"}},
+		{"repeated literal", match("n", "0 => 1, -0 => 2, _ => 3"), []string{"E0318"}},
+		{"arm after a wildcard", match("c", "_ => 1, C::R => 2"), []string{"E0318"}},
+		{"wildcard after every variant", match("c", "C::R => 1, C::G => 2, C::B => 3, _ => 4"), []string{"E0318"}},
+		{"wildcard after both bools", match("b", "true => 1, false => 0, _ => 2"), []string{"E0318"}},
+		{"wildcard after some variants", match("c", "C::R => 1, C::G => 2, _ => 3"), nil},
+		{"missing bindings", match("s", "Shape::Circle => 1, _ => 0"), []string{"E0317"}},
+		{"wrong number of bindings", match("s", "Shape::Rect(w) => 1, _ => 0"), []string{"E0317"}},
+		{"variant of another enum", match("c", "Shape::Empty => 1, _ => 0"), []string{"E0300"}},
+		{"arms of different types", match("b", "true => 1, false => 2.5"), []string{"E0300"}},
+	})
+}
+
+func TestArrays(t *testing.T) {
+	runDiagnosticTests(t, []diagnosticTest{
+		{"array literal", "let [4]i32 primes = [2, 3, 5, 7]", nil},
+		{"inferred element type", "let xs = [1.5, 2.5]\nlet [2]f64 ys = xs", nil},
+		{"literal for a slice", "let []f32 xs = [1, 2]", nil},
+		{"empty slice", "let []i32 empty = []", nil},
+		{"array as a slice", "fn f32 :: last([]f32 xs) {\n    return xs[len(xs) - 1]\n}\n\nfn f32 :: f() {\n    let [2]f32 v = [1, 2]\n    return last(v)\n}", nil},
+		{"length of a string", "fn i32 :: f(str s) {\n    return len(s)\n}", nil},
+		{"wrong length", "let [3]i32 xs = [1, 2]", []string{"E0300"}},
+		{"wrong element type", "let [2]i32 xs = [1, true]", []string{"E0300"}},
+		{"empty literal without a type", "let xs = []", []string{"E0320"}},
+		{"element without a value", "fn :: g() {}\n\nlet xs = [g()]", []string{"E0309"}},
+		{"mutable elements", "fn :: f() {\n    let mut [2]i32 xs = [1, 2]\n    xs[0] = 3\n}", nil},
+		{"immutable elements", "fn :: f() {\n    let [2]i32 xs = [1, 2]\n    xs[0] = 3\n}", []string{"E0311"}},
+		{"constant index out of range", "fn i32 :: f([4]i32 xs) {\n    return xs[4]\n}", []string{"E0319"}},
+		{"negative index", "fn i32 :: f([]i32 xs) {\n    return xs[-1]\n}", []string{"E0319"}},
+		{"index into a slice", "fn i32 :: f([]i32 xs, i64 i) {\n    return xs[i] + xs[100]\n}", nil},
+		{"float index", "fn i32 :: f([4]i32 xs) {\n    return xs[1.0]\n}", []string{"E0319"}},
+		{"index into a number", "fn i32 :: f(i32 n) {\n    return n[0]\n}", []string{"E0319"}},
+	})
+}
+
+func TestFunctionValues(t *testing.T) {
+	const add = "fn i32 :: add(i32 a, i32 b) {\n    return a + b\n}\n\n"
+	runDiagnosticTests(t, []diagnosticTest{
+		{"variable", add + "let fn(i32, i32) -> i32 op = add", nil},
+		{"inferred type", add + "fn i32 :: f() {\n    let op = add\n    return op(1, 2)\n}", nil},
+		{"parameter", add + "fn i32 :: apply(fn(i32, i32) -> i32 f, i32 x) {\n    return f(x, x)\n}\n\nfn i32 :: g() {\n    return apply(add, 1)\n}", nil},
+		{"returned", add + "fn fn(i32, i32) -> i32 :: pick() {\n    return add\n}\n\nfn i32 :: g() {\n    return pick()(1, 2)\n}", nil},
+		{"in an array", add + "fn i32 :: f() {\n    let [2]fn(i32, i32) -> i32 ops = [add, add]\n    return ops[1](3, 4)\n}", nil},
+		{"without a result", "fn :: log(i32 x) {}\n\nlet fn(i32) f = log", nil},
+		{"wrong parameter types", add + "let fn(f32, f32) -> i32 op = add", []string{"E0300"}},
+		{"wrong result", add + "let fn(i32, i32) op = add", []string{"E0300"}},
+		{"wrong number of arguments", add + "fn i32 :: f(fn(i32, i32) -> i32 op) {\n    return op(1)\n}", []string{"E0303"}},
+		{"wrong argument type", add + "fn i32 :: f(fn(i32, i32) -> i32 op) {\n    return op(1, true)\n}", []string{"E0300"}},
+		{"calling a number", "fn i32 :: f(i32 n) {\n    return n(1)\n}", []string{"E0304"}},
+		{"unknown parameter type", "let fn(Missing) f", []string{"E0301"}},
+	})
+}
+
+func TestClosures(t *testing.T) {
+	runDiagnosticTests(t, []diagnosticTest{
+		{"capture", "fn fn(i32) -> i32 :: adder(i32 offset) {\n    return fn(i32 x) -> i32 { return x + offset }\n}", nil},
+		{"capture of a local", "fn fn() -> i32 :: f() {\n    let i32 n = 1\n    return fn() -> i32 { return n }\n}", nil},
+		{"nested", "fn fn() -> fn() -> i32 :: f(i32 a) {\n    return fn() -> fn() -> i32 { return fn() -> i32 { return a } }\n}", nil},
+		{"called directly", "fn i32 :: f() {\n    return fn(i32 x) -> i32 { return x * 2 }(3)\n}", nil},
+		{"own locals are mutable", "fn fn() -> i32 :: f() {\n    return fn() -> i32 {\n        let mut i32 n = 1\n        n += 1\n        return n\n    }\n}", nil},
+		{"assignment to a capture", "fn fn() :: f() {\n    let mut i32 n = 0\n    return fn() { n = 1 }\n}", []string{"E0311"}},
+		{"wrong result", "let fn() -> i32 f = fn() -> bool { return true }", []string{"E0300"}},
+		{"missing return", "let fn() -> i32 f = fn() -> i32 {}", []string{"E0324"}},
+		{"parameters are not captured", "fn :: f() {\n    let g = fn(i32 x) -> i32 { return x }\n    let i32 y = x\n}", []string{"E0200"}},
+	})
+}
+
+func TestBlocksAndIf(t *testing.T) {
+	runDiagnosticTests(t, []diagnosticTest{
+		{"if with else", "fn i32 :: sign(i32 x) {\n    return if x > 0 { 1 } else if x < 0 { -1 } else { 0 }\n}", nil},
+		{"block value", "fn i32 :: f(i32 width) {\n    let i32 area = {\n        let i32 w = width + 2\n        w * w\n    }\n    return area\n}", nil},
+		{"block scope", "fn i32 :: f() {\n    let i32 a = {\n        let i32 w = 2\n        w\n    }\n    return w\n}", []string{"E0200"}},
+		{"branches of different types", "fn i32 :: f(bool b) {\n    return if b { 1 } else { true }\n}", []string{"E0300"}},
+		{"branch that returns", "fn i32 :: f(bool b) {\n    let i32 x = if b { 1 } else { return 0 }\n    return x\n}", nil},
+		{"literal adapts to the other branch", "fn f64 :: f(bool b, f64 x) {\n    return if b { 1 } else { x }\n}", nil},
+		{"value without else", "fn i32 :: f(bool b) {\n    return if b { 1 }\n}", []string{"E0309"}},
+		{"statement without else", "fn :: f(bool b) {\n    if b { 1 }\n}", nil},
+		{"statement with different types", "fn :: f(bool b) {\n    if b { 1 } else { true }\n}", nil},
+		{"block ending in a statement", "fn i32 :: f() {\n    let i32 x = {\n        let i32 y = 1\n    }\n    return x\n}", []string{"E0309"}},
+		{"condition must be a bool", "fn i32 :: f(i32 n) {\n    return if n { 1 } else { 0 }\n}", []string{"E0300"}},
+	})
+}
+
+func TestCasts(t *testing.T) {
+	cast := func(from, to string) string {
+		return "fn " + to + " :: f(" + from + " x) {\n    return x as " + to + "\n}"
+	}
+	runDiagnosticTests(t, []diagnosticTest{
+		{"narrowing", cast("i64", "i8"), nil},
+		{"widening", cast("u16", "i64"), nil},
+		{"float to integer", cast("f64", "u32"), nil},
+		{"integer to float", cast("i32", "f32"), nil},
+		{"between floats", cast("f64", "f32"), nil},
+		{"bool to integer", cast("bool", "i32"), nil},
+		{"plain enum to integer", "enum C { R, G }\n\n" + cast("C", "i32"), nil},
+		{"same type", cast("i32", "i32"), nil},
+		{"integer to bool", cast("i32", "bool"), []string{"E0321"}},
+		{"float to bool", cast("f32", "bool"), []string{"E0321"}},
+		{"bool to float", cast("bool", "f64"), []string{"E0321"}},
+		{"integer to enum", "enum C { R, G }\n\n" + cast("i32", "C"), []string{"E0321"}},
+		{"enum with values to integer", "enum S { A(i32), B }\n\n" + cast("S", "i32"), []string{"E0321"}},
+		{"string to integer", cast("str", "i32"), []string{"E0321"}},
+		{"struct to integer", "struct P { i32 x }\n\n" + cast("P", "i32"), []string{"E0321"}},
+		{"unknown type", "fn :: f(i32 x) {\n    let y = x as Missing\n}", []string{"E0301"}},
+		{"mixed integer types", "fn i64 :: f(i32 a, i64 b) {\n    return a + b\n}", []string{"E0300"}},
+		{"mixed integer and float", "fn f32 :: f(i32 a, f32 b) {\n    return a * b\n}", []string{"E0300"}},
+		{"cast before arithmetic", "fn f32 :: f(i32 a, f32 b) {\n    return a as f32 * b\n}", nil},
+	})
+}
+
+func TestIntegerTypes(t *testing.T) {
+	runDiagnosticTests(t, []diagnosticTest{
+		{"limits", "let u8 a = 255\nlet i8 b = -128\nlet i16 c = 32767\nlet u16 d = 65535\nlet u32 e = 4294967295\nlet u64 f = 18446744073709551615\nlet i64 g = -9223372036854775808", nil},
+		{"negative unsigned", "let u8 x = -1", []string{"E0310"}},
+		{"above u8", "let u8 x = 256", []string{"E0310"}},
+		{"above i8", "let i8 x = 128", []string{"E0310"}},
+		{"above u32", "let u32 x = 4294967296", []string{"E0310"}},
+		{"below i16", "let i16 x = -32769", []string{"E0310"}},
+		{"negated unsigned", "fn u32 :: f(u32 a) {\n    return -a\n}", []string{"E0302"}},
+		{"subtraction from zero", "fn u32 :: f(u32 a) {\n    return 0 - a\n}", nil},
+		{"narrow arithmetic", "fn u8 :: f(u8 a, u8 b) {\n    return a * b + 1 >> 1\n}", nil},
+		{"signed and unsigned", "fn u32 :: f(u32 a, i32 b) {\n    return a + b\n}", []string{"E0300"}},
+		{"different widths", "fn i16 :: f(i16 a, i8 b) {\n    return a - b\n}", []string{"E0300"}},
+		{"comparison of unsigned", "fn bool :: f(u64 a, u64 b) {\n    return a >= b\n}", nil},
+	})
+}
+
+func TestInference(t *testing.T) {
+	runDiagnosticTests(t, []diagnosticTest{
+		{"from another global", "let a = b + 1\nlet b = 2", nil},
+		{"cycle", "let a = b\nlet b = a", []string{"E0322"}},
+		{"self reference", "let a = a + 1", []string{"E0322"}},
+		{"through a function", "let a = f()\n\nfn i32 :: f() {\n    return a\n}", nil},
+		{"no value", "fn :: g() {}\n\nlet a = g()", []string{"E0309"}},
+		{"function without a type", "fn :: g() {}\n\nfn :: f() {\n    let x = g\n}", nil},
+	})
+
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"let x = 5 + 2", "i32"},
+		{"let x = 0.5", "f64"},
+		{"let x = 10u8", "u8"},
+		{"let x = 2.0f32 * 3.0", "f32"},
+		{"let x = 1 < 2", "bool"},
+		{`let x = "text"`, "str"},
+		{"let x = [1, 2, 3]", "[3]i32"},
+		{"let x = 5 as i64 * 3", "i64"},
+		{"struct P { i32 x }\n\nlet x = P { x: 1 }", "P"},
+		{"fn i32 :: f(bool b) {\n    return 1\n}\n\nlet x = f", "fn(bool) -> i32"},
+		{"let x = if true { 1 } else { 2.5 }", "f64"},
+	}
+	for _, test := range tests {
+		module := check(t, test.src, nil)
+		if len(module.Diagnostics) > 0 {
+			t.Errorf("%q: got %v", test.src, codes(module))
+			continue
+		}
+		if got := module.Scope.Lookup("x").Type.String(); got != test.want {
+			t.Errorf("%q: x is %s, want %s", test.src, got, test.want)
+		}
+	}
+}
+
+func TestConstantShifts(t *testing.T) {
+	runDiagnosticTests(t, []diagnosticTest{
+		{"within the width", "let u16 x = 1 << 10 | 3", nil},
+		{"largest count", "let i64 x = 1 << 62", nil},
+		{"by the width of u8", "let u8 x = 1 << 10", []string{"E0310"}},
+		{"inferred i32", "let x = 1 << 40", []string{"E0310"}},
+		{"by the width", "let x = 1 >> 32", []string{"E0310"}},
+		{"unsigned right shift", "let u8 x = 255 >>> 8", []string{"E0310"}},
+		{"negative count", "let x = 256 >> -1", []string{"E0310"}},
+		{"computed count", "let x = 1 << (30 + 2)", []string{"E0310"}},
+		{"i64 count", "let i64 x = 1 << 40", nil},
+		{"in a function", "fn u32 :: f() {\n    return 7 >> 33\n}", []string{"E0310"}},
+	})
+}
+
+func TestControlFlow(t *testing.T) {
+	runDiagnosticTests(t, []diagnosticTest{
+		{"returns", "fn i32 :: f() {\n    return 1\n}", nil},
+		{"empty body", "fn i32 :: f() {}", []string{"E0324"}},
+		{"void function", "fn :: f() {}", nil},
+		{"if without else", "fn i32 :: f(bool b) {\n    if b {\n        return 1\n    }\n}", []string{"E0324"}},
+		{"if and else", "fn i32 :: f(bool b) {\n    if b {\n        return 1\n    } else {\n        return 2\n    }\n}", nil},
+		{"match", "enum C { R, G }\n\nfn i32 :: f(C c) {\n    match c {\n        C::R => { return 1 },\n        C::G => { return 2 },\n    }\n}", nil},
+		{"function expression", "let fn() -> i32 g = fn() -> i32 {\n    let i32 x = 1\n}", []string{"E0324"}},
+		{"after a return", "fn i32 :: f() {\n    return 1\n    let i32 x = 2\n}", []string{"E0325"}},
+		{"once per run", "fn :: f() {\n    return\n    let i32 x = 1\n    let i32 y = 2\n}", []string{"E0325"}},
+		{"after both branches", "fn i32 :: f(bool b) {\n    if b {\n        return 1\n    } else {\n        return 2\n    }\n    return 3\n}", []string{"E0325"}},
+	})
+}
+
+func TestExterns(t *testing.T) {
+	const log = "extern \"env\" \"print\" fn :: log(i32 value)\n\n"
+	const sqrt = "extern \"math\" fn f64 :: sqrt(f64 x)\n\n"
+	runDiagnosticTests(t, []diagnosticTest{
+		{"call", log + "fn :: f() {\n    log(1)\n}", nil},
+		{"result", sqrt + "fn f64 :: f() {\n    return sqrt(2.0)\n}", nil},
+		{"default module and field", "extern fn :: log(i32 value)\n\nfn :: f() {\n    log(1)\n}", nil},
+		{"as a value", log + "let fn(i32) f = log", nil},
+		{"wrong number of arguments", log + "fn :: f() {\n    log(1, 2)\n}", []string{"E0303"}},
+		{"wrong argument type", log + "fn :: f() {\n    log(true)\n}", []string{"E0300"}},
+		{"wrong result type", sqrt + "fn i32 :: f() {\n    return sqrt(2.0)\n}", []string{"E0300"}},
+		{"unknown parameter type", "extern fn :: log(Missing value)", []string{"E0301"}},
+		{"duplicate", log + "fn :: log(i32 value) {}", []string{"E0201"}},
+	})
+
+	t.Run("other module", func(t *testing.T) {
+		module := check(t, "use host\n\nfn :: f() {\n    host::log(1)\n}", map[string]string{
+			"host": "extern fn :: log(i32 value)",
+		})
+		if got := codes(module); !slices.Equal(got, []string{"E0204"}) {
+			t.Errorf("got %v, want [E0204], extern functions are not exported", got)
+		}
+	})
+}
@@ -0,0 +1,86 @@
+package checker
+
+import (
+	"github.com/LaH-DeV/veles/ast"
+	"github.com/LaH-DeV/veles/types"
+)
+
+// closure is a function expression being checked.
+type closure struct {
+	scope    *Scope    // the scope of its parameters
+	captures []*Symbol // the variables of enclosing functions it uses
+}
+
+// functionExpr checks a function expression and computes the variables it
+// captures. Captured variables are copied when the function value is created,
+// so they cannot be assigned in its body.
+func (c *checker) functionExpr(expr *ast.FunctionExpr) types.Type {
+	sig := c.signature(expr.Params, expr.ReturnType, expr.Span)
+
+	c.openScope(expr.Span)
+	fn := &closure{scope: c.scope, captures: make([]*Symbol, 0)}
+	c.closures = append(c.closures, fn)
+	c.declareParams(expr.Params, sig)
+	outer := c.function
+	c.function = sig
+	c.stmts(expr.Body)
+	c.function = outer
+	c.closures = c.closures[:len(c.closures)-1]
+	c.closeScope()
+
+	c.module.Info.Captures[expr] = fn.captures
+	return sig
+}
+
+// capture adds a variable used in a function expression, but declared outside
+// of it, to the captures of the function expressions between its declaration
+// and its use. An outer function expression captures the variable too, so
+// that it can pass it on to the inner one.
+func (c *checker) capture(symbol *Symbol) {
+	if symbol.Kind != LocalSymbol && symbol.Kind != ParamSymbol {
+		return
+	}
+	declaring := c.declaringScope(symbol)
+	for i := len(c.closures) - 1; i >= 0; i-- {
+		fn := c.closures[i]
+		if within(declaring, fn.scope) {
+			return
+		}
+		captured := false
+		for _, s := range fn.captures {
+			captured = captured || s == symbol
+		}
+		if !captured {
+			fn.captures = append(fn.captures, symbol)
+		}
+	}
+}
+
+// captured reports whether symbol is a variable captured by the innermost
+// function expression being checked.
+func (c *checker) captured(symbol *Symbol) bool {
+	if len(c.closures) == 0 || (symbol.Kind != LocalSymbol && symbol.Kind != ParamSymbol) {
+		return false
+	}
+	return !within(c.declaringScope(symbol), c.closures[len(c.closures)-1].scope)
+}
+
+// declaringScope returns the scope around the current one that declares symbol.
+func (c *checker) declaringScope(symbol *Symbol) *Scope {
+	for scope := c.scope; scope != nil; scope = scope.Parent {
+		if scope.Symbols[symbol.Name] == symbol {
+			return scope
+		}
+	}
+	return nil
+}
+
+// within reports whether scope is ancestor or a scope nested in it.
+func within(scope *Scope, ancestor *Scope) bool {
+	for ; scope != nil; scope = scope.Parent {
+		if scope == ancestor {
+			return true
+		}
+	}
+	return false
+}
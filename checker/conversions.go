@@ -0,0 +1,258 @@
+package checker
+
+import (
+	"math/big"
+	"strings"
+
+	"github.com/LaH-DeV/veles/ast"
+	"github.com/LaH-DeV/veles/diagnostics"
+	"github.com/LaH-DeV/veles/lexer"
+	"github.com/LaH-DeV/veles/types"
+)
+
+// Numbers of different types do not mix: a value of one numeric type is only
+// converted to another with "as". Unsuffixed literals are the exception, they
+// take the type of the value they are used with, so that x * 2 is an f32 when
+// x is an f32. Like the untyped constants of Go, arithmetic on them adapts as
+// a whole: 1 << 10 is a u16 when it is used as a u16. Where nothing gives them
+// a type, integer constants are i32 and float constants f64.
+
+// castExpr checks a conversion with "as". Numbers convert to every numeric
+// type, and booleans and the variants of plain enums to integers.
+func (c *checker) castExpr(expr *ast.CastExpr) types.Type {
+	target := c.resolveType(expr.Type, expr.TypeSpan)
+	value := c.expr(expr.Value)
+	if types.IsInvalid(value) || types.IsInvalid(target) {
+		return target
+	}
+	if types.IsNumeric(target) && c.adaptLiteral(expr.Value, target) {
+		return target
+	}
+
+	enum, isEnum := value.(*types.Enum)
+	switch {
+	case types.IsNumeric(value) && types.IsNumeric(target):
+	case value == types.Bool && types.IsInteger(target):
+	case isEnum && enum.IsPlain() && types.IsInteger(target):
+	case types.Identical(value, target):
+	default:
+		d := diagnostics.Errorf(diagnostics.InvalidCast, expr.Span, "cannot cast %s (%s) to %s", expr.Value.String(), value, target)
+		if isEnum && !enum.IsPlain() {
+			d = d.WithNote("only the variants of enums whose variants carry no values convert to integers")
+		}
+		c.report(d)
+	}
+	return target
+}
+
+// adaptLiteral gives an unsuffixed literal, possibly negated, the numeric
+// type t of the value it is used with, and reports whether it could. Integer
+// literals are usable as any number and float literals as floats. The value
+// of a block or an if adapts when the values of all of its branches do, and
+// an arithmetic operation when both of its operands do.
+func (c *checker) adaptLiteral(expr ast.Expr, t types.Type) bool {
+	if !types.IsNumeric(t) || !adaptable(expr, t) {
+		return false
+	}
+	c.checkOverflow(expr, t)
+	c.retype(expr, t)
+	return true
+}
+
+func adaptable(expr ast.Expr, t types.Type) bool {
+	switch expr := expr.(type) {
+	case *ast.IntegerExpr:
+		return expr.Suffix == ""
+	case *ast.FloatExpr:
+		return expr.Suffix == "" && types.IsFloat(t)
+	case *ast.PrefixExpr:
+		return expr.Operator.Kind == lexer.DASH && adaptable(expr.Right, t)
+	case *ast.BinaryExpr:
+		switch expr.Operator.Kind {
+		case lexer.PLUS, lexer.DASH, lexer.ASTERISK, lexer.SLASH, lexer.EXPONENTIATION:
+		case lexer.REMAINDER, lexer.AMPERSAND, lexer.PIPE, lexer.CARET, lexer.SHIFT_LEFT, lexer.SHIFT_RIGHT, lexer.SHIFT_RIGHT_UNSIGNED:
+			if !types.IsInteger(t) {
+				return false
+			}
+		default:
+			return false
+		}
+		return adaptable(expr.Left, t) && adaptable(expr.Right, t)
+	case *ast.BlockExpr:
+		last := blockValue(expr)
+		return last != nil && adaptable(last, t)
+	case *ast.IfExpr:
+		if expr.Else == nil || (diverges(expr.Then) && diverges(expr.Else)) {
+			return false
+		}
+		return (diverges(expr.Then) || adaptable(expr.Then, t)) && (diverges(expr.Else) || adaptable(expr.Else, t))
+	}
+	return false
+}
+
+// retype records the new type of an adapted literal and of the expressions
+// whose value it is. Branches that return keep their type.
+func (c *checker) retype(expr ast.Expr, t types.Type) {
+	c.module.Info.Types[expr] = t
+	switch expr := expr.(type) {
+	case *ast.PrefixExpr:
+		c.retype(expr.Right, t)
+	case *ast.BinaryExpr:
+		c.retype(expr.Left, t)
+		c.retype(expr.Right, t)
+	case *ast.BlockExpr:
+		c.retype(blockValue(expr), t)
+	case *ast.IfExpr:
+		for _, branch := range []ast.Expr{expr.Then, expr.Else} {
+			if !diverges(branch) {
+				c.retype(branch, t)
+			}
+		}
+	}
+}
+
+// blockValue returns the expression producing the value of a block, or nil
+// when the block does not end with an expression.
+func blockValue(block *ast.BlockExpr) ast.Expr {
+	if len(block.Body) == 0 {
+		return nil
+	}
+	if last, ok := block.Body[len(block.Body)-1].(*ast.ExpressionStmt); ok {
+		return last.Expression
+	}
+	return nil
+}
+
+// constant computes the exact value of an integer constant expression used as
+// a value of type t, reporting the first step whose value t cannot represent.
+// The generated code wraps around at the width of t, so it computes the same
+// value exactly when no step overflows. Shifts by the width of t or more, or
+// by a negative count, are reported too, as the generated code would shift by
+// the count modulo the width. It returns false when a step is reported and for
+// expressions whose value is not defined, like divisions by zero.
+func (c *checker) constant(expr ast.Expr, t types.Type) (*big.Int, bool) {
+	var value *big.Int
+	switch expr := expr.(type) {
+	case *ast.IntegerExpr:
+		value = new(big.Int).SetUint64(expr.Value)
+	case *ast.PrefixExpr:
+		if expr.Operator.Kind != lexer.DASH {
+			return nil, false
+		}
+		if literal, ok := expr.Right.(*ast.IntegerExpr); ok {
+			// -128 is an i8 although 128 is not; literals beyond the range of
+			// i64 were reported by integerLiteral
+			if !fits(literal.Value, true, types.I64) {
+				return nil, false
+			}
+			value = new(big.Int).Neg(new(big.Int).SetUint64(literal.Value))
+			break
+		}
+		right, ok := c.constant(expr.Right, t)
+		if !ok {
+			return nil, false
+		}
+		value = new(big.Int).Neg(right)
+	case *ast.BinaryExpr:
+		left, ok := c.constant(expr.Left, t)
+		if !ok {
+			return nil, false
+		}
+		right, ok := c.constant(expr.Right, t)
+		if !ok {
+			return nil, false
+		}
+		if isShift(expr.Operator.Kind) && (right.Sign() < 0 || right.Cmp(big.NewInt(int64(types.Bits(t)))) >= 0) {
+			c.errorf(diagnostics.ConstantOverflow, expr.Right.Location(), "shift count %s is out of range for %s: it must be from 0 to %d", right, t, types.Bits(t)-1)
+			return nil, false
+		}
+		if value, ok = operate(expr.Operator.Kind, left, right, types.Bits(t)); !ok {
+			return nil, false
+		}
+		if value == nil {
+			c.errorf(diagnostics.ConstantOverflow, expr.Span, "constant %s overflows %s", expr.String(), t)
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+
+	bits := types.Bits(t)
+	min, max := new(big.Int), new(big.Int).Lsh(big.NewInt(1), uint(bits))
+	if types.IsSigned(t) {
+		max.Rsh(max, 1)
+		min.Neg(max)
+	}
+	max.Sub(max, big.NewInt(1))
+	if value.Cmp(min) >= 0 && value.Cmp(max) <= 0 {
+		return value, true
+	}
+	text := expr.String()
+	if _, ok := expr.(*ast.BinaryExpr); ok {
+		text = strings.TrimSuffix(strings.TrimPrefix(text, "("), ")") + " = " + value.String()
+	}
+	c.errorf(diagnostics.ConstantOverflow, expr.Location(), "constant %s overflows %s", text, t)
+	return nil, false
+}
+
+func isShift(operator lexer.TokenKind) bool {
+	return operator == lexer.SHIFT_LEFT || operator == lexer.SHIFT_RIGHT || operator == lexer.SHIFT_RIGHT_UNSIGNED
+}
+
+// operate applies an integer operator to constants. It returns a nil value for
+// powers too large to compute, which overflow every integer type, and false
+// for operations that are not computed at compile time.
+func operate(operator lexer.TokenKind, x, y *big.Int, bits int) (*big.Int, bool) {
+	z := new(big.Int)
+	switch operator {
+	case lexer.PLUS:
+		return z.Add(x, y), true
+	case lexer.DASH:
+		return z.Sub(x, y), true
+	case lexer.ASTERISK:
+		return z.Mul(x, y), true
+	case lexer.SLASH:
+		if y.Sign() == 0 {
+			return nil, false
+		}
+		return z.Quo(x, y), true
+	case lexer.REMAINDER:
+		if y.Sign() == 0 {
+			return nil, false
+		}
+		return z.Rem(x, y), true
+	case lexer.EXPONENTIATION:
+		if y.Sign() < 0 {
+			return nil, false
+		}
+		if z.Abs(x).Cmp(big.NewInt(1)) > 0 && y.Cmp(big.NewInt(64)) > 0 {
+			return nil, true
+		}
+		return z.Exp(x, y, nil), true
+	case lexer.AMPERSAND:
+		return z.And(x, y), true
+	case lexer.PIPE:
+		return z.Or(x, y), true
+	case lexer.CARET:
+		return z.Xor(x, y), true
+	}
+
+	if y.Sign() < 0 || y.Cmp(big.NewInt(int64(bits))) >= 0 {
+		return nil, false
+	}
+	shift := uint(y.Uint64())
+	switch operator {
+	case lexer.SHIFT_LEFT:
+		return z.Lsh(x, shift), true
+	case lexer.SHIFT_RIGHT:
+		return z.Rsh(x, shift), true
+	case lexer.SHIFT_RIGHT_UNSIGNED:
+		if x.Sign() < 0 {
+			// the bits of the two's complement of x
+			z.Add(x, new(big.Int).Lsh(big.NewInt(1), uint(bits)))
+			return z.Rsh(z, shift), true
+		}
+		return z.Rsh(x, shift), true
+	}
+	return nil, false
+}
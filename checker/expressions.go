@@ -0,0 +1,589 @@
+package checker
+
+import (
+	"math"
+	"strings"
+
+	"github.com/LaH-DeV/veles/ast"
+	"github.com/LaH-DeV/veles/diagnostics"
+	"github.com/LaH-DeV/veles/lexer"
+	"github.com/LaH-DeV/veles/types"
+)
+
+// expr computes and records the type of an expression.
+func (c *checker) expr(expr ast.Expr) types.Type {
+	t := c.exprType(expr)
+	c.module.Info.Types[expr] = t
+	return t
+}
+
+func (c *checker) exprType(expr ast.Expr) types.Type {
+	switch expr := expr.(type) {
+	case *ast.IntegerExpr:
+		return c.integerLiteral(expr, false)
+	case *ast.FloatExpr:
+		return c.floatLiteral(expr)
+	case *ast.BooleanExpr:
+		return types.Bool
+	case *ast.StringExpr:
+		return types.Str
+	case *ast.SymbolExpr:
+		return c.symbolExpr(expr)
+	case *ast.MemberExpr:
+		return c.memberExpr(expr)
+	case *ast.PrefixExpr:
+		return c.prefixExpr(expr)
+	case *ast.BinaryExpr:
+		return c.binaryExpr(expr)
+	case *ast.AssignmentExpr:
+		return c.assignmentExpr(expr)
+	case *ast.CallExpr:
+		return c.callExpr(expr)
+	case *ast.FieldExpr:
+		return c.fieldExpr(expr)
+	case *ast.StructLiteralExpr:
+		return c.structLiteralExpr(expr)
+	case *ast.MatchExpr:
+		return c.matchExpr(expr)
+	case *ast.IndexExpr:
+		return c.indexExpr(expr)
+	case *ast.ArrayLiteralExpr:
+		return c.arrayLiteral(expr, nil)
+	case *ast.FunctionExpr:
+		return c.functionExpr(expr)
+	case *ast.BlockExpr:
+		return c.blockExpr(expr, true)
+	case *ast.IfExpr:
+		return c.ifExpr(expr, true)
+	case *ast.CastExpr:
+		return c.castExpr(expr)
+	}
+	c.errorf(diagnostics.Unsupported, expr.Location(), "unsupported expression %s", expr.String())
+	return types.Invalid
+}
+
+func (c *checker) symbolExpr(expr *ast.SymbolExpr) types.Type {
+	symbol := c.scope.Lookup(expr.Value)
+	if symbol == nil {
+		symbol = builtins[expr.Value]
+	}
+	if symbol == nil {
+		c.errorf(diagnostics.Undefined, expr.Span, "undefined: %s", expr.Value)
+		return types.Invalid
+	}
+	if symbol.Kind == GlobalSymbol && symbol.Type == nil {
+		c.inferGlobal(symbol, expr)
+	}
+	c.module.Info.Uses[expr] = symbol
+	c.capture(symbol)
+	switch symbol.Kind {
+	case BuiltinSymbol:
+		c.errorf(diagnostics.InvalidOperation, expr.Span, "builtin function %s must be called", expr.Value)
+		return types.Invalid
+	case ModuleSymbol:
+		c.errorf(diagnostics.ModuleMisuse, expr.Span, "module %s cannot be used as a value", expr.Value)
+		return types.Invalid
+	case StructSymbol, EnumSymbol:
+		c.report(c.declaredHere(diagnostics.Errorf(diagnostics.TypeMisuse, expr.Span, "%s %s cannot be used as a value", symbol.Kind, expr.Value), symbol))
+		return types.Invalid
+	}
+	return symbol.Type
+}
+
+// memberExpr resolves module::member and Enum::Variant.
+func (c *checker) memberExpr(expr *ast.MemberExpr) types.Type {
+	member := c.member(expr)
+	if member == nil {
+		return types.Invalid
+	}
+	if member.Kind == StructSymbol || member.Kind == EnumSymbol {
+		c.report(c.declaredHere(diagnostics.Errorf(diagnostics.TypeMisuse, expr.Span, "%s %s cannot be used as a value", member.Kind, expr.String()), member))
+		return types.Invalid
+	}
+	return member.Type
+}
+
+// member returns the symbol named by module::member or Enum::Variant, or nil
+// when there is no such symbol.
+func (c *checker) member(expr *ast.MemberExpr) *Symbol {
+	var symbol *Symbol
+	switch container := expr.Container.(type) {
+	case *ast.SymbolExpr:
+		if symbol = c.scope.Lookup(container.Value); symbol == nil {
+			c.errorf(diagnostics.Undefined, container.Span, "undefined: %s", container.Value)
+			return nil
+		}
+		c.module.Info.Uses[container] = symbol
+	case *ast.MemberExpr:
+		if symbol = c.member(container); symbol == nil {
+			return nil
+		}
+	default:
+		c.expr(expr.Container)
+		c.errorf(diagnostics.ModuleMisuse, expr.Container.Location(), "%s is not a module or an enum", expr.Container.String())
+		return nil
+	}
+
+	if symbol.Kind == EnumSymbol {
+		variant := symbol.Members[expr.Member]
+		if variant == nil {
+			c.report(c.declaredHere(diagnostics.Errorf(diagnostics.NoMember, expr.MemberSpan, "enum %s has no variant %s", symbol.Name, expr.Member), symbol))
+			return nil
+		}
+		c.module.Info.Uses[expr] = variant
+		return variant
+	}
+	if symbol.Kind != ModuleSymbol {
+		c.report(c.declaredHere(diagnostics.Errorf(diagnostics.ModuleMisuse, expr.Container.Location(), "%s is not a module or an enum", expr.Container.String()), symbol))
+		return nil
+	}
+
+	member := symbol.Target.Member(expr.Member)
+	if member == nil {
+		c.errorf(diagnostics.NoMember, expr.MemberSpan, "module %s has no member %s", symbol.Target.Name, expr.Member)
+		return nil
+	}
+	c.module.Info.Uses[expr] = member
+	if !member.Exported {
+		c.report(diagnostics.Errorf(diagnostics.NotExported, expr.MemberSpan, "%s is not exported by module %s", expr.Member, symbol.Target.Name).
+			WithNote("declare %s with \"pub\" in module %s to export it", expr.Member, symbol.Target.Name))
+	}
+	return member
+}
+
+// fieldExpr resolves value.field on a struct value.
+func (c *checker) fieldExpr(expr *ast.FieldExpr) types.Type {
+	object := c.expr(expr.Object)
+	if types.IsInvalid(object) {
+		return types.Invalid
+	}
+	st, ok := object.(*types.Struct)
+	if !ok {
+		c.errorf(diagnostics.NoField, expr.FieldSpan, "%s has no field %s: values of type %s have no fields", expr.Object.String(), expr.Field, object)
+		return types.Invalid
+	}
+	i := st.Field(expr.Field)
+	if i < 0 {
+		c.errorf(diagnostics.NoField, expr.FieldSpan, "struct %s has no field %s", st, expr.Field)
+		return types.Invalid
+	}
+	return st.Fields[i].Type
+}
+
+// structLiteralExpr checks that a struct literal gives every field a value
+// exactly once.
+func (c *checker) structLiteralExpr(expr *ast.StructLiteralExpr) types.Type {
+	st := c.structType(expr.Type)
+	given := make(map[string]ast.FieldValue)
+	for _, field := range expr.Fields {
+		i := -1
+		var target types.Type
+		if st != nil {
+			if i = st.Field(field.Name); i >= 0 {
+				target = st.Fields[i].Type
+			}
+		}
+		value := c.exprFor(field.Value, target)
+		if st == nil {
+			continue
+		}
+		if i < 0 {
+			c.errorf(diagnostics.NoField, field.NameSpan, "struct %s has no field %s", st, field.Name)
+			continue
+		}
+		if previous, exists := given[field.Name]; exists {
+			c.report(diagnostics.Errorf(diagnostics.InvalidStructLiteral, field.NameSpan, "field %s is given twice", field.Name).
+				WithLabel(previous.NameSpan, "first value of %s", field.Name))
+			continue
+		}
+		given[field.Name] = field
+		c.expectAssignable(value, st.Fields[i].Type, field.Value)
+	}
+	if st == nil {
+		return types.Invalid
+	}
+
+	missing := make([]string, 0)
+	for _, field := range st.Fields {
+		if _, exists := given[field.Name]; !exists {
+			missing = append(missing, field.Name)
+		}
+	}
+	if len(missing) > 0 {
+		c.errorf(diagnostics.InvalidStructLiteral, expr.Span, "missing %s in literal of struct %s", plural(len(missing), "field", "fields")+" "+strings.Join(missing, ", "), st)
+	}
+	return st
+}
+
+// structType resolves the name of the struct in a struct literal.
+func (c *checker) structType(expr ast.Expr) *types.Struct {
+	var symbol *Symbol
+	switch expr := expr.(type) {
+	case *ast.SymbolExpr:
+		if symbol = c.scope.Lookup(expr.Value); symbol == nil {
+			c.errorf(diagnostics.Undefined, expr.Span, "undefined: %s", expr.Value)
+			return nil
+		}
+		c.module.Info.Uses[expr] = symbol
+	case *ast.MemberExpr:
+		if symbol = c.member(expr); symbol == nil {
+			return nil
+		}
+	default:
+		return nil
+	}
+	st, ok := symbol.Type.(*types.Struct)
+	if symbol.Kind != StructSymbol || !ok {
+		c.report(c.declaredHere(diagnostics.Errorf(diagnostics.UnknownType, expr.Location(), "%s is not a struct type", expr.String()), symbol))
+		return nil
+	}
+	return st
+}
+
+func plural(n int, singular string, plural string) string {
+	if n == 1 {
+		return singular
+	}
+	return plural
+}
+
+// integerLiteral types an integer literal, negated when it is the operand of
+// a unary minus. Without a suffix a literal is an i32, or the first of i64 and
+// u64 that can represent it.
+func (c *checker) integerLiteral(expr *ast.IntegerExpr, negated bool) types.Type {
+	t := types.Lookup(expr.Suffix)
+	if t == nil {
+		t = types.I32
+		if !fits(expr.Value, negated, t) {
+			t = types.I64
+		}
+		if !fits(expr.Value, negated, t) && !negated {
+			t = types.U64
+		}
+	}
+	if !fits(expr.Value, negated, t) {
+		text := expr.String()
+		if negated {
+			text = "-" + text
+		}
+		c.errorf(diagnostics.ConstantOverflow, expr.Span, "constant %s overflows %s", text, t)
+	}
+	return t
+}
+
+func (c *checker) floatLiteral(expr *ast.FloatExpr) types.Type {
+	if expr.Suffix == "f32" {
+		if expr.Value > math.MaxFloat32 {
+			c.errorf(diagnostics.ConstantOverflow, expr.Span, "constant %s overflows f32", expr.String())
+		}
+		return types.F32
+	}
+	return types.F64
+}
+
+// fits reports whether an integer of the given magnitude and sign can be
+// represented by the integer type t.
+func fits(magnitude uint64, negated bool, t types.Type) bool {
+	bits := types.Bits(t)
+	if types.IsUnsigned(t) {
+		return (!negated || magnitude == 0) && (bits == 64 || magnitude < 1<<bits)
+	}
+	limit := uint64(1)<<(bits-1) - 1
+	if negated {
+		limit++
+	}
+	return magnitude <= limit
+}
+
+// checkOverflow reports an unsuffixed constant, possibly negated, that is
+// converted to a type which cannot represent it.
+func (c *checker) checkOverflow(expr ast.Expr, t types.Type) {
+	switch expr := expr.(type) {
+	case *ast.BlockExpr:
+		if value := branchValue(expr); value != ast.Expr(expr) {
+			c.checkOverflow(value, t)
+		}
+		return
+	case *ast.IfExpr:
+		c.checkOverflow(expr.Then, t)
+		if expr.Else != nil {
+			c.checkOverflow(expr.Else, t)
+		}
+		return
+	}
+	if types.IsInteger(t) {
+		c.constant(expr, t)
+		return
+	}
+	switch expr := expr.(type) {
+	case *ast.PrefixExpr:
+		c.checkOverflow(expr.Right, t)
+	case *ast.BinaryExpr:
+		c.checkOverflow(expr.Left, t)
+		c.checkOverflow(expr.Right, t)
+	case *ast.FloatExpr:
+		if expr.Suffix == "" && t == types.F32 && expr.Value > math.MaxFloat32 {
+			c.errorf(diagnostics.ConstantOverflow, expr.Span, "constant %s overflows f32", expr)
+		}
+	}
+}
+
+func (c *checker) prefixExpr(expr *ast.PrefixExpr) types.Type {
+	var right types.Type
+	literal, negatedLiteral := expr.Right.(*ast.IntegerExpr)
+	negatedLiteral = negatedLiteral && expr.Operator.Kind == lexer.DASH
+	if negatedLiteral {
+		// -2147483648 is an i32, although 2147483648 is not
+		right = c.integerLiteral(literal, true)
+		c.module.Info.Types[literal] = right
+	} else {
+		right = c.expr(expr.Right)
+	}
+	switch expr.Operator.Kind {
+	case lexer.DASH:
+		// negative unsigned literals were reported as overflowing
+		if types.IsUnsigned(right) && !negatedLiteral {
+			c.report(diagnostics.Errorf(diagnostics.InvalidOperation, expr.Span, "operator - not defined on unsigned %s", right).
+				WithNote("subtract from zero to negate modulo 2^%d, like 0 - %s", types.Bits(right), expr.Right.String()))
+			return types.Invalid
+		}
+		if !types.IsInvalid(right) && !types.IsNumeric(right) {
+			c.errorf(diagnostics.InvalidOperation, expr.Span, "operator - not defined on %s", right)
+			return types.Invalid
+		}
+	case lexer.NOT:
+		c.expectType(right, types.Bool, expr.Right)
+		return types.Bool
+	case lexer.TILDE:
+		if !types.IsInvalid(right) && !types.IsInteger(right) {
+			c.errorf(diagnostics.InvalidOperation, expr.Span, "operator ~ not defined on %s", right)
+			return types.Invalid
+		}
+	}
+	return right
+}
+
+func (c *checker) binaryExpr(expr *ast.BinaryExpr) types.Type {
+	left := c.expr(expr.Left)
+	right := c.expr(expr.Right)
+	return c.binaryOp(expr.Operator, left, right, expr.Left, expr.Right)
+}
+
+// binaryOp checks the operands of a binary operator, which is also used for
+// the operation of compound assignments, and returns the type of the result.
+func (c *checker) binaryOp(op lexer.Token, left, right types.Type, leftExpr, rightExpr ast.Expr) types.Type {
+	if types.IsInvalid(left) || types.IsInvalid(right) {
+		return invalidOr(op, types.Invalid)
+	}
+
+	operator := op.Value
+	switch op.Kind {
+	case lexer.AND, lexer.OR:
+		c.expectType(left, types.Bool, leftExpr)
+		c.expectType(right, types.Bool, rightExpr)
+		return types.Bool
+	case lexer.EQUAL, lexer.NOT_EQUAL:
+		if (left == types.Str && right == types.Str) || (types.IsStruct(left) && types.IsStruct(right)) || isTaggedUnion(left) || types.IsArray(left) || types.IsSlice(left) {
+			c.report(diagnostics.Errorf(diagnostics.InvalidOperation, op.Span, "operator %s not defined on %s", operator, left).
+				WithLabel(leftExpr.Location(), "%s", left).
+				WithLabel(rightExpr.Location(), "%s", right))
+			return types.Bool
+		}
+		if types.IsNumeric(left) && types.IsNumeric(right) {
+			c.unify(op, left, right, leftExpr, rightExpr)
+		} else if !types.Identical(left, right) {
+			c.report(diagnostics.Errorf(diagnostics.MismatchedTypes, op.Span, "mismatched types %s and %s in %s", left, right, operator).
+				WithLabel(leftExpr.Location(), "%s", left).
+				WithLabel(rightExpr.Location(), "%s", right))
+		}
+		return types.Bool
+	case lexer.LESS, lexer.LESS_EQUAL, lexer.GREATER, lexer.GREATER_EQUAL:
+		if !types.IsNumeric(left) || !types.IsNumeric(right) {
+			c.report(diagnostics.Errorf(diagnostics.InvalidOperation, op.Span, "operator %s not defined on %s and %s", operator, left, right).
+				WithLabel(leftExpr.Location(), "%s", left).
+				WithLabel(rightExpr.Location(), "%s", right))
+			return types.Bool
+		}
+		c.unify(op, left, right, leftExpr, rightExpr)
+		return types.Bool
+	case lexer.REMAINDER, lexer.AMPERSAND, lexer.PIPE, lexer.CARET, lexer.SHIFT_LEFT, lexer.SHIFT_RIGHT, lexer.SHIFT_RIGHT_UNSIGNED:
+		if !types.IsInteger(left) || !types.IsInteger(right) {
+			c.report(diagnostics.Errorf(diagnostics.InvalidOperation, op.Span, "operator %s not defined on %s and %s", operator, left, right).
+				WithLabel(leftExpr.Location(), "%s", left).
+				WithLabel(rightExpr.Location(), "%s", right))
+			return types.Invalid
+		}
+		return c.unify(op, left, right, leftExpr, rightExpr)
+	default:
+		if !types.IsNumeric(left) || !types.IsNumeric(right) {
+			c.report(diagnostics.Errorf(diagnostics.InvalidOperation, op.Span, "operator %s not defined on %s and %s", operator, left, right).
+				WithLabel(leftExpr.Location(), "%s", left).
+				WithLabel(rightExpr.Location(), "%s", right))
+			return types.Invalid
+		}
+		return c.unify(op, left, right, leftExpr, rightExpr)
+	}
+}
+
+// unify returns the common type of the numeric operands of a binary operator.
+// An unsuffixed literal takes the type of the other operand, other numbers of
+// different types do not mix.
+func (c *checker) unify(op lexer.Token, left, right types.Type, leftExpr, rightExpr ast.Expr) types.Type {
+	switch {
+	case types.Identical(left, right), c.adaptLiteral(rightExpr, left):
+		return left
+	case c.adaptLiteral(leftExpr, right):
+		return right
+	}
+	c.report(diagnostics.Errorf(diagnostics.MismatchedTypes, op.Span, "mismatched types %s and %s in %s", left, right, op.Value).
+		WithLabel(leftExpr.Location(), "%s", left).
+		WithLabel(rightExpr.Location(), "%s", right).
+		WithNote("numbers of different types do not mix implicitly: convert one of them with \"as\", like %s as %s", rightExpr.String(), left))
+	return types.Invalid
+}
+
+// isTaggedUnion reports whether t is an enum with variants carrying values.
+// Unlike plain enums, their values cannot be compared with ==.
+func isTaggedUnion(t types.Type) bool {
+	enum, ok := t.(*types.Enum)
+	return ok && !enum.IsPlain()
+}
+
+// invalidOr keeps comparisons boolean even when an operand failed to check, which
+// avoids a cascade of errors in the enclosing condition.
+func invalidOr(operator lexer.Token, t types.Type) types.Type {
+	switch operator.Kind {
+	case lexer.AND, lexer.OR, lexer.EQUAL, lexer.NOT_EQUAL, lexer.LESS, lexer.LESS_EQUAL, lexer.GREATER, lexer.GREATER_EQUAL:
+		return types.Bool
+	}
+	return t
+}
+
+func (c *checker) assignmentExpr(expr *ast.AssignmentExpr) types.Type {
+	target := c.expr(expr.Assigne)
+	value := c.exprFor(expr.AssignedValue, target)
+
+	// fields and elements are assigned through the variable holding the
+	// struct, the array or the slice
+	root := expr.Assigne
+	for {
+		if field, ok := root.(*ast.FieldExpr); ok {
+			root = field.Object
+		} else if index, ok := root.(*ast.IndexExpr); ok {
+			root = index.Object
+		} else {
+			break
+		}
+	}
+	var symbol *Symbol
+	switch root := root.(type) {
+	case *ast.SymbolExpr, *ast.MemberExpr:
+		symbol = c.module.Info.Uses[root]
+	}
+	if symbol == nil {
+		if !types.IsInvalid(target) {
+			c.errorf(diagnostics.InvalidAssignment, expr.Assigne.Location(), "cannot assign to %s", expr.Assigne.String())
+		}
+		return target
+	}
+	if c.captured(symbol) {
+		c.report(c.declaredHere(diagnostics.Errorf(diagnostics.ImmutableAssignment, expr.Assigne.Location(), "cannot assign to %s inside a function expression: captured variables are read-only copies", symbol.Name), symbol))
+		return target
+	}
+	switch symbol.Kind {
+	case LocalSymbol, GlobalSymbol:
+		if symbol.Module != c.module {
+			c.report(c.declaredHere(diagnostics.Errorf(diagnostics.ImmutableAssignment, expr.Assigne.Location(), "cannot assign to %s: globals of module %s are read-only here", symbol.Name, symbol.Module.Name), symbol))
+		} else if !symbol.Mutable {
+			c.report(c.declaredHere(diagnostics.Errorf(diagnostics.ImmutableAssignment, expr.Assigne.Location(), "cannot assign to immutable %s %s", symbol.Kind, symbol.Name), symbol).
+				WithNote("declare %s with \"let mut\" to make it mutable", symbol.Name))
+		}
+	case ParamSymbol:
+		c.report(c.declaredHere(diagnostics.Errorf(diagnostics.ImmutableAssignment, expr.Assigne.Location(), "cannot assign to parameter %s", symbol.Name), symbol))
+	default:
+		c.report(c.declaredHere(diagnostics.Errorf(diagnostics.InvalidAssignment, expr.Assigne.Location(), "cannot assign to %s %s", symbol.Kind, symbol.Name), symbol))
+		return target
+	}
+
+	if operator, compound := lexer.CompoundOperator(expr.Operator.Kind); compound {
+		op := expr.Operator
+		op.Kind = operator
+		c.binaryOp(op, target, value, expr.Assigne, expr.AssignedValue)
+		return target
+	}
+	c.expectAssignable(value, target, expr.AssignedValue)
+	return target
+}
+
+func (c *checker) callExpr(expr *ast.CallExpr) types.Type {
+	if builtin := c.builtin(expr); builtin != nil {
+		return c.builtinCall(expr, builtin)
+	}
+	callee := c.expr(expr.Callee)
+	sig, ok := callee.(*types.Signature)
+	args := make([]types.Type, 0, len(expr.Arguments))
+	for i, arg := range expr.Arguments {
+		var param types.Type
+		if ok && i < len(sig.Params) {
+			param = sig.Params[i]
+		}
+		args = append(args, c.exprFor(arg, param))
+	}
+	if types.IsInvalid(callee) {
+		return types.Invalid
+	}
+
+	if !ok {
+		c.errorf(diagnostics.NotCallable, expr.Callee.Location(), "cannot call non-function %s of type %s", expr.Callee.String(), callee)
+		return types.Invalid
+	}
+	if len(args) != len(sig.Params) {
+		d := diagnostics.Errorf(diagnostics.WrongArgumentCount, expr.Span, "wrong number of arguments in call to %s: have %d, want %d", expr.Callee.String(), len(args), len(sig.Params))
+		if symbol := c.module.Info.Uses[expr.Callee]; symbol != nil {
+			d = c.declaredHere(d, symbol)
+		}
+		c.report(d)
+		return sig.Result
+	}
+	for i, arg := range args {
+		c.expectAssignable(arg, sig.Params[i], expr.Arguments[i])
+	}
+	return sig.Result
+}
+
+// assignable reports whether a value of type value can be stored in a location
+// of type target. Values have the type of the location, except that an array
+// can be used as a slice of its elements.
+func assignable(value, target types.Type) bool {
+	if types.IsInvalid(value) || types.IsInvalid(target) {
+		return true
+	}
+	if array, ok := value.(*types.Array); ok {
+		if slice, ok := target.(*types.Slice); ok {
+			return types.Identical(array.Elem, slice.Elem)
+		}
+	}
+	return types.Identical(value, target)
+}
+
+func (c *checker) expectAssignable(value, target types.Type, expr ast.Expr) {
+	if value == types.Void {
+		c.errorf(diagnostics.NoValue, expr.Location(), "%s does not produce a value", expr.String())
+		return
+	}
+	// constants adapt even to their own type, which checks their value
+	if c.adaptLiteral(expr, target) || assignable(value, target) {
+		return
+	}
+	d := diagnostics.Errorf(diagnostics.MismatchedTypes, expr.Location(), "cannot use %s (%s) as %s", expr.String(), value, target)
+	if types.IsNumeric(value) && types.IsNumeric(target) {
+		d = d.WithNote("numbers of different types do not mix implicitly: convert with \"as\", like %s as %s", expr.String(), target)
+	}
+	c.report(d)
+}
+
+func (c *checker) expectType(t, expected types.Type, expr ast.Expr) {
+	if !types.IsInvalid(t) && !types.Identical(t, expected) {
+		c.errorf(diagnostics.MismatchedTypes, expr.Location(), "expected %s but %s has type %s", expected, expr.String(), t)
+	}
+}
@@ -0,0 +1,49 @@
+package checker
+
+import (
+	"github.com/LaH-DeV/veles/ast"
+	"github.com/LaH-DeV/veles/cfg"
+	"github.com/LaH-DeV/veles/diagnostics"
+	"github.com/LaH-DeV/veles/source"
+	"github.com/LaH-DeV/veles/types"
+)
+
+// checkControlFlow builds the control-flow graph of every function and
+// function expression of the module. It reports functions with a result that
+// can end without returning a value, and statements that never run.
+func (c *checker) checkControlFlow() {
+	ast.Inspect(c.module.Program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.FunctionStmt:
+			if symbol := c.module.Info.Defs[node]; symbol != nil {
+				sig, _ := symbol.Type.(*types.Signature)
+				c.checkFlow(node.Body, sig, node.Span, "function "+node.Identifier)
+			}
+		case *ast.FunctionExpr:
+			sig, _ := c.module.Info.Types[node].(*types.Signature)
+			c.checkFlow(node.Body, sig, node.Span, "function expression")
+		}
+		return true
+	})
+}
+
+func (c *checker) checkFlow(body []ast.Stmt, sig *types.Signature, span source.Span, what string) {
+	graph := cfg.Build(body)
+	for _, unreachable := range graph.Unreachable {
+		c.report(diagnostics.Warningf(diagnostics.UnreachableCode, unreachable.Stmt.Location(), "unreachable code").
+			WithLabel(unreachable.After.Location(), "any code after this statement is unreachable"))
+	}
+	if sig == nil || sig.Result == types.Void || types.IsInvalid(sig.Result) || !graph.FallsOffEnd() {
+		return
+	}
+	c.errorf(diagnostics.MissingReturn, closingBrace(span), "missing return at the end of %s returning %s", what, sig.Result)
+}
+
+// closingBrace returns the span of the last character of a function, the brace
+// closing its body.
+func closingBrace(span source.Span) source.Span {
+	start := span.End
+	start.Offset--
+	start.Column--
+	return source.Span{Start: start, End: span.End}
+}
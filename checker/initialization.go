@@ -0,0 +1,218 @@
+package checker
+
+import (
+	"github.com/LaH-DeV/veles/ast"
+	"github.com/LaH-DeV/veles/diagnostics"
+	"github.com/LaH-DeV/veles/lexer"
+	"github.com/LaH-DeV/veles/types"
+)
+
+// A local variable declared without an initializer holds the zero value of
+// its type until it is assigned. Reading it before then is allowed, but
+// usually a mistake, so the checker follows the assignments through every
+// path of a function and warns about reads on a path without one.
+
+// assigned is the set of variables without an initializer that are assigned
+// on every path to a point of a function. It is nil after a return, where no
+// path continues.
+type assigned map[*Symbol]bool
+
+func (a assigned) clone() assigned {
+	if a == nil {
+		return nil
+	}
+	clone := make(assigned, len(a))
+	for symbol := range a {
+		clone[symbol] = true
+	}
+	return clone
+}
+
+// join returns the variables assigned on both paths.
+func join(a, b assigned) assigned {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	both := make(assigned)
+	for symbol := range a {
+		if b[symbol] {
+			both[symbol] = true
+		}
+	}
+	return both
+}
+
+type initChecker struct {
+	c         *checker
+	unset     map[*Symbol]bool // variables declared without an initializer
+	warned    map[*Symbol]bool
+	functions []*ast.FunctionExpr // function expressions whose bodies are checked next
+}
+
+// checkInitialization warns about the variables of the functions of the
+// module that are read before they are assigned.
+func (c *checker) checkInitialization() {
+	ic := &initChecker{c: c, unset: make(map[*Symbol]bool), warned: make(map[*Symbol]bool)}
+	for _, stmt := range c.module.Program.Statements {
+		switch stmt := stmt.(type) {
+		case *ast.FunctionStmt:
+			ic.stmts(stmt.Body, assigned{})
+		case *ast.VariableDeclarationStmt:
+			if stmt.Value != nil {
+				ic.expr(stmt.Value, assigned{})
+			}
+		}
+	}
+	// the body of a function expression runs after the enclosing function
+	// reached it, with copies of the captured variables, whose reads were
+	// checked there
+	for len(ic.functions) > 0 {
+		fn := ic.functions[0]
+		ic.functions = ic.functions[1:]
+		captured := assigned{}
+		for _, symbol := range c.module.Info.Captures[fn] {
+			captured[symbol] = true
+		}
+		ic.stmts(fn.Body, captured)
+	}
+}
+
+func (ic *initChecker) stmts(stmts []ast.Stmt, in assigned) assigned {
+	for _, stmt := range stmts {
+		in = ic.stmt(stmt, in)
+	}
+	return in
+}
+
+func (ic *initChecker) stmt(stmt ast.Stmt, in assigned) assigned {
+	switch stmt := stmt.(type) {
+	case *ast.ExpressionStmt:
+		return ic.expr(stmt.Expression, in)
+	case *ast.VariableDeclarationStmt:
+		if stmt.Value != nil {
+			return ic.expr(stmt.Value, in)
+		}
+		if symbol := ic.c.module.Info.Defs[stmt]; symbol != nil {
+			ic.unset[symbol] = true
+		}
+	case *ast.ReturnStmt:
+		if stmt.Value != nil {
+			ic.expr(stmt.Value, in)
+		}
+		return nil
+	}
+	return in
+}
+
+func (ic *initChecker) exprs(exprs []ast.Expr, in assigned) assigned {
+	for _, expr := range exprs {
+		in = ic.expr(expr, in)
+	}
+	return in
+}
+
+func (ic *initChecker) expr(expr ast.Expr, in assigned) assigned {
+	switch expr := expr.(type) {
+	case *ast.SymbolExpr:
+		ic.read(ic.c.module.Info.Uses[expr], expr, in)
+	case *ast.AssignmentExpr:
+		return ic.assignment(expr, in)
+	case *ast.BinaryExpr:
+		in = ic.expr(expr.Left, in)
+		if expr.Operator.Kind == lexer.AND || expr.Operator.Kind == lexer.OR {
+			// the right operand is not evaluated on every path
+			ic.expr(expr.Right, in.clone())
+			return in
+		}
+		return ic.expr(expr.Right, in)
+	case *ast.PrefixExpr:
+		return ic.expr(expr.Right, in)
+	case *ast.CastExpr:
+		return ic.expr(expr.Value, in)
+	case *ast.CallExpr:
+		return ic.exprs(expr.Arguments, ic.expr(expr.Callee, in))
+	case *ast.FieldExpr:
+		return ic.expr(expr.Object, in)
+	case *ast.IndexExpr:
+		return ic.expr(expr.Index, ic.expr(expr.Object, in))
+	case *ast.StructLiteralExpr:
+		for _, field := range expr.Fields {
+			in = ic.expr(field.Value, in)
+		}
+	case *ast.ArrayLiteralExpr:
+		return ic.exprs(expr.Elements, in)
+	case *ast.FunctionExpr:
+		for _, symbol := range ic.c.module.Info.Captures[expr] {
+			ic.read(symbol, expr, in)
+		}
+		ic.functions = append(ic.functions, expr)
+	case *ast.BlockExpr:
+		return ic.stmts(expr.Body, in)
+	case *ast.IfExpr:
+		in = ic.expr(expr.Condition, in)
+		then := ic.expr(expr.Then, in.clone())
+		if expr.Else == nil {
+			return join(then, in)
+		}
+		return join(then, ic.expr(expr.Else, in))
+	case *ast.MatchExpr:
+		in = ic.expr(expr.Value, in)
+		var out assigned
+		for i, arm := range expr.Arms {
+			body := ic.expr(arm.Body, in.clone())
+			if i == 0 {
+				out = body
+			} else {
+				out = join(out, body)
+			}
+		}
+		return out
+	}
+	return in
+}
+
+// assignment records the assignment of a variable. Assigning a field or an
+// element of a variable neither reads nor assigns the variable.
+func (ic *initChecker) assignment(expr *ast.AssignmentExpr, in assigned) assigned {
+	in = ic.expr(expr.AssignedValue, in)
+	target := expr.Assigne
+	for {
+		if field, ok := target.(*ast.FieldExpr); ok {
+			target = field.Object
+		} else if index, ok := target.(*ast.IndexExpr); ok {
+			in = ic.expr(index.Index, in)
+			target = index.Object
+		} else {
+			break
+		}
+	}
+	symbol, ok := target.(*ast.SymbolExpr)
+	if !ok || symbol != expr.Assigne {
+		return in
+	}
+	if _, compound := lexer.CompoundOperator(expr.Operator.Kind); compound {
+		ic.expr(symbol, in)
+	}
+	if variable := ic.c.module.Info.Uses[symbol]; variable != nil && in != nil {
+		in[variable] = true
+	}
+	return in
+}
+
+// read warns about a variable read on a path where it is not assigned, once
+// per variable. Variables without a valid type were reported already.
+func (ic *initChecker) read(symbol *Symbol, expr ast.Expr, in assigned) {
+	if symbol == nil || !ic.unset[symbol] || in == nil || in[symbol] || ic.warned[symbol] || symbol.Type == types.Invalid {
+		return
+	}
+	ic.warned[symbol] = true
+	d := diagnostics.Warningf(diagnostics.UnassignedVariable, expr.Location(), "%s is read before it is assigned", symbol.Name)
+	if _, ok := expr.(*ast.FunctionExpr); ok {
+		d = diagnostics.Warningf(diagnostics.UnassignedVariable, expr.Location(), "%s is captured before it is assigned", symbol.Name)
+	}
+	ic.c.report(d.WithLabel(symbol.Span, "%s declared here without an initializer", symbol.Name).
+		WithNote("%s holds the zero value of %s on this path", symbol.Name, symbol.Type))
+}
@@ -0,0 +1,249 @@
+package checker
+
+import (
+	"strings"
+
+	"github.com/LaH-DeV/veles/ast"
+	"github.com/LaH-DeV/veles/diagnostics"
+	"github.com/LaH-DeV/veles/lexer"
+	"github.com/LaH-DeV/veles/types"
+)
+
+// coverage records the values matched by the arms of a match checked so far.
+type coverage struct {
+	wildcard bool
+	variants map[int]bool    // the tags of the matched variants
+	literals map[string]bool // the matched literals, like "-1" or "true"
+}
+
+// matchExpr checks the arms of a match and returns the type of its value, the
+// type of the first arm. The arms must match every value of the matched type.
+// Arms that return from the function produce no value and agree with any type.
+func (c *checker) matchExpr(expr *ast.MatchExpr) types.Type {
+	value := c.expr(expr.Value)
+	covered := &coverage{variants: make(map[int]bool), literals: make(map[string]bool)}
+
+	var result types.Type
+	var first ast.Expr
+	for i := range expr.Arms {
+		arm := &expr.Arms[i]
+		c.openScope(arm.Span)
+		c.pattern(arm.Pattern, value, covered)
+		body := c.expr(arm.Body)
+		c.closeScope()
+
+		switch {
+		case types.IsInvalid(body), diverges(arm.Body):
+		case result == nil:
+			result, first = body, arm.Body
+		case assignable(body, result), c.adaptLiteral(arm.Body, result):
+		case c.adaptArms(expr.Arms[:i], body):
+			result, first = body, arm.Body
+		default:
+			c.report(diagnostics.Errorf(diagnostics.MismatchedTypes, arm.Body.Location(), "match arms have different types: %s and %s", result, body).
+				WithLabel(first.Location(), "%s", result))
+		}
+	}
+
+	if !types.IsInvalid(value) {
+		c.checkExhaustive(expr, value, covered)
+	}
+	if result == nil {
+		for _, arm := range expr.Arms {
+			if !diverges(arm.Body) {
+				return types.Invalid
+			}
+		}
+		return types.Void
+	}
+	return result
+}
+
+// adaptArms gives the literals producing the values of arms the type t, when
+// all of them can take it. An arm with a literal may come before the first arm
+// with a value of a numeric type.
+func (c *checker) adaptArms(arms []ast.MatchArm, t types.Type) bool {
+	if !types.IsNumeric(t) {
+		return false
+	}
+	for _, arm := range arms {
+		if !diverges(arm.Body) && !types.IsInvalid(c.module.Info.Types[arm.Body]) && !adaptable(arm.Body, t) {
+			return false
+		}
+	}
+	for _, arm := range arms {
+		if !diverges(arm.Body) && !types.IsInvalid(c.module.Info.Types[arm.Body]) {
+			c.adaptLiteral(arm.Body, t)
+		}
+	}
+	return true
+}
+
+// pattern checks a pattern against the type of the matched value, declares the
+// names it binds in the current scope and adds the values it matches to covered.
+func (c *checker) pattern(pattern ast.Pattern, value types.Type, covered *coverage) {
+	switch pattern := pattern.(type) {
+	case *ast.WildcardPattern:
+		c.reachable(pattern, covered.complete(value))
+		covered.wildcard = true
+	case *ast.LiteralPattern:
+		key, ok := c.literalPattern(pattern, value)
+		if !ok {
+			return
+		}
+		c.reachable(pattern, covered.wildcard || covered.literals[key])
+		covered.literals[key] = true
+	case *ast.VariantPattern:
+		tag := c.variantPattern(pattern, value)
+		if tag < 0 {
+			return
+		}
+		c.reachable(pattern, covered.wildcard || covered.variants[tag])
+		covered.variants[tag] = true
+	}
+}
+
+// reachable warns about a pattern whose values were matched by earlier arms.
+func (c *checker) reachable(pattern ast.Pattern, shadowed bool) {
+	if shadowed {
+		c.report(diagnostics.Warningf(diagnostics.UnreachablePattern, pattern.Location(), "unreachable pattern %s: earlier arms match all of its values", pattern))
+	}
+}
+
+// literalPattern checks a literal pattern and returns the literal in a form
+// that identifies its value.
+func (c *checker) literalPattern(pattern *ast.LiteralPattern, value types.Type) (string, bool) {
+	t := c.expr(pattern.Value)
+	if types.IsInvalid(t) || types.IsInvalid(value) {
+		return "", false
+	}
+	if value != types.Bool && !types.IsNumeric(value) {
+		c.errorf(diagnostics.InvalidPattern, pattern.Span, "cannot match a value of type %s against the literal %s", value, pattern)
+		return "", false
+	}
+	if !types.Identical(t, value) && !c.adaptLiteral(pattern.Value, value) {
+		c.errorf(diagnostics.MismatchedTypes, pattern.Span, "pattern %s (%s) does not match values of type %s", pattern, t, value)
+		return "", false
+	}
+
+	expr, sign := pattern.Value, ""
+	if prefix, ok := expr.(*ast.PrefixExpr); ok && prefix.Operator.Kind == lexer.DASH {
+		expr, sign = prefix.Right, "-"
+	}
+	switch literal := expr.(type) {
+	case *ast.IntegerExpr:
+		if literal.Value == 0 {
+			sign = ""
+		}
+		return sign + literal.String(), true
+	case *ast.FloatExpr:
+		if literal.Value == 0 {
+			sign = ""
+		}
+		return sign + literal.String(), true
+	}
+	return pattern.Value.String(), true
+}
+
+// variantPattern checks a variant pattern, declares its bindings and returns
+// the tag of the variant, or -1 when the pattern is invalid.
+func (c *checker) variantPattern(pattern *ast.VariantPattern, value types.Type) int {
+	var symbol *Symbol
+	switch expr := pattern.Variant.(type) {
+	case *ast.SymbolExpr:
+		if symbol = c.scope.Lookup(expr.Value); symbol == nil {
+			c.report(diagnostics.Errorf(diagnostics.Undefined, expr.Span, "undefined: %s", expr.Value).
+				WithNote("variants are written with the name of their enum, like Shape::%s, and _ matches any value", expr.Value))
+			return -1
+		}
+		c.module.Info.Uses[expr] = symbol
+	case *ast.MemberExpr:
+		if symbol = c.member(expr); symbol == nil {
+			return -1
+		}
+	}
+
+	enum, tag := symbol.Variant()
+	if enum == nil {
+		c.report(c.declaredHere(diagnostics.Errorf(diagnostics.InvalidPattern, pattern.Variant.Location(), "%s %s is not an enum variant", symbol.Kind, pattern.Variant), symbol))
+		return -1
+	}
+	if !types.IsInvalid(value) && !types.Identical(enum, value) {
+		c.errorf(diagnostics.MismatchedTypes, pattern.Span, "pattern %s (%s) does not match values of type %s", pattern.Variant, enum, value)
+		return -1
+	}
+
+	fields := enum.Variants[tag].Fields
+	if !pattern.Parens && len(fields) > 0 {
+		c.report(diagnostics.Errorf(diagnostics.InvalidPattern, pattern.Span, "variant %s carries %d %s, which the pattern must bind", pattern.Variant, len(fields), plural(len(fields), "value", "values")).
+			WithNote("use _ for the values that are not needed, like %s(%s)", pattern.Variant, strings.TrimSuffix(strings.Repeat("_, ", len(fields)), ", ")))
+		return tag
+	}
+	if pattern.Parens && len(pattern.Bindings) != len(fields) {
+		c.errorf(diagnostics.InvalidPattern, pattern.Span, "wrong number of bindings for variant %s: have %d, want %d", pattern.Variant, len(pattern.Bindings), len(fields))
+		return tag
+	}
+	for i := range pattern.Bindings {
+		binding := &pattern.Bindings[i]
+		if binding.Name == "_" {
+			continue
+		}
+		c.declare(&Symbol{
+			Name:   binding.Name,
+			Kind:   LocalSymbol,
+			Type:   fields[i],
+			Decl:   binding,
+			Span:   binding.Span,
+			Module: c.module,
+		})
+	}
+	return tag
+}
+
+// checkExhaustive reports the values of type value no arm matches.
+func (c *checker) checkExhaustive(expr *ast.MatchExpr, value types.Type, covered *coverage) {
+	if covered.wildcard {
+		return
+	}
+	missing, listed := covered.missing(value)
+	if !listed {
+		c.report(diagnostics.Errorf(diagnostics.NonExhaustiveMatch, expr.Span, "non-exhaustive match on %s: not every value is covered", value).
+			WithNote("add a _ arm to match the remaining values"))
+		return
+	}
+	if len(missing) == 0 {
+		return
+	}
+	c.report(diagnostics.Errorf(diagnostics.NonExhaustiveMatch, expr.Span, "non-exhaustive match: %s %s not covered", strings.Join(missing, ", "), plural(len(missing), "is", "are")).
+		WithNote("add arms for the missing values or a _ arm"))
+}
+
+// missing returns the values of type t not matched yet. Only the values of
+// enums and of bool can be listed, for other types it reports false.
+func (covered *coverage) missing(t types.Type) ([]string, bool) {
+	missing := make([]string, 0)
+	switch t := t.(type) {
+	case *types.Enum:
+		for tag, variant := range t.Variants {
+			if !covered.variants[tag] {
+				missing = append(missing, t.Name+"::"+variant.Name)
+			}
+		}
+	default:
+		if t != types.Bool {
+			return nil, false
+		}
+		for _, literal := range []string{"true", "false"} {
+			if !covered.literals[literal] {
+				missing = append(missing, literal)
+			}
+		}
+	}
+	return missing, true
+}
+
+// complete reports whether every value of type t is matched already.
+func (covered *coverage) complete(t types.Type) bool {
+	missing, listed := covered.missing(t)
+	return covered.wildcard || (listed && len(missing) == 0)
+}
@@ -0,0 +1,422 @@
+package checker
+
+import (
+	"strings"
+
+	"github.com/LaH-DeV/veles/ast"
+	"github.com/LaH-DeV/veles/diagnostics"
+	"github.com/LaH-DeV/veles/types"
+)
+
+// declareTypes adds the imports and the struct types of a module to its scope.
+// The fields of the structs are resolved by declareTopLevel.
+func (c *checker) declareTypes(stmt ast.Stmt) {
+	switch stmt := stmt.(type) {
+	case *ast.UseStmt:
+		c.declareUse(stmt)
+	case *ast.StructStmt:
+		c.declare(&Symbol{
+			Name:     stmt.Identifier,
+			Kind:     StructSymbol,
+			Type:     &types.Struct{Name: stmt.Identifier},
+			Exported: stmt.Exported,
+			Decl:     stmt,
+			Span:     stmt.NameSpan,
+			Module:   c.module,
+		})
+	case *ast.EnumStmt:
+		c.declare(&Symbol{
+			Name:     stmt.Identifier,
+			Kind:     EnumSymbol,
+			Type:     &types.Enum{Name: stmt.Identifier},
+			Exported: stmt.Exported,
+			Decl:     stmt,
+			Span:     stmt.NameSpan,
+			Module:   c.module,
+			Members:  make(map[string]*Symbol),
+		})
+	}
+}
+
+// declareTopLevel adds the symbols of a top-level statement to the module scope,
+// so that functions and globals can be used before they are declared.
+func (c *checker) declareTopLevel(stmt ast.Stmt) {
+	switch stmt := stmt.(type) {
+	case *ast.StructStmt:
+		c.declareFields(stmt)
+	case *ast.EnumStmt:
+		c.declareVariants(stmt)
+	case *ast.FunctionStmt:
+		c.declare(&Symbol{
+			Name:     stmt.Identifier,
+			Kind:     FunctionSymbol,
+			Type:     c.signature(stmt.Params, stmt.ReturnType, stmt.Span),
+			Exported: stmt.Exported,
+			Decl:     stmt,
+			Span:     stmt.NameSpan,
+			Module:   c.module,
+		})
+	case *ast.ExternStmt:
+		c.declareTopLevel(stmt.Statement)
+	case *ast.FunctionDeclaration:
+		kind := FunctionSymbol
+		if stmt.Extern {
+			kind = ExternSymbol
+		}
+		c.declare(&Symbol{
+			Name:     stmt.Identifier,
+			Kind:     kind,
+			Type:     c.signature(stmt.Params, stmt.ReturnType, stmt.Span),
+			Exported: stmt.Exported,
+			Decl:     stmt,
+			Span:     stmt.NameSpan,
+			Module:   c.module,
+		})
+	case *ast.VariableDeclarationStmt:
+		var t types.Type // inferred by inferGlobal when the type is left out
+		if stmt.VarType != "" {
+			t = c.resolveType(stmt.VarType, stmt.Span)
+		}
+		c.declare(&Symbol{
+			Name:     stmt.VarName,
+			Kind:     GlobalSymbol,
+			Type:     t,
+			Exported: stmt.Exported,
+			Mutable:  stmt.Mutable,
+			Decl:     stmt,
+			Span:     stmt.NameSpan,
+			Module:   c.module,
+		})
+	}
+}
+
+// declareFields resolves the field types of a struct declared by declareTypes.
+func (c *checker) declareFields(stmt *ast.StructStmt) {
+	symbol := c.module.Info.Defs[stmt]
+	if symbol == nil {
+		return
+	}
+	st := symbol.Type.(*types.Struct)
+	spans := make(map[string]ast.StructField)
+	for _, field := range stmt.Fields {
+		if previous, exists := spans[field.FieldName]; exists {
+			c.report(diagnostics.Errorf(diagnostics.Redeclared, field.NameSpan, "field %s redeclared in struct %s", field.FieldName, stmt.Identifier).
+				WithLabel(previous.NameSpan, "previous declaration of %s", field.FieldName))
+			continue
+		}
+		spans[field.FieldName] = field
+		st.Fields = append(st.Fields, types.Field{
+			Name: field.FieldName,
+			Type: c.resolveType(field.FieldType, field.Span),
+		})
+	}
+}
+
+// declareVariants resolves the variants of an enum declared by declareTypes.
+// Variants are members of the enum, not of the module scope.
+func (c *checker) declareVariants(stmt *ast.EnumStmt) {
+	symbol := c.module.Info.Defs[stmt]
+	if symbol == nil || symbol.Kind != EnumSymbol {
+		return
+	}
+	enum := symbol.Type.(*types.Enum)
+	for i := range stmt.Variants {
+		decl := &stmt.Variants[i]
+		if previous, exists := symbol.Members[decl.Name]; exists {
+			c.report(diagnostics.Errorf(diagnostics.Redeclared, decl.NameSpan, "variant %s redeclared in enum %s", decl.Name, stmt.Identifier).
+				WithLabel(previous.Span, "previous declaration of %s", decl.Name))
+			continue
+		}
+		variant := types.Variant{Name: decl.Name, Fields: make([]types.Type, 0, len(decl.Fields))}
+		for j, field := range decl.Fields {
+			variant.Fields = append(variant.Fields, c.resolveType(field, decl.FieldSpans[j]))
+		}
+		enum.Variants = append(enum.Variants, variant)
+
+		// a variant carrying values is constructed like a function call
+		var t types.Type = enum
+		if len(variant.Fields) > 0 {
+			t = &types.Signature{
+				Params:     variant.Fields,
+				ParamNames: make([]string, len(variant.Fields)),
+				Result:     enum,
+			}
+		}
+		member := &Symbol{
+			Name:     decl.Name,
+			Kind:     VariantSymbol,
+			Type:     t,
+			Exported: stmt.Exported,
+			Decl:     decl,
+			Span:     decl.NameSpan,
+			Module:   c.module,
+		}
+		symbol.Members[decl.Name] = member
+		c.module.Info.Defs[decl] = member
+	}
+}
+
+// checkRecursiveStructs reports structs that contain themselves. Fields are
+// stored inline, so such structs have no finite layout. The recursive fields
+// are replaced by invalid ones to keep later passes from looping.
+func (c *checker) checkRecursiveStructs() {
+	for _, stmt := range c.module.Program.Statements {
+		decl, ok := stmt.(*ast.StructStmt)
+		if !ok {
+			continue
+		}
+		symbol := c.module.Info.Defs[decl]
+		if symbol == nil || symbol.Kind != StructSymbol {
+			continue
+		}
+		st := symbol.Type.(*types.Struct)
+		for i, field := range st.Fields {
+			if path := containsStruct(field.Type, st, nil); path != nil {
+				c.report(diagnostics.Errorf(diagnostics.RecursiveType, decl.Fields[i].Span, "struct %s contains itself through field %s", st.Name, field.Name).
+					WithNote("%s", strings.Join(append([]string{st.Name + "." + field.Name}, path...), " contains ")))
+				st.Fields[i].Type = types.Invalid
+			}
+		}
+	}
+}
+
+// containsStruct returns the chain of fields through which t contains target
+// by value, or nil when it does not. Arrays store their elements inline, while
+// slices only refer to theirs.
+func containsStruct(t types.Type, target *types.Struct, seen []*types.Struct) []string {
+	if array, ok := t.(*types.Array); ok {
+		return containsStruct(array.Elem, target, seen)
+	}
+	st, ok := t.(*types.Struct)
+	if !ok {
+		return nil
+	}
+	if st == target {
+		return []string{st.Name}
+	}
+	for _, s := range seen {
+		if s == st {
+			return nil
+		}
+	}
+	for _, field := range st.Fields {
+		if path := containsStruct(field.Type, target, append(seen, st)); path != nil {
+			return append([]string{st.Name + "." + field.Name}, path...)
+		}
+	}
+	return nil
+}
+
+// declareUse imports a module, or a single exported member of a module, under
+// the alias or the last segment of the path.
+func (c *checker) declareUse(stmt *ast.UseStmt) {
+	path := append([]string{stmt.Module}, stmt.Segments...)
+	name := path[len(path)-1]
+	span := stmt.ModuleSpan
+	if len(stmt.SegmentSpans) > 0 {
+		span = stmt.SegmentSpans[len(stmt.SegmentSpans)-1]
+	}
+	if len(stmt.Alias) > 0 {
+		name = stmt.Alias
+		span = stmt.AliasSpan
+	}
+
+	if c.importer == nil {
+		c.errorf(diagnostics.ImportFailed, stmt.Span, "cannot import %s: imports are not available", strings.Join(path, "::"))
+		return
+	}
+
+	module, err := c.importer.Import(path)
+	if err == nil {
+		c.declare(&Symbol{
+			Name:   name,
+			Kind:   ModuleSymbol,
+			Type:   types.Invalid,
+			Decl:   stmt,
+			Span:   span,
+			Module: c.module,
+			Target: module,
+		})
+		return
+	}
+
+	if len(path) > 1 {
+		if parent, parentErr := c.importer.Import(path[:len(path)-1]); parentErr == nil {
+			member := parent.Member(path[len(path)-1])
+			if member != nil {
+				c.module.Info.Imports[stmt] = member
+			}
+			if member == nil {
+				c.errorf(diagnostics.NoMember, span, "module %s has no member %s", parent.Name, path[len(path)-1])
+				return
+			}
+			if !member.Exported {
+				c.report(diagnostics.Errorf(diagnostics.NotExported, span, "%s is not exported by module %s", member.Name, parent.Name).
+					WithNote("declare %s with \"pub\" in module %s to export it", member.Name, parent.Name))
+				return
+			}
+			if previous, exists := c.scope.Symbols[name]; exists {
+				c.report(diagnostics.Errorf(diagnostics.Redeclared, span, "%s redeclared in this scope", name).
+					WithLabel(previous.Span, "previous declaration of %s", name))
+				return
+			}
+			c.scope.Symbols[name] = member
+			return
+		}
+	}
+
+	c.errorf(diagnostics.ImportFailed, stmt.Span, "cannot import %s: %s", strings.Join(path, "::"), err)
+}
+
+func (c *checker) checkTopLevel(stmt ast.Stmt) {
+	switch stmt := stmt.(type) {
+	case *ast.FunctionStmt:
+		c.checkFunction(stmt)
+	case *ast.VariableDeclarationStmt:
+		symbol := c.module.Info.Defs[stmt]
+		switch {
+		case stmt.Value == nil:
+		case symbol == nil:
+			c.expr(stmt.Value)
+		case stmt.VarType != "":
+			c.expectAssignable(c.exprFor(stmt.Value, symbol.Type), symbol.Type, stmt.Value)
+		}
+		// the initializers of globals without a type were checked by inferGlobal
+	case *ast.UseStmt, *ast.ExternStmt, *ast.FunctionDeclaration, *ast.StructStmt, *ast.EnumStmt:
+	default:
+		c.errorf(diagnostics.MisplacedDeclaration, stmt.Location(), "only declarations are allowed at the top level of a module")
+	}
+}
+
+// inferGlobal gives a global declared without a type the type of its
+// initializer. Globals are inferred in the order of their declarations, and
+// earlier when another initializer refers to them. The initializer is checked
+// at the top level of the module, whatever the reference is nested in.
+func (c *checker) inferGlobal(symbol *Symbol, ref ast.Expr) {
+	if symbol == nil || symbol.Type != nil {
+		return
+	}
+	if c.inferring[symbol] {
+		c.report(c.declaredHere(diagnostics.Errorf(diagnostics.InitializationCycle, ref.Location(), "initialization cycle: the type of %s depends on itself", symbol.Name), symbol).
+			WithNote("declare the type of %s, like \"let <type> %s = ...\"", symbol.Name, symbol.Name))
+		symbol.Type = types.Invalid
+		return
+	}
+	decl := symbol.Decl.(*ast.VariableDeclarationStmt)
+	c.inferring[symbol] = true
+	scope, function, closures := c.scope, c.function, c.closures
+	c.scope, c.function, c.closures = c.module.Scope, nil, nil
+	t := c.inferType(decl.Value)
+	c.scope, c.function, c.closures = scope, function, closures
+	delete(c.inferring, symbol)
+	if symbol.Type == nil {
+		symbol.Type = t
+	}
+}
+
+// inferType checks the initializer of a variable declared without a type and
+// returns its type. Unsuffixed constants default to i32 and f64.
+func (c *checker) inferType(value ast.Expr) types.Type {
+	if value == nil {
+		// reported by the parser
+		return types.Invalid
+	}
+	t := c.exprFor(value, nil)
+	c.expectAssignable(t, t, value)
+	if t == types.Void {
+		return types.Invalid
+	}
+	return t
+}
+
+func (c *checker) checkFunction(fn *ast.FunctionStmt) {
+	symbol := c.module.Info.Defs[fn]
+	if symbol == nil {
+		return
+	}
+	sig, ok := symbol.Type.(*types.Signature)
+	if !ok {
+		return
+	}
+
+	c.openScope(fn.Span)
+	defer c.closeScope()
+
+	c.declareParams(fn.Params, sig)
+	outer := c.function
+	c.function = sig
+	c.stmts(fn.Body)
+	c.function = outer
+}
+
+func (c *checker) declareParams(params []ast.FunctionParameter, sig *types.Signature) {
+	for i := range params {
+		param := &params[i]
+		c.declare(&Symbol{
+			Name:   param.ParamName,
+			Kind:   ParamSymbol,
+			Type:   sig.Params[i],
+			Decl:   param,
+			Span:   param.NameSpan,
+			Module: c.module,
+		})
+	}
+}
+
+func (c *checker) stmts(stmts []ast.Stmt) {
+	for _, stmt := range stmts {
+		c.stmt(stmt)
+	}
+}
+
+func (c *checker) stmt(stmt ast.Stmt) {
+	switch stmt := stmt.(type) {
+	case *ast.ExpressionStmt:
+		c.exprUsed(stmt.Expression, false)
+	case *ast.VariableDeclarationStmt:
+		if stmt.Exported {
+			c.errorf(diagnostics.MisplacedDeclaration, stmt.Span, "local variable %s cannot be exported", stmt.VarName)
+		}
+		var t types.Type
+		if stmt.VarType == "" {
+			t = c.inferType(stmt.Value)
+		} else {
+			t = c.resolveType(stmt.VarType, stmt.Span)
+			if stmt.Value != nil {
+				c.expectAssignable(c.exprFor(stmt.Value, t), t, stmt.Value)
+			}
+		}
+		// declared after the initializer, so "let i32 x = x" refers to an outer x
+		c.declare(&Symbol{
+			Name:    stmt.VarName,
+			Kind:    LocalSymbol,
+			Type:    t,
+			Mutable: stmt.Mutable,
+			Decl:    stmt,
+			Span:    stmt.NameSpan,
+			Module:  c.module,
+		})
+	case *ast.ReturnStmt:
+		c.checkReturn(stmt)
+	case *ast.FunctionStmt, *ast.FunctionDeclaration, *ast.ExternStmt, *ast.UseStmt, *ast.StructStmt, *ast.EnumStmt:
+		c.errorf(diagnostics.MisplacedDeclaration, stmt.Location(), "declaration is only allowed at the top level of a module")
+	}
+}
+
+func (c *checker) checkReturn(stmt *ast.ReturnStmt) {
+	if c.function == nil {
+		return
+	}
+	if stmt.Value == nil {
+		if c.function.Result != types.Void {
+			c.errorf(diagnostics.ReturnMismatch, stmt.Span, "missing return value of type %s", c.function.Result)
+		}
+		return
+	}
+	value := c.exprFor(stmt.Value, c.function.Result)
+	if c.function.Result == types.Void {
+		c.errorf(diagnostics.ReturnMismatch, stmt.Value.Location(), "function does not return a value")
+		return
+	}
+	c.expectAssignable(value, c.function.Result, stmt.Value)
+}
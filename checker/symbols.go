@@ -0,0 +1,241 @@
+package checker
+
+import (
+	"sort"
+
+	"github.com/LaH-DeV/veles/ast"
+	"github.com/LaH-DeV/veles/source"
+	"github.com/LaH-DeV/veles/types"
+)
+
+type SymbolKind int
+
+const (
+	FunctionSymbol SymbolKind = iota
+	ExternSymbol
+	GlobalSymbol
+	LocalSymbol
+	ParamSymbol
+	ModuleSymbol
+	StructSymbol
+	EnumSymbol
+	VariantSymbol
+	BuiltinSymbol
+)
+
+func (k SymbolKind) String() string {
+	switch k {
+	case FunctionSymbol:
+		return "function"
+	case ExternSymbol:
+		return "extern function"
+	case GlobalSymbol:
+		return "global"
+	case LocalSymbol:
+		return "local"
+	case ParamSymbol:
+		return "parameter"
+	case ModuleSymbol:
+		return "module"
+	case StructSymbol:
+		return "struct"
+	case EnumSymbol:
+		return "enum"
+	case VariantSymbol:
+		return "variant"
+	case BuiltinSymbol:
+		return "builtin function"
+	default:
+		return "unknown"
+	}
+}
+
+// Symbol is a named entity: a function, a variable, a parameter, a struct or
+// an enum type, an enum variant, an imported module or a builtin function.
+type Symbol struct {
+	Name     string
+	Kind     SymbolKind
+	Type     types.Type
+	Exported bool
+	Mutable  bool // variables declared with "let mut"
+
+	Decl   ast.Node    // the declaring node
+	Span   source.Span // the span of the declared name
+	Module *Module     // the module declaring the symbol
+	Target *Module     // the imported module, for module symbols
+
+	Members map[string]*Symbol // the variants of an enum
+}
+
+// Variant returns the enum of a variant symbol and the tag of the variant. The
+// type of a variant carrying values is the signature of its constructor.
+func (s *Symbol) Variant() (*types.Enum, int) {
+	t := s.Type
+	if sig, ok := t.(*types.Signature); ok {
+		t = sig.Result
+	}
+	enum, ok := t.(*types.Enum)
+	if s.Kind != VariantSymbol || !ok {
+		return nil, -1
+	}
+	return enum, enum.Variant(s.Name)
+}
+
+// Describe renders the symbol the way it would be declared in Veles.
+func (s *Symbol) Describe() string {
+	var str string
+	if s.Exported {
+		str += "pub "
+	}
+	switch s.Kind {
+	case FunctionSymbol, ExternSymbol:
+		if s.Kind == ExternSymbol {
+			str = "extern "
+		}
+		str += "fn "
+		sig, ok := s.Type.(*types.Signature)
+		if !ok {
+			return str + ":: " + s.Name
+		}
+		if sig.Result != types.Void {
+			str += sig.Result.String() + " "
+		}
+		str += ":: " + s.Name + "("
+		for i, param := range sig.Params {
+			if i > 0 {
+				str += ", "
+			}
+			str += param.String() + " " + sig.ParamNames[i]
+		}
+		return str + ")"
+	case GlobalSymbol, LocalSymbol:
+		str += "let "
+		if s.Mutable {
+			str += "mut "
+		}
+		return str + s.Type.String() + " " + s.Name
+	case ParamSymbol:
+		return s.Type.String() + " " + s.Name
+	case ModuleSymbol:
+		return "module " + s.Target.Name
+	case StructSymbol:
+		str += "struct " + s.Name
+		st, ok := s.Type.(*types.Struct)
+		if !ok || len(st.Fields) == 0 {
+			return str + " {}"
+		}
+		str += " { "
+		for i, field := range st.Fields {
+			if i > 0 {
+				str += ", "
+			}
+			str += field.Type.String() + " " + field.Name
+		}
+		return str + " }"
+	case EnumSymbol:
+		str += "enum " + s.Name
+		enum, ok := s.Type.(*types.Enum)
+		if !ok || len(enum.Variants) == 0 {
+			return str + " {}"
+		}
+		str += " { "
+		for i, variant := range enum.Variants {
+			if i > 0 {
+				str += ", "
+			}
+			str += describeVariant(variant)
+		}
+		return str + " }"
+	case VariantSymbol:
+		enum, tag := s.Variant()
+		if enum == nil || tag < 0 {
+			return s.Name
+		}
+		return enum.Name + "::" + describeVariant(enum.Variants[tag])
+	case BuiltinSymbol:
+		return "builtin fn " + s.Name
+	}
+	return s.Name
+}
+
+// builtins are the functions provided by the language. They are generic, so
+// they have no signature and every call is checked on its own. A declaration
+// with the same name shadows a builtin.
+var builtins = map[string]*Symbol{
+	"len": {Name: "len", Kind: BuiltinSymbol, Type: types.Invalid},
+}
+
+// Scope maps names to symbols. Scopes form a tree that mirrors the nesting of
+// the source: the module scope, function scopes and block scopes.
+type Scope struct {
+	Parent   *Scope
+	Children []*Scope
+	Span     source.Span
+	Symbols  map[string]*Symbol
+}
+
+func NewScope(parent *Scope, span source.Span) *Scope {
+	scope := &Scope{
+		Parent:  parent,
+		Span:    span,
+		Symbols: make(map[string]*Symbol),
+	}
+	if parent != nil {
+		parent.Children = append(parent.Children, scope)
+	}
+	return scope
+}
+
+func (s *Scope) Lookup(name string) *Symbol {
+	for scope := s; scope != nil; scope = scope.Parent {
+		if symbol, exists := scope.Symbols[name]; exists {
+			return symbol
+		}
+	}
+	return nil
+}
+
+// Innermost returns the deepest scope containing the offset.
+func (s *Scope) Innermost(offset int) *Scope {
+	for _, child := range s.Children {
+		if child.Span.Contains(offset) {
+			return child.Innermost(offset)
+		}
+	}
+	return s
+}
+
+// Visible returns the symbols visible at the offset, sorted by name. Symbols of
+// nested scopes are only visible after their declaration.
+func (s *Scope) Visible(offset int) []*Symbol {
+	seen := make(map[string]bool)
+	result := make([]*Symbol, 0)
+	for scope := s.Innermost(offset); scope != nil; scope = scope.Parent {
+		for name, symbol := range scope.Symbols {
+			if seen[name] {
+				continue
+			}
+			if scope.Parent != nil && symbol.Span.Start.Offset > offset {
+				continue
+			}
+			seen[name] = true
+			result = append(result, symbol)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+func describeVariant(variant types.Variant) string {
+	if len(variant.Fields) == 0 {
+		return variant.Name
+	}
+	str := variant.Name + "("
+	for i, field := range variant.Fields {
+		if i > 0 {
+			str += ", "
+		}
+		str += field.String()
+	}
+	return str + ")"
+}
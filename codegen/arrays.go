@@ -0,0 +1,131 @@
+package codegen
+
+import (
+	"math"
+
+	"github.com/LaH-DeV/veles/ast"
+	"github.com/LaH-DeV/veles/ir"
+	"github.com/LaH-DeV/veles/types"
+)
+
+// A failed bounds check calls a function that traps, rather than trapping in
+// place. WebAssembly traps carry no message, but hosts report the functions on
+// the stack of a trap, so the name of the function tells why the program
+// stopped.
+func (g *generator) outOfBounds() {
+	f := ir.NewFunction("__index_out_of_bounds", nil)
+	ir.NewBuilder(f).Terminate(&ir.Unreachable{})
+	g.ir.Functions = append(g.ir.Functions, f)
+}
+
+// arrayLiteral allocates an array and stores its elements, then returns its
+// address.
+func (g *generator) arrayLiteral(expr *ast.ArrayLiteralExpr, array *types.Array) ir.Value {
+	size, _ := sizeOf(array.Elem)
+	address := g.alloc(size * array.Len)
+	for i, element := range expr.Elements {
+		g.storeValue(address, i*size, array.Elem, g.exprAs(element, array.Elem))
+	}
+	return address
+}
+
+// element returns an address and the offset of an element from it: the
+// element of an array stored inside a struct or another array is addressed
+// from the outermost value, like a field. Unless bounds checks are off, an
+// index outside of the array or the slice traps.
+func (g *generator) element(expr *ast.IndexExpr) (ir.Value, int) {
+	size, _ := sizeOf(g.module.Info.Types[expr])
+	var address, length ir.Value
+	offset := 0
+	switch object := g.module.Info.Types[expr.Object].(type) {
+	case *types.Array:
+		if index, ok := constantIndex(expr.Index); ok && index < object.Len {
+			// the checker rejected constant indices out of range
+			address, offset = g.locate(expr.Object)
+			return address, offset + index*size
+		}
+		address, offset = g.locate(expr.Object)
+		length = ir.Int(ir.I32, int64(object.Len))
+	case *types.Slice:
+		values := g.expr(expr.Object)
+		address, length = values[0], values[1]
+	}
+
+	var index ir.Value
+	if g.options.NoBoundsChecks {
+		index = g.exprAs(expr.Index, types.I32)[0]
+	} else {
+		index = g.boundsCheck(expr.Index, length)
+	}
+	if size != 1 {
+		index = g.b.Op(ir.Mul, ir.I32, index, ir.Int(ir.I32, int64(size)))
+	}
+	return g.b.Op(ir.Add, ir.I32, address, index), offset
+}
+
+// boundsCheck returns an index as an i32 after checking that it is less than
+// length. Negative indices are large unsigned numbers, so a single unsigned
+// comparison rejects them too. A 64-bit index is compared before it is
+// wrapped.
+func (g *generator) boundsCheck(expr ast.Expr, length ir.Value) ir.Value {
+	g.bounds = true
+	t := g.module.Info.Types[expr]
+	wide := valueType(t) == ir.I64
+	if !wide {
+		t = types.I32
+	}
+	index := g.exprAs(expr, t)[0]
+	if wide {
+		length = g.b.Op(ir.ExtendI32U, ir.I64, length)
+	}
+	fail, ok := new(ir.Block), new(ir.Block)
+	g.b.Terminate(&ir.Branch{Cond: g.b.Op(ir.GeU, index.Type, index, length), Then: fail, Else: ok})
+	g.b.Place(fail)
+	g.b.Call("__index_out_of_bounds", nil)
+	g.b.Terminate(&ir.Unreachable{})
+	g.b.Place(ok)
+	if wide {
+		index = g.b.Op(ir.WrapI64, ir.I32, index)
+	}
+	return index
+}
+
+// length returns the length of an array, a slice or a string. The length of
+// an array is part of its type, so the array is only evaluated for its
+// effects.
+func (g *generator) length(expr ast.Expr) ir.Value {
+	if array, ok := g.module.Info.Types[expr].(*types.Array); ok {
+		switch expr.(type) {
+		case *ast.SymbolExpr, *ast.MemberExpr:
+		default:
+			g.expr(expr)
+		}
+		return ir.Int(ir.I32, int64(array.Len))
+	}
+	return g.expr(expr)[1]
+}
+
+// constantSlice places the elements of a constant slice in the data segment
+// and returns their address and number.
+func (g *generator) constantSlice(expr ast.Expr, slice *types.Slice) (int, int, bool) {
+	literal, ok := expr.(*ast.ArrayLiteralExpr)
+	if !ok {
+		return 0, 0, false
+	}
+	array := &types.Array{Elem: slice.Elem, Len: len(literal.Elements)}
+	size, align := sizeOf(array)
+	buf := make([]byte, size)
+	if !g.encode(buf, 0, expr, array) {
+		return 0, 0, false
+	}
+	return g.place(buf, align), array.Len, true
+}
+
+// constantIndex returns the value of an index written as a literal.
+func constantIndex(expr ast.Expr) (int, bool) {
+	literal, ok := expr.(*ast.IntegerExpr)
+	if !ok || literal.Value > math.MaxInt32 {
+		return 0, false
+	}
+	return int(literal.Value), true
+}
@@ -0,0 +1,60 @@
+package codegen
+
+import (
+	"github.com/LaH-DeV/veles/ast"
+	"github.com/LaH-DeV/veles/ir"
+	"github.com/LaH-DeV/veles/types"
+)
+
+// block lowers the statements of a block. The last one produces the value of
+// the block when it has one.
+func (g *generator) block(expr *ast.BlockExpr, t types.Type) []ir.Value {
+	body := expr.Body
+	if t == types.Void {
+		g.stmts(body)
+		return nil
+	}
+	g.stmts(body[:len(body)-1])
+	return g.exprAs(body[len(body)-1].(*ast.ExpressionStmt).Expression, t)
+}
+
+// ifExpr lowers an if. The branches of an if producing a value assign it to
+// the same locals, read after they join.
+func (g *generator) ifExpr(expr *ast.IfExpr, t types.Type) []ir.Value {
+	cond := g.exprAs(expr.Condition, types.Bool)[0]
+	results := g.temps(t)
+	then, join := new(ir.Block), new(ir.Block)
+	if expr.Else == nil {
+		g.b.Terminate(&ir.Branch{Cond: cond, Then: then, Else: join})
+		g.b.Place(then)
+		g.branch(expr.Then, t, results, join)
+	} else {
+		els := new(ir.Block)
+		g.b.Terminate(&ir.Branch{Cond: cond, Then: then, Else: els})
+		g.b.Place(then)
+		g.branch(expr.Then, t, results, join)
+		g.b.Place(els)
+		g.branch(expr.Else, t, results, join)
+	}
+	g.b.Place(join)
+	return uses(results)
+}
+
+// branch lowers a branch of an if or a match producing a value of type t into
+// results, and continues with join. A branch that returns from the function
+// produces no value and never reaches join.
+func (g *generator) branch(expr ast.Expr, t types.Type, results []*ir.Local, join *ir.Block) {
+	if t != types.Void && g.module.Info.Types[expr] == types.Void {
+		g.expr(expr)
+		if !g.b.Terminated() {
+			g.b.Terminate(&ir.Unreachable{})
+		}
+		return
+	}
+	values := g.exprAs(expr, t)
+	if g.b.Terminated() {
+		return
+	}
+	g.assign(results, values)
+	g.b.Jump(join)
+}
@@ -0,0 +1,158 @@
+package codegen
+
+import (
+	"github.com/LaH-DeV/veles/checker"
+	"github.com/LaH-DeV/veles/diagnostics"
+	"github.com/LaH-DeV/veles/ir"
+	"github.com/LaH-DeV/veles/opt"
+	"github.com/LaH-DeV/veles/source"
+	"github.com/LaH-DeV/veles/types"
+)
+
+// Program is the input of the backends: every module of a checked program and
+// the entry module, whose pub functions become the exports of the output.
+type Program struct {
+	Entry   *checker.Module
+	Modules []*checker.Module
+}
+
+// Options control the code the backends generate.
+type Options struct {
+	// NoBoundsChecks omits the checks of array and slice indices, which trap
+	// when an index is out of range. Release builds of programs that are known
+	// to index correctly can leave them out.
+	NoBoundsChecks bool
+
+	// Optimize selects the optimizations run over the IR.
+	Optimize opt.Options
+}
+
+// Diagnostics maps modules to the problems the backend found in them.
+type Diagnostics map[*checker.Module][]diagnostics.Diagnostic
+
+func (d Diagnostics) errorf(module *checker.Module, code *diagnostics.Code, span source.Span, format string, args ...any) {
+	d[module] = append(d[module], diagnostics.Errorf(code, span, format, args...))
+}
+
+func (d Diagnostics) HasErrors() bool {
+	for _, diags := range d {
+		if diagnostics.HasErrors(diags) {
+			return true
+		}
+	}
+	return false
+}
+
+// qualifiedName is the name of a top-level symbol in the generated module.
+// Every module is compiled into the same WebAssembly module, so names are
+// prefixed with the module path.
+func qualifiedName(symbol *checker.Symbol) string {
+	return symbol.Module.Name + "::" + symbol.Name
+}
+
+// valueTypes returns the WebAssembly values representing a value of type t.
+// Strings and slices are passed as a pointer into linear memory followed by a
+// length.
+func valueTypes(t types.Type) []ir.Type {
+	if t == types.Void {
+		return nil
+	}
+	if isPair(t) {
+		return []ir.Type{ir.I32, ir.I32}
+	}
+	return []ir.Type{valueType(t)}
+}
+
+// parts names the WebAssembly values of a variable of type t called name.
+func parts(name string, t types.Type) []string {
+	if isPair(t) {
+		return []string{name + ".ptr", name + ".len"}
+	}
+	return []string{name}
+}
+
+// isPair reports whether values of type t are a pointer and a length.
+func isPair(t types.Type) bool {
+	return t == types.Str || types.IsSlice(t)
+}
+
+// inMemory reports whether values of type t live in linear memory and are
+// represented by their address. Such values are copied when they are assigned.
+func inMemory(t types.Type) bool {
+	return types.IsStruct(t) || types.IsArray(t)
+}
+
+// valueType returns the WebAssembly value type representing a scalar type t.
+func valueType(t types.Type) ir.Type {
+	switch t {
+	case types.I64, types.U64:
+		return ir.I64
+	case types.F32:
+		return ir.F32
+	case types.F64:
+		return ir.F64
+	default:
+		return ir.I32
+	}
+}
+
+// Integers of 8, 16 and 32 bits are i32 values and 64-bit integers are i64
+// values. An i32 holding an i8 or an i16 is always sign-extended and one
+// holding a u8 or a u16 zero-extended, so operations that may leave other
+// bits set are followed by normalize.
+
+// convert converts a value of type from into type to. Narrower integers are
+// wrapped, and wider ones sign-extended from signed types and zero-extended
+// from unsigned ones. Floats are truncated towards zero into integers,
+// saturating at the limits of i32, u32, i64 or u64 with NaN converting to 0,
+// and wrapped from there into narrower integers. Integers and wider floats
+// are rounded to the nearest float.
+func (g *generator) convert(value ir.Value, from, to types.Type) ir.Value {
+	if from == to || !types.IsNumeric(from) || !types.IsNumeric(to) {
+		return value
+	}
+	vt := valueType(to)
+	switch {
+	case types.IsInteger(from) && types.IsInteger(to):
+		switch {
+		case value.Type == ir.I32 && vt == ir.I64:
+			value = g.b.Op(ir.Op("extend_i32_"+sign(from)), ir.I64, value)
+		case value.Type == ir.I64 && vt == ir.I32:
+			value = g.b.Op(ir.WrapI64, ir.I32, value)
+		}
+	case types.IsInteger(from) && types.IsFloat(to):
+		value = g.b.Op(ir.Op("convert_"+value.Type.String()+"_"+sign(from)), vt, value)
+	case types.IsFloat(from) && types.IsInteger(to):
+		value = g.b.Op(ir.Op("trunc_sat_"+value.Type.String()+"_"+sign(to)), vt, value)
+	case from == types.F32 && to == types.F64:
+		value = g.b.Op(ir.PromoteF32, ir.F64, value)
+	default:
+		value = g.b.Op(ir.DemoteF64, ir.F32, value)
+	}
+	return g.normalize(value, to)
+}
+
+// normalize clears or sets the bits of an i32 above the bits of a narrow
+// integer type t.
+func (g *generator) normalize(value ir.Value, t types.Type) ir.Value {
+	switch t {
+	case types.I8:
+		return g.b.Op(ir.Extend8S, ir.I32, value)
+	case types.I16:
+		return g.b.Op(ir.Extend16S, ir.I32, value)
+	case types.U8:
+		return g.b.Op(ir.And, ir.I32, value, ir.Int(ir.I32, 0xff))
+	case types.U16:
+		return g.b.Op(ir.And, ir.I32, value, ir.Int(ir.I32, 0xffff))
+	}
+	return value
+}
+
+// sign returns the suffix of the instructions treating integers of type t as
+// signed or unsigned.
+func sign(t types.Type) string {
+	if types.IsUnsigned(t) {
+		return "u"
+	}
+	return "s"
+}
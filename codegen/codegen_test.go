@@ -0,0 +1,499 @@
+package codegen
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/LaH-DeV/veles/diagnostics"
+	"github.com/LaH-DeV/veles/workspace"
+)
+
+// load checks the modules of a program held in memory, main.vs being the
+// entry module, and fails the test when they have errors.
+func load(t *testing.T, sources map[string]string) *Program {
+	t.Helper()
+	root := filepath.FromSlash("/veles")
+	ws := workspace.New(root)
+	for path, text := range sources {
+		ws.SetOverlay(filepath.Join(root, path), text)
+	}
+	entry, err := ws.Load(filepath.Join(root, "main.vs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	program := &Program{Entry: entry.Module}
+	for _, file := range ws.Files() {
+		if diagnostics.HasErrors(file.Diagnostics) {
+			t.Fatalf("%s: %s", file.Path, file.Diagnostics[0].Message)
+		}
+		program.Modules = append(program.Modules, file.Module)
+	}
+	return program
+}
+
+func TestGenerateWat(t *testing.T) {
+	tests := []struct {
+		name    string
+		sources map[string]string
+		options Options
+		want    []string
+		exclude []string // text the output must not contain
+	}{
+		{
+			name: "exported function",
+			sources: map[string]string{"main.vs": `
+pub fn i32 :: add(i32 a, i32 b) {
+    return a + b
+}`},
+			want: []string{
+				`(func $main::add (param $a i32) (param $b i32) (result i32)`,
+				"local.get $a\n    local.get $b\n    i32.add\n    return",
+				`(export "add" (func $main::add))`,
+			},
+		},
+		{
+			name: "extern function",
+			sources: map[string]string{"main.vs": `
+extern fn :: log(i32 value)
+
+pub fn :: run() {
+    log(7)
+}`},
+			want: []string{
+				`(import "env" "log" (func $main::log (param i32)))`,
+				"i32.const 7\n    call $main::log",
+			},
+		},
+		{
+			name: "extern modules and fields",
+			sources: map[string]string{"main.vs": `
+extern "console" "log" fn :: logFloat(f64 value)
+extern "math" fn f64 :: sqrt(f64 x)
+extern "w\t" "é" fn :: odd()
+
+pub fn :: run() {
+    logFloat(sqrt(2.0))
+    odd()
+}`},
+			want: []string{
+				`(import "console" "log" (func $main::logFloat (param f64)))`,
+				`(import "math" "sqrt" (func $main::sqrt (param f64) (result f64)))`,
+				`(import "w\09" "\c3\a9" (func $main::odd))`,
+			},
+		},
+		{
+			name: "string literals",
+			sources: map[string]string{"main.vs": `
+extern fn :: print(str s)
+
+pub fn :: run() {
+    print("hi\n")
+    print("hi\n")
+    print("")
+    print("ż\u{1F600}")
+}`},
+			want: []string{
+				`(import "env" "print" (func $main::print (param i32) (param i32)))`,
+				"i32.const 0\n    i32.const 3\n    call $main::print\n    i32.const 0\n    i32.const 3\n    call $main::print",
+				"i32.const 3\n    i32.const 0\n    call $main::print",
+				"i32.const 3\n    i32.const 6\n    call $main::print",
+				`(memory (export "memory") 1)`,
+				`(data (i32.const 0) "hi\0a\c5\bc\f0\9f\98\80")`,
+			},
+		},
+		{
+			name: "bitwise operators",
+			sources: map[string]string{"main.vs": `
+pub fn i32 :: f(i32 a, u32 b) {
+    return a >> 1 >>> 2 ^ (b >> 3) as i32 & ~a
+}`},
+			want: []string{
+				"i32.const 1\n    i32.shr_s\n    i32.const 2\n    i32.shr_u",
+				"local.get $b\n    i32.const 3\n    i32.shr_u",
+				"i32.const -1\n    i32.xor\n    i32.and\n    i32.xor",
+			},
+		},
+		{
+			name: "struct layout",
+			sources: map[string]string{"main.vs": `
+struct S { bool flag, f64 value, i32 count }
+
+pub fn f64 :: f() {
+    let mut S s = S { flag: true, value: 2.5, count: 3 }
+    s.count = 4
+    return s.value
+}`},
+			want: []string{
+				"i32.const 24\n    call $__alloc",
+				"i32.const 1\n    i32.store8\n",
+				"f64.const 2.5\n    f64.store offset=8\n",
+				"i32.const 4\n    i32.store offset=16\n",
+				"local.get $s\n    f64.load offset=8\n",
+				"(global $__heap (mut i32) (i32.const 0))",
+			},
+		},
+		{
+			name: "match on an enum",
+			sources: map[string]string{"main.vs": `
+enum Shape { Circle(f32), Empty }
+
+pub fn f32 :: area(f32 r, bool b) {
+    let s = if b { Shape::Circle(r) } else { Shape::Empty }
+    return match s {
+        Shape::Circle(x) => x * x,
+        Shape::Empty => 0.0,
+    }
+}`},
+			want: []string{
+				// variants without values are shared, in the data segment
+				`(data (i32.const 0) "\01\00\00\00")`,
+				"i32.const 8\n      call $__alloc\n      local.tee $tmp.1\n      i32.const 0\n      i32.store",
+				"local.get $r\n      f32.store offset=4",
+				"i32.load\n          br_table $b4 $b5 $b5",
+				"local.get $s\n        f32.load offset=4\n        local.tee $x",
+			},
+		},
+		{
+			name: "bounds checks",
+			sources: map[string]string{"main.vs": `
+pub fn i32 :: get([]i32 xs, i32 i) {
+    return xs[i]
+}`},
+			want: []string{
+				"(func $main::get (param $xs.ptr i32) (param $xs.len i32) (param $i i32) (result i32)",
+				"local.get $i\n    local.get $xs.len\n    i32.ge_u\n    if\n      call $__index_out_of_bounds\n      unreachable\n    end",
+				"i32.const 4\n    i32.mul",
+				"i32.add\n    i32.load\n",
+				"(func $__index_out_of_bounds\n    unreachable\n  )",
+			},
+		},
+		{
+			name: "no bounds checks",
+			sources: map[string]string{"main.vs": `
+pub fn i32 :: get([]i32 xs, i32 i) {
+    return xs[i]
+}`},
+			options: Options{NoBoundsChecks: true},
+			want:    []string{"i32.add\n    i32.load\n"},
+			exclude: []string{"i32.ge_u", "$__index_out_of_bounds"},
+		},
+		{
+			name: "function values",
+			sources: map[string]string{"main.vs": `
+fn i32 :: add(i32 a, i32 b) {
+    return a + b
+}
+
+pub fn i32 :: apply(fn(i32, i32) -> i32 f, i32 x) {
+    return f(x, x)
+}
+
+pub fn i32 :: run() {
+    return apply(add, 2)
+}`},
+			want: []string{
+				"local.get $f\n    i32.load\n    local.set $tmp\n    local.get $f\n    local.get $x\n    local.get $x\n    local.get $tmp\n    call_indirect (param i32) (param i32) (param i32) (result i32)",
+				"(func $main::add.ref (param $env i32) (param $a i32) (param $b i32) (result i32)",
+				"(table $__functions 1 funcref)",
+				"(elem (i32.const 0) func $main::add.ref)",
+				// the constant closure of add holds its table index
+				`(data (i32.const 0) "\00\00\00\00")`,
+				"i32.const 0\n    i32.const 2\n    call $main::apply",
+			},
+		},
+		{
+			name: "closures",
+			sources: map[string]string{"main.vs": `
+pub fn fn(i32) -> i32 :: adder(i32 offset) {
+    return fn(i32 x) -> i32 { return x + offset }
+}`},
+			want: []string{
+				// the closure is the table index followed by the captured offset
+				"i32.const 8\n    call $__alloc\n    local.tee $tmp\n    i32.const 0\n    i32.store\n    local.get $tmp\n    local.get $offset\n    i32.store offset=4",
+				"(func $main::adder.fn0 (param $env i32) (param $x i32) (result i32)",
+				"local.get $env\n    i32.load offset=4\n    local.set $offset",
+				"(elem (i32.const 0) func $main::adder.fn0)",
+			},
+		},
+		{
+			name: "if and blocks",
+			sources: map[string]string{"main.vs": `
+pub fn i32 :: sign(i32 x) {
+    return if x > 0 { 1 } else if x < 0 { -1 } else { 0 }
+}
+
+pub fn i32 :: area(i32 width) {
+    return {
+        let i32 w = width + 2
+        w * w
+    }
+}
+
+pub fn i32 :: clamp(i32 x) {
+    let mut i32 y = x
+    if y > 10 {
+        y = 10
+    }
+    return y
+}`},
+			want: []string{
+				"i32.gt_s\n    if (result i32)\n      i32.const 1\n    else",
+				"i32.lt_s\n      if (result i32)\n        i32.const -1\n      else\n        i32.const 0\n      end\n    end\n    return",
+				"i32.add\n    local.tee $w\n    local.get $w\n    i32.mul\n    return",
+				// an if statement produces no value
+				"i32.gt_s\n    if\n      i32.const 10\n      local.set $y\n    end",
+			},
+			exclude: []string{"local.set $tmp"},
+		},
+		{
+			name: "unsigned and narrow integers",
+			sources: map[string]string{"main.vs": `
+pub fn bool :: lt(u32 a, u32 b) {
+    return a < b
+}
+
+pub fn u64 :: div(u64 a, u64 b) {
+    return a / b % 3
+}
+
+pub fn i8 :: add(i8 a, i8 b) {
+    return a + b
+}
+
+pub fn u16 :: mul(u16 a, u16 b) {
+    return a * b
+}
+
+pub fn u32 :: shr(u32 a) {
+    return a >> 2
+}`},
+			want: []string{
+				"i32.lt_u",
+				"i64.div_u\n    i64.const 3\n    i64.rem_u",
+				// narrow results wrap into their type
+				"i32.add\n    i32.extend8_s",
+				"i32.mul\n    i32.const 65535\n    i32.and",
+				"i32.const 2\n    i32.shr_u",
+			},
+			exclude: []string{"i32.lt_s", "i64.div_s", "i64.rem_s", "i32.shr_s"},
+		},
+		{
+			name: "zero values",
+			sources: map[string]string{"main.vs": `
+struct P { i32 x, f64 y }
+
+pub fn f64 :: f() {
+    let mut P p
+    let [2]i32 xs
+    p.x = xs[1]
+    return p.y
+}
+
+pub fn i32 :: h() {
+    let fn(i32) -> i32 g
+    return g(1)
+}`},
+			want: []string{
+				// zeroed structs and arrays are allocated, the heap is zero
+				"i32.const 16\n    call $__alloc\n    local.set $p",
+				"i32.const 8\n    call $__alloc",
+				// the zero function value is a closure with an index out of the table
+				"i32.const 0\n    local.tee $g\n    i32.load",
+				"(table $__functions 0 funcref)",
+				`(data (i32.const 0) "\ff\ff\ff\ff")`,
+			},
+		},
+		{
+			name: "constant globals",
+			sources: map[string]string{"main.vs": `
+pub let f32 PI = 3.14159265358979323846
+pub let f32 TAU = PI * 2.0
+let i32 BIG = 2 ** 20
+pub let mut bool ready = !false`},
+			want: []string{
+				"(global $main::PI f32 (f32.const 3.1415927))",
+				"(global $main::TAU f32 (f32.const 6.2831855))",
+				"(global $main::BIG i32 (i32.const 1048576))",
+				"(global $main::ready (mut i32) (i32.const 1))",
+				`(export "PI" (global $main::PI))`,
+				`(export "ready" (global $main::ready))`,
+			},
+			exclude: []string{`(export "BIG"`, "__start", "__pow_"},
+		},
+		{
+			name: "start function",
+			sources: map[string]string{
+				"main.vs": `
+use geometry
+
+let mut i32 seen = geometry::ORIGIN + 1
+pub let i32 COUNT = 3 * 4`,
+				"geometry.vs": `
+use math
+
+fn i32 :: one() {
+    return 1
+}
+
+pub let i32 ORIGIN = one() + math::BIG
+let i32 LATER = ORIGIN * 2`,
+				"math.vs": `
+pub let i32 BIG = 2 ** 20`,
+			},
+			want: []string{
+				"(global $math::BIG i32 (i32.const 1048576))",
+				"(global $geometry::ORIGIN (mut i32) (i32.const 0))",
+				"(global $main::seen (mut i32) (i32.const 0))",
+				"(global $main::COUNT i32 (i32.const 12))",
+				"call $geometry::one\n    global.get $math::BIG\n    i32.add\n    global.set $geometry::ORIGIN\n" +
+					"    global.get $geometry::ORIGIN\n    i32.const 2\n    i32.mul\n    global.set $geometry::LATER\n" +
+					"    global.get $geometry::ORIGIN\n    i32.const 1\n    i32.add\n    global.set $main::seen\n    return",
+				"(start $__start)",
+			},
+			exclude: []string{`(export "ORIGIN"`},
+		},
+		{
+			name: "float arithmetic",
+			sources: map[string]string{"main.vs": `
+pub fn f64 :: half(f64 x) {
+    return x / 2.0
+}`},
+			want: []string{
+				`(func $main::half (param $x f64) (result f64)`,
+				"f64.const 2\n    f64.div",
+			},
+		},
+		{
+			name: "imported module",
+			sources: map[string]string{
+				"main.vs": `
+use math
+
+pub fn i32 :: run() {
+    return math::twice(4)
+}`,
+				"math.vs": `
+pub fn i32 :: twice(i32 x) {
+    return x * 2
+}`,
+			},
+			want: []string{
+				`(func $math::twice (param $x i32) (result i32)`,
+				"call $math::twice",
+				`(export "run" (func $main::run))`,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			wat, problems := GenerateWat(load(t, test.sources), test.options)
+			if problems.HasErrors() {
+				t.Fatalf("unexpected errors: %v", problems)
+			}
+			for _, want := range test.want {
+				if !strings.Contains(wat, want) {
+					t.Errorf("output does not contain %q:\n%s", want, wat)
+				}
+			}
+			for _, exclude := range test.exclude {
+				if strings.Contains(wat, exclude) {
+					t.Errorf("output contains %q:\n%s", exclude, wat)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateWatErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		code   *diagnostics.Code
+	}{
+		{"variant with values as a value", "enum Shape { Circle(f32), Empty }\n\nfn :: f() {\n    let s = Shape::Circle\n}", diagnostics.UnsupportedByBackend},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			program := load(t, map[string]string{"main.vs": test.source})
+			_, problems := GenerateWat(program, Options{})
+			found := problems[program.Entry]
+			if len(found) == 0 || found[0].Code != test.code {
+				t.Errorf("got %v, want %s", found, test.code.ID)
+			}
+		})
+	}
+}
+
+func TestConversions(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     string // the instructions converting the parameter x
+	}{
+		{"f64", "i32", "i32.trunc_sat_f64_s"},
+		{"f32", "u64", "i64.trunc_sat_f32_u"},
+		{"f64", "u8", "i32.trunc_sat_f64_u\n    i32.const 255\n    i32.and"},
+		{"i64", "i8", "i32.wrap_i64\n    i32.extend8_s"},
+		{"i32", "u16", "i32.const 65535\n    i32.and"},
+		{"u32", "u64", "i64.extend_i32_u"},
+		{"i32", "i64", "i64.extend_i32_s"},
+		{"u32", "f32", "f32.convert_i32_u"},
+		{"i64", "f64", "f64.convert_i64_s"},
+		{"f64", "f32", "f32.demote_f64"},
+		{"f32", "f64", "f64.promote_f32"},
+		{"u8", "i32", "return"}, // u8 values are kept zero-extended
+	}
+	for _, test := range tests {
+		t.Run(test.from+" as "+test.to, func(t *testing.T) {
+			src := "pub fn " + test.to + " :: f(" + test.from + " x) {\n    return x as " + test.to + "\n}"
+			wat, problems := GenerateWat(load(t, map[string]string{"main.vs": src}), Options{})
+			if problems.HasErrors() {
+				t.Fatalf("unexpected errors: %v", problems)
+			}
+			if !strings.Contains(wat, "local.get $x\n    "+test.want) {
+				t.Errorf("output does not convert with %q:\n%s", test.want, wat)
+			}
+		})
+	}
+}
+
+func TestPow(t *testing.T) {
+	tests := []struct {
+		name    string
+		t, expr string
+		want    string   // the instructions computing the power
+		runtime []string // the pow functions added to the module
+	}{
+		{"constants", "i32", "2 ** 10", "i32.const 1024\n    return", nil},
+		{"zero exponent", "i32", "x ** 0", "i32.const 1\n    return", nil},
+		{"small exponent", "i32", "x ** 3", "local.get $x\n    local.get $x\n    i32.mul\n    local.set $tmp\n    local.get $x\n    local.get $tmp\n    i32.mul", nil},
+		{"narrow result", "u8", "x ** 3", "i32.mul\n    i32.const 255\n    i32.and", nil},
+		{"large exponent", "i32", "x ** 65", "i32.const 65\n    call $__pow_i32", []string{"__pow_i32", "__pow_u32"}},
+		{"signed", "i64", "x ** y", "local.get $y\n    call $__pow_i64", []string{"__pow_i64", "__pow_u64"}},
+		{"unsigned", "u32", "x ** y", "local.get $y\n    call $__pow_u32", []string{"__pow_u32"}},
+		{"negative exponent", "i32", "2 ** -1", "i32.const 0\n    return", nil},
+		{"negative exponent of -1", "i32", "(-1) ** -3", "i32.const -1\n    return", nil},
+		{"negative exponent of 0", "i32", "0 ** -1", "i32.const 0\n    i32.const -1\n    call $__pow_i32", []string{"__pow_i32", "__pow_u32"}},
+		{"float constants", "f64", "2.0 ** 0.5", "f64.const 1.4142135623730951\n    return", nil},
+		{"float", "f64", "x ** y", "local.get $y\n    call $__pow_f64", []string{"__pow_f64"}},
+		{"f32 as f64", "f32", "x ** y", "f64.promote_f32\n    local.get $y\n    f64.promote_f32\n    call $__pow_f64\n    f32.demote_f64", []string{"__pow_f64"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			src := "pub fn " + test.t + " :: f(" + test.t + " x, " + test.t + " y) {\n    return " + test.expr + "\n}"
+			wat, problems := GenerateWat(load(t, map[string]string{"main.vs": src}), Options{})
+			if problems.HasErrors() {
+				t.Fatalf("unexpected errors: %v", problems)
+			}
+			if !strings.Contains(wat, test.want) {
+				t.Errorf("output does not compute the power with %q:\n%s", test.want, wat)
+			}
+			for _, name := range []string{"__pow_i32", "__pow_i64", "__pow_u32", "__pow_u64", "__pow_f64"} {
+				if defined := strings.Contains(wat, "(func $"+name+" "); defined != slices.Contains(test.runtime, name) {
+					t.Errorf("$%s defined: %v\n%s", name, defined, wat)
+				}
+			}
+		})
+	}
+}
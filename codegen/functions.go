@@ -0,0 +1,156 @@
+package codegen
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/LaH-DeV/veles/ast"
+	"github.com/LaH-DeV/veles/checker"
+	"github.com/LaH-DeV/veles/ir"
+	"github.com/LaH-DeV/veles/types"
+)
+
+// A function value is the address of a closure: an object in linear memory
+// holding the index of a function in the table of functions used as values,
+// followed by the variables the function captured, laid out like the fields of
+// a struct. Functions in the table take the address of their closure as their
+// first parameter.
+//
+// Function expressions are lowered to separate functions after the function
+// containing them, and their closures are allocated when they are evaluated.
+// Declared functions used as values get a constant closure and a wrapper in
+// the table, which ignores the closure and calls them. Calls through function
+// values use call_indirect, which traps when the function in the table does
+// not have the signature the caller expects.
+
+// lambda is a function expression waiting to be lowered.
+type lambda struct {
+	name string
+	expr *ast.FunctionExpr
+}
+
+// slot returns the index of a function in the table, adding it on first use.
+func (g *generator) slot(name string) int {
+	if i, ok := g.slots[name]; ok {
+		return i
+	}
+	g.slots[name] = len(g.ir.Table)
+	g.ir.Table = append(g.ir.Table, name)
+	return g.slots[name]
+}
+
+// reference returns the address of the closure of a declared function.
+func (g *generator) reference(symbol *checker.Symbol) int {
+	if address, ok := g.refs[symbol]; ok {
+		return address
+	}
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf, uint32(g.slot(qualifiedName(symbol)+".ref")))
+	address := g.place(buf, 4)
+	g.refs[symbol] = address
+	g.wrapped = append(g.wrapped, symbol)
+	return address
+}
+
+// functionConstant returns the value of a constant expression of a function
+// type: a declared function, or a function expression capturing nothing.
+func (g *generator) functionConstant(expr ast.Expr) (int, bool) {
+	if fn, ok := expr.(*ast.FunctionExpr); ok {
+		if len(g.module.Info.Captures[fn]) > 0 {
+			return 0, false
+		}
+		buf := make([]byte, 4)
+		binary.LittleEndian.PutUint32(buf, uint32(g.slot(g.lambda(fn))))
+		return g.place(buf, 4), true
+	}
+	symbol := g.module.Info.Uses[expr]
+	if symbol == nil || (symbol.Kind != checker.FunctionSymbol && symbol.Kind != checker.ExternSymbol) {
+		return 0, false
+	}
+	return g.reference(symbol), true
+}
+
+// lambda names a function expression and queues it to be lowered.
+func (g *generator) lambda(expr *ast.FunctionExpr) string {
+	name := fmt.Sprintf("%s.fn%d", g.context, g.lambdaCount)
+	g.lambdaCount++
+	g.pending = append(g.pending, lambda{name, expr})
+	return name
+}
+
+// captureLayout returns the offsets of the captured variables in a closure and
+// the size of the closure.
+func captureLayout(captures []*checker.Symbol) (offsets []int, size int) {
+	captureTypes := make([]types.Type, len(captures))
+	for i, symbol := range captures {
+		captureTypes[i] = symbol.Type
+	}
+	offsets, size, _ = layout(captureTypes, 4)
+	return offsets, size
+}
+
+// closure allocates the closure of a function expression, copying the values
+// of the variables it captures, and returns its address.
+func (g *generator) closure(expr *ast.FunctionExpr) ir.Value {
+	captures := g.module.Info.Captures[expr]
+	offsets, size := captureLayout(captures)
+	address := g.alloc(size)
+	g.b.Store(ir.Store, address, ir.Int(ir.I32, int64(g.slot(g.lambda(expr)))), 0)
+	for i, symbol := range captures {
+		g.storeValue(address, offsets[i], symbol.Type, uses(g.locals[symbol]))
+	}
+	return address
+}
+
+// loadCaptures declares locals for the variables captured by a function
+// expression and loads their values from the closure held by env.
+func (g *generator) loadCaptures(env *ir.Local, captures []*checker.Symbol) {
+	offsets, _ := captureLayout(captures)
+	for i, symbol := range captures {
+		locals := g.declare(symbol, symbol.Name, symbol.Type)
+		g.assign(locals, g.loadValue(ir.Use(env), offsets[i], symbol.Type))
+	}
+}
+
+// lambdas lowers the queued function expressions, and the function
+// expressions they contain.
+func (g *generator) lambdas() {
+	for len(g.pending) > 0 {
+		next := g.pending[0]
+		g.pending = g.pending[1:]
+		sig := g.module.Info.Types[next.expr].(*types.Signature)
+		g.function(next.name, next.expr.Params, sig, next.expr.Body, g.module.Info.Captures[next.expr], true)
+	}
+}
+
+// wrappers creates the functions through which declared functions are called
+// as values.
+func (g *generator) wrappers() {
+	for _, symbol := range g.wrapped {
+		sig := symbol.Type.(*types.Signature)
+		f := ir.NewFunction(qualifiedName(symbol)+".ref", valueTypes(sig.Result))
+		f.NewParam("env", ir.I32)
+		var args []ir.Value
+		for i, param := range sig.Params {
+			name := "arg"
+			if i < len(sig.ParamNames) {
+				name = sig.ParamNames[i]
+			}
+			for j, part := range parts(name, param) {
+				args = append(args, ir.Use(f.NewParam(part, valueTypes(param)[j])))
+			}
+		}
+		b := ir.NewBuilder(f)
+		b.Terminate(&ir.Return{Values: b.Call(qualifiedName(symbol), f.Results, args...)})
+		g.ir.Functions = append(g.ir.Functions, f)
+	}
+}
+
+// indirectCall calls the function value of the callee of expr, passing its
+// closure first.
+func (g *generator) indirectCall(expr *ast.CallExpr, sig *types.Signature) []ir.Value {
+	closure := g.expr(expr.Callee)[0]
+	args := append([]ir.Value{closure}, g.arguments(expr.Arguments, sig)...)
+	index := g.b.Load(ir.Load, ir.I32, closure, 0)
+	return g.b.CallIndirect(signature(sig, true), index, args...)
+}
@@ -0,0 +1,121 @@
+package codegen
+
+import (
+	"github.com/LaH-DeV/veles/ir"
+	"github.com/LaH-DeV/veles/types"
+)
+
+// Structs live in linear memory and are represented by the address of their
+// first byte. Fields are laid out in declaration order, each aligned to its
+// natural alignment, and nested structs are stored inline.
+//
+// Plain enums are represented by the i32 tag of their variant. Values of
+// tagged unions are immutable objects in linear memory, referred to by their
+// address: the i32 tag of the variant followed by the values it carries, laid
+// out like the fields of a struct.
+//
+// Arrays live in linear memory like structs, their elements one after the
+// other. A slice is a pointer to its first element and a length, like a
+// string, and refers to elements stored elsewhere.
+//
+// Function values are the addresses of closures, which hold the i32 index of
+// a function in the table followed by the captured values, laid out like the
+// values of a variant.
+
+// sizeOf returns the number of bytes a value of type t occupies in linear memory
+// and the alignment of its address.
+func sizeOf(t types.Type) (size int, align int) {
+	switch t {
+	case types.Bool, types.I8, types.U8:
+		return 1, 1
+	case types.I16, types.U16:
+		return 2, 2
+	case types.I32, types.U32, types.F32:
+		return 4, 4
+	case types.I64, types.U64, types.F64:
+		return 8, 8
+	case types.Str:
+		return 8, 4
+	}
+	switch t := t.(type) {
+	case *types.Array:
+		size, align := sizeOf(t.Elem)
+		return size * t.Len, align
+	case *types.Slice:
+		return 8, 4
+	}
+	st, ok := t.(*types.Struct)
+	if !ok {
+		return 4, 4
+	}
+	fieldTypes := make([]types.Type, len(st.Fields))
+	for i, field := range st.Fields {
+		fieldTypes[i] = field.Type
+	}
+	_, size, align = layout(fieldTypes, 0)
+	return size, align
+}
+
+// layout places values of the given types one after the other from start,
+// each at an offset aligned to its alignment. It returns the offsets, the size
+// of the whole rounded up to its alignment, and the alignment.
+func layout(fields []types.Type, start int) (offsets []int, size int, align int) {
+	offsets = make([]int, len(fields))
+	size, align = start, 1
+	for i, field := range fields {
+		fieldSize, fieldAlign := sizeOf(field)
+		size = alignTo(size, fieldAlign)
+		offsets[i] = size
+		size += fieldSize
+		align = max(align, fieldAlign)
+	}
+	return offsets, alignTo(size, align), align
+}
+
+// offsets returns the offset of every field of a struct from its address.
+func offsets(st *types.Struct) []int {
+	fieldTypes := make([]types.Type, len(st.Fields))
+	for i, field := range st.Fields {
+		fieldTypes[i] = field.Type
+	}
+	result, _, _ := layout(fieldTypes, 0)
+	return result
+}
+
+// variantLayout returns the offsets of the values carried by a variant of a
+// tagged union, which follow the tag, and the size of the variant.
+func variantLayout(variant types.Variant) (offsets []int, size int) {
+	offsets, size, _ = layout(variant.Fields, 4)
+	return offsets, size
+}
+
+func alignTo(offset int, align int) int {
+	return (offset + align - 1) / align * align
+}
+
+// loadOp returns the operation loading a scalar of type t from memory.
+// Narrow integers are extended like their values are kept in an i32.
+func loadOp(t types.Type) ir.Op {
+	switch t {
+	case types.Bool, types.U8:
+		return ir.Load8U
+	case types.I8:
+		return ir.Load8S
+	case types.U16:
+		return ir.Load16U
+	case types.I16:
+		return ir.Load16S
+	}
+	return ir.Load
+}
+
+// storeOp returns the operation storing a scalar of type t into memory.
+func storeOp(t types.Type) ir.Op {
+	switch t {
+	case types.Bool, types.I8, types.U8:
+		return ir.Store8
+	case types.I16, types.U16:
+		return ir.Store16
+	}
+	return ir.Store
+}
@@ -0,0 +1,731 @@
+package codegen
+
+import (
+	"github.com/LaH-DeV/veles/ast"
+	"github.com/LaH-DeV/veles/checker"
+	"github.com/LaH-DeV/veles/diagnostics"
+	"github.com/LaH-DeV/veles/ir"
+	"github.com/LaH-DeV/veles/lexer"
+	"github.com/LaH-DeV/veles/types"
+)
+
+// Lower translates a checked program into a module of the IR, which the
+// backends generate code from.
+func Lower(program *Program, options Options) (*ir.Module, Diagnostics) {
+	g := &generator{
+		program:     program,
+		options:     options,
+		diagnostics: Diagnostics{},
+		ir:          &ir.Module{},
+		strings:     map[string]int{},
+		units:       map[unit]int{},
+		zeros:       map[*types.Enum]int{},
+		nilFunction: -1,
+		slots:       map[string]int{},
+		refs:        map[*checker.Symbol]int{},
+		pows:        map[string]bool{},
+	}
+	g.lower()
+	return g.ir, g.diagnostics
+}
+
+type generator struct {
+	program     *Program
+	options     Options
+	ir          *ir.Module
+	diagnostics Diagnostics
+
+	// the modules in dependency order, and the state of the module being
+	// lowered
+	modules []*checker.Module
+	module  *checker.Module
+
+	// state of the function being lowered
+	b      *ir.Builder
+	result types.Type
+	locals map[*checker.Symbol][]*ir.Local
+
+	// string literals and constant structs, placed in a data segment at the
+	// start of linear memory
+	data    []byte
+	strings map[string]int
+	units   map[unit]int
+
+	// the zero values of tagged unions, and the closure of zero function
+	// values or -1 before it is placed
+	zeros       map[*types.Enum]int
+	nilFunction int
+
+	// the indices of the functions in the table, the closures of declared
+	// functions and the function expressions waiting to be lowered
+	slots       map[string]int
+	refs        map[*checker.Symbol]int
+	wrapped     []*checker.Symbol
+	pending     []lambda
+	context     string // the name of the declaration containing the function expressions
+	lambdaCount int
+
+	// the initializers of global variables run by the start function
+	initializers []initializer
+
+	heap   bool            // whether the allocator is used
+	bounds bool            // whether a bounds check is lowered
+	pows   map[string]bool // the runtime functions raising to powers that are called
+}
+
+func (g *generator) lower() {
+	g.modules = g.ordered()
+	g.each(g.imports)
+	g.each(g.globals)
+	g.each(g.functions)
+	g.start()
+	g.wrappers()
+	if g.bounds {
+		g.outOfBounds()
+	}
+	g.exports()
+	if g.heap {
+		g.allocator()
+	}
+	g.powFunctions()
+	g.ir.Data = g.data
+}
+
+// each calls f with every top-level statement of every module, in dependency
+// order.
+func (g *generator) each(f func(ast.Stmt)) {
+	for _, module := range g.modules {
+		g.module = module
+		for _, stmt := range module.Program.Statements {
+			f(stmt)
+		}
+	}
+	g.module = nil
+}
+
+func (g *generator) errorf(code *diagnostics.Code, node ast.Node, format string, args ...any) {
+	g.diagnostics.errorf(g.module, code, node.Location(), format, args...)
+}
+
+func (g *generator) imports(stmt ast.Stmt) {
+	extern, ok := stmt.(*ast.ExternStmt)
+	if !ok {
+		return
+	}
+	symbol := g.module.Info.Defs[extern.Statement]
+	if symbol == nil {
+		return
+	}
+	module, field := extern.Import()
+	g.ir.Imports = append(g.ir.Imports, &ir.Import{
+		Name:   qualifiedName(symbol),
+		Module: module,
+		Field:  field,
+		Sig:    signature(symbol.Type.(*types.Signature), false),
+	})
+}
+
+func (g *generator) globals(stmt ast.Stmt) {
+	decl, ok := stmt.(*ast.VariableDeclarationStmt)
+	if !ok {
+		return
+	}
+	symbol := g.module.Info.Defs[decl]
+	if symbol == nil {
+		return
+	}
+	g.context = qualifiedName(symbol)
+	defer g.lambdas()
+	if decl.Value == nil {
+		g.global(symbol, g.zeroConstant(symbol.Type)...)
+		return
+	}
+	if inMemory(symbol.Type) {
+		// the global holds the address of the value, which never changes
+		size, align := sizeOf(symbol.Type)
+		buf := make([]byte, size)
+		if !g.encode(buf, 0, decl.Value, symbol.Type) {
+			g.initializeAtStart(decl, symbol)
+			return
+		}
+		g.global(symbol, ir.Int(ir.I32, int64(g.place(buf, align))))
+		return
+	}
+	if _, ok := symbol.Type.(*types.Signature); ok {
+		value, ok := g.functionConstant(decl.Value)
+		if !ok {
+			g.initializeAtStart(decl, symbol)
+			return
+		}
+		g.global(symbol, ir.Int(ir.I32, int64(value)))
+		return
+	}
+	if enum, ok := symbol.Type.(*types.Enum); ok {
+		value, ok := g.enumConstant(decl.Value, enum)
+		if !ok {
+			g.initializeAtStart(decl, symbol)
+			return
+		}
+		g.global(symbol, ir.Int(ir.I32, int64(value)))
+		return
+	}
+	if slice, ok := symbol.Type.(*types.Slice); ok {
+		address, length, ok := g.constantSlice(decl.Value, slice)
+		if !ok {
+			g.initializeAtStart(decl, symbol)
+			return
+		}
+		g.global(symbol, ir.Int(ir.I32, int64(address)), ir.Int(ir.I32, int64(length)))
+		return
+	}
+	if literal, ok := decl.Value.(*ast.StringExpr); ok && symbol.Type == types.Str {
+		g.global(symbol, ir.Int(ir.I32, int64(g.intern(literal.Value))), ir.Int(ir.I32, int64(len(literal.Value))))
+		return
+	}
+	value, ok := constant(decl.Value, symbol.Type)
+	if !ok && (types.IsNumeric(symbol.Type) || symbol.Type == types.Bool) {
+		value, ok = g.evaluate(decl.Value, symbol.Type)
+	}
+	if !ok {
+		g.initializeAtStart(decl, symbol)
+		return
+	}
+	g.global(symbol, value)
+}
+
+// global adds the globals holding the values of a global variable. They are
+// mutable when the variable is, except for the address of a struct or an
+// array, which never changes.
+func (g *generator) global(symbol *checker.Symbol, values ...ir.Value) {
+	for i, name := range parts(qualifiedName(symbol), symbol.Type) {
+		g.ir.Globals = append(g.ir.Globals, &ir.Global{
+			Name:    name,
+			Type:    values[i].Type,
+			Mutable: symbol.Mutable && !inMemory(symbol.Type),
+			Init:    values[i],
+		})
+	}
+}
+
+func (g *generator) functions(stmt ast.Stmt) {
+	fn, ok := stmt.(*ast.FunctionStmt)
+	if !ok {
+		return
+	}
+	symbol := g.module.Info.Defs[fn]
+	if symbol == nil {
+		return
+	}
+	g.context = qualifiedName(symbol)
+	g.function(g.context, fn.Params, symbol.Type.(*types.Signature), fn.Body, nil, false)
+	g.lambdas()
+}
+
+// function lowers a function. Function expressions receive the address of
+// their closure first, and start by loading the variables they capture from it.
+func (g *generator) function(name string, params []ast.FunctionParameter, sig *types.Signature, body []ast.Stmt, captures []*checker.Symbol, closure bool) {
+	f := ir.NewFunction(name, valueTypes(sig.Result))
+	g.b = ir.NewBuilder(f)
+	g.result = sig.Result
+	g.locals = map[*checker.Symbol][]*ir.Local{}
+
+	var env *ir.Local
+	if closure {
+		env = f.NewParam("env", ir.I32)
+	}
+	for i := range params {
+		var locals []*ir.Local
+		for j, name := range parts(params[i].ParamName, sig.Params[i]) {
+			locals = append(locals, f.NewParam(name, valueTypes(sig.Params[i])[j]))
+		}
+		if symbol := g.module.Info.Defs[&params[i]]; symbol != nil {
+			g.locals[symbol] = locals
+		}
+	}
+	g.loadCaptures(env, captures)
+	g.stmts(body)
+	if !g.b.Terminated() {
+		if sig.Result == types.Void {
+			g.b.Terminate(&ir.Return{})
+		} else {
+			// the checker reported the missing return
+			g.b.Terminate(&ir.Unreachable{})
+		}
+	}
+	g.ir.Functions = append(g.ir.Functions, f)
+}
+
+func (g *generator) exports() {
+	if g.program.Entry == nil {
+		return
+	}
+	for _, stmt := range g.program.Entry.Program.Statements {
+		switch stmt := stmt.(type) {
+		case *ast.FunctionStmt:
+			if symbol := g.program.Entry.Info.Defs[stmt]; symbol != nil && stmt.Exported {
+				g.ir.Exports = append(g.ir.Exports, &ir.Export{Name: stmt.Identifier, Function: qualifiedName(symbol)})
+			}
+		case *ast.VariableDeclarationStmt:
+			// the globals of strings and slices are exported as name.ptr
+			// and name.len
+			if symbol := g.program.Entry.Info.Defs[stmt]; symbol != nil && stmt.Exported {
+				names := parts(qualifiedName(symbol), symbol.Type)
+				for i, name := range parts(stmt.VarName, symbol.Type) {
+					g.ir.Exports = append(g.ir.Exports, &ir.Export{Name: name, Global: names[i]})
+				}
+			}
+		}
+	}
+}
+
+// signature returns the signature of the function lowered from a function of
+// type sig. Functions called through function values take their closure
+// first.
+func signature(sig *types.Signature, closure bool) *ir.Signature {
+	var params []ir.Type
+	if closure {
+		params = append(params, ir.I32)
+	}
+	for _, param := range sig.Params {
+		params = append(params, valueTypes(param)...)
+	}
+	return &ir.Signature{Params: params, Results: valueTypes(sig.Result)}
+}
+
+// declare creates the locals holding the values of a local variable.
+func (g *generator) declare(symbol *checker.Symbol, name string, t types.Type) []*ir.Local {
+	var locals []*ir.Local
+	for i, part := range parts(name, t) {
+		locals = append(locals, g.b.Func.NewLocal(part, valueTypes(t)[i]))
+	}
+	if symbol != nil {
+		g.locals[symbol] = locals
+	}
+	return locals
+}
+
+// assign copies values into locals.
+func (g *generator) assign(locals []*ir.Local, values []ir.Value) {
+	for i, local := range locals {
+		g.b.Copy(local, values[i])
+	}
+}
+
+// temps creates locals holding an intermediate value of type t.
+func (g *generator) temps(t types.Type) []*ir.Local {
+	var locals []*ir.Local
+	for _, vt := range valueTypes(t) {
+		locals = append(locals, g.b.Temp(vt))
+	}
+	return locals
+}
+
+// uses returns the values of locals.
+func uses(locals []*ir.Local) []ir.Value {
+	values := make([]ir.Value, len(locals))
+	for i, local := range locals {
+		values[i] = ir.Use(local)
+	}
+	return values
+}
+
+// invalid returns zero values of type t standing in for an expression the
+// backend reported an error for.
+func invalid(t types.Type) []ir.Value {
+	var values []ir.Value
+	for _, vt := range valueTypes(t) {
+		values = append(values, ir.Value{Type: vt})
+	}
+	return values
+}
+
+// intern places a string literal in the data segment and returns its address.
+func (g *generator) intern(value string) int {
+	if offset, ok := g.strings[value]; ok {
+		return offset
+	}
+	offset := len(g.data)
+	g.data = append(g.data, value...)
+	g.strings[value] = offset
+	return offset
+}
+
+func (g *generator) stmts(stmts []ast.Stmt) {
+	for _, stmt := range stmts {
+		g.stmt(stmt)
+	}
+}
+
+func (g *generator) stmt(stmt ast.Stmt) {
+	switch stmt := stmt.(type) {
+	case *ast.ExpressionStmt:
+		if assignment, ok := stmt.Expression.(*ast.AssignmentExpr); ok {
+			g.assignment(assignment, false)
+			return
+		}
+		g.expr(stmt.Expression)
+	case *ast.VariableDeclarationStmt:
+		symbol := g.module.Info.Defs[stmt]
+		if symbol == nil {
+			return
+		}
+		locals := g.declare(symbol, stmt.VarName, symbol.Type)
+		if stmt.Value == nil {
+			g.assign(locals, g.zero(symbol.Type))
+			return
+		}
+		if inMemory(symbol.Type) && !fresh(stmt.Value) {
+			// the variable gets its own copy of the struct or the array
+			size, _ := sizeOf(symbol.Type)
+			address := g.alloc(size)
+			g.copy(address, g.expr(stmt.Value)[0], size)
+			g.assign(locals, []ir.Value{address})
+			return
+		}
+		g.assign(locals, g.exprAs(stmt.Value, symbol.Type))
+	case *ast.ReturnStmt:
+		var values []ir.Value
+		if stmt.Value != nil {
+			values = g.exprAs(stmt.Value, g.result)
+		}
+		g.b.Terminate(&ir.Return{Values: values})
+	}
+}
+
+// exprAs lowers an expression and converts its value to the type t.
+func (g *generator) exprAs(expr ast.Expr, t types.Type) []ir.Value {
+	if value, ok := constant(expr, t); ok {
+		return []ir.Value{value}
+	}
+	from := g.module.Info.Types[expr]
+	values := g.expr(expr)
+	if array, ok := from.(*types.Array); ok && types.IsSlice(t) {
+		// a slice of the whole array
+		return []ir.Value{values[0], ir.Int(ir.I32, int64(array.Len))}
+	}
+	if len(values) == 1 {
+		values[0] = g.convert(values[0], from, t)
+	}
+	return values
+}
+
+// fresh reports whether an expression creates a new struct or array, which
+// needs no copy to be stored in a variable.
+func fresh(expr ast.Expr) bool {
+	switch expr.(type) {
+	case *ast.StructLiteralExpr, *ast.ArrayLiteralExpr:
+		return true
+	}
+	return false
+}
+
+// expr lowers an expression and returns its values.
+func (g *generator) expr(expr ast.Expr) []ir.Value {
+	t := g.module.Info.Types[expr]
+	switch expr := expr.(type) {
+	case *ast.IntegerExpr, *ast.FloatExpr, *ast.BooleanExpr:
+		return g.exprAs(expr, t)
+	case *ast.StringExpr:
+		return []ir.Value{ir.Int(ir.I32, int64(g.intern(expr.Value))), ir.Int(ir.I32, int64(len(expr.Value)))}
+	case *ast.SymbolExpr, *ast.MemberExpr:
+		return g.load(expr, t)
+	case *ast.PrefixExpr:
+		return []ir.Value{g.prefix(expr, t)}
+	case *ast.BinaryExpr:
+		return []ir.Value{g.binary(expr, t)}
+	case *ast.AssignmentExpr:
+		return g.assignment(expr, true)
+	case *ast.CallExpr:
+		return g.call(expr, t)
+	case *ast.FieldExpr, *ast.IndexExpr:
+		return g.access(expr, t)
+	case *ast.StructLiteralExpr:
+		return []ir.Value{g.structLiteral(expr, t.(*types.Struct))}
+	case *ast.ArrayLiteralExpr:
+		return []ir.Value{g.arrayLiteral(expr, t.(*types.Array))}
+	case *ast.MatchExpr:
+		return g.match(expr, t)
+	case *ast.FunctionExpr:
+		return []ir.Value{g.closure(expr)}
+	case *ast.BlockExpr:
+		return g.block(expr, t)
+	case *ast.IfExpr:
+		return g.ifExpr(expr, t)
+	case *ast.CastExpr:
+		return []ir.Value{g.cast(expr, t)}
+	}
+	g.errorf(diagnostics.UnsupportedByBackend, expr, "%s is not supported by the WebAssembly backend", expr.String())
+	return invalid(t)
+}
+
+// load reads the value of a symbol. A mutable variable is copied, so that the
+// value read does not change when the variable is assigned before it is used.
+func (g *generator) load(expr ast.Expr, t types.Type) []ir.Value {
+	symbol := g.module.Info.Uses[expr]
+	if symbol == nil {
+		return invalid(t)
+	}
+	switch symbol.Kind {
+	case checker.LocalSymbol, checker.ParamSymbol:
+		locals := g.locals[symbol]
+		if !symbol.Mutable {
+			return uses(locals)
+		}
+		temps := g.temps(symbol.Type)
+		g.assign(temps, uses(locals))
+		return uses(temps)
+	case checker.GlobalSymbol:
+		var values []ir.Value
+		for i, name := range parts(qualifiedName(symbol), symbol.Type) {
+			values = append(values, g.b.GlobalGet(name, valueTypes(symbol.Type)[i]))
+		}
+		return values
+	case checker.FunctionSymbol, checker.ExternSymbol:
+		return []ir.Value{ir.Int(ir.I32, int64(g.reference(symbol)))}
+	case checker.VariantSymbol:
+		if enum, tag := symbol.Variant(); len(enum.Variants[tag].Fields) == 0 {
+			return []ir.Value{g.variant(enum, tag, nil)}
+		}
+	}
+	g.errorf(diagnostics.UnsupportedByBackend, expr, "%s %s cannot be used as a value by the WebAssembly backend", symbol.Kind, symbol.Name)
+	return invalid(t)
+}
+
+func (g *generator) prefix(expr *ast.PrefixExpr, t types.Type) ir.Value {
+	vt := valueType(t)
+	switch expr.Operator.Kind {
+	case lexer.NOT:
+		return g.b.Op(ir.Eqz, ir.I32, g.exprAs(expr.Right, types.Bool)[0])
+	case lexer.DASH:
+		if types.IsFloat(t) {
+			return g.b.Op(ir.Neg, vt, g.exprAs(expr.Right, t)[0])
+		}
+		return g.normalize(g.b.Op(ir.Sub, vt, ir.Int(vt, 0), g.exprAs(expr.Right, t)[0]), t)
+	default:
+		return g.normalize(g.b.Op(ir.Xor, vt, g.exprAs(expr.Right, t)[0], ir.Int(vt, -1)), t)
+	}
+}
+
+// cast lowers a conversion with "as". Booleans and enum tags are i32 values,
+// which convert like integers.
+func (g *generator) cast(expr *ast.CastExpr, t types.Type) ir.Value {
+	from := g.module.Info.Types[expr.Value]
+	value := g.expr(expr.Value)[0]
+	if !types.IsNumeric(from) {
+		from = types.I32
+	}
+	return g.convert(value, from, t)
+}
+
+func (g *generator) binary(expr *ast.BinaryExpr, t types.Type) ir.Value {
+	switch expr.Operator.Kind {
+	case lexer.AND, lexer.OR:
+		// the right operand is only evaluated when the left one does not
+		// decide the result
+		result := g.b.Temp(ir.I32)
+		right, short, join := new(ir.Block), new(ir.Block), new(ir.Block)
+		left := g.exprAs(expr.Left, types.Bool)[0]
+		decided := ir.Int(ir.I32, 0)
+		if expr.Operator.Kind == lexer.AND {
+			g.b.Terminate(&ir.Branch{Cond: left, Then: right, Else: short})
+		} else {
+			g.b.Terminate(&ir.Branch{Cond: left, Then: short, Else: right})
+			decided = ir.Int(ir.I32, 1)
+		}
+		g.b.Place(right)
+		g.b.Copy(result, g.exprAs(expr.Right, types.Bool)[0])
+		g.b.Jump(join)
+		g.b.Place(short)
+		g.b.Copy(result, decided)
+		g.b.Jump(join)
+		g.b.Place(join)
+		return ir.Use(result)
+	case lexer.EXPONENTIATION:
+		return g.pow(t, g.exprAs(expr.Left, t)[0], g.exprAs(expr.Right, t)[0])
+	}
+
+	// the operands have the same type, which comparisons do not produce
+	operands := t
+	if t == types.Bool {
+		operands = g.module.Info.Types[expr.Left]
+	}
+	left := g.exprAs(expr.Left, operands)[0]
+	right := g.exprAs(expr.Right, operands)[0]
+	return g.operation(expr.Operator.Kind, operands, left, right)
+}
+
+// operation applies a binary operator to operands of type t.
+func (g *generator) operation(kind lexer.TokenKind, t types.Type, left, right ir.Value) ir.Value {
+	result := g.b.Op(instruction(kind, t), valueType(t), left, right)
+	switch kind {
+	case lexer.EQUAL, lexer.NOT_EQUAL, lexer.LESS, lexer.LESS_EQUAL, lexer.GREATER, lexer.GREATER_EQUAL:
+	case lexer.AMPERSAND, lexer.PIPE, lexer.CARET:
+		// keep the extension of both operands
+	default:
+		result = g.normalize(result, t)
+	}
+	return result
+}
+
+// instruction returns the operation implementing a binary operator on
+// operands of type t.
+func instruction(kind lexer.TokenKind, t types.Type) ir.Op {
+	signed := func(name string) ir.Op {
+		if types.IsFloat(t) {
+			return ir.Op(name)
+		}
+		return ir.Op(name + "_" + sign(t))
+	}
+	switch kind {
+	case lexer.PLUS:
+		return ir.Add
+	case lexer.DASH:
+		return ir.Sub
+	case lexer.ASTERISK:
+		return ir.Mul
+	case lexer.SLASH:
+		return signed("div")
+	case lexer.REMAINDER:
+		return signed("rem")
+	case lexer.AMPERSAND:
+		return ir.And
+	case lexer.PIPE:
+		return ir.Or
+	case lexer.CARET:
+		return ir.Xor
+	case lexer.SHIFT_LEFT:
+		return ir.Shl
+	case lexer.SHIFT_RIGHT:
+		return signed("shr")
+	case lexer.SHIFT_RIGHT_UNSIGNED:
+		return ir.ShrU
+	case lexer.EQUAL:
+		return ir.Eq
+	case lexer.NOT_EQUAL:
+		return ir.Ne
+	case lexer.LESS:
+		return signed("lt")
+	case lexer.LESS_EQUAL:
+		return signed("le")
+	case lexer.GREATER:
+		return signed("gt")
+	default:
+		return signed("ge")
+	}
+}
+
+// assignment stores a value, and returns it when it is used.
+func (g *generator) assignment(expr *ast.AssignmentExpr, used bool) []ir.Value {
+	switch expr.Assigne.(type) {
+	case *ast.FieldExpr, *ast.IndexExpr:
+		return g.memoryAssignment(expr, used)
+	}
+	symbol := g.module.Info.Uses[expr.Assigne]
+	if symbol == nil {
+		return nil
+	}
+	if inMemory(symbol.Type) {
+		// the value is copied into the storage of the variable
+		size, _ := sizeOf(symbol.Type)
+		address := g.load(expr.Assigne, symbol.Type)[0]
+		g.copy(address, g.expr(expr.AssignedValue)[0], size)
+		return []ir.Value{address}
+	}
+	values := g.assignedValue(expr, symbol.Type, func() []ir.Value { return g.load(expr.Assigne, symbol.Type) })
+	switch symbol.Kind {
+	case checker.LocalSymbol, checker.ParamSymbol:
+		g.assign(g.locals[symbol], values)
+	case checker.GlobalSymbol:
+		for i, name := range parts(qualifiedName(symbol), symbol.Type) {
+			g.b.GlobalSet(name, values[i])
+		}
+	}
+	return values
+}
+
+// assignedValue returns the value stored by an assignment of type t.
+// Compound assignments apply their operator to the current value, returned
+// by load.
+func (g *generator) assignedValue(expr *ast.AssignmentExpr, t types.Type, load func() []ir.Value) []ir.Value {
+	operator, compound := lexer.CompoundOperator(expr.Operator.Kind)
+	if !compound {
+		return g.exprAs(expr.AssignedValue, t)
+	}
+	current := load()[0]
+	value := g.exprAs(expr.AssignedValue, t)[0]
+	return []ir.Value{g.operation(operator, t, current, value)}
+}
+
+func (g *generator) call(expr *ast.CallExpr, t types.Type) []ir.Value {
+	symbol := g.module.Info.Uses[expr.Callee]
+	if symbol != nil {
+		switch symbol.Kind {
+		case checker.VariantSymbol:
+			enum, tag := symbol.Variant()
+			return []ir.Value{g.variant(enum, tag, expr.Arguments)}
+		case checker.BuiltinSymbol:
+			// len is the only builtin
+			return []ir.Value{g.length(expr.Arguments[0])}
+		}
+	}
+	sig, ok := g.module.Info.Types[expr.Callee].(*types.Signature)
+	if !ok {
+		return invalid(t)
+	}
+	if symbol == nil || (symbol.Kind != checker.FunctionSymbol && symbol.Kind != checker.ExternSymbol) {
+		return g.indirectCall(expr, sig)
+	}
+	return g.b.Call(qualifiedName(symbol), valueTypes(sig.Result), g.arguments(expr.Arguments, sig)...)
+}
+
+// arguments lowers the arguments of a call, converted to the types of the
+// parameters.
+func (g *generator) arguments(args []ast.Expr, sig *types.Signature) []ir.Value {
+	var values []ir.Value
+	for i, arg := range args {
+		if i < len(sig.Params) {
+			values = append(values, g.exprAs(arg, sig.Params[i])...)
+		}
+	}
+	return values
+}
+
+// constant returns a literal, or a negated literal, as a constant of type t.
+func constant(expr ast.Expr, t types.Type) (ir.Value, bool) {
+	negate := false
+	if prefix, ok := expr.(*ast.PrefixExpr); ok && prefix.Operator.Kind == lexer.DASH {
+		negate = true
+		expr = prefix.Right
+	}
+	vt := valueType(t)
+	var value float64
+	switch expr := expr.(type) {
+	case *ast.IntegerExpr:
+		if !types.IsFloat(t) {
+			if negate {
+				return ir.Int(vt, -int64(expr.Value)), true
+			}
+			return ir.Int(vt, int64(expr.Value)), true
+		}
+		value = float64(expr.Value)
+	case *ast.FloatExpr:
+		value = expr.Value
+	case *ast.BooleanExpr:
+		if negate || t != types.Bool {
+			return ir.Value{}, false
+		}
+		if expr.Value {
+			return ir.Int(ir.I32, 1), true
+		}
+		return ir.Int(ir.I32, 0), true
+	default:
+		return ir.Value{}, false
+	}
+	if negate {
+		value = -value
+	}
+	if types.IsInteger(t) {
+		return ir.Int(vt, int64(value)), true
+	}
+	return ir.Float(vt, value), true
+}
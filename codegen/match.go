@@ -0,0 +1,105 @@
+package codegen
+
+import (
+	"github.com/LaH-DeV/veles/ast"
+	"github.com/LaH-DeV/veles/ir"
+	"github.com/LaH-DeV/veles/types"
+)
+
+// match lowers a match expression. Every arm gets a block of its own, which
+// assigns the value of the match to the same locals, read after the arms
+// join.
+func (g *generator) match(expr *ast.MatchExpr, t types.Type) []ir.Value {
+	value := g.module.Info.Types[expr.Value]
+	matched := g.expr(expr.Value)
+	results := g.temps(t)
+	join := new(ir.Block)
+	if enum, ok := value.(*types.Enum); ok {
+		g.matchTag(expr, enum, matched[0], results, join, t)
+	} else {
+		g.matchLiterals(expr, value, matched[0], results, join, t)
+	}
+	g.b.Place(join)
+	return uses(results)
+}
+
+// matchTag dispatches on the tag of an enum value with a switch to the block
+// of the first arm matching each variant.
+func (g *generator) matchTag(expr *ast.MatchExpr, enum *types.Enum, value ir.Value, results []*ir.Local, join *ir.Block, t types.Type) {
+	arms := make([]*ir.Block, len(expr.Arms))
+	targets := make([]*ir.Block, len(enum.Variants))
+	var fallback *ir.Block
+	for i := len(expr.Arms) - 1; i >= 0; i-- {
+		arms[i] = new(ir.Block)
+		switch pattern := expr.Arms[i].Pattern.(type) {
+		case *ast.WildcardPattern:
+			for tag := range targets {
+				targets[tag] = arms[i]
+			}
+			fallback = arms[i]
+		case *ast.VariantPattern:
+			if _, tag := g.module.Info.Uses[pattern.Variant].Variant(); tag >= 0 {
+				targets[tag] = arms[i]
+			}
+		}
+	}
+	if fallback == nil && len(targets) > 0 {
+		fallback = targets[len(targets)-1]
+	}
+	if fallback == nil {
+		// an enum without variants has no values
+		g.b.Terminate(&ir.Unreachable{})
+		return
+	}
+
+	tag := value
+	if !enum.IsPlain() {
+		tag = g.b.Load(ir.Load, ir.I32, value, 0)
+	}
+	g.b.Terminate(&ir.Switch{Value: tag, Targets: targets, Default: fallback})
+	for i, arm := range expr.Arms {
+		g.b.Place(arms[i])
+		if pattern, ok := arm.Pattern.(*ast.VariantPattern); ok {
+			g.bindings(pattern, value)
+		}
+		g.branch(arm.Body, t, results, join)
+	}
+}
+
+// bindings loads the values carried by the matched variant into the locals
+// of the names bound by the pattern.
+func (g *generator) bindings(pattern *ast.VariantPattern, value ir.Value) {
+	enum, tag := g.module.Info.Uses[pattern.Variant].Variant()
+	if enum == nil || enum.IsPlain() {
+		return
+	}
+	variant := enum.Variants[tag]
+	fieldOffsets, _ := variantLayout(variant)
+	for i := range pattern.Bindings {
+		symbol := g.module.Info.Defs[&pattern.Bindings[i]]
+		if symbol == nil {
+			continue
+		}
+		locals := g.declare(symbol, symbol.Name, symbol.Type)
+		g.assign(locals, g.loadValue(value, fieldOffsets[i], variant.Fields[i]))
+	}
+}
+
+// matchLiterals compares the value with the literal patterns in order. The
+// arm of the first wildcard pattern ends the chain.
+func (g *generator) matchLiterals(expr *ast.MatchExpr, t types.Type, value ir.Value, results []*ir.Local, join *ir.Block, result types.Type) {
+	for _, arm := range expr.Arms {
+		pattern, ok := arm.Pattern.(*ast.LiteralPattern)
+		if !ok {
+			g.branch(arm.Body, result, results, join)
+			return
+		}
+		then, next := new(ir.Block), new(ir.Block)
+		literal := g.exprAs(pattern.Value, t)[0]
+		g.b.Terminate(&ir.Branch{Cond: g.b.Op(ir.Eq, valueType(t), value, literal), Then: then, Else: next})
+		g.b.Place(then)
+		g.branch(arm.Body, result, results, join)
+		g.b.Place(next)
+	}
+	g.b.Terminate(&ir.Unreachable{})
+}
@@ -0,0 +1,319 @@
+package codegen
+
+import (
+	"encoding/binary"
+
+	"github.com/LaH-DeV/veles/ast"
+	"github.com/LaH-DeV/veles/checker"
+	"github.com/LaH-DeV/veles/ir"
+	"github.com/LaH-DeV/veles/types"
+)
+
+// allocator adds the allocator, which reserves memory on the heap. The heap
+// starts after the data segment and grows upwards. Memory is never freed:
+// values live as long as the module instance.
+//
+//	func $__alloc(%size i32) -> i32
+//	b0:
+//	  %address = global.get $__heap
+//	  %end = (%address + %size + 7) & -8
+//	  global.set $__heap, %end
+//	  branch %end > memory.size << 16, b1, b3
+//	b1:
+//	  grow the memory by the missing pages, branching to b2 when it fails
+//	b2:
+//	  unreachable
+//	b3:
+//	  return %address
+func (g *generator) allocator() {
+	g.ir.Globals = append(g.ir.Globals, &ir.Global{
+		Name:    "__heap",
+		Type:    ir.I32,
+		Mutable: true,
+		Init:    ir.Int(ir.I32, int64(alignTo(len(g.data), 8))),
+	})
+	f := ir.NewFunction("__alloc", []ir.Type{ir.I32})
+	size := ir.Use(f.NewParam("size", ir.I32))
+	b := ir.NewBuilder(f)
+	address := f.NewLocal("address", ir.I32)
+	b.Copy(address, b.GlobalGet("__heap", ir.I32))
+	end := b.Op(ir.And, ir.I32, b.Op(ir.Add, ir.I32, b.Op(ir.Add, ir.I32, ir.Use(address), size), ir.Int(ir.I32, 7)), ir.Int(ir.I32, -8))
+	b.GlobalSet("__heap", end)
+
+	grow, fail, done := new(ir.Block), new(ir.Block), new(ir.Block)
+	pages := &ir.Instr{Op: ir.MemorySize, Dests: []*ir.Local{b.Temp(ir.I32)}}
+	b.Emit(pages)
+	capacity := b.Op(ir.Shl, ir.I32, ir.Use(pages.Dests[0]), ir.Int(ir.I32, 16))
+	b.Terminate(&ir.Branch{Cond: b.Op(ir.GtU, ir.I32, end, capacity), Then: grow, Else: done})
+
+	b.Place(grow)
+	missing := b.Op(ir.ShrU, ir.I32, b.Op(ir.Add, ir.I32, b.Op(ir.Sub, ir.I32, end, capacity), ir.Int(ir.I32, 65535)), ir.Int(ir.I32, 16))
+	grown := &ir.Instr{Op: ir.MemoryGrow, Dests: []*ir.Local{b.Temp(ir.I32)}, Args: []ir.Value{missing}}
+	b.Emit(grown)
+	b.Terminate(&ir.Branch{Cond: b.Op(ir.Eq, ir.I32, ir.Use(grown.Dests[0]), ir.Int(ir.I32, -1)), Then: fail, Else: done})
+	b.Place(fail)
+	b.Terminate(&ir.Unreachable{})
+	b.Place(done)
+	b.Terminate(&ir.Return{Values: []ir.Value{ir.Use(address)}})
+	g.ir.Functions = append(g.ir.Functions, f)
+}
+
+// alloc reserves size bytes on the heap and returns their address.
+func (g *generator) alloc(size int) ir.Value {
+	g.heap = true
+	return g.b.Call("__alloc", []ir.Type{ir.I32}, ir.Int(ir.I32, int64(size)))[0]
+}
+
+// copy copies size bytes from the address src to the address dst.
+func (g *generator) copy(dst, src ir.Value, size int) {
+	g.b.MemoryCopy(dst, src, ir.Int(ir.I32, int64(size)))
+}
+
+// address returns an address plus offset.
+func (g *generator) address(address ir.Value, offset int) ir.Value {
+	if offset == 0 {
+		return address
+	}
+	return g.b.Op(ir.Add, ir.I32, address, ir.Int(ir.I32, int64(offset)))
+}
+
+// structLiteral allocates a struct and stores the values of its fields, in the
+// order they are written, then returns its address.
+func (g *generator) structLiteral(expr *ast.StructLiteralExpr, st *types.Struct) ir.Value {
+	size, _ := sizeOf(st)
+	address := g.alloc(size)
+	fieldOffsets := offsets(st)
+	for _, field := range expr.Fields {
+		i := st.Field(field.Name)
+		if i < 0 {
+			continue
+		}
+		t := st.Fields[i].Type
+		g.storeValue(address, fieldOffsets[i], t, g.exprAs(field.Value, t))
+	}
+	return address
+}
+
+// storeValue stores the values of type t at offset from an address. Structs
+// and arrays are copied into place.
+func (g *generator) storeValue(address ir.Value, offset int, t types.Type, values []ir.Value) {
+	switch {
+	case inMemory(t):
+		size, _ := sizeOf(t)
+		g.copy(g.address(address, offset), values[0], size)
+	case isPair(t):
+		for i, value := range values {
+			g.b.Store(ir.Store, address, value, offset+4*i)
+		}
+	default:
+		g.b.Store(storeOp(t), address, values[0], offset)
+	}
+}
+
+// loadValue returns the value of type t stored at offset from an address.
+// Structs and arrays are represented by their address.
+func (g *generator) loadValue(address ir.Value, offset int, t types.Type) []ir.Value {
+	switch {
+	case inMemory(t):
+		return []ir.Value{g.address(address, offset)}
+	case isPair(t):
+		return []ir.Value{
+			g.b.Load(ir.Load, ir.I32, address, offset),
+			g.b.Load(ir.Load, ir.I32, address, offset+4),
+		}
+	}
+	return []ir.Value{g.b.Load(loadOp(t), valueType(t), address, offset)}
+}
+
+// locate returns the address of the outermost value of a chain of field and
+// element accesses and the offset of the accessed value from it, so that
+// a.b.c is a single load. The offsets of elements are only known at run time
+// and are added to the address as they are computed.
+func (g *generator) locate(expr ast.Expr) (ir.Value, int) {
+	switch expr := expr.(type) {
+	case *ast.FieldExpr:
+		st := g.module.Info.Types[expr.Object].(*types.Struct)
+		address, offset := g.locate(expr.Object)
+		return address, offset + offsets(st)[st.Field(expr.Field)]
+	case *ast.IndexExpr:
+		return g.element(expr)
+	}
+	return g.expr(expr)[0], 0
+}
+
+// access loads the value of a field or an element.
+func (g *generator) access(expr ast.Expr, t types.Type) []ir.Value {
+	address, offset := g.locate(expr)
+	return g.loadValue(address, offset, t)
+}
+
+// memoryAssignment stores a value into a field or an element, and returns it
+// when it is used.
+func (g *generator) memoryAssignment(expr *ast.AssignmentExpr, used bool) []ir.Value {
+	target := expr.Assigne
+	t := g.module.Info.Types[target]
+	address, offset := g.locate(target)
+	values := g.assignedValue(expr, t, func() []ir.Value { return g.loadValue(address, offset, t) })
+	g.storeValue(address, offset, t, values)
+	if used {
+		return g.loadValue(address, offset, t)
+	}
+	return nil
+}
+
+// place appends bytes to the data segment at an address aligned to align and
+// returns the address.
+func (g *generator) place(bytes []byte, align int) int {
+	offset := alignTo(len(g.data), align)
+	g.data = append(g.data, make([]byte, offset-len(g.data))...)
+	g.data = append(g.data, bytes...)
+	return offset
+}
+
+// encode writes the value of a constant expression of type t into buf at
+// offset, reporting whether the expression is constant.
+func (g *generator) encode(buf []byte, offset int, expr ast.Expr, t types.Type) bool {
+	switch t := t.(type) {
+	case *types.Array:
+		literal, ok := expr.(*ast.ArrayLiteralExpr)
+		if !ok {
+			return false
+		}
+		size, _ := sizeOf(t.Elem)
+		for i, element := range literal.Elements {
+			if !g.encode(buf, offset+i*size, element, t.Elem) {
+				return false
+			}
+		}
+		return true
+	case *types.Slice:
+		address, length, ok := g.constantSlice(expr, t)
+		if !ok {
+			return false
+		}
+		binary.LittleEndian.PutUint32(buf[offset:], uint32(address))
+		binary.LittleEndian.PutUint32(buf[offset+4:], uint32(length))
+		return true
+	case *types.Signature:
+		value, ok := g.functionConstant(expr)
+		if !ok {
+			return false
+		}
+		binary.LittleEndian.PutUint32(buf[offset:], uint32(value))
+		return true
+	}
+	switch {
+	case types.IsStruct(t):
+		literal, ok := expr.(*ast.StructLiteralExpr)
+		if !ok {
+			return false
+		}
+		st := t.(*types.Struct)
+		fieldOffsets := offsets(st)
+		for _, field := range literal.Fields {
+			i := st.Field(field.Name)
+			if i < 0 || !g.encode(buf, offset+fieldOffsets[i], field.Value, st.Fields[i].Type) {
+				return false
+			}
+		}
+		return true
+	case types.IsEnum(t):
+		value, ok := g.enumConstant(expr, t.(*types.Enum))
+		if !ok {
+			return false
+		}
+		binary.LittleEndian.PutUint32(buf[offset:], uint32(value))
+		return true
+	case t == types.Str:
+		literal, ok := expr.(*ast.StringExpr)
+		if !ok {
+			return false
+		}
+		binary.LittleEndian.PutUint32(buf[offset:], uint32(g.intern(literal.Value)))
+		binary.LittleEndian.PutUint32(buf[offset+4:], uint32(len(literal.Value)))
+		return true
+	}
+
+	value, ok := constant(expr, t)
+	if !ok {
+		return false
+	}
+	switch size, _ := sizeOf(t); size {
+	case 1:
+		buf[offset] = byte(value.Bits)
+	case 2:
+		binary.LittleEndian.PutUint16(buf[offset:], uint16(value.Bits))
+	case 4:
+		binary.LittleEndian.PutUint32(buf[offset:], uint32(value.Bits))
+	default:
+		binary.LittleEndian.PutUint64(buf[offset:], value.Bits)
+	}
+	return true
+}
+
+// unit identifies a variant without values of a tagged union.
+type unit struct {
+	enum *types.Enum
+	tag  int
+}
+
+// variant returns a value of an enum: the tag of a plain enum, or the address
+// of a new object holding the tag and the values carried by the variant.
+func (g *generator) variant(enum *types.Enum, tag int, args []ast.Expr) ir.Value {
+	if enum.IsPlain() {
+		return ir.Int(ir.I32, int64(tag))
+	}
+	if len(args) == 0 {
+		// variants without values are constants, placed once
+		key := unit{enum, tag}
+		address, ok := g.units[key]
+		if !ok {
+			address, _ = g.constantVariant(enum, tag, nil)
+			g.units[key] = address
+		}
+		return ir.Int(ir.I32, int64(address))
+	}
+	variant := enum.Variants[tag]
+	fieldOffsets, size := variantLayout(variant)
+	address := g.alloc(size)
+	g.b.Store(ir.Store, address, ir.Int(ir.I32, int64(tag)), 0)
+	for i, arg := range args {
+		t := variant.Fields[i]
+		g.storeValue(address, fieldOffsets[i], t, g.exprAs(arg, t))
+	}
+	return address
+}
+
+// enumConstant returns the value of a constant expression of an enum type: the
+// tag of a plain enum, or the address of a tagged union object placed in the
+// data segment.
+func (g *generator) enumConstant(expr ast.Expr, enum *types.Enum) (int, bool) {
+	var args []ast.Expr
+	if call, ok := expr.(*ast.CallExpr); ok {
+		expr, args = call.Callee, call.Arguments
+	}
+	symbol := g.module.Info.Uses[expr]
+	if symbol == nil || symbol.Kind != checker.VariantSymbol {
+		return 0, false
+	}
+	_, tag := symbol.Variant()
+	if enum.IsPlain() {
+		return tag, true
+	}
+	return g.constantVariant(enum, tag, args)
+}
+
+// constantVariant places an object of a tagged union with constant values in
+// the data segment and returns its address.
+func (g *generator) constantVariant(enum *types.Enum, tag int, args []ast.Expr) (int, bool) {
+	variant := enum.Variants[tag]
+	fieldOffsets, size := variantLayout(variant)
+	buf := make([]byte, size)
+	binary.LittleEndian.PutUint32(buf, uint32(tag))
+	for i, arg := range args {
+		if !g.encode(buf, fieldOffsets[i], arg, variant.Fields[i]) {
+			return 0, false
+		}
+	}
+	return g.place(buf, 8), true
+}
@@ -0,0 +1,395 @@
+package codegen
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/LaH-DeV/veles/ir"
+	"github.com/LaH-DeV/veles/types"
+)
+
+// WebAssembly has no instruction raising a number to a power. Powers of
+// constants are computed at compile time, and powers to small constant
+// exponents multiply the base by itself, squaring it for every bit of the
+// exponent. The others call a runtime function doing the same over every bit,
+// added to the module when a program needs it: __pow_i32 and __pow_i64 for
+// signed integers, __pow_u32 and __pow_u64 for unsigned ones, and __pow_f64
+// for floats, which raises f32 values as f64.
+//
+// Integer powers wrap like multiplication. A negative exponent raises the
+// reciprocal of the base, as an integer division computes it: 1 stays 1, -1
+// alternates between -1 and 1, other bases give 0, and 0 traps like a
+// division by zero. Float powers follow the usual rules of pow.
+
+// maxInlineExponent is the largest constant exponent raised by multiplying in
+// place.
+const maxInlineExponent = 64
+
+// pow lowers left ** right on operands of type t.
+func (g *generator) pow(t types.Type, left, right ir.Value) ir.Value {
+	if t == types.F32 {
+		// computed as f64 and rounded once
+		result := g.pow(types.F64, g.promote(left), g.promote(right))
+		if result.IsConst() {
+			return ir.Float(ir.F32, result.Float())
+		}
+		return g.b.Op(ir.DemoteF64, ir.F32, result)
+	}
+	vt := valueType(t)
+	if left.IsConst() && right.IsConst() {
+		if value, ok := powConstant(t, left, right); ok {
+			return value
+		}
+	}
+	if n, ok := smallExponent(t, right); ok {
+		if n == 0 {
+			if vt.IsFloat() {
+				return ir.Float(vt, 1)
+			}
+			return ir.Int(vt, 1)
+		}
+		var result ir.Value
+		for ; n > 0; n >>= 1 {
+			if n&1 == 1 && result == (ir.Value{}) {
+				result = left
+			} else if n&1 == 1 {
+				result = g.b.Op(ir.Mul, vt, result, left)
+			}
+			if n > 1 {
+				left = g.b.Op(ir.Mul, vt, left, left)
+			}
+		}
+		return g.normalize(result, t)
+	}
+
+	name := "__pow_" + vt.String()
+	if types.IsUnsigned(t) {
+		name = unsignedPow(vt)
+	}
+	g.pows[name] = true
+	return g.normalize(g.b.Call(name, []ir.Type{vt}, left, right)[0], t)
+}
+
+// promote converts an f32 to an f64.
+func (g *generator) promote(value ir.Value) ir.Value {
+	if value.IsConst() {
+		return ir.Float(ir.F64, value.Float())
+	}
+	return g.b.Op(ir.PromoteF32, ir.F64, value)
+}
+
+// unsignedPow names the runtime function raising integers of type t to
+// unsigned exponents.
+func unsignedPow(t ir.Type) string {
+	return "__pow_u" + strconv.Itoa(t.Bits())
+}
+
+// smallExponent returns a constant exponent small enough to raise by
+// multiplying in place: a non-negative integer up to maxInlineExponent.
+func smallExponent(t types.Type, exponent ir.Value) (uint64, bool) {
+	switch {
+	case !exponent.IsConst():
+		return 0, false
+	case types.IsFloat(t):
+		y := exponent.Float()
+		if y >= 0 && y <= maxInlineExponent && y == math.Trunc(y) {
+			return uint64(y), true
+		}
+		return 0, false
+	case types.IsSigned(t) && exponent.Int() < 0:
+		return 0, false
+	}
+	n := exponent.Bits
+	return n, n <= maxInlineExponent
+}
+
+// powConstant raises a constant to a constant power of type t, which is not
+// f32. It returns false for a negative power of zero, which traps when it
+// runs.
+func powConstant(t types.Type, base, exponent ir.Value) (ir.Value, bool) {
+	vt := valueType(t)
+	if t == types.F64 {
+		return ir.Float(vt, math.Pow(base.Float(), exponent.Float())), true
+	}
+	x, n := base.Bits, exponent.Bits
+	if types.IsSigned(t) && exponent.Int() < 0 {
+		if base.Int() == 0 {
+			return ir.Value{}, false
+		}
+		x, n = uint64(1/base.Int()), uint64(-exponent.Int())
+	}
+	result := uint64(1)
+	for ; n > 0; n >>= 1 {
+		if n&1 == 1 {
+			result *= x
+		}
+		x *= x
+	}
+	// wrap to the bits of t, extending the sign of signed types
+	shift := 64 - types.Bits(t)
+	if types.IsSigned(t) {
+		return ir.Int(vt, int64(result<<shift)>>shift), true
+	}
+	return ir.Int(vt, int64(result<<shift>>shift)), true
+}
+
+// powFunctions adds the runtime functions raising to powers that the program
+// calls.
+func (g *generator) powFunctions() {
+	for _, t := range []ir.Type{ir.I32, ir.I64} {
+		if g.pows["__pow_"+t.String()] {
+			g.ir.Functions = append(g.ir.Functions, powSigned(t))
+			g.pows[unsignedPow(t)] = true
+		}
+	}
+	for _, t := range []ir.Type{ir.I32, ir.I64} {
+		if g.pows[unsignedPow(t)] {
+			g.ir.Functions = append(g.ir.Functions, powUnsigned(t))
+		}
+	}
+	if g.pows["__pow_f64"] {
+		g.ir.Functions = append(g.ir.Functions, powFloat())
+	}
+}
+
+// powSigned builds __pow_i32 or __pow_i64, which raise the reciprocal of the
+// base to the opposite of a negative exponent.
+func powSigned(t ir.Type) *ir.Function {
+	f := ir.NewFunction("__pow_"+t.String(), []ir.Type{t})
+	base, exponent := ir.Use(f.NewParam("base", t)), ir.Use(f.NewParam("exponent", t))
+	b := ir.NewBuilder(f)
+	negative := b.Op(ir.LtS, t, exponent, ir.Int(t, 0))
+	// the base is only divided by when the exponent is negative
+	divisor := b.Select(base, ir.Int(t, 1), negative)
+	base = b.Select(b.Op(ir.DivS, t, ir.Int(t, 1), divisor), base, negative)
+	exponent = b.Select(b.Op(ir.Sub, t, ir.Int(t, 0), exponent), exponent, negative)
+	results := b.Call(unsignedPow(t), []ir.Type{t}, base, exponent)
+	b.Terminate(&ir.Return{Values: results})
+	return f
+}
+
+// powUnsigned builds __pow_u32 or __pow_u64, which raise a base to an
+// unsigned exponent by squaring. There are no loops, so the function goes
+// through every bit of the exponent, choosing whether to multiply with a
+// select.
+func powUnsigned(t ir.Type) *ir.Function {
+	f := ir.NewFunction(unsignedPow(t), []ir.Type{t})
+	base, exponent := f.NewParam("base", t), ir.Use(f.NewParam("exponent", t))
+	result := f.NewLocal("result", t)
+	b := ir.NewBuilder(f)
+	b.Copy(result, ir.Int(t, 1))
+	for bit := range t.Bits() {
+		product := b.Op(ir.Mul, t, ir.Use(result), ir.Use(base))
+		set := b.Op(ir.And, t, exponent, ir.Int(t, int64(1)<<bit))
+		if t == ir.I64 {
+			set = b.Op(ir.Ne, t, set, ir.Int(t, 0))
+		}
+		b.Copy(result, b.Select(product, ir.Use(result), set))
+		if bit < t.Bits()-1 {
+			b.Copy(base, b.Op(ir.Mul, t, ir.Use(base), ir.Use(base)))
+		}
+	}
+	b.Terminate(&ir.Return{Values: []ir.Value{ir.Use(result)}})
+	return f
+}
+
+// powFloat builds __pow_f64, which follows the algorithm of Go's math.Pow.
+// After the special cases, |x| is raised to the fraction of |y| with exp and
+// log, then to its integer part by squaring, keeping the powers of two apart
+// so that only the final result can overflow or underflow.
+func powFloat() *ir.Function {
+	f := ir.NewFunction("__pow_f64", []ir.Type{ir.F64})
+	x, y := ir.Use(f.NewParam("x", ir.F64)), ir.Use(f.NewParam("y", ir.F64))
+	b := ir.NewBuilder(f)
+	c := func(value float64) ir.Value { return ir.Float(ir.F64, value) }
+	op := func(op ir.Op, args ...ir.Value) ir.Value { return b.Op(op, ir.F64, args...) }
+	flag := func(op ir.Op, args ...ir.Value) ir.Value { return b.Op(op, ir.I32, args...) }
+	long := func(op ir.Op, args ...ir.Value) ir.Value { return b.Op(op, ir.I64, args...) }
+	returnIf := func(cond, value ir.Value) {
+		then, next := new(ir.Block), new(ir.Block)
+		b.Terminate(&ir.Branch{Cond: cond, Then: then, Else: next})
+		b.Place(then)
+		b.Terminate(&ir.Return{Values: []ir.Value{value}})
+		b.Place(next)
+	}
+	inf, nan := c(math.Inf(1)), c(math.NaN())
+	ax, ay := op(ir.Abs, x), op(ir.Abs, y)
+
+	returnIf(flag(ir.Or, op(ir.Eq, y, c(0)), op(ir.Eq, x, c(1))), c(1))
+	returnIf(op(ir.Eq, y, c(1)), x)
+	returnIf(flag(ir.Or, op(ir.Ne, x, x), op(ir.Ne, y, y)), nan)
+
+	// odd integer exponents keep the sign of x, and all integers from 2^53
+	// on are even
+	integer := op(ir.Eq, y, op(ir.Trunc, y))
+	low := b.Op(ir.WrapI64, ir.I32, b.Op(ir.And, ir.I64, b.Op(ir.TruncSatF64S, ir.I64, y), ir.Int(ir.I64, 1)))
+	odd := flag(ir.And, flag(ir.And, integer, op(ir.Lt, ay, c(1<<53))), low)
+	signed := b.Op(ir.LtS, ir.I64, b.Op(ir.ReinterpretF64, ir.I64, x), ir.Int(ir.I64, 0))
+	negate := flag(ir.And, odd, signed)
+
+	// zeros and infinities of x give 0 or Inf
+	zero := op(ir.Eq, x, c(0))
+	huge := b.Select(inf, c(0), flag(ir.Eq, zero, op(ir.Lt, y, c(0))))
+	returnIf(flag(ir.Or, zero, op(ir.Eq, ax, inf)), b.Select(op(ir.Neg, huge), huge, negate))
+	// so do infinite exponents and the ones from 2^63 on, which are even,
+	// but for -1
+	vanish := flag(ir.Eq, op(ir.Lt, ax, c(1)), op(ir.Gt, y, c(0)))
+	returnIf(op(ir.Ge, ay, c(1<<63)), b.Select(c(1), b.Select(c(0), inf, vanish), op(ir.Eq, x, c(-1))))
+	returnIf(op(ir.Eq, y, c(0.5)), op(ir.Sqrt, x))
+	returnIf(op(ir.Eq, y, c(-0.5)), op(ir.Div, c(1), op(ir.Sqrt, x)))
+	// negative numbers have no real powers but to integers
+	returnIf(flag(ir.And, op(ir.Lt, x, c(0)), flag(ir.Eqz, integer)), nan)
+
+	// the fraction of |y| is rounded into [-0.5, 0.5]
+	yi := op(ir.Trunc, ay)
+	yf := op(ir.Sub, ay, yi)
+	up := op(ir.Gt, yf, c(0.5))
+	yf = b.Select(op(ir.Sub, yf, c(1)), yf, up)
+	yi = b.Select(op(ir.Add, yi, c(1)), yi, up)
+	n := b.Op(ir.TruncSatF64U, ir.I64, yi)
+
+	// result * 2^exponent is the power so far, and square * 2^scale is |x|
+	// raised to the bit of n reached. The scale stops growing once the
+	// result is bound to overflow or underflow, so that the sums cannot.
+	result, exponent := f.NewLocal("result", ir.F64), f.NewLocal("exponent", ir.I64)
+	square, scale := f.NewLocal("square", ir.F64), f.NewLocal("scale", ir.I64)
+	b.Copy(result, exp(b, op(ir.Mul, yf, log(b, ax))))
+	b.Copy(exponent, ir.Int(ir.I64, 0))
+	fraction, power := frexp(b, ax)
+	b.Copy(square, fraction)
+	b.Copy(scale, b.Op(ir.ExtendI32S, ir.I64, power))
+	for bit := range 63 {
+		product := op(ir.Mul, ir.Use(result), ir.Use(square))
+		set := long(ir.Ne, long(ir.And, n, ir.Int(ir.I64, int64(1)<<bit)), ir.Int(ir.I64, 0))
+		b.Copy(result, b.Select(product, ir.Use(result), set))
+		sum := long(ir.Add, ir.Use(exponent), ir.Use(scale))
+		b.Copy(exponent, b.Select(sum, ir.Use(exponent), set))
+		if bit == 62 {
+			break
+		}
+		b.Copy(square, op(ir.Mul, ir.Use(square), ir.Use(square)))
+		low := op(ir.Lt, ir.Use(square), c(0.5))
+		b.Copy(square, b.Select(op(ir.Add, ir.Use(square), ir.Use(square)), ir.Use(square), low))
+		doubled := long(ir.Sub, long(ir.Shl, ir.Use(scale), ir.Int(ir.I64, 1)), b.Op(ir.ExtendI32U, ir.I64, low))
+		bounded := long(ir.LtU, long(ir.Add, ir.Use(scale), ir.Int(ir.I64, 1<<12)), ir.Int(ir.I64, 1<<13))
+		b.Copy(scale, b.Select(doubled, ir.Use(scale), bounded))
+	}
+	negative := op(ir.Lt, y, c(0))
+	b.Copy(result, b.Select(op(ir.Div, c(1), ir.Use(result)), ir.Use(result), negative))
+	b.Copy(exponent, b.Select(long(ir.Sub, ir.Int(ir.I64, 0), ir.Use(exponent)), ir.Use(exponent), negative))
+	value := ldexp(b, ir.Use(result), ir.Use(exponent))
+	b.Terminate(&ir.Return{Values: []ir.Value{b.Select(op(ir.Neg, value), value, negate)}})
+	return f
+}
+
+// The constants of log and exp, from Go's math package and FreeBSD's
+// msun before it.
+const (
+	ln2Hi = 6.93147180369123816490e-01
+	ln2Lo = 1.90821492927058770002e-10
+	log2e = 1.44269504088896338700e+00
+
+	logL1 = 6.666666666666735130e-01
+	logL2 = 3.999999999940941908e-01
+	logL3 = 2.857142874366239149e-01
+	logL4 = 2.222219843214978396e-01
+	logL5 = 1.818357216161805012e-01
+	logL6 = 1.531383769920937332e-01
+	logL7 = 1.479819860511658591e-01
+
+	expP1        = 1.66666666666666657415e-01
+	expP2        = -2.77777777770155933842e-03
+	expP3        = 6.61375632143793436117e-05
+	expP4        = -1.65339022054652515390e-06
+	expP5        = 4.13813679705723846039e-08
+	expOverflow  = 7.09782712893383973096e+02
+	expUnderflow = -7.45133219101941108420e+02
+	expNearZero  = 1.0 / (1 << 28)
+)
+
+// log computes the natural logarithm of a finite positive f64.
+func log(b *ir.Builder, x ir.Value) ir.Value {
+	c := func(value float64) ir.Value { return ir.Float(ir.F64, value) }
+	op := func(op ir.Op, args ...ir.Value) ir.Value { return b.Op(op, ir.F64, args...) }
+
+	fraction, exponent := frexp(b, x)
+	below := op(ir.Lt, fraction, c(math.Sqrt2/2))
+	fraction = b.Select(op(ir.Add, fraction, fraction), fraction, below)
+	exponent = b.Op(ir.Sub, ir.I32, exponent, below)
+
+	f := op(ir.Sub, fraction, c(1))
+	k := b.Op(ir.ConvertI32S, ir.F64, exponent)
+	s := op(ir.Div, f, op(ir.Add, c(2), f))
+	s2 := op(ir.Mul, s, s)
+	s4 := op(ir.Mul, s2, s2)
+	t1 := op(ir.Mul, s2, op(ir.Add, c(logL1), op(ir.Mul, s4, op(ir.Add, c(logL3), op(ir.Mul, s4, op(ir.Add, c(logL5), op(ir.Mul, s4, c(logL7))))))))
+	t2 := op(ir.Mul, s4, op(ir.Add, c(logL2), op(ir.Mul, s4, op(ir.Add, c(logL4), op(ir.Mul, s4, c(logL6))))))
+	r := op(ir.Add, t1, t2)
+	hfsq := op(ir.Mul, op(ir.Mul, c(0.5), f), f)
+	// k*ln2Hi - ((hfsq - (s*(hfsq+r) + k*ln2Lo)) - f)
+	inner := op(ir.Add, op(ir.Mul, s, op(ir.Add, hfsq, r)), op(ir.Mul, k, c(ln2Lo)))
+	return op(ir.Sub, op(ir.Mul, k, c(ln2Hi)), op(ir.Sub, op(ir.Sub, hfsq, inner), f))
+}
+
+// frexp splits a finite positive f64 into a fraction in [0.5, 1) and the
+// i32 power of two it is multiplied by.
+func frexp(b *ir.Builder, x ir.Value) (ir.Value, ir.Value) {
+	// subnormals are scaled into the normal range first
+	subnormal := b.Op(ir.Lt, ir.F64, x, ir.Float(ir.F64, 0x1p-1022))
+	x = b.Select(b.Op(ir.Mul, ir.F64, x, ir.Float(ir.F64, 0x1p52)), x, subnormal)
+	bits := b.Op(ir.ReinterpretF64, ir.I64, x)
+	exponent := b.Op(ir.WrapI64, ir.I32, b.Op(ir.ShrU, ir.I64, bits, ir.Int(ir.I64, 52)))
+	exponent = b.Op(ir.Sub, ir.I32, exponent, b.Select(ir.Int(ir.I32, 1022+52), ir.Int(ir.I32, 1022), subnormal))
+	mantissa := b.Op(ir.And, ir.I64, bits, ir.Int(ir.I64, 1<<52-1))
+	return b.Op(ir.ReinterpretI64, ir.F64, b.Op(ir.Or, ir.I64, mantissa, ir.Int(ir.I64, 1022<<52))), exponent
+}
+
+// ldexp computes x * 2^e for a finite positive f64 and any i64, rounding
+// once when the result is subnormal.
+func ldexp(b *ir.Builder, x, e ir.Value) ir.Value {
+	fraction, exponent := frexp(b, x)
+	e = b.Op(ir.Add, ir.I64, e, b.Op(ir.ExtendI32S, ir.I64, exponent))
+	// anything beyond overflows or underflows all the same
+	e = b.Select(ir.Int(ir.I64, -1100), e, b.Op(ir.LtS, ir.I64, e, ir.Int(ir.I64, -1100)))
+	e = b.Select(ir.Int(ir.I64, 1100), e, b.Op(ir.GtS, ir.I64, e, ir.Int(ir.I64, 1100)))
+	return scale(b, fraction, b.Op(ir.WrapI64, ir.I32, e))
+}
+
+// exp computes e to the power of an f64 that is not NaN.
+func exp(b *ir.Builder, x ir.Value) ir.Value {
+	c := func(value float64) ir.Value { return ir.Float(ir.F64, value) }
+	op := func(op ir.Op, args ...ir.Value) ir.Value { return b.Op(op, ir.F64, args...) }
+
+	// x = k ln 2 + r, with |r| <= 0.5 ln 2 kept as hi - lo
+	half := b.Select(c(-0.5), c(0.5), op(ir.Lt, x, c(0)))
+	k := b.Op(ir.TruncSatF64S, ir.I32, op(ir.Add, op(ir.Mul, c(log2e), x), half))
+	fk := b.Op(ir.ConvertI32S, ir.F64, k)
+	hi := op(ir.Sub, x, op(ir.Mul, fk, c(ln2Hi)))
+	lo := op(ir.Mul, fk, c(ln2Lo))
+	r := op(ir.Sub, hi, lo)
+	t := op(ir.Mul, r, r)
+	poly := op(ir.Mul, t, op(ir.Add, c(expP1), op(ir.Mul, t, op(ir.Add, c(expP2), op(ir.Mul, t, op(ir.Add, c(expP3), op(ir.Mul, t, op(ir.Add, c(expP4), op(ir.Mul, t, c(expP5))))))))))
+	cr := op(ir.Sub, r, poly)
+	// 1 - ((lo - (r*cr)/(2-cr)) - hi)
+	y := op(ir.Sub, c(1), op(ir.Sub, op(ir.Sub, lo, op(ir.Div, op(ir.Mul, r, cr), op(ir.Sub, c(2), cr))), hi))
+
+	y = scale(b, y, k)
+
+	y = b.Select(op(ir.Add, c(1), x), y, op(ir.Lt, op(ir.Abs, x), c(expNearZero)))
+	y = b.Select(c(0), y, op(ir.Lt, x, c(expUnderflow)))
+	return b.Select(c(math.Inf(1)), y, op(ir.Gt, x, c(expOverflow)))
+}
+
+// scale computes x * 2^k for k from -2044 to 2046, in two steps so that both
+// powers of two are normal.
+func scale(b *ir.Builder, x, k ir.Value) ir.Value {
+	half := b.Op(ir.ShrS, ir.I32, k, ir.Int(ir.I32, 1))
+	x = b.Op(ir.Mul, ir.F64, x, powerOfTwo(b, half))
+	return b.Op(ir.Mul, ir.F64, x, powerOfTwo(b, b.Op(ir.Sub, ir.I32, k, half)))
+}
+
+// powerOfTwo returns 2^k as an f64, for k from -1022 to 1023.
+func powerOfTwo(b *ir.Builder, k ir.Value) ir.Value {
+	biased := b.Op(ir.Add, ir.I64, b.Op(ir.ExtendI32S, ir.I64, k), ir.Int(ir.I64, 1023))
+	return b.Op(ir.ReinterpretI64, ir.F64, b.Op(ir.Shl, ir.I64, biased, ir.Int(ir.I64, 52)))
+}
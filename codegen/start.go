@@ -0,0 +1,227 @@
+package codegen
+
+import (
+	"maps"
+	"strings"
+
+	"github.com/LaH-DeV/veles/ast"
+	"github.com/LaH-DeV/veles/checker"
+	"github.com/LaH-DeV/veles/ir"
+	"github.com/LaH-DeV/veles/opt"
+	"github.com/LaH-DeV/veles/types"
+)
+
+// Global variables become WebAssembly globals, which are initialized with
+// constants. Initializers computing on constants and on other constant
+// globals, like TAU = PI * 2, are evaluated at compile time. The others run in
+// the start function __start when the module is instantiated, module after
+// module so that the modules a module uses are initialized before it, and in
+// the order of their declarations within a module. Until then their globals
+// hold zero values.
+
+// initializer is the initializer of a global variable that runs in the start
+// function.
+type initializer struct {
+	module *checker.Module
+	decl   *ast.VariableDeclarationStmt
+	symbol *checker.Symbol
+}
+
+// ordered returns the modules of the program, every module after the modules
+// it uses and in the order of the program otherwise.
+func (g *generator) ordered() []*checker.Module {
+	uses := map[*checker.Module]map[*checker.Module]bool{}
+	for _, module := range g.program.Modules {
+		used := map[*checker.Module]bool{}
+		for _, symbol := range module.Info.Uses {
+			used[symbol.Module] = true
+		}
+		for _, symbol := range module.Info.Imports {
+			used[symbol.Module] = true
+		}
+		for _, symbol := range module.Info.Defs {
+			if symbol.Kind == checker.ModuleSymbol {
+				used[symbol.Target] = true
+			}
+		}
+		uses[module] = used
+	}
+	var modules []*checker.Module
+	visited := map[*checker.Module]bool{}
+	var visit func(module *checker.Module)
+	visit = func(module *checker.Module) {
+		if visited[module] {
+			return
+		}
+		// imports cannot form cycles
+		visited[module] = true
+		for _, other := range g.program.Modules {
+			if other != module && uses[module][other] {
+				visit(other)
+			}
+		}
+		modules = append(modules, module)
+	}
+	for _, module := range g.program.Modules {
+		visit(module)
+	}
+	return modules
+}
+
+// initializeAtStart gives a global variable zero values and queues its
+// initializer to run in the start function. The globals are assigned there,
+// so they are mutable, but for the address of a struct or an array, whose
+// value is copied into the memory it points to.
+func (g *generator) initializeAtStart(decl *ast.VariableDeclarationStmt, symbol *checker.Symbol) {
+	g.global(symbol, g.zeroConstant(symbol.Type)...)
+	if !inMemory(symbol.Type) {
+		for _, name := range parts(qualifiedName(symbol), symbol.Type) {
+			g.ir.Global(name).Mutable = true
+		}
+	}
+	g.initializers = append(g.initializers, initializer{g.module, decl, symbol})
+}
+
+// start creates the start function running the initializers that are not
+// constant.
+func (g *generator) start() {
+	if len(g.initializers) == 0 {
+		return
+	}
+	f := ir.NewFunction("__start", nil)
+	b := ir.NewBuilder(f)
+	for _, init := range g.initializers {
+		g.module, g.context = init.module, qualifiedName(init.symbol)
+		g.b, g.result, g.locals = b, types.Void, map[*checker.Symbol][]*ir.Local{}
+		names := parts(qualifiedName(init.symbol), init.symbol.Type)
+		if inMemory(init.symbol.Type) {
+			size, _ := sizeOf(init.symbol.Type)
+			g.copy(b.GlobalGet(names[0], ir.I32), g.expr(init.decl.Value)[0], size)
+		} else {
+			for i, value := range g.exprAs(init.decl.Value, init.symbol.Type) {
+				b.GlobalSet(names[i], value)
+			}
+		}
+		// the function expressions of the initializer are lowered while
+		// its module is the current one
+		g.lambdas()
+	}
+	b.Terminate(&ir.Return{})
+	g.ir.Functions = append(g.ir.Functions, f)
+	g.ir.Start = f.Name
+	g.module = nil
+}
+
+// evaluate computes the initializer of a global variable of a number or bool
+// type at compile time, when it only computes on constants and on the
+// globals of other variables initialized with constants. The initializer is
+// lowered into a function of its own, which is then run.
+func (g *generator) evaluate(expr ast.Expr, t types.Type) (ir.Value, bool) {
+	if !g.computable(expr) {
+		return ir.Value{}, false
+	}
+	pows := maps.Clone(g.pows)
+	f := ir.NewFunction("", []ir.Type{valueType(t)})
+	g.b, g.result, g.locals = ir.NewBuilder(f), t, map[*checker.Symbol][]*ir.Local{}
+	g.b.Terminate(&ir.Return{Values: g.exprAs(expr, t)})
+
+	known := map[*ir.Local]ir.Value{}
+	get := func(value ir.Value) (ir.Value, bool) {
+		if value.IsConst() {
+			return value, true
+		}
+		value, ok := known[value.Local]
+		return value, ok
+	}
+	block := f.Blocks[0]
+	for {
+		for _, instr := range block.Instrs {
+			args := make([]ir.Value, len(instr.Args))
+			for i, arg := range instr.Args {
+				value, ok := get(arg)
+				if !ok {
+					return ir.Value{}, false
+				}
+				args[i] = value
+			}
+			var result ir.Value
+			ok := len(instr.Dests) == 1
+			switch {
+			case !ok:
+			case instr.Op == ir.Copy:
+				result = args[0]
+			case instr.Op == ir.Select && args[2].Bits != 0:
+				result = args[0]
+			case instr.Op == ir.Select:
+				result = args[1]
+			case instr.Op == ir.GlobalGet:
+				global := g.ir.Global(instr.Name)
+				ok = global != nil && !global.Mutable
+				if ok {
+					result = global.Init
+				}
+			case instr.Op == ir.Call && strings.HasPrefix(instr.Name, "__pow_"):
+				// the powers of other constant globals
+				result, ok = powConstant(powTypes[instr.Name], args[0], args[1])
+			default:
+				result, ok = opt.Evaluate(instr.Op, instr.Type, args)
+			}
+			if !ok {
+				return ir.Value{}, false
+			}
+			known[instr.Dests[0]] = result
+		}
+		switch term := block.Term.(type) {
+		case *ir.Jump:
+			block = term.Target
+		case *ir.Branch:
+			cond, ok := get(term.Cond)
+			if !ok {
+				return ir.Value{}, false
+			}
+			block = term.Else
+			if cond.Bits != 0 {
+				block = term.Then
+			}
+		case *ir.Return:
+			value, ok := get(term.Values[0])
+			if ok {
+				// the runtime functions the initializer would call are not
+				// needed after all
+				g.pows = pows
+			}
+			return value, ok
+		default:
+			return ir.Value{}, false
+		}
+	}
+}
+
+// powTypes maps the runtime functions raising to powers to the types they
+// raise.
+var powTypes = map[string]types.Type{
+	"__pow_i32": types.I32, "__pow_i64": types.I64,
+	"__pow_u32": types.U32, "__pow_u64": types.U64,
+	"__pow_f64": types.F64,
+}
+
+// computable reports whether an expression only computes on literals and
+// global variables of number and bool types, so that lowering it adds nothing
+// to the module but the runtime functions raising to powers.
+func (g *generator) computable(expr ast.Expr) bool {
+	switch expr := expr.(type) {
+	case *ast.IntegerExpr, *ast.FloatExpr, *ast.BooleanExpr:
+		return true
+	case *ast.SymbolExpr, *ast.MemberExpr:
+		symbol := g.module.Info.Uses[expr]
+		return symbol != nil && symbol.Kind == checker.GlobalSymbol &&
+			(types.IsNumeric(symbol.Type) || symbol.Type == types.Bool)
+	case *ast.PrefixExpr:
+		return g.computable(expr.Right)
+	case *ast.BinaryExpr:
+		return g.computable(expr.Left) && g.computable(expr.Right)
+	case *ast.CastExpr:
+		return g.computable(expr.Value)
+	}
+	return false
+}
@@ -0,0 +1,595 @@
+package codegen
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/LaH-DeV/veles/ir"
+	"github.com/LaH-DeV/veles/opt"
+)
+
+// GenerateIR lowers a checked program into a module of the IR and optimizes
+// it.
+func GenerateIR(program *Program, options Options) (*ir.Module, Diagnostics) {
+	module, diags := Lower(program, options)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	if err := ir.Verify(module); err != nil {
+		panic("codegen: invalid IR: " + err.Error())
+	}
+	opt.Run(module, options.Optimize)
+	return module, diags
+}
+
+// GenerateWat compiles a checked program into a single module in the
+// WebAssembly text format.
+func GenerateWat(program *Program, options Options) (string, Diagnostics) {
+	module, diags := GenerateIR(program, options)
+	if module == nil {
+		return "", diags
+	}
+	return Wat(module), diags
+}
+
+// Wat renders a module of the IR in the WebAssembly text format.
+func Wat(m *ir.Module) string {
+	var out strings.Builder
+	out.WriteString("(module\n")
+	for _, imp := range m.Imports {
+		fmt.Fprintf(&out, "  (import \"%s\" \"%s\" (func $%s%s))\n", escapeData([]byte(imp.Module)), escapeData([]byte(imp.Field)), imp.Name, watSignature(imp.Sig, nil))
+	}
+	for _, global := range m.Globals {
+		t := global.Type.String()
+		if global.Mutable {
+			t = "(mut " + t + ")"
+		}
+		fmt.Fprintf(&out, "  (global $%s %s (%s))\n", global.Name, t, constInstr(global.Init))
+	}
+	memory := len(m.Data) > 0
+	indirect := len(m.Table) > 0
+	for _, f := range m.Functions {
+		w := &funcWriter{f: f}
+		out.WriteString(w.function())
+		memory = memory || w.memory
+		indirect = indirect || w.indirect
+	}
+	if indirect {
+		fmt.Fprintf(&out, "  (table $__functions %d funcref)\n", len(m.Table))
+		if len(m.Table) > 0 {
+			fmt.Fprintf(&out, "  (elem (i32.const 0) func $%s)\n", strings.Join(m.Table, " $"))
+		}
+	}
+	for _, export := range m.Exports {
+		if export.Global != "" {
+			fmt.Fprintf(&out, "  (export %q (global $%s))\n", export.Name, export.Global)
+		} else {
+			fmt.Fprintf(&out, "  (export %q (func $%s))\n", export.Name, export.Function)
+		}
+	}
+	if m.Start != "" {
+		fmt.Fprintf(&out, "  (start $%s)\n", m.Start)
+	}
+	if memory {
+		// exported so that host functions can read the strings and
+		// structs they are passed
+		pages := max((len(m.Data)+65535)/65536, 1)
+		fmt.Fprintf(&out, "  (memory (export \"memory\") %d)\n", pages)
+		if len(m.Data) > 0 {
+			fmt.Fprintf(&out, "  (data (i32.const 0) \"%s\")\n", escapeData(m.Data))
+		}
+	}
+	out.WriteString(")\n")
+	return out.String()
+}
+
+// watSignature renders the parameters and the results of a function, naming
+// the parameters when params is not nil.
+func watSignature(sig *ir.Signature, params []*ir.Local) string {
+	var str string
+	for i, t := range sig.Params {
+		if params != nil {
+			str += fmt.Sprintf(" (param $%s %s)", params[i].Name, t)
+		} else {
+			str += fmt.Sprintf(" (param %s)", t)
+		}
+	}
+	if len(sig.Results) > 0 {
+		results := make([]string, len(sig.Results))
+		for i, t := range sig.Results {
+			results[i] = t.String()
+		}
+		str += fmt.Sprintf(" (result %s)", strings.Join(results, " "))
+	}
+	return str
+}
+
+// constInstr renders the instruction pushing a constant.
+func constInstr(value ir.Value) string {
+	if value.Type.IsInteger() {
+		return fmt.Sprintf("%s.const %d", value.Type, value.Int())
+	}
+	return fmt.Sprintf("%s.const %s", value.Type, ir.FormatFloat(value.Float(), value.Type))
+}
+
+// escapeData renders bytes as the contents of a WebAssembly string.
+func escapeData(data []byte) string {
+	var str strings.Builder
+	for _, b := range data {
+		if b >= 0x20 && b < 0x7f && b != '"' && b != '\\' {
+			str.WriteByte(b)
+		} else {
+			fmt.Fprintf(&str, "\\%02x", b)
+		}
+	}
+	return str.String()
+}
+
+// WebAssembly has no jumps between blocks, only branches out of nested
+// blocks, ifs and loops, so the blocks of a function are arranged along its
+// dominator tree. A block is written inside the block dominating it, in one of
+// two ways. A block reached from a single branch is written in place of that
+// branch. A block reached from several branches, or from a switch, follows a
+// WebAssembly block enclosing the code of its dominator, and the branches to
+// it leave that block with br:
+//
+//	block $b3
+//	  the code of b0, branching to b3 with br $b3
+//	end
+//	the code of b3
+//
+// This works for acyclic control flow, where branches only lead forward. The
+// result is then simplified: branches to the end of the block they are in and
+// blocks no branch leaves are removed, so that most ifs come out as plain ifs.
+// An if whose arms both end by assigning the local read right after it, and
+// nowhere else, leaves the value on the stack instead, as an if (result T).
+//
+// Within a block, the temporary value of an instruction used once, by a later
+// instruction of the same block, is left on the stack rather than stored in
+// its local when the stack order allows it.
+
+// wasmNode is an instruction of the output, or a block or an if holding
+// instructions.
+type wasmNode struct {
+	instr  string // the instruction, or "block" or "if"
+	label  string // a block: the label branched to
+	result string // an if: the type of the value it leaves, or ""
+	body   []*wasmNode
+	els    []*wasmNode
+}
+
+type funcWriter struct {
+	f        *ir.Function
+	memory   bool // whether the function uses linear memory
+	indirect bool // whether the function calls through the table
+
+	children []([]*ir.Block) // the blocks every block immediately dominates
+	labelled []bool          // whether a block is branched to with br
+	uses     map[*ir.Local]int
+	stacked  map[*ir.Local]bool // the locals whose value can stay on the stack
+
+	seq   *[]*wasmNode // the sequence the output is appended to
+	stack []*ir.Local  // the values left on the stack
+}
+
+func (w *funcWriter) function() string {
+	w.analyze()
+	var body []*wasmNode
+	w.seq = &body
+	if len(w.f.Blocks) > 0 {
+		w.tree(w.f.Blocks[0])
+	}
+	body = w.typedIfs(simplify(body, ""))
+	used := map[string]bool{}
+	referenced(body, used)
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "  (func $%s%s\n", w.f.Name, watSignature(w.f.Signature(), w.f.Params))
+	for _, local := range w.f.Locals {
+		if used[local.Name] {
+			fmt.Fprintf(&out, "    (local $%s %s)\n", local.Name, local.Type)
+		}
+	}
+	write(&out, body, 2)
+	out.WriteString("  )\n")
+	return out.String()
+}
+
+// analyze computes the dominator tree of the reachable blocks, the blocks
+// branched to with br, and the locals whose values can stay on the stack.
+func (w *funcWriter) analyze() {
+	f := w.f
+	reachable := f.Reachable()
+	w.children = make([][]*ir.Block, len(f.Blocks))
+	for i, dom := range f.Dominators() {
+		if dom >= 0 {
+			w.children[dom] = append(w.children[dom], f.Blocks[i])
+		}
+	}
+
+	edges := make([]int, len(f.Blocks))
+	w.labelled = make([]bool, len(f.Blocks))
+	type site struct {
+		block *ir.Block
+		pos   int
+	}
+	defs, uses := map[*ir.Local][]site{}, map[*ir.Local][]site{}
+	use := func(values []ir.Value, at site) {
+		for _, value := range values {
+			if value.Local != nil {
+				uses[value.Local] = append(uses[value.Local], at)
+			}
+		}
+	}
+	for _, block := range f.Blocks {
+		if !reachable[block.Index] {
+			continue
+		}
+		for pos, instr := range block.Instrs {
+			use(instr.Args, site{block, pos})
+			for _, dest := range instr.Dests {
+				defs[dest] = append(defs[dest], site{block, pos})
+			}
+		}
+		end := site{block, len(block.Instrs)}
+		switch term := block.Term.(type) {
+		case *ir.Jump:
+			edges[term.Target.Index]++
+		case *ir.Branch:
+			use([]ir.Value{term.Cond}, end)
+			edges[term.Then.Index]++
+			edges[term.Else.Index]++
+		case *ir.Switch:
+			use([]ir.Value{term.Value}, end)
+			for _, target := range term.Succs() {
+				w.labelled[target.Index] = true
+			}
+		case *ir.Return:
+			use(term.Values, end)
+		}
+	}
+	for i, n := range edges {
+		w.labelled[i] = w.labelled[i] || n > 1
+	}
+
+	w.uses = map[*ir.Local]int{}
+	w.stacked = map[*ir.Local]bool{}
+	for local, sites := range uses {
+		w.uses[local] = len(sites)
+		def := defs[local]
+		w.stacked[local] = len(def) == 1 && len(sites) == 1 &&
+			def[0].block == sites[0].block && def[0].pos < sites[0].pos
+	}
+}
+
+func (w *funcWriter) emit(instr string) {
+	*w.seq = append(*w.seq, &wasmNode{instr: instr})
+}
+
+// tree writes a block and the blocks it dominates.
+func (w *funcWriter) tree(block *ir.Block) {
+	var merges []*ir.Block
+	for _, child := range w.children[block.Index] {
+		if w.labelled[child.Index] {
+			merges = append(merges, child)
+		}
+	}
+	w.within(block, merges)
+}
+
+// within writes a block inside WebAssembly blocks for the blocks it
+// dominates that are branched to with br, the last one outermost, each
+// followed by its code.
+func (w *funcWriter) within(block *ir.Block, merges []*ir.Block) {
+	if len(merges) == 0 {
+		w.code(block)
+		return
+	}
+	last := merges[len(merges)-1]
+	node := &wasmNode{instr: "block", label: label(last)}
+	outer := w.seq
+	w.seq = &node.body
+	w.within(block, merges[:len(merges)-1])
+	w.seq = outer
+	*w.seq = append(*w.seq, node)
+	w.tree(last)
+}
+
+func label(block *ir.Block) string {
+	return "$b" + strconv.Itoa(block.Index)
+}
+
+// code writes the instructions and the terminator of a block.
+func (w *funcWriter) code(block *ir.Block) {
+	for _, instr := range block.Instrs {
+		w.instr(instr)
+	}
+	switch term := block.Term.(type) {
+	case *ir.Jump:
+		w.flush()
+		w.branch(term.Target)
+	case *ir.Branch:
+		w.push([]ir.Value{term.Cond})
+		node := &wasmNode{instr: "if"}
+		outer := w.seq
+		w.seq = &node.body
+		w.branch(term.Then)
+		w.seq = &node.els
+		w.branch(term.Else)
+		w.seq = outer
+		*w.seq = append(*w.seq, node)
+	case *ir.Switch:
+		w.push([]ir.Value{term.Value})
+		targets := ""
+		for _, target := range term.Targets {
+			targets += " " + label(target)
+		}
+		w.emit("br_table" + targets + " " + label(term.Default))
+	case *ir.Return:
+		w.push(term.Values)
+		w.emit("return")
+	default:
+		w.flush()
+		w.emit("unreachable")
+	}
+}
+
+// branch continues with a block: it is written in place, or branched to.
+func (w *funcWriter) branch(target *ir.Block) {
+	if w.labelled[target.Index] {
+		w.emit("br " + label(target))
+		return
+	}
+	w.tree(target)
+}
+
+func (w *funcWriter) instr(instr *ir.Instr) {
+	w.push(instr.Args)
+	switch {
+	case instr.Op == ir.Copy:
+	case instr.Op.Typed():
+		text := instr.Type.String() + "." + string(instr.Op)
+		if instr.Offset != 0 {
+			text += " offset=" + strconv.Itoa(instr.Offset)
+		}
+		w.memory = w.memory || instr.Op.IsMemory()
+		w.emit(text)
+	case instr.Op == ir.Call, instr.Op == ir.GlobalGet, instr.Op == ir.GlobalSet:
+		w.emit(string(instr.Op) + " $" + instr.Name)
+	case instr.Op == ir.Select:
+		w.emit("select")
+	case instr.Op == ir.CallIndirect:
+		w.indirect = true
+		w.emit("call_indirect" + watSignature(instr.Sig, nil))
+	default:
+		w.memory = true
+		w.emit(string(instr.Op))
+	}
+
+	// the results are on the stack, the last one on top
+	keep := 0
+	for keep < len(instr.Dests) && w.stacked[instr.Dests[keep]] {
+		keep++
+	}
+	for i := len(instr.Dests) - 1; i >= keep; i-- {
+		w.set(instr.Dests[i])
+	}
+	w.stack = append(w.stack, instr.Dests[:keep]...)
+}
+
+// push pushes the operands of an instruction. Operands left on the stack are
+// used in place when they are its topmost values in the right order. When
+// they are not, every value on the stack is stored into its local first.
+func (w *funcWriter) push(args []ir.Value) {
+	n := w.onStack(args)
+	if n < 0 {
+		w.flush()
+		n = 0
+	}
+	w.stack = w.stack[:len(w.stack)-n]
+	for _, arg := range args[n:] {
+		if arg.IsConst() {
+			w.emit(constInstr(arg))
+		} else {
+			w.emit("local.get $" + arg.Local.Name)
+		}
+	}
+}
+
+// onStack returns the number of leading operands that are the topmost values
+// of the stack, or -1 when the other operands are on the stack too.
+func (w *funcWriter) onStack(args []ir.Value) int {
+	for n := min(len(args), len(w.stack)); n >= 0; n-- {
+		top := w.stack[len(w.stack)-n:]
+		matches := true
+		for i := range n {
+			matches = matches && args[i].Local == top[i]
+		}
+		if !matches {
+			continue
+		}
+		for _, arg := range args[n:] {
+			for _, local := range w.stack {
+				if arg.Local == local {
+					return -1
+				}
+			}
+		}
+		return n
+	}
+	return -1
+}
+
+// flush stores the values left on the stack into their locals.
+func (w *funcWriter) flush() {
+	for i := len(w.stack) - 1; i >= 0; i-- {
+		w.set(w.stack[i])
+	}
+	w.stack = nil
+}
+
+// set stores the value on top of the stack into a local, or drops it when
+// the local is never read.
+func (w *funcWriter) set(local *ir.Local) {
+	if w.uses[local] == 0 {
+		w.emit("drop")
+		return
+	}
+	w.emit("local.set $" + local.Name)
+}
+
+// simplify removes the branches to the end of the sequence, where falling off
+// its end continues after the block labelled next, and the blocks no branch
+// leaves. An if whose first arm never falls off its end is followed by its
+// second arm rather than holding it.
+func simplify(nodes []*wasmNode, next string) []*wasmNode {
+	var out []*wasmNode
+	for i, node := range nodes {
+		follow := ""
+		if i == len(nodes)-1 {
+			follow = next
+		}
+		switch node.instr {
+		case "br " + follow:
+			if follow != "" {
+				continue
+			}
+		case "block":
+			node.body = simplify(node.body, node.label)
+			if !branches(node.body, node.label) {
+				out = append(out, node.body...)
+				continue
+			}
+		case "if":
+			node.body = simplify(node.body, follow)
+			node.els = simplify(node.els, follow)
+			if len(node.els) > 0 && !fallsThrough(node.body) {
+				out = append(out, node)
+				out = append(out, node.els...)
+				node.els = nil
+				continue
+			}
+		}
+		out = append(out, node)
+	}
+	// a value stored and read right away stays on the stack
+	for i := 0; i+1 < len(out); i++ {
+		name, ok := strings.CutPrefix(out[i].instr, "local.set ")
+		if ok && out[i+1].instr == "local.get "+name {
+			out[i].instr = "local.tee " + name
+			out = append(out[:i+1], out[i+2:]...)
+		}
+	}
+	return out
+}
+
+// typedIfs turns the ifs whose arms both end by assigning a local, read only
+// by the instruction following the if, into ifs leaving the value on the
+// stack.
+func (w *funcWriter) typedIfs(nodes []*wasmNode) []*wasmNode {
+	for i := 0; i < len(nodes); i++ {
+		node := nodes[i]
+		node.body = w.typedIfs(node.body)
+		node.els = w.typedIfs(node.els)
+		if node.instr != "if" || len(node.body) == 0 || len(node.els) == 0 || i+1 == len(nodes) {
+			continue
+		}
+		name, ok := strings.CutPrefix(node.body[len(node.body)-1].instr, "local.set $")
+		if !ok || node.els[len(node.els)-1].instr != "local.set $"+name || nodes[i+1].instr != "local.get $"+name {
+			continue
+		}
+		local := w.local(name)
+		if local == nil || w.uses[local] != 1 {
+			continue
+		}
+		node.body = node.body[:len(node.body)-1]
+		node.els = node.els[:len(node.els)-1]
+		node.result = local.Type.String()
+		nodes = append(nodes[:i+1], nodes[i+2:]...)
+	}
+	return nodes
+}
+
+// local returns the local of the function with the given name, or nil.
+func (w *funcWriter) local(name string) *ir.Local {
+	for _, local := range w.f.Locals {
+		if local.Name == name {
+			return local
+		}
+	}
+	return nil
+}
+
+// referenced adds the names of the locals a sequence refers to to names.
+func referenced(nodes []*wasmNode, names map[string]bool) {
+	for _, node := range nodes {
+		for _, prefix := range []string{"local.get $", "local.set $", "local.tee $"} {
+			if name, ok := strings.CutPrefix(node.instr, prefix); ok {
+				names[name] = true
+			}
+		}
+		referenced(node.body, names)
+		referenced(node.els, names)
+	}
+}
+
+// fallsThrough reports whether running a sequence can continue after its
+// end.
+func fallsThrough(nodes []*wasmNode) bool {
+	if len(nodes) == 0 {
+		return true
+	}
+	last := nodes[len(nodes)-1]
+	switch {
+	case last.instr == "unreachable", last.instr == "return",
+		strings.HasPrefix(last.instr, "br "), strings.HasPrefix(last.instr, "br_table "):
+		return false
+	case last.instr == "if":
+		return len(last.els) == 0 || fallsThrough(last.body) || fallsThrough(last.els)
+	}
+	return true
+}
+
+// branches reports whether a sequence branches to a label.
+func branches(nodes []*wasmNode, label string) bool {
+	for _, node := range nodes {
+		if node.instr == "br "+label || branches(node.body, label) || branches(node.els, label) {
+			return true
+		}
+		if targets, ok := strings.CutPrefix(node.instr, "br_table "); ok {
+			for _, target := range strings.Fields(targets) {
+				if target == label {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func write(out *strings.Builder, nodes []*wasmNode, indent int) {
+	prefix := strings.Repeat("  ", indent)
+	for _, node := range nodes {
+		switch node.instr {
+		case "block":
+			fmt.Fprintf(out, "%sblock %s\n", prefix, node.label)
+			write(out, node.body, indent+1)
+			fmt.Fprintf(out, "%send\n", prefix)
+		case "if":
+			if node.result != "" {
+				fmt.Fprintf(out, "%sif (result %s)\n", prefix, node.result)
+			} else {
+				fmt.Fprintf(out, "%sif\n", prefix)
+			}
+			write(out, node.body, indent+1)
+			if len(node.els) > 0 {
+				fmt.Fprintf(out, "%selse\n", prefix)
+				write(out, node.els, indent+1)
+			}
+			fmt.Fprintf(out, "%send\n", prefix)
+		default:
+			fmt.Fprintf(out, "%s%s\n", prefix, node.instr)
+		}
+	}
+}
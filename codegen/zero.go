@@ -0,0 +1,114 @@
+package codegen
+
+import (
+	"encoding/binary"
+
+	"github.com/LaH-DeV/veles/ir"
+	"github.com/LaH-DeV/veles/types"
+)
+
+// Variables declared without an initializer start as the zero value of their
+// type. Numbers are 0, booleans false, and strings and slices empty; structs
+// and arrays hold the zero values of their fields and elements. A tagged union
+// is its first variant holding zero values, and a function value is a closure
+// with an index beyond the end of the table, so calling it traps.
+
+// zero returns the zero value of type t. Structs and arrays are allocated, so
+// that every variable gets its own.
+func (g *generator) zero(t types.Type) []ir.Value {
+	if inMemory(t) {
+		size, align := sizeOf(t)
+		buf := make([]byte, size)
+		g.zeroValue(buf, 0, t)
+		address := g.alloc(size)
+		if !allZero(buf) {
+			// the heap is never reused, so only values holding addresses
+			// need to be copied
+			g.copy(address, ir.Int(ir.I32, int64(g.place(buf, align))), size)
+		}
+		return []ir.Value{address}
+	}
+	return g.zeroConstant(t)
+}
+
+// zeroConstant returns the zero value of type t as constants, placing structs
+// and arrays in the data segment.
+func (g *generator) zeroConstant(t types.Type) []ir.Value {
+	if inMemory(t) {
+		size, align := sizeOf(t)
+		buf := make([]byte, size)
+		g.zeroValue(buf, 0, t)
+		return []ir.Value{ir.Int(ir.I32, int64(g.place(buf, align)))}
+	}
+	if address, ok := g.zeroAddress(t); ok {
+		return []ir.Value{ir.Int(ir.I32, int64(address))}
+	}
+	var values []ir.Value
+	for _, vt := range valueTypes(t) {
+		values = append(values, ir.Value{Type: vt})
+	}
+	return values
+}
+
+// zeroValue writes the zero value of type t into buf at offset, which holds
+// zero bytes.
+func (g *generator) zeroValue(buf []byte, offset int, t types.Type) {
+	switch t := t.(type) {
+	case *types.Array:
+		size, _ := sizeOf(t.Elem)
+		for i := 0; i < t.Len; i++ {
+			g.zeroValue(buf, offset+i*size, t.Elem)
+		}
+		return
+	case *types.Struct:
+		fieldOffsets := offsets(t)
+		for i, field := range t.Fields {
+			g.zeroValue(buf, offset+fieldOffsets[i], field.Type)
+		}
+		return
+	}
+	if address, ok := g.zeroAddress(t); ok {
+		binary.LittleEndian.PutUint32(buf[offset:], uint32(address))
+	}
+}
+
+// zeroAddress returns the address representing the zero value of a tagged
+// union or a function type, placing it in the data segment the first time.
+func (g *generator) zeroAddress(t types.Type) (int, bool) {
+	switch t := t.(type) {
+	case *types.Enum:
+		if t.IsPlain() {
+			return 0, false
+		}
+		if address, ok := g.zeros[t]; ok {
+			return address, true
+		}
+		variant := t.Variants[0]
+		fieldOffsets, size := variantLayout(variant)
+		// placed before its fields are known, since they may hold the
+		// zero value of the union itself
+		address := g.place(make([]byte, size), 8)
+		g.zeros[t] = address
+		buf := make([]byte, size)
+		for i, field := range variant.Fields {
+			g.zeroValue(buf, fieldOffsets[i], field)
+		}
+		copy(g.data[address:], buf)
+		return address, true
+	case *types.Signature:
+		if g.nilFunction < 0 {
+			g.nilFunction = g.place([]byte{0xff, 0xff, 0xff, 0xff}, 4)
+		}
+		return g.nilFunction, true
+	}
+	return 0, false
+}
+
+func allZero(buf []byte) bool {
+	for _, b := range buf {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,461 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/LaH-DeV/veles/ast"
+	"github.com/LaH-DeV/veles/checker"
+	"github.com/LaH-DeV/veles/codegen"
+	"github.com/LaH-DeV/veles/diagnostics"
+	"github.com/LaH-DeV/veles/index"
+	"github.com/LaH-DeV/veles/ir"
+	"github.com/LaH-DeV/veles/opt"
+	"github.com/LaH-DeV/veles/types"
+	"github.com/LaH-DeV/veles/workspace"
+)
+
+// loadIndex loads every module below root and indexes their symbols.
+func loadIndex(root string) (*index.Index, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("Veles :: %s.", err)
+	}
+	ws := workspace.New(absRoot)
+	files, errs := ws.LoadAll()
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("Veles :: %s.", errs[0])
+	}
+	return index.Build(files), nil
+}
+
+var positionPattern = regexp.MustCompile(`^(.+\.vs):(\d+):(\d+)$`)
+
+// resolveTarget finds the symbol named on the command line, either by a
+// "file.vs:line:column" position or by its (optionally module qualified) name.
+func resolveTarget(ix *index.Index, target string) (*checker.Symbol, error) {
+	if match := positionPattern.FindStringSubmatch(target); match != nil {
+		path, err := filepath.Abs(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("Veles :: %s.", err)
+		}
+		line, _ := strconv.Atoi(match[2])
+		column, _ := strconv.Atoi(match[3])
+		for _, file := range ix.Files() {
+			if file.Path == path {
+				if occurrence, found := ix.At(path, file.Source.Offset(line, column)); found {
+					return occurrence.Symbol, nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("Veles :: No symbol at \"%s\".", target)
+	}
+
+	symbols := ix.Lookup(target)
+	switch len(symbols) {
+	case 0:
+		return nil, fmt.Errorf("Veles :: No top-level symbol named \"%s\".", target)
+	case 1:
+		return symbols[0], nil
+	}
+	candidates := make([]string, 0, len(symbols))
+	for _, symbol := range symbols {
+		candidates = append(candidates, symbol.Module.Name+"::"+symbol.Name)
+	}
+	sort.Strings(candidates)
+	return nil, fmt.Errorf("Veles :: \"%s\" is ambiguous, use one of: %s.", target, strings.Join(candidates, ", "))
+}
+
+func displayPath(path string) string {
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return rel
+		}
+	}
+	return path
+}
+
+func runRefs(args []string) error {
+	flags := flag.NewFlagSet("refs", flag.ContinueOnError)
+	root := flags.String("root", ".", "directory the module paths are relative to")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("Veles :: usage: veles refs [-root dir] <name | file.vs:line:column>")
+	}
+
+	ix, err := loadIndex(*root)
+	if err != nil {
+		return err
+	}
+	symbol, err := resolveTarget(ix, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	for _, occurrence := range ix.References(symbol, true) {
+		kind := "reference"
+		if occurrence.Declaration {
+			kind = "declaration"
+		}
+		line := strings.TrimSpace(occurrence.File.Source.Line(occurrence.Span.Start.Line))
+		fmt.Printf("%s:%d:%d: %s: %s\n", displayPath(occurrence.File.Path), occurrence.Span.Start.Line, occurrence.Span.Start.Column, kind, line)
+	}
+	return nil
+}
+
+func runRename(args []string) error {
+	flags := flag.NewFlagSet("rename", flag.ContinueOnError)
+	root := flags.String("root", ".", "directory the module paths are relative to")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return fmt.Errorf("Veles :: usage: veles rename [-root dir] <name | file.vs:line:column> <new name>")
+	}
+
+	ix, err := loadIndex(*root)
+	if err != nil {
+		return err
+	}
+	symbol, err := resolveTarget(ix, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	edits, err := ix.Rename(symbol, flags.Arg(1))
+	if err != nil {
+		return fmt.Errorf("Veles :: %s.", err)
+	}
+	changed := index.Apply(edits)
+	for file, text := range changed {
+		if err := os.WriteFile(file.Path, []byte(text), 0644); err != nil {
+			return fmt.Errorf("Veles :: %s.", err)
+		}
+		fmt.Printf("Veles :: Updated \"%s\".\n", displayPath(file.Path))
+	}
+	fmt.Printf("Veles :: Renamed %d occurrences of \"%s\" in %d files.\n", len(edits), symbol.Name, len(changed))
+	return nil
+}
+
+// colorEnabled decides whether diagnostics written to stderr are colored.
+func colorEnabled(mode string) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+		if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+			return false, nil
+		}
+		info, err := os.Stderr.Stat()
+		return err == nil && info.Mode()&os.ModeCharDevice != 0, nil
+	}
+	return false, fmt.Errorf("Veles :: Unknown color mode \"%s\", expected auto, always or never.", mode)
+}
+
+// loadProgram loads the given files and every module they import.
+func loadProgram(root string, paths []string) (*workspace.Workspace, error) {
+	if root == "" {
+		root = filepath.Dir(paths[0])
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("Veles :: %s.", err)
+	}
+	ws := workspace.New(absRoot)
+	for _, path := range paths {
+		if filepath.Ext(path) != ".vs" {
+			return nil, fmt.Errorf("Veles :: Unrecognized file type for file: \"%s\".", path)
+		}
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("Veles :: %s.", err)
+		}
+		if _, err := ws.Load(absPath); err != nil {
+			return nil, fmt.Errorf("Veles :: %s.", err)
+		}
+	}
+	return ws, nil
+}
+
+// reportDiagnostics writes the diagnostics of every loaded file in the given
+// format and returns the number of errors. Text is rendered to stderr, the
+// machine readable formats are written to stdout.
+func reportDiagnostics(files []*workspace.File, format string, color bool) (int, error) {
+	reports := make([]diagnostics.FileReport, 0, len(files))
+	errors, warnings := 0, 0
+	for _, file := range files {
+		sorted := append([]diagnostics.Diagnostic{}, file.Diagnostics...)
+		sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Span.Start.Offset < sorted[j].Span.Start.Offset })
+		reports = append(reports, diagnostics.FileReport{Path: displayPath(file.Path), Source: file.Source, Diagnostics: sorted})
+		for _, diagnostic := range sorted {
+			switch diagnostic.Severity {
+			case diagnostics.Error:
+				errors++
+			case diagnostics.Warning:
+				warnings++
+			}
+		}
+	}
+
+	switch format {
+	case "json":
+		return errors, diagnostics.WriteJSON(os.Stdout, reports)
+	case "sarif":
+		return errors, diagnostics.WriteSARIF(os.Stdout, reports)
+	}
+	renderer := &diagnostics.Renderer{Color: color, DisplayPath: displayPath}
+	for i, report := range reports {
+		for _, diagnostic := range report.Diagnostics {
+			renderer.Render(os.Stderr, files[i].Source, diagnostic)
+		}
+	}
+	if errors > 0 || warnings > 0 {
+		fmt.Fprintf(os.Stderr, "Veles :: %s, %s.\n", plural(errors, "error"), plural(warnings, "warning"))
+	}
+	return errors, nil
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, word)
+	}
+	return fmt.Sprintf("%d %ss", n, word)
+}
+
+// diagnosticFlags registers the flags controlling how diagnostics are reported.
+func diagnosticFlags(flags *flag.FlagSet) (format *string, colorMode *string) {
+	format = flags.String("diagnostics-format", "text", "diagnostics output: text, json or sarif")
+	colorMode = flags.String("color", "auto", "color text diagnostics: auto, always or never")
+	return format, colorMode
+}
+
+func parseDiagnosticFlags(format string, colorMode string) (bool, error) {
+	switch format {
+	case "text", "json", "sarif":
+	default:
+		return false, fmt.Errorf("Veles :: Unknown diagnostics format \"%s\", expected text, json or sarif.", format)
+	}
+	return colorEnabled(colorMode)
+}
+
+func runCheck(args []string) error {
+	flags := flag.NewFlagSet("check", flag.ContinueOnError)
+	root := flags.String("root", "", "directory the module paths are relative to (default: the directory of the first file)")
+	showTypes := flags.Bool("show-types", false, "print the types inferred for variables declared without one")
+	format, colorMode := diagnosticFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return fmt.Errorf("Veles :: usage: veles check [-root dir] [-show-types] [-color mode] [--diagnostics-format=text|json|sarif] <file.vs>...")
+	}
+	color, err := parseDiagnosticFlags(*format, *colorMode)
+	if err != nil {
+		return err
+	}
+	if *showTypes && *format != "text" {
+		return fmt.Errorf("Veles :: -show-types writes text and cannot be combined with --diagnostics-format=%s.", *format)
+	}
+
+	ws, err := loadProgram(*root, flags.Args())
+	if err != nil {
+		return err
+	}
+	if *showTypes {
+		printInferredTypes(ws.Files())
+	}
+	errors, err := reportDiagnostics(ws.Files(), *format, color)
+	if err != nil {
+		return fmt.Errorf("Veles :: %s.", err)
+	}
+	if errors > 0 {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// printInferredTypes prints every variable declared without a type on its
+// source line, with the inferred type written where the declaration leaves it
+// out, like the inlay hints of an editor.
+func printInferredTypes(files []*workspace.File) {
+	for _, file := range files {
+		if file.Module == nil {
+			continue
+		}
+		ast.Inspect(file.Program, func(node ast.Node) bool {
+			decl, ok := node.(*ast.VariableDeclarationStmt)
+			if !ok || decl.VarType != "" {
+				return true
+			}
+			symbol := file.Module.Info.Defs[decl]
+			if symbol == nil || symbol.Type == nil || types.IsInvalid(symbol.Type) {
+				return true
+			}
+			position := decl.NameSpan.Start
+			line := file.Source.Line(position.Line)
+			hinted := line[:position.Column-1] + symbol.Type.String() + " " + line[position.Column-1:]
+			fmt.Printf("%s:%d:%d: %s\n", displayPath(file.Path), position.Line, position.Column, strings.TrimSpace(hinted))
+			return true
+		})
+	}
+}
+
+func runBuild(args []string) error {
+	flags := flag.NewFlagSet("build", flag.ContinueOnError)
+	root := flags.String("root", "", "directory the module paths are relative to (default: the directory of the file)")
+	output := flags.String("o", "", "output file (default: the input file with the extension of the output)")
+	emit := flags.String("emit", "wat", "output: wat, the WebAssembly text format, or ir, the intermediate representation")
+	noBoundsChecks := flags.Bool("no-bounds-checks", false, "omit the checks of array and slice indices, for release builds")
+	levels := []*bool{
+		flags.Bool("O0", false, "do not optimize (the default)"),
+		flags.Bool("O1", false, "fold constants, propagate copies and remove dead code"),
+		flags.Bool("O2", false, "also inline small functions"),
+	}
+	enable := flags.String("enable", "", "comma-separated passes to run whatever the level: "+opt.Names())
+	disable := flags.String("disable", "", "comma-separated passes not to run")
+	dumpPasses := flags.Bool("dump-passes", false, "print the IR to stderr before the first pass and after every pass")
+	format, colorMode := diagnosticFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("Veles :: usage: veles build [-root dir] [-o file] [-emit wat|ir] [-O0|-O1|-O2] [-enable passes] [-disable passes] [-dump-passes] [-no-bounds-checks] [-color mode] [--diagnostics-format=text|json|sarif] <file.vs>")
+	}
+	color, err := parseDiagnosticFlags(*format, *colorMode)
+	if err != nil {
+		return err
+	}
+	if *emit != "wat" && *emit != "ir" {
+		return fmt.Errorf("Veles :: Unknown output \"%s\", expected wat or ir.", *emit)
+	}
+	optimize, err := optimizeOptions(levels, *enable, *disable)
+	if err != nil {
+		return err
+	}
+	if *dumpPasses {
+		optimize.Dump = os.Stderr
+	}
+
+	ws, err := loadProgram(*root, flags.Args())
+	if err != nil {
+		return err
+	}
+	entry, err := ws.Load(mustAbs(flags.Arg(0)))
+	if err != nil {
+		return fmt.Errorf("Veles :: %s.", err)
+	}
+	files := ws.Files()
+
+	var out string
+	if !hasErrors(files) {
+		program := &codegen.Program{Entry: entry.Module}
+		for _, file := range files {
+			program.Modules = append(program.Modules, file.Module)
+		}
+		options := codegen.Options{NoBoundsChecks: *noBoundsChecks, Optimize: optimize}
+		var problems codegen.Diagnostics
+		if *emit == "ir" {
+			var module *ir.Module
+			if module, problems = codegen.GenerateIR(program, options); module != nil {
+				out = module.String()
+			}
+		} else {
+			out, problems = codegen.GenerateWat(program, options)
+		}
+		for _, file := range files {
+			file.Diagnostics = append(file.Diagnostics, problems[file.Module]...)
+		}
+	}
+
+	errors, err := reportDiagnostics(files, *format, color)
+	if err != nil {
+		return fmt.Errorf("Veles :: %s.", err)
+	}
+	if errors > 0 {
+		os.Exit(1)
+	}
+
+	path := *output
+	if path == "" {
+		path = strings.TrimSuffix(flags.Arg(0), ".vs") + "." + *emit
+	}
+	if err := os.WriteFile(path, []byte(out), 0644); err != nil {
+		return fmt.Errorf("Veles :: %s.", err)
+	}
+	if *format == "text" {
+		fmt.Fprintf(os.Stderr, "Veles :: Wrote \"%s\".\n", displayPath(mustAbs(path)))
+	}
+	return nil
+}
+
+// optimizeOptions reads the optimization level and the passes enabled and
+// disabled from the flags of build.
+func optimizeOptions(levels []*bool, enable, disable string) (opt.Options, error) {
+	var options opt.Options
+	set := false
+	for level, on := range levels {
+		if !*on {
+			continue
+		}
+		if set {
+			return options, fmt.Errorf("Veles :: Only one of -O0, -O1 and -O2 can be given.")
+		}
+		options.Level, set = level, true
+	}
+	passes := func(list string) ([]string, error) {
+		var names []string
+		for _, name := range strings.Split(list, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if opt.Lookup(name) == nil {
+				return nil, fmt.Errorf("Veles :: Unknown pass \"%s\", expected %s.", name, opt.Names())
+			}
+			names = append(names, name)
+		}
+		return names, nil
+	}
+	var err error
+	if options.Enable, err = passes(enable); err != nil {
+		return options, err
+	}
+	options.Disable, err = passes(disable)
+	return options, err
+}
+
+func hasErrors(files []*workspace.File) bool {
+	for _, file := range files {
+		if diagnostics.HasErrors(file.Diagnostics) {
+			return true
+		}
+	}
+	return false
+}
+
+func mustAbs(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+func runExplain(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("Veles :: usage: veles explain <code>")
+	}
+	code := diagnostics.LookupCode(args[0])
+	if code == nil {
+		return fmt.Errorf("Veles :: Unknown error code \"%s\".", args[0])
+	}
+	fmt.Printf("%s: %s (%s)\n\n%s\n", code.ID, code.Title, code.Stage, code.Explanation)
+	return nil
+}
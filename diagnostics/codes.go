@@ -0,0 +1,499 @@
+package diagnostics
+
+import (
+	"sort"
+	"strings"
+)
+
+// Code is a stable identifier of a kind of diagnostic, like E0200. Codes never
+// change meaning once released, so they can be searched for and explained.
+type Code struct {
+	ID          string
+	Stage       Stage
+	Title       string
+	Explanation string
+}
+
+func (c *Code) String() string {
+	return c.ID
+}
+
+var codes = map[string]*Code{}
+
+func register(id string, stage Stage, title string, explanation string) *Code {
+	code := &Code{
+		ID:          id,
+		Stage:       stage,
+		Title:       title,
+		Explanation: strings.TrimSpace(explanation),
+	}
+	codes[id] = code
+	return code
+}
+
+// LookupCode returns the code with the given ID, or nil.
+func LookupCode(id string) *Code {
+	return codes[strings.ToUpper(id)]
+}
+
+// Codes returns every registered code ordered by ID.
+func Codes() []*Code {
+	result := make([]*Code, 0, len(codes))
+	for _, code := range codes {
+		result = append(result, code)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// Lexer codes.
+var (
+	UnrecognizedToken = register("E0001", Lexer, "unrecognized token", `
+The source contains a character that does not start any token of the language.
+
+    let i32 price = 5$
+
+Only letters, digits, underscores, the operators and the punctuation of the
+language may appear outside of comments. Remove the character, or move it into
+a comment.
+`)
+	UnterminatedString = register("E0002", Lexer, "unterminated string literal", `
+A string literal is missing its closing quote before the end of the line.
+
+    log("hello)
+
+String literals cannot span lines. Close the literal with a double quote, and
+write line breaks inside it as \n.
+`)
+	InvalidEscape = register("E0003", Lexer, "invalid escape sequence", `
+A string literal contains a backslash that does not start a known escape
+sequence.
+
+    log("C:\data")
+
+The supported escapes are \n, \t, \r, \0, \", \', \\ and \u{...} with one to six
+hexadecimal digits naming a unicode code point. Write a literal backslash as \\.
+`)
+	MalformedNumber = register("E0004", Lexer, "malformed numeric literal", `
+A numeric literal is not written correctly, or its value does not fit in 64 bits.
+
+    let i32 mask = 0xFF__FF
+    let i64 big = 1_000_i64
+
+Integers are written in decimal, or in hexadecimal, binary and octal with the
+0x, 0b and 0o prefixes. Floats are decimal with a fraction, an exponent or
+both, like 1.5 or 1.5e-3. A single underscore may separate two digits. The type
+of a literal can be fixed with a suffix: i8, i16, i32, i64, u8, u16, u32, u64,
+f32 or f64, like 10i64, 255u8 or 2.5f32. Hexadecimal literals only take the
+integer suffixes, since f is one of their digits.
+`)
+)
+
+// Parser codes.
+var (
+	UnexpectedToken = register("E0100", Parser, "unexpected token", `
+The parser found a token that cannot appear at this point of the program.
+
+    fn i32 add(i32 a, i32 b) {   // "::" is missing before the name
+        return a + b
+    }
+
+Function declarations separate the return type from the name with "::":
+
+    fn i32 :: add(i32 a, i32 b) {
+        return a + b
+    }
+
+The message names the token that was expected. After reporting the error the
+parser skips the rest of the line and continues with the next statement.
+`)
+	ExpectedExpression = register("E0101", Parser, "expected an expression", `
+An expression was required, but the source ended or continued with something
+that does not start an expression.
+
+    let i32 x = 5 +
+
+Binary operators need an operand on both sides, "if" needs a condition and
+every argument of a call must be an expression:
+
+    let i32 x = 5 + 1
+
+A variable declared without a type needs an initializer to infer it from:
+
+    let x           // neither a type nor an initializer
+    let x = 0       // ok: x is an i32
+`)
+	MisplacedModifier = register("E0102", Parser, "misplaced modifier", `
+The "pub" and "extern" modifiers only apply to declarations.
+
+    pub use math::constants
+
+"pub" may precede "fn" and "let", "extern" may only precede "fn":
+
+    pub fn i32 :: add(i32 a, i32 b) { return a + b }
+    extern fn :: log(i32 value)
+`)
+)
+
+// Resolver codes.
+var (
+	Undefined = register("E0200", Resolver, "undefined name", `
+A name is used that is not declared in the current scope or in any enclosing one.
+
+    fn i32 :: main {
+        return count
+    }
+
+Declare the variable before using it, import the module that declares it with
+"use", or check the spelling. Local variables are only visible after their
+declaration and inside the block that declares them.
+`)
+	Redeclared = register("E0201", Resolver, "name declared twice", `
+Two declarations in the same scope use the same name.
+
+    let i32 x = 1
+    let i32 x = 2
+
+Every name can be declared only once per scope. Rename one of the declarations,
+or assign to the existing variable instead of declaring it again.
+`)
+	ImportFailed = register("E0202", Resolver, "cannot import module", `
+The module named by a use statement could not be loaded.
+
+    use math::constants
+
+Module paths are resolved relative to the root of the project: the statement
+above loads "math/constants.vs". The error is also reported for import cycles,
+where a module directly or indirectly imports itself.
+`)
+	NoMember = register("E0203", Resolver, "no such member", `
+A module is accessed with "::" but it does not declare the requested member.
+
+    use math::constants
+    let f32 x = constants::PIE
+
+Check the spelling of the member, or the module it is declared in.
+`)
+	NotExported = register("E0204", Resolver, "member is not exported", `
+A module member is used from another module, but it is not declared with "pub".
+
+    // math/constants.vs
+    let f32 PI = 3.14159
+
+    // main.vs
+    use math::constants
+    let f32 x = constants::PI
+
+Only "pub" declarations are visible outside of the module declaring them. Add
+"pub" to the declaration to export it.
+`)
+)
+
+// Checker codes.
+var (
+	MismatchedTypes = register("E0300", Checker, "mismatched types", `
+A value is used where a value of a different type is required.
+
+    let bool ready = 5
+
+Every variable, parameter and return value has a type, and the values stored
+in them must have that type. Booleans and numbers do not convert into each other.
+`)
+	UnknownType = register("E0301", Checker, "unknown type", `
+A type name does not name any type.
+
+    let int x = 5
+
+The builtin types are i32, i64, f32, f64 and bool.
+`)
+	InvalidOperation = register("E0302", Checker, "invalid operation", `
+An operator is applied to operands it is not defined on.
+
+    let bool b = true + 1
+    let f32 r = 5.0 % 2.0
+
+Arithmetic and ordering operators need numeric operands, "&&", "||" and "!"
+need booleans, and the remainder operator "%" is only defined on integers.
+`)
+	WrongArgumentCount = register("E0303", Checker, "wrong number of arguments", `
+A function is called with more or fewer arguments than it declares parameters.
+
+    fn i32 :: add(i32 a, i32 b) { return a + b }
+    let i32 x = add(1)
+
+Pass exactly one argument for every parameter of the function.
+`)
+	NotCallable = register("E0304", Checker, "value is not callable", `
+A call expression calls something that is not a function.
+
+    let i32 x = 5
+    x(1)
+
+Only functions, including extern functions, can be called.
+`)
+	InvalidAssignment = register("E0305", Checker, "invalid assignment target", `
+The left-hand side of an assignment is not a variable.
+
+    fn :: main {
+        main = 5
+    }
+
+Only variables can be assigned to, and only when they are declared with
+"let mut"; see E0311.
+`)
+	ModuleMisuse = register("E0306", Checker, "invalid use of a module", `
+A module is used as a value, or "::" is applied to something that is not a module.
+
+    use math::constants
+    let f32 x = constants
+
+Modules only group declarations: access their members with "module::member".
+`)
+	ReturnMismatch = register("E0307", Checker, "invalid return", `
+A return statement does not match the return type of its function.
+
+    fn i32 :: answer {
+        return
+    }
+
+Functions declaring a return type must return a value of that type, functions
+without a return type must not return a value.
+`)
+	MisplacedDeclaration = register("E0308", Checker, "misplaced declaration", `
+A declaration or statement appears where it is not allowed.
+
+    fn :: main {
+        use math::constants
+    }
+
+Functions, extern declarations and use statements are only allowed at the top
+level of a module, and only top-level variables can be exported with "pub".
+Statements other than declarations are only allowed inside functions.
+`)
+	NoValue = register("E0309", Checker, "expression has no value", `
+An expression that does not produce a value is used as one.
+
+    extern fn :: log(i32 value)
+    let i32 x = log(5)
+
+Calls of functions without a return type can only be used as statements.
+An if without an else, or a block that does not end with an expression, has no
+value either.
+`)
+	ConstantOverflow = register("E0310", Checker, "constant overflows its type", `
+A constant is used as a value of a type that cannot represent it.
+
+    let i32 big = 3_000_000_000
+    let u8 byte = 200 + 100
+
+Constant expressions of unsuffixed literals are computed exactly, and every
+step of the computation must fit in the type the expression is used as. The
+count of a constant shift must be less than the width of that type: 1 << 40 is
+reported as an i32, and accepted as an i64.
+
+The range of i32 is -2147483648 to 2147483647, and of i64 -9223372036854775808
+to 9223372036854775807. The unsigned types u8, u16, u32 and u64 range from 0 to
+255, 65535, 4294967295 and 18446744073709551615. Use a wider type, like i64, or
+a smaller value. Float literals overflow f32 beyond about 3.4e38.
+`)
+	ImmutableAssignment = register("E0311", Checker, "assignment to an immutable binding", `
+A value is assigned to a variable that cannot change.
+
+    fn :: count(i32 n) {
+        let i32 total = 0
+        total += n           // total is immutable
+        n = 0                // parameters are immutable
+    }
+
+Variables are immutable unless they are declared with "let mut". Parameters
+are always immutable; copy one into a "let mut" variable to change it. Globals
+of other modules can only be changed by functions of the declaring module.
+`)
+	RecursiveType = register("E0312", Checker, "recursive struct type", `
+A struct contains itself, directly or through the fields of another struct.
+
+    struct Node { i32 value, Node next }
+
+Fields are stored inline, so such a struct would have an infinite size.
+`)
+	NoField = register("E0313", Checker, "no such field", `
+A field is accessed on a value that does not have it.
+
+    struct Vec2 { f32 x, f32 y }
+
+    fn f32 :: depth(Vec2 v) {
+        return v.z           // Vec2 has no field z
+    }
+
+Only structs have fields. Check the spelling against the struct declaration.
+`)
+	InvalidStructLiteral = register("E0314", Checker, "invalid struct literal", `
+A struct literal does not initialize every field of the struct exactly once.
+
+    struct Vec2 { f32 x, f32 y }
+
+    let Vec2 v = Vec2 { x: 1.0 }            // y is missing
+    let Vec2 w = Vec2 { x: 1.0, x: 2.0 }    // x is given twice
+
+Every field must be given a value, in any order.
+`)
+	TypeMisuse = register("E0315", Checker, "type used as a value", `
+The name of a type appears where a value is expected.
+
+    struct Vec2 { f32 x, f32 y }
+
+    let Vec2 v = Vec2
+
+Create a value of the struct with a literal, like Vec2 { x: 0.0, y: 0.0 }.
+`)
+	NonExhaustiveMatch = register("E0316", Checker, "non-exhaustive match", `
+A match expression has no arm for some values of the matched type.
+
+    enum Shape { Circle(f32), Rect(f32, f32) }
+
+    fn f32 :: area(Shape s) {
+        return match s {
+            Shape::Circle(r) => 3.14 * r * r,
+        }                    // Shape::Rect is not covered
+    }
+
+Add arms for the missing variants, or a _ arm matching every other value.
+Matches on numbers always need a _ arm.
+`)
+	InvalidPattern = register("E0317", Checker, "invalid pattern", `
+A pattern of a match arm cannot match the matched value.
+
+    match shape {
+        Shape::Rect(w) => w,     // Rect carries two values
+        1 => 0.0,                // a Shape is not a number
+    }
+
+A variant pattern binds every value the variant carries; use _ for the values
+that are not needed, like Shape::Rect(w, _). Literal patterns match numbers and
+booleans.
+`)
+	UnreachablePattern = register("E0318", Checker, "unreachable pattern", `
+A match arm can never be selected, because the arms before it match every value
+its pattern matches.
+
+    match n {
+        _ => "many",
+        1 => "one",          // _ matched 1 already
+    }
+
+Arms are tried in order. Move the arm before the arm that shadows it, or remove
+it.
+`)
+	InvalidIndex = register("E0319", Checker, "invalid index", `
+A value is indexed that is not an array or a slice, the index is not an
+integer, or a constant index is outside of an array.
+
+    let [4]i32 a = [1, 2, 3, 4]
+
+    a[4]                 // the indices of a are 0 to 3
+    a[1.5]               // indices are integers
+
+Indices that are only known at run time are checked when the program runs,
+unless bounds checks are turned off with "veles build -no-bounds-checks".
+`)
+	InvalidArrayLiteral = register("E0320", Checker, "invalid array literal", `
+The type of the elements of an array literal cannot be determined.
+
+    len([])                      // no elements and no expected type
+    let []i32 empty = []         // ok: the elements are i32
+
+An empty literal needs an expected array or slice type, like the declared type
+of a variable or of a parameter, to take its element type from.
+`)
+	InvalidCast = register("E0321", Checker, "invalid cast", `
+A value is converted with "as" to a type it cannot be converted to.
+
+    let str s = 5 as str
+
+Numbers convert to every numeric type, and booleans and the variants of plain
+enums convert to integers. Numbers of different types never mix implicitly:
+
+    let i32 count = 3
+    let f32 half = count * 0.5           // mismatched types i32 and f64
+    let f32 half = count as f32 * 0.5    // ok
+`)
+	InitializationCycle = register("E0322", Checker, "initialization cycle", `
+The type of a variable declared without one depends on the variable itself.
+
+    let a = b + 1
+    let b = a * 2
+
+A variable without a type takes the type of its initializer, so the
+initializer cannot refer to the variable, directly or through other variables.
+Declare the type of one of them, like "let i32 a = b + 1".
+`)
+	UnassignedVariable = register("E0323", Checker, "variable read before it is assigned", `
+A local variable declared without an initializer is read on a path where
+nothing was assigned to it yet. This is a warning: the variable holds the
+zero value of its type, but the read is usually a mistake.
+
+    let i32 total
+    if verbose {
+        total = 10
+    }
+    log(total)           // total is 0 when verbose is false
+
+Assign the variable on every path before reading it, or initialize it where
+it is declared. The zero values are 0, false, empty strings and slices, and
+structs and arrays of zero values.
+`)
+	MissingReturn = register("E0324", Checker, "missing return", `
+A function with a result type can reach the end of its body without a return
+statement.
+
+    fn i32 :: sign(i32 x) {
+        if x < 0 {
+            return -1
+        } else if x > 0 {
+            return 1
+        }
+    }                    // missing return when x is 0
+
+The last statement of a body is not its result: every path through the body
+must end with a return, like the else branch returning 0 here would.
+`)
+	UnreachableCode = register("E0325", Checker, "unreachable code", `
+A statement follows a statement that returns from the function on every path,
+so it never runs. This is a warning.
+
+    fn i32 :: half(i32 x) {
+        return x / 2
+        log(x)           // unreachable
+    }
+
+Remove the statement, or move it before the return.
+`)
+	Unsupported = register("E0399", Checker, "unsupported construct", `
+The construct is recognized by the parser but not supported by the checker yet.
+`)
+)
+
+// Code generation codes.
+var (
+	UnsupportedByBackend = register("E0500", Codegen, "not supported by the backend", `
+The program is valid, but the WebAssembly backend cannot compile one of its
+constructs yet.
+
+    let s = Shape::Circle
+
+The backend has no representation for the construct, here a variant holding
+values used without them. Rewrite the expression using supported operations.
+`)
+	// NonConstantGlobal is no longer reported, and stays registered so that
+	// the code keeps its meaning.
+	NonConstantGlobal = register("E0501", Codegen, "global initializer is not constant (retired)", `
+This code is no longer reported. Earlier versions of the compiler reported it
+for a module-level variable initialized with an expression that could not be
+evaluated at compile time.
+
+    let i32 start = compute()
+
+Such initializers now run in the start function of the module when it is
+instantiated, so the program compiles as written.
+`)
+)
@@ -0,0 +1,28 @@
+package diagnostics
+
+import "testing"
+
+func TestLookupCode(t *testing.T) {
+	tests := []struct {
+		id   string
+		want *Code
+	}{
+		{"E0004", MalformedNumber},
+		{"e0200", Undefined},
+		{"E0500", UnsupportedByBackend},
+		{"E0501", NonConstantGlobal}, // retired, but still explained
+		{"E9999", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.id, func(t *testing.T) {
+			if got := LookupCode(test.id); got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+	for _, code := range Codes() {
+		if code.Title == "" || code.Explanation == "" {
+			t.Errorf("%s has no title or explanation", code.ID)
+		}
+	}
+}
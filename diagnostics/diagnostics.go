@@ -0,0 +1,105 @@
+package diagnostics
+
+import (
+	"fmt"
+
+	"github.com/LaH-DeV/veles/source"
+)
+
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+	Information
+	Hint
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	case Information:
+		return "info"
+	case Hint:
+		return "hint"
+	default:
+		return fmt.Sprintf("unknown(%d)", s)
+	}
+}
+
+// Stage names the compiler phase that produced a diagnostic.
+type Stage string
+
+const (
+	Lexer    Stage = "lexer"
+	Parser   Stage = "parser"
+	Resolver Stage = "resolver"
+	Checker  Stage = "checker"
+	Codegen  Stage = "codegen"
+)
+
+// Label points at a secondary location related to a diagnostic, like the
+// previous declaration of a redeclared name.
+type Label struct {
+	Span    source.Span
+	Message string
+}
+
+type Diagnostic struct {
+	Severity Severity
+	Stage    Stage
+	Code     *Code
+	Message  string
+	Span     source.Span
+
+	Labels []Label
+	Notes  []string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("Veles :: %s: %d:%d: %s", d.Stage, d.Span.Start.Line, d.Span.Start.Column, d.Message)
+}
+
+// WithLabel returns a copy of the diagnostic with an additional label.
+func (d Diagnostic) WithLabel(span source.Span, format string, args ...any) Diagnostic {
+	d.Labels = append(append([]Label{}, d.Labels...), Label{Span: span, Message: fmt.Sprintf(format, args...)})
+	return d
+}
+
+// WithNote returns a copy of the diagnostic with an additional note.
+func (d Diagnostic) WithNote(format string, args ...any) Diagnostic {
+	d.Notes = append(append([]string{}, d.Notes...), fmt.Sprintf(format, args...))
+	return d
+}
+
+func Errorf(code *Code, span source.Span, format string, args ...any) Diagnostic {
+	return Diagnostic{
+		Severity: Error,
+		Stage:    code.Stage,
+		Code:     code,
+		Message:  fmt.Sprintf(format, args...),
+		Span:     span,
+	}
+}
+
+func Warningf(code *Code, span source.Span, format string, args ...any) Diagnostic {
+	return Diagnostic{
+		Severity: Warning,
+		Stage:    code.Stage,
+		Code:     code,
+		Message:  fmt.Sprintf(format, args...),
+		Span:     span,
+	}
+}
+
+func HasErrors(diags []Diagnostic) bool {
+	for _, d := range diags {
+		if d.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
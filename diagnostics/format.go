@@ -0,0 +1,273 @@
+package diagnostics
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/LaH-DeV/veles/source"
+)
+
+// FileReport groups the diagnostics of one source file for the machine
+// readable output formats.
+type FileReport struct {
+	Path        string // the path written to the output
+	Source      *source.File
+	Diagnostics []Diagnostic
+}
+
+type jsonPosition struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	Offset int `json:"offset"`
+}
+
+type jsonSpan struct {
+	Start jsonPosition `json:"start"`
+	End   jsonPosition `json:"end"`
+}
+
+type jsonLabel struct {
+	Span    jsonSpan `json:"span"`
+	Message string   `json:"message"`
+}
+
+type jsonDiagnostic struct {
+	File     string      `json:"file"`
+	Severity string      `json:"severity"`
+	RuleID   string      `json:"ruleId,omitempty"`
+	Title    string      `json:"title,omitempty"`
+	Stage    Stage       `json:"stage"`
+	Message  string      `json:"message"`
+	Span     jsonSpan    `json:"span"`
+	Labels   []jsonLabel `json:"labels"`
+	Notes    []string    `json:"notes"`
+}
+
+func toJSONSpan(span source.Span) jsonSpan {
+	return jsonSpan{
+		Start: jsonPosition{Line: span.Start.Line, Column: span.Start.Column, Offset: span.Start.Offset},
+		End:   jsonPosition{Line: span.End.Line, Column: span.End.Column, Offset: span.End.Offset},
+	}
+}
+
+// WriteJSON writes the diagnostics as a JSON array with one record per
+// diagnostic. Columns count bytes, offsets are byte offsets into the file.
+func WriteJSON(w io.Writer, reports []FileReport) error {
+	records := []jsonDiagnostic{}
+	for _, report := range reports {
+		for _, d := range report.Diagnostics {
+			record := jsonDiagnostic{
+				File:     report.Path,
+				Severity: d.Severity.String(),
+				Stage:    d.Stage,
+				Message:  d.Message,
+				Span:     toJSONSpan(d.Span),
+				Labels:   []jsonLabel{},
+				Notes:    append([]string{}, d.Notes...),
+			}
+			if d.Code != nil {
+				record.RuleID = d.Code.ID
+				record.Title = d.Code.Title
+			}
+			for _, label := range d.Labels {
+				record.Labels = append(record.Labels, jsonLabel{Span: toJSONSpan(label.Span), Message: label.Message})
+			}
+			records = append(records, record)
+		}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(records)
+}
+
+// SARIF 2.1.0, the subset used by code scanning tools.
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool       sarifTool     `json:"tool"`
+	ColumnKind string        `json:"columnKind"`
+	Results    []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri,omitempty"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string         `json:"id"`
+	Name             string         `json:"name"`
+	ShortDescription sarifMessage   `json:"shortDescription"`
+	FullDescription  sarifMessage   `json:"fullDescription"`
+	Properties       map[string]any `json:"properties"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID           string          `json:"ruleId,omitempty"`
+	RuleIndex        *int            `json:"ruleIndex,omitempty"`
+	Level            string          `json:"level"`
+	Message          sarifMessage    `json:"message"`
+	Locations        []sarifLocation `json:"locations"`
+	RelatedLocations []sarifLocation `json:"relatedLocations,omitempty"`
+}
+
+type sarifLocation struct {
+	ID               *int                  `json:"id,omitempty"`
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	Message          *sarifMessage         `json:"message,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+	EndLine     int `json:"endLine"`
+	EndColumn   int `json:"endColumn"`
+}
+
+// WriteSARIF writes the diagnostics as a SARIF 2.1.0 log. Every registered
+// error code is described as a rule of the "veles" tool.
+func WriteSARIF(w io.Writer, reports []FileReport) error {
+	codes := Codes()
+	rules := make([]sarifRule, 0, len(codes))
+	ruleIndex := map[*Code]int{}
+	for i, code := range codes {
+		ruleIndex[code] = i
+		rules = append(rules, sarifRule{
+			ID:               code.ID,
+			Name:             ruleName(code.Title),
+			ShortDescription: sarifMessage{Text: code.Title},
+			FullDescription:  sarifMessage{Text: strings.TrimSpace(code.Explanation)},
+			Properties:       map[string]any{"category": string(code.Stage)},
+		})
+	}
+
+	results := []sarifResult{}
+	for _, report := range reports {
+		for _, d := range report.Diagnostics {
+			message := d.Message
+			for _, note := range d.Notes {
+				message += "\nnote: " + note
+			}
+			result := sarifResult{
+				Level:     sarifLevel(d.Severity),
+				Message:   sarifMessage{Text: message},
+				Locations: []sarifLocation{sarifLocationOf(report, d.Span, "")},
+			}
+			if d.Code != nil {
+				index := ruleIndex[d.Code]
+				result.RuleID = d.Code.ID
+				result.RuleIndex = &index
+			}
+			for i, label := range d.Labels {
+				location := sarifLocationOf(report, label.Span, label.Message)
+				id := i + 1
+				location.ID = &id
+				result.RelatedLocations = append(result.RelatedLocations, location)
+			}
+			results = append(results, result)
+		}
+	}
+
+	log := sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Tool:       sarifTool{Driver: sarifDriver{Name: "veles", Rules: rules}},
+			ColumnKind: "unicodeCodePoints",
+			Results:    results,
+		}},
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(log)
+}
+
+func sarifLevel(severity Severity) string {
+	switch severity {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	default:
+		return "note"
+	}
+}
+
+// ruleName turns a code title into the PascalCase identifier SARIF expects.
+func ruleName(title string) string {
+	var name string
+	for _, word := range strings.FieldsFunc(title, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	}) {
+		name += strings.ToUpper(word[:1]) + word[1:]
+	}
+	return name
+}
+
+func sarifLocationOf(report FileReport, span source.Span, message string) sarifLocation {
+	end := span.End
+	if span.IsZero() || end.Offset < span.Start.Offset {
+		end = span.Start
+	}
+	location := sarifLocation{
+		PhysicalLocation: sarifPhysicalLocation{
+			ArtifactLocation: sarifArtifactLocation{URI: toSlash(report.Path)},
+			Region: sarifRegion{
+				StartLine:   max(span.Start.Line, 1),
+				StartColumn: codePointColumn(report.Source, span.Start),
+				EndLine:     max(end.Line, 1),
+				EndColumn:   codePointColumn(report.Source, end),
+			},
+		},
+	}
+	if message != "" {
+		location.Message = &sarifMessage{Text: message}
+	}
+	return location
+}
+
+// codePointColumn converts the byte based column of a position into the 1-based
+// column counted in unicode code points.
+func codePointColumn(file *source.File, position source.Position) int {
+	if file == nil || position.Line < 1 || position.Line > file.LineCount() {
+		return max(position.Column, 1)
+	}
+	line := file.Line(position.Line)
+	column := position.Column - 1
+	if column < 0 {
+		return 1
+	}
+	if column > len(line) {
+		return utf8.RuneCountInString(line) + 1 + column - len(line)
+	}
+	return utf8.RuneCountInString(line[:column]) + 1
+}
+
+func toSlash(path string) string {
+	return strings.ReplaceAll(path, "\\", "/")
+}
@@ -0,0 +1,163 @@
+package diagnostics
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/LaH-DeV/veles/source"
+)
+
+const formatText = "let ż = true\nlet i32 x = ż\n"
+
+func formatReports(t *testing.T) []FileReport {
+	t.Helper()
+	file := source.NewFile("main.vs", formatText)
+	use := strings.LastIndex(formatText, "ż")
+	return []FileReport{
+		{Path: "src\\main.vs", Source: file, Diagnostics: []Diagnostic{
+			Errorf(MismatchedTypes, file.Span(use, use+len("ż")), "cannot use bool as i32").
+				WithLabel(span(t, file, "ż ="), "declared here").
+				WithNote("convert it first"),
+			Warningf(UnreachableCode, span(t, file, "let i32"), "unreachable code"),
+		}},
+		{Path: "empty.vs", Source: source.NewFile("empty.vs", "")},
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var out bytes.Buffer
+	if err := WriteJSON(&out, formatReports(t)); err != nil {
+		t.Fatal(err)
+	}
+	var records []jsonDiagnostic
+	if err := json.Unmarshal(out.Bytes(), &records); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+
+	tests := []struct {
+		field string
+		got   any
+		want  any
+	}{
+		{"file", records[0].File, "src\\main.vs"},
+		{"severity", records[0].Severity, "error"},
+		{"rule", records[0].RuleID, "E0300"},
+		{"title", records[0].Title, "mismatched types"},
+		{"stage", records[0].Stage, Checker},
+		{"start", records[0].Span.Start, jsonPosition{Line: 2, Column: 13, Offset: 26}},
+		{"end", records[0].Span.End, jsonPosition{Line: 2, Column: 15, Offset: 28}},
+		{"labels", len(records[0].Labels), 1},
+		{"label", records[0].Labels[0].Message, "declared here"},
+		{"label start", records[0].Labels[0].Span.Start.Column, 5},
+		{"notes", strings.Join(records[0].Notes, ";"), "convert it first"},
+		{"warning", records[1].Severity, "warning"},
+		{"warning labels", len(records[1].Labels), 0},
+		{"warning notes", len(records[1].Notes), 0},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%s: got %v, want %v", test.field, test.got, test.want)
+		}
+	}
+	// the arrays are never null, which would be a pain for consumers
+	if strings.Contains(out.String(), "null") {
+		t.Errorf("null in the output:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := WriteJSON(&out, nil); err != nil || strings.TrimSpace(out.String()) != "[]" {
+		t.Errorf("no diagnostics written as %q", out.String())
+	}
+}
+
+func TestWriteSARIF(t *testing.T) {
+	var out bytes.Buffer
+	if err := WriteSARIF(&out, formatReports(t)); err != nil {
+		t.Fatal(err)
+	}
+	var log sarifLog
+	if err := json.Unmarshal(out.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("got version %s with %d runs", log.Version, len(log.Runs))
+	}
+	run := log.Runs[0]
+	if len(run.Tool.Driver.Rules) != len(Codes()) {
+		t.Errorf("got %d rules, want one for each of the %d codes", len(run.Tool.Driver.Rules), len(Codes()))
+	}
+	if len(run.Results) != 2 {
+		t.Fatalf("got %d results, want 2", len(run.Results))
+	}
+
+	result := run.Results[0]
+	if result.RuleIndex == nil || run.Tool.Driver.Rules[*result.RuleIndex].ID != result.RuleID || result.RuleID != "E0300" {
+		t.Errorf("result of rule %s points at rule %v", result.RuleID, result.RuleIndex)
+	}
+	if rule := run.Tool.Driver.Rules[*result.RuleIndex]; rule.Name != "MismatchedTypes" || rule.Properties["category"] != "checker" {
+		t.Errorf("unexpected rule %+v", rule)
+	}
+	if result.Level != "error" || result.Message.Text != "cannot use bool as i32\nnote: convert it first" {
+		t.Errorf("got level %s and message %q", result.Level, result.Message.Text)
+	}
+	location := result.Locations[0].PhysicalLocation
+	if location.ArtifactLocation.URI != "src/main.vs" {
+		t.Errorf("got uri %s", location.ArtifactLocation.URI)
+	}
+	// ż takes two bytes but one column
+	if want := (sarifRegion{StartLine: 2, StartColumn: 13, EndLine: 2, EndColumn: 14}); location.Region != want {
+		t.Errorf("got region %+v, want %+v", location.Region, want)
+	}
+	if len(result.RelatedLocations) != 1 || *result.RelatedLocations[0].ID != 1 || result.RelatedLocations[0].Message.Text != "declared here" {
+		t.Errorf("unexpected related locations %+v", result.RelatedLocations)
+	}
+	if run.Results[1].Level != "warning" || run.Results[1].RelatedLocations != nil {
+		t.Errorf("unexpected warning %+v", run.Results[1])
+	}
+}
+
+func TestRuleName(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"mismatched types", "MismatchedTypes"},
+		{"assignment to an immutable binding", "AssignmentToAnImmutableBinding"},
+		{"non-exhaustive match", "NonExhaustiveMatch"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := ruleName(test.title); got != test.want {
+			t.Errorf("ruleName(%q) = %q, want %q", test.title, got, test.want)
+		}
+	}
+}
+
+func TestCodePointColumn(t *testing.T) {
+	file := source.NewFile("main.vs", formatText)
+	tests := []struct {
+		name     string
+		position source.Position
+		want     int
+	}{
+		{"line start", source.Position{Line: 1, Column: 1}, 1},
+		{"before a wide character", source.Position{Line: 1, Column: 5}, 5},
+		{"after a wide character", source.Position{Line: 1, Column: 7}, 6},
+		{"past the end of the line", source.Position{Line: 1, Column: 16}, 15},
+		{"unknown line", source.Position{Line: 9, Column: 3}, 3},
+		{"zero position", source.Position{}, 1},
+	}
+	for _, test := range tests {
+		if got := codePointColumn(file, test.position); got != test.want {
+			t.Errorf("%s: got %d, want %d", test.name, got, test.want)
+		}
+	}
+	if got := codePointColumn(nil, source.Position{Line: 1, Column: 7}); got != 7 {
+		t.Errorf("without a file: got %d, want 7", got)
+	}
+}
@@ -0,0 +1,186 @@
+package diagnostics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/LaH-DeV/veles/source"
+)
+
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiRed    = "\x1b[31m"
+	ansiYellow = "\x1b[33m"
+	ansiBlue   = "\x1b[34m"
+	ansiCyan   = "\x1b[36m"
+)
+
+const tabWidth = 4
+
+// Renderer prints diagnostics for people reading a terminal: the location, the
+// offending source lines with the spans underlined, and the notes.
+type Renderer struct {
+	Color bool
+
+	// DisplayPath shortens the file names printed in locations. Optional.
+	DisplayPath func(path string) string
+}
+
+// annotation is an underline drawn below a source line.
+type annotation struct {
+	line    int
+	start   int // display columns, 0-based
+	end     int
+	primary bool
+	message string
+}
+
+func (r *Renderer) paint(text string, styles ...string) string {
+	if !r.Color || len(styles) == 0 {
+		return text
+	}
+	return strings.Join(styles, "") + text + ansiReset
+}
+
+func severityColor(severity Severity) string {
+	switch severity {
+	case Error:
+		return ansiRed
+	case Warning:
+		return ansiYellow
+	default:
+		return ansiCyan
+	}
+}
+
+// Render writes the diagnostic. The file may be nil when the source is not
+// available, in which case only the header and the location are written.
+func (r *Renderer) Render(w io.Writer, file *source.File, d Diagnostic) {
+	color := severityColor(d.Severity)
+	header := d.Severity.String()
+	if d.Code != nil {
+		header += "[" + d.Code.ID + "]"
+	}
+	fmt.Fprintf(w, "%s%s\n", r.paint(header, ansiBold, color), r.paint(": "+d.Message, ansiBold))
+
+	name := "<unknown>"
+	if file != nil {
+		name = file.Name
+		if r.DisplayPath != nil {
+			name = r.DisplayPath(name)
+		}
+	}
+
+	annotations := make([]annotation, 0, len(d.Labels)+1)
+	if file != nil {
+		annotations = append(annotations, r.annotate(file, d.Span, true, ""))
+		for _, label := range d.Labels {
+			annotations = append(annotations, r.annotate(file, label.Span, false, label.Message))
+		}
+	}
+
+	lastLine := d.Span.Start.Line
+	for _, a := range annotations {
+		if a.line > lastLine {
+			lastLine = a.line
+		}
+	}
+	gutter := strings.Repeat(" ", len(strconv.Itoa(lastLine)))
+	bar := r.paint("|", ansiBold, ansiBlue)
+
+	fmt.Fprintf(w, "%s%s %s:%d:%d\n", gutter, r.paint("-->", ansiBold, ansiBlue), name, d.Span.Start.Line, d.Span.Start.Column)
+
+	if len(annotations) > 0 {
+		sort.SliceStable(annotations, func(i, j int) bool { return annotations[i].line < annotations[j].line })
+		fmt.Fprintf(w, "%s %s\n", gutter, bar)
+		previous := 0
+		for i, a := range annotations {
+			if i == 0 || a.line != previous {
+				if previous != 0 && a.line > previous+1 {
+					fmt.Fprintf(w, "%s\n", r.paint("...", ansiBold, ansiBlue))
+				}
+				number := fmt.Sprintf("%*d", len(gutter), a.line)
+				fmt.Fprintf(w, "%s %s %s\n", r.paint(number, ansiBold, ansiBlue), bar, expandTabs(file.Line(a.line)))
+				previous = a.line
+			}
+			mark, style := "-", ansiBlue
+			if a.primary {
+				mark, style = "^", color
+			}
+			underline := strings.Repeat(" ", a.start) + strings.Repeat(mark, a.end-a.start)
+			if a.message != "" {
+				underline += " " + a.message
+			}
+			fmt.Fprintf(w, "%s %s %s\n", gutter, bar, r.paint(underline, ansiBold, style))
+		}
+	}
+
+	for _, note := range d.Notes {
+		fmt.Fprintf(w, "%s %s %s\n", gutter, r.paint("=", ansiBold, ansiBlue), r.paint("note: ", ansiBold)+note)
+	}
+	if d.Code != nil {
+		fmt.Fprintf(w, "%s %s %s\n", gutter, r.paint("=", ansiBold, ansiBlue), r.paint("help: ", ansiBold)+"run \"veles explain "+d.Code.ID+"\" for more information")
+	}
+	fmt.Fprintln(w)
+}
+
+// annotate converts a span into display columns of its first line. Spans that
+// continue on later lines are underlined up to the end of the first one.
+func (r *Renderer) annotate(file *source.File, span source.Span, primary bool, message string) annotation {
+	line := file.Line(span.Start.Line)
+	startByte := min(span.Start.Column-1, len(line))
+	endByte := len(line)
+	if span.End.Line == span.Start.Line {
+		endByte = min(span.End.Column-1, len(line))
+	}
+	start := displayWidth(line[:startByte])
+	end := displayWidth(line[:max(endByte, startByte)])
+	if end <= start {
+		end = start + 1
+	}
+	return annotation{
+		line:    span.Start.Line,
+		start:   start,
+		end:     end,
+		primary: primary,
+		message: message,
+	}
+}
+
+func displayWidth(text string) int {
+	width := 0
+	for _, r := range text {
+		if r == '\t' {
+			width += tabWidth - width%tabWidth
+		} else {
+			width++
+		}
+	}
+	return width
+}
+
+func expandTabs(text string) string {
+	if !strings.Contains(text, "\t") {
+		return text
+	}
+	var builder strings.Builder
+	width := 0
+	for len(text) > 0 {
+		r, size := utf8.DecodeRuneInString(text)
+		text = text[size:]
+		if r == '\t' {
+			spaces := tabWidth - width%tabWidth
+			builder.WriteString(strings.Repeat(" ", spaces))
+			width += spaces
+			continue
+		}
+		builder.WriteRune(r)
+		width++
+	}
+	return builder.String()
+}
@@ -0,0 +1,135 @@
+package diagnostics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/LaH-DeV/veles/source"
+)
+
+const renderText = "fn i32 :: f() {\n\tlet i32 x = true\n    let ż = 1\n\n\n    return x +\n        y\n}\n"
+
+// span returns the span of the first occurrence of text in file.
+func span(t *testing.T, file *source.File, text string) source.Span {
+	t.Helper()
+	offset := strings.Index(file.Text, text)
+	if offset < 0 {
+		t.Fatalf("no %q in the file", text)
+	}
+	return file.Span(offset, offset+len(text))
+}
+
+func TestRender(t *testing.T) {
+	file := source.NewFile("main.vs", renderText)
+	tests := []struct {
+		name       string
+		diagnostic func(t *testing.T) Diagnostic
+		want       string
+	}{
+		{
+			"tab before the span",
+			func(t *testing.T) Diagnostic {
+				return Errorf(MismatchedTypes, span(t, file, "true"), "cannot use bool as i32")
+			},
+			`error[E0300]: cannot use bool as i32
+ --> main.vs:2:14
+  |
+2 |     let i32 x = true
+  |                 ^^^^
+  = help: run "veles explain E0300" for more information
+
+`,
+		},
+		{
+			"wide characters before the span",
+			func(t *testing.T) Diagnostic {
+				return Warningf(UnreachableCode, span(t, file, "1"), "unreachable code")
+			},
+			`warning[E0325]: unreachable code
+ --> main.vs:3:14
+  |
+3 |     let ż = 1
+  |             ^
+  = help: run "veles explain E0325" for more information
+
+`,
+		},
+		{
+			"label on a distant line",
+			func(t *testing.T) Diagnostic {
+				return Errorf(MismatchedTypes, span(t, file, "return"), "mismatched").
+					WithLabel(span(t, file, "x ="), "declared here").
+					WithNote("a note")
+			},
+			`error[E0300]: mismatched
+ --> main.vs:6:5
+  |
+2 |     let i32 x = true
+  |             --- declared here
+...
+6 |     return x +
+  |     ^^^^^^
+  = note: a note
+  = help: run "veles explain E0300" for more information
+
+`,
+		},
+		{
+			"span over several lines",
+			func(t *testing.T) Diagnostic {
+				return Errorf(Undefined, span(t, file, "x +\n        y"), "undefined: y")
+			},
+			`error[E0200]: undefined: y
+ --> main.vs:6:12
+  |
+6 |     return x +
+  |            ^^^
+  = help: run "veles explain E0200" for more information
+
+`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out strings.Builder
+			(&Renderer{}).Render(&out, file, test.diagnostic(t))
+			if out.String() != test.want {
+				t.Errorf("got\n%s\nwant\n%s", out.String(), test.want)
+			}
+		})
+	}
+}
+
+func TestRenderWithoutSource(t *testing.T) {
+	file := source.NewFile("main.vs", renderText)
+	d := Errorf(Undefined, span(t, file, "y"), "undefined: y").WithNote("a note")
+	var out strings.Builder
+	(&Renderer{DisplayPath: strings.ToUpper}).Render(&out, nil, d)
+	want := "error[E0200]: undefined: y\n --> <unknown>:7:9\n  = note: a note\n  = help: run \"veles explain E0200\" for more information\n\n"
+	if out.String() != want {
+		t.Errorf("got\n%q\nwant\n%q", out.String(), want)
+	}
+
+	out.Reset()
+	(&Renderer{DisplayPath: strings.ToUpper}).Render(&out, file, d)
+	if !strings.Contains(out.String(), "--> MAIN.VS:7:9") {
+		t.Errorf("the path is not shortened:\n%s", out.String())
+	}
+}
+
+func TestRenderColor(t *testing.T) {
+	file := source.NewFile("main.vs", renderText)
+	var out strings.Builder
+	(&Renderer{Color: true}).Render(&out, file, Warningf(UnreachableCode, span(t, file, "return"), "unreachable code"))
+	for _, want := range []string{ansiBold + ansiYellow + "warning[E0325]" + ansiReset, ansiBold + ansiYellow + "    ^^^^^^" + ansiReset} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("no %q in\n%q", want, out.String())
+		}
+	}
+
+	out.Reset()
+	(&Renderer{}).Render(&out, file, Warningf(UnreachableCode, span(t, file, "return"), "unreachable code"))
+	if strings.Contains(out.String(), "\x1b") {
+		t.Errorf("escape codes without color:\n%q", out.String())
+	}
+}
@@ -0,0 +1,5 @@
+extern fn :: print(str message)
+
+pub fn :: main {
+	print("Hello, Veles!\n")
+}
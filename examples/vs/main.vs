@@ -5,7 +5,7 @@ pub fn :: main {
 	let bool test = 5 > 4
 	let i32 result = 2 * 8 + 1
 	if test && 5 >= 5 {
-		log(result * constants::PI)
+		log((result as f32 * constants::PI) as i32)
 	}
 }
 
@@ -0,0 +1,289 @@
+package index
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/LaH-DeV/veles/ast"
+	"github.com/LaH-DeV/veles/checker"
+	"github.com/LaH-DeV/veles/lexer"
+	"github.com/LaH-DeV/veles/source"
+	"github.com/LaH-DeV/veles/workspace"
+)
+
+// Occurrence is a place in a file where a symbol is declared or referenced.
+type Occurrence struct {
+	File        *workspace.File
+	Span        source.Span // the span of the name
+	Symbol      *checker.Symbol
+	Declaration bool
+}
+
+func (o Occurrence) String() string {
+	return fmt.Sprintf("%s:%d:%d", o.File.Path, o.Span.Start.Line, o.Span.Start.Column)
+}
+
+// Text returns the name as written at the occurrence, which differs from the
+// symbol name for aliased imports.
+func (o Occurrence) Text() string {
+	return o.File.Source.Text[o.Span.Start.Offset:o.Span.End.Offset]
+}
+
+// Index maps every symbol expression, member expression and use segment of a
+// set of files to the symbol it refers to, and every symbol to its occurrences.
+type Index struct {
+	files       []*workspace.File
+	occurrences []Occurrence
+	bySymbol    map[*checker.Symbol][]Occurrence
+}
+
+// Build indexes the given files. The files must come from the same workspace, so
+// that a symbol imported by several files is the same *checker.Symbol in each.
+func Build(files []*workspace.File) *Index {
+	ix := &Index{
+		files:    files,
+		bySymbol: make(map[*checker.Symbol][]Occurrence),
+	}
+	for _, file := range files {
+		info := file.Module.Info
+		for node, symbol := range info.Defs {
+			if _, isUse := node.(*ast.UseStmt); isUse && symbol.Kind == checker.ModuleSymbol && len(node.(*ast.UseStmt).Alias) == 0 {
+				// "use math::constants" names the module file, it does not declare a new name
+				ix.add(Occurrence{File: file, Span: symbol.Span, Symbol: symbol})
+				continue
+			}
+			ix.add(Occurrence{File: file, Span: symbol.Span, Symbol: symbol, Declaration: true})
+		}
+		for expr, symbol := range info.Uses {
+			span := expr.Location()
+			if member, ok := expr.(*ast.MemberExpr); ok {
+				span = member.MemberSpan
+			}
+			ix.add(Occurrence{File: file, Span: span, Symbol: symbol})
+		}
+		for stmt, symbol := range info.Imports {
+			ix.add(Occurrence{File: file, Span: stmt.SegmentSpans[len(stmt.SegmentSpans)-1], Symbol: symbol})
+		}
+	}
+	for symbol := range ix.bySymbol {
+		sortOccurrences(ix.bySymbol[symbol])
+	}
+	sortOccurrences(ix.occurrences)
+	return ix
+}
+
+func (ix *Index) add(occurrence Occurrence) {
+	ix.occurrences = append(ix.occurrences, occurrence)
+	ix.bySymbol[occurrence.Symbol] = append(ix.bySymbol[occurrence.Symbol], occurrence)
+}
+
+func sortOccurrences(occurrences []Occurrence) {
+	sort.Slice(occurrences, func(i, j int) bool {
+		a, b := occurrences[i], occurrences[j]
+		if a.File.Path != b.File.Path {
+			return a.File.Path < b.File.Path
+		}
+		return a.Span.Start.Offset < b.Span.Start.Offset
+	})
+}
+
+func (ix *Index) Files() []*workspace.File {
+	return ix.files
+}
+
+// At returns the occurrence covering the offset in the file at path.
+func (ix *Index) At(path string, offset int) (Occurrence, bool) {
+	for _, occurrence := range ix.occurrences {
+		if occurrence.File.Path == path && occurrence.Span.Contains(offset) {
+			return occurrence, true
+		}
+	}
+	return Occurrence{}, false
+}
+
+// Definition returns the declaring occurrence of the symbol. For module symbols
+// without an alias the definition is the start of the imported file.
+func (ix *Index) Definition(symbol *checker.Symbol) (Occurrence, bool) {
+	if symbol.Kind == checker.ModuleSymbol {
+		if use, ok := symbol.Decl.(*ast.UseStmt); ok && len(use.Alias) == 0 {
+			for _, file := range ix.files {
+				if file.Module == symbol.Target {
+					return Occurrence{File: file, Symbol: symbol, Declaration: true, Span: file.Source.Span(0, 0)}, true
+				}
+			}
+			return Occurrence{}, false
+		}
+	}
+	for _, occurrence := range ix.bySymbol[symbol] {
+		if occurrence.Declaration {
+			return occurrence, true
+		}
+	}
+	return Occurrence{}, false
+}
+
+// References returns every occurrence of the symbol, optionally including its declaration.
+func (ix *Index) References(symbol *checker.Symbol, includeDeclaration bool) []Occurrence {
+	result := make([]Occurrence, 0)
+	for _, occurrence := range ix.bySymbol[symbol] {
+		if occurrence.Declaration && !includeDeclaration {
+			continue
+		}
+		result = append(result, occurrence)
+	}
+	return result
+}
+
+// Lookup finds top-level symbols by name. The name is either a plain name,
+// matching the symbol in any module, or qualified with its module path as in
+// "math::constants::PI".
+func (ix *Index) Lookup(name string) []*checker.Symbol {
+	result := make([]*checker.Symbol, 0)
+	module := ""
+	if i := strings.LastIndex(name, "::"); i >= 0 {
+		module, name = name[:i], name[i+2:]
+	}
+	for _, file := range ix.files {
+		if module != "" && file.Module.Name != module {
+			continue
+		}
+		if symbol := file.Module.Member(name); symbol != nil {
+			result = append(result, symbol)
+		}
+	}
+	return result
+}
+
+// Edit replaces the text covered by Span in File with NewText.
+type Edit struct {
+	File    *workspace.File
+	Span    source.Span
+	NewText string
+}
+
+// Rename computes the edits renaming the symbol to newName in every indexed
+// file. Aliased references keep their alias; only the places spelling the
+// original name are changed.
+func (ix *Index) Rename(symbol *checker.Symbol, newName string) ([]Edit, error) {
+	if !isIdentifier(newName) {
+		return nil, fmt.Errorf("%q is not a valid identifier", newName)
+	}
+	if symbol.Kind == checker.ModuleSymbol {
+		if use, ok := symbol.Decl.(*ast.UseStmt); !ok || len(use.Alias) == 0 {
+			return nil, fmt.Errorf("cannot rename module %s, rename its file instead", symbol.Name)
+		}
+	}
+	if symbol.Kind == checker.StructSymbol || symbol.Kind == checker.EnumSymbol {
+		// the type names of declarations are not part of the syntax tree yet
+		return nil, fmt.Errorf("cannot rename %s %s: renaming types is not supported", symbol.Kind, symbol.Name)
+	}
+	if symbol.Kind == checker.BuiltinSymbol {
+		return nil, fmt.Errorf("cannot rename builtin function %s", symbol.Name)
+	}
+	if conflict := ix.conflict(symbol, newName); conflict != nil {
+		return nil, fmt.Errorf("cannot rename %s to %s: %s is already declared at %s", symbol.Name, newName, newName, conflict)
+	}
+
+	edits := make([]Edit, 0)
+	for _, occurrence := range ix.References(symbol, true) {
+		if occurrence.Text() != symbol.Name {
+			continue
+		}
+		edits = append(edits, Edit{File: occurrence.File, Span: occurrence.Span, NewText: newName})
+	}
+	if symbol.Kind == checker.ExternSymbol {
+		if edit, ok := ix.importName(symbol); ok {
+			edits = append(edits, edit)
+		}
+	}
+	return edits, nil
+}
+
+// importName returns the edit writing out the field an extern function is
+// imported from when it is left to default to the name of the function, so
+// that renaming the function keeps the import.
+func (ix *Index) importName(symbol *checker.Symbol) (Edit, bool) {
+	for _, file := range ix.files {
+		if file.Module != symbol.Module {
+			continue
+		}
+		for _, stmt := range file.Program.Statements {
+			extern, ok := stmt.(*ast.ExternStmt)
+			if !ok || extern.Statement != symbol.Decl || extern.FieldSpan != (source.Span{}) {
+				continue
+			}
+			module, field := extern.Import()
+			if extern.ModuleSpan != (source.Span{}) {
+				at := extern.ModuleSpan.End.Offset
+				return Edit{File: file, Span: file.Source.Span(at, at), NewText: " " + strconv.Quote(field)}, true
+			}
+			at := extern.Span.Start.Offset + len("extern")
+			return Edit{File: file, Span: file.Source.Span(at, at), NewText: " " + strconv.Quote(module) + " " + strconv.Quote(field)}, true
+		}
+	}
+	return Edit{}, false
+}
+
+// conflict returns an occurrence of a declaration that would clash with the renamed symbol.
+func (ix *Index) conflict(symbol *checker.Symbol, newName string) *Occurrence {
+	for _, file := range ix.files {
+		scope := file.Module.Scope
+		if file.Module != symbol.Module {
+			// importing modules only see the symbol when it is imported by name
+			imported := false
+			for _, s := range file.Module.Info.Imports {
+				imported = imported || s == symbol
+			}
+			if !imported {
+				continue
+			}
+		} else if symbol.Kind != checker.FunctionSymbol && symbol.Kind != checker.ExternSymbol && symbol.Kind != checker.GlobalSymbol {
+			scope = scope.Innermost(symbol.Span.Start.Offset)
+		}
+		if existing := scope.Lookup(newName); existing != nil {
+			if occurrence, ok := ix.Definition(existing); ok {
+				return &occurrence
+			}
+			return &Occurrence{File: file, Span: existing.Span}
+		}
+	}
+	return nil
+}
+
+func isIdentifier(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		letter := r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+		if !letter && (i == 0 || r < '0' || r > '9') {
+			return false
+		}
+	}
+	for _, keyword := range append(lexer.Keywords(lexer.Vs), lexer.TypeNames(lexer.Vs)...) {
+		if keyword == name {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply applies the edits and returns the new text of every changed file.
+func Apply(edits []Edit) map[*workspace.File]string {
+	byFile := make(map[*workspace.File][]Edit)
+	for _, edit := range edits {
+		byFile[edit.File] = append(byFile[edit.File], edit)
+	}
+	result := make(map[*workspace.File]string)
+	for file, fileEdits := range byFile {
+		sort.Slice(fileEdits, func(i, j int) bool { return fileEdits[i].Span.Start.Offset > fileEdits[j].Span.Start.Offset })
+		text := file.Source.Text
+		for _, edit := range fileEdits {
+			text = text[:edit.Span.Start.Offset] + edit.NewText + text[edit.Span.End.Offset:]
+		}
+		result[file] = text
+	}
+	return result
+}
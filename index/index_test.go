@@ -0,0 +1,240 @@
+package index
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/LaH-DeV/veles/checker"
+	"github.com/LaH-DeV/veles/workspace"
+)
+
+// build indexes a program written to a temporary directory, mapping file
+// names like "main.vs" to their text.
+func build(t *testing.T, sources map[string]string) *Index {
+	t.Helper()
+	root := t.TempDir()
+	for name, text := range sources {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, errs := workspace.New(root).LoadAll()
+	if len(errs) > 0 {
+		t.Fatal(errs[0])
+	}
+	for _, file := range files {
+		if len(file.Diagnostics) > 0 {
+			t.Fatalf("%s: %s", file.Path, file.Diagnostics[0].Message)
+		}
+	}
+	return Build(files)
+}
+
+// lookup returns the only top-level symbol called name.
+func lookup(t *testing.T, ix *Index, name string) *checker.Symbol {
+	t.Helper()
+	symbols := ix.Lookup(name)
+	if len(symbols) != 1 {
+		t.Fatalf("found %d symbols called %s", len(symbols), name)
+	}
+	return symbols[0]
+}
+
+// texts returns the text of every file changed by the edits, by file name.
+func texts(edits []Edit) map[string]string {
+	result := map[string]string{}
+	for file, text := range Apply(edits) {
+		result[filepath.Base(file.Path)] = text
+	}
+	return result
+}
+
+func TestRenameExtern(t *testing.T) {
+	const call = "\n\npub fn :: run() {\n    log(1)\n}\n"
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			"default module and field",
+			"extern fn :: log(i32 value)" + call,
+			"extern \"env\" \"log\" fn :: logger(i32 value)\n\npub fn :: run() {\n    logger(1)\n}\n",
+		},
+		{
+			"default field",
+			"extern \"console\" fn :: log(i32 value)" + call,
+			"extern \"console\" \"log\" fn :: logger(i32 value)\n\npub fn :: run() {\n    logger(1)\n}\n",
+		},
+		{
+			"written field",
+			"extern \"console\" \"print\" fn :: log(i32 value)" + call,
+			"extern \"console\" \"print\" fn :: logger(i32 value)\n\npub fn :: run() {\n    logger(1)\n}\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ix := build(t, map[string]string{"main.vs": test.src})
+			edits, err := ix.Rename(lookup(t, ix, "log"), "logger")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := texts(edits)["main.vs"]; got != test.want {
+				t.Errorf("got\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+const geometryText = `pub fn f32 :: area(f32 w, f32 h) {
+    return w * h
+}
+
+pub let f32 unit = 1.0
+`
+
+const mainText = `use math::geometry
+use math::geometry::area
+use math::geometry::area as surface
+
+fn f32 :: run() {
+    let f32 a = geometry::area(2.0, 3.0)
+    return a + area(1.0, 1.0) + surface(geometry::unit, a)
+}
+`
+
+func buildProgram(t *testing.T) *Index {
+	t.Helper()
+	return build(t, map[string]string{"main.vs": mainText, "math/geometry.vs": geometryText})
+}
+
+// symbolAt returns the symbol at the first occurrence of marker in the file
+// called name.
+func symbolAt(t *testing.T, ix *Index, name, marker string) *checker.Symbol {
+	t.Helper()
+	for _, file := range ix.Files() {
+		if filepath.Base(file.Path) != name {
+			continue
+		}
+		offset := strings.Index(file.Source.Text, marker)
+		if offset < 0 {
+			t.Fatalf("no %q in %s", marker, name)
+		}
+		occurrence, found := ix.At(file.Path, offset)
+		if !found {
+			t.Fatalf("no symbol at %q in %s", marker, name)
+		}
+		return occurrence.Symbol
+	}
+	t.Fatalf("no file %s", name)
+	return nil
+}
+
+func TestReferences(t *testing.T) {
+	tests := []struct {
+		name   string
+		file   string
+		marker string
+		want   []string // file, line and text of every occurrence, sorted by path
+	}{
+		{"function across modules", "geometry.vs", "area", []string{
+			"main.vs:2 area", "main.vs:3 area", "main.vs:6 area",
+			"main.vs:7 area", "main.vs:7 surface", "geometry.vs:1 area (declaration)",
+		}},
+		{"global", "geometry.vs", "unit", []string{"main.vs:7 unit", "geometry.vs:5 unit (declaration)"}},
+		{"parameter", "geometry.vs", "w,", []string{"geometry.vs:1 w (declaration)", "geometry.vs:2 w"}},
+		{"local", "main.vs", "a =", []string{"main.vs:6 a (declaration)", "main.vs:7 a", "main.vs:7 a"}},
+		{"module", "main.vs", "geometry::area(", []string{"main.vs:1 geometry", "main.vs:6 geometry", "main.vs:7 geometry"}},
+	}
+	ix := buildProgram(t)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := make([]string, 0)
+			for _, occurrence := range ix.References(symbolAt(t, ix, test.file, test.marker), true) {
+				str := fmt.Sprintf("%s:%d %s", filepath.Base(occurrence.File.Path), occurrence.Span.Start.Line, occurrence.Text())
+				if occurrence.Declaration {
+					str += " (declaration)"
+				}
+				got = append(got, str)
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDefinition(t *testing.T) {
+	ix := buildProgram(t)
+	definition, found := ix.Definition(symbolAt(t, ix, "main.vs", "area(1.0"))
+	if !found || filepath.Base(definition.File.Path) != "geometry.vs" || definition.Span.Start.Line != 1 || definition.Text() != "area" {
+		t.Errorf("area is defined at %v", definition)
+	}
+	definition, found = ix.Definition(symbolAt(t, ix, "main.vs", "geometry"))
+	if !found || filepath.Base(definition.File.Path) != "geometry.vs" || definition.Span.Start.Offset != 0 {
+		t.Errorf("module geometry is defined at %v", definition)
+	}
+}
+
+func TestRename(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		marker  string
+		newName string
+		want    map[string]string // the changed files
+		err     string            // the start of the error, if renaming fails
+	}{
+		{
+			name: "function across modules", file: "geometry.vs", marker: "area", newName: "size",
+			want: map[string]string{
+				"geometry.vs": strings.Replace(geometryText, "area", "size", 1),
+				"main.vs":     strings.ReplaceAll(mainText, "area", "size"),
+			},
+		},
+		{
+			name: "local", file: "main.vs", marker: "a =", newName: "first",
+			want: map[string]string{
+				"main.vs": strings.NewReplacer("f32 a =", "f32 first =", "return a +", "return first +", ", a)", ", first)").Replace(mainText),
+			},
+		},
+		{name: "keyword", file: "main.vs", marker: "a =", newName: "let", err: `"let" is not a valid identifier`},
+		{name: "not an identifier", file: "main.vs", marker: "a =", newName: "1a", err: `"1a" is not a valid identifier`},
+		{name: "module", file: "main.vs", marker: "geometry", newName: "geo", err: "cannot rename module geometry"},
+		{name: "clash with a function", file: "main.vs", marker: "a =", newName: "run", err: "cannot rename a to run: run is already declared"},
+		{name: "clash in the declaring module", file: "geometry.vs", marker: "area", newName: "unit", err: "cannot rename area to unit: unit is already declared"},
+		{name: "clash in an importing module", file: "geometry.vs", marker: "area", newName: "run", err: "cannot rename area to run: run is already declared"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ix := buildProgram(t)
+			edits, err := ix.Rename(symbolAt(t, ix, test.file, test.marker), test.newName)
+			if test.err != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+					t.Errorf("got error %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := texts(edits)
+			if len(got) != len(test.want) {
+				t.Errorf("changed %d files, want %d", len(got), len(test.want))
+			}
+			for name, want := range test.want {
+				if got[name] != want {
+					t.Errorf("%s:\ngot\n%s\nwant\n%s", name, got[name], want)
+				}
+			}
+		})
+	}
+}
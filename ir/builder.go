@@ -0,0 +1,131 @@
+package ir
+
+// Builder appends instructions to a block of a function.
+type Builder struct {
+	Func  *Function
+	Block *Block // the block instructions are appended to
+}
+
+// NewBuilder returns a builder appending to a new entry block of f.
+func NewBuilder(f *Function) *Builder {
+	return &Builder{Func: f, Block: f.NewBlock()}
+}
+
+// Emit appends an instruction.
+func (b *Builder) Emit(instr *Instr) {
+	block := b.current()
+	block.Instrs = append(block.Instrs, instr)
+}
+
+// current returns the block to append to. Once a block is terminated, what
+// follows goes to a new block, which has no predecessors: it is the code after
+// a return, which never runs.
+func (b *Builder) current() *Block {
+	if b.Block.Term != nil {
+		b.Block = b.Func.NewBlock()
+	}
+	return b.Block
+}
+
+// Temp creates a local holding an intermediate value of type t.
+func (b *Builder) Temp(t Type) *Local {
+	return b.Func.NewLocal("tmp", t)
+}
+
+// Op applies a numeric operation on type t and returns its result.
+func (b *Builder) Op(op Op, t Type, args ...Value) Value {
+	dest := b.Temp(op.Result(t))
+	b.Emit(&Instr{Op: op, Type: t, Dests: []*Local{dest}, Args: args})
+	return Use(dest)
+}
+
+// Copy assigns a value to a local.
+func (b *Builder) Copy(dest *Local, value Value) {
+	b.Emit(&Instr{Op: Copy, Type: dest.Type, Dests: []*Local{dest}, Args: []Value{value}})
+}
+
+// Select returns a when cond is not zero, and other otherwise.
+func (b *Builder) Select(a, other, cond Value) Value {
+	dest := b.Temp(a.Type)
+	b.Emit(&Instr{Op: Select, Type: a.Type, Dests: []*Local{dest}, Args: []Value{a, other, cond}})
+	return Use(dest)
+}
+
+// Load loads a value of type t from offset bytes after an address.
+func (b *Builder) Load(op Op, t Type, address Value, offset int) Value {
+	dest := b.Temp(t)
+	b.Emit(&Instr{Op: op, Type: t, Dests: []*Local{dest}, Args: []Value{address}, Offset: offset})
+	return Use(dest)
+}
+
+// Store stores a value at offset bytes after an address.
+func (b *Builder) Store(op Op, address Value, value Value, offset int) {
+	b.Emit(&Instr{Op: op, Type: value.Type, Args: []Value{address, value}, Offset: offset})
+}
+
+// Call calls a function returning values of the given types.
+func (b *Builder) Call(name string, results []Type, args ...Value) []Value {
+	instr := &Instr{Op: Call, Name: name, Args: args}
+	b.Emit(instr)
+	return b.results(instr, results)
+}
+
+// CallIndirect calls the function of the table at index, which must have the
+// signature sig.
+func (b *Builder) CallIndirect(sig *Signature, index Value, args ...Value) []Value {
+	instr := &Instr{Op: CallIndirect, Sig: sig, Args: append(args, index)}
+	b.Emit(instr)
+	return b.results(instr, sig.Results)
+}
+
+func (b *Builder) results(instr *Instr, results []Type) []Value {
+	values := make([]Value, len(results))
+	for i, t := range results {
+		dest := b.Temp(t)
+		instr.Dests = append(instr.Dests, dest)
+		values[i] = Use(dest)
+	}
+	return values
+}
+
+// GlobalGet reads a global of type t.
+func (b *Builder) GlobalGet(name string, t Type) Value {
+	dest := b.Temp(t)
+	b.Emit(&Instr{Op: GlobalGet, Type: t, Name: name, Dests: []*Local{dest}})
+	return Use(dest)
+}
+
+// GlobalSet assigns a global.
+func (b *Builder) GlobalSet(name string, value Value) {
+	b.Emit(&Instr{Op: GlobalSet, Type: value.Type, Name: name, Args: []Value{value}})
+}
+
+// MemoryCopy copies size bytes from the address src to the address dst.
+func (b *Builder) MemoryCopy(dst, src, size Value) {
+	b.Emit(&Instr{Op: MemoryCopy, Args: []Value{dst, src, size}})
+}
+
+// Terminate ends the current block with a terminator.
+func (b *Builder) Terminate(term Terminator) {
+	b.current().Term = term
+}
+
+// Terminated reports whether the current block is terminated, so that
+// nothing appended now can run.
+func (b *Builder) Terminated() bool {
+	return b.Block.Term != nil
+}
+
+// Jump ends the current block with a jump to target.
+func (b *Builder) Jump(target *Block) {
+	b.Terminate(&Jump{Target: target})
+}
+
+// Place adds a block, created with new(Block) before the blocks branching to
+// it were built, to the function after them, and continues with it. Blocks
+// are placed after every block branching to them.
+func (b *Builder) Place(block *Block) {
+	block.Index = len(b.Func.Blocks)
+	b.Func.Blocks = append(b.Func.Blocks, block)
+	b.Block = block
+}
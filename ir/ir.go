@@ -0,0 +1,470 @@
+package ir
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// The IR sits between the checked syntax trees and the backends. A module is
+// lowered into functions of basic blocks holding three-address instructions:
+// every instruction reads constants and locals and writes its results to
+// locals, and every block ends with a terminator transferring control to
+// other blocks or out of the function.
+//
+// Values are WebAssembly value types. Everything above them is lowered
+// already: strings and slices are pairs of locals, structs, arrays, tagged
+// unions and closures are addresses into linear memory, and narrow integers
+// are i32 values kept extended by explicit instructions.
+//
+// Blocks are ordered so that branches only lead to later blocks. The language
+// has no loops, and the backends rely on the order to rebuild structured
+// control flow.
+
+// Type is the type of a value.
+type Type uint8
+
+const (
+	I32 Type = iota + 1
+	I64
+	F32
+	F64
+)
+
+func (t Type) String() string {
+	switch t {
+	case I32:
+		return "i32"
+	case I64:
+		return "i64"
+	case F32:
+		return "f32"
+	case F64:
+		return "f64"
+	}
+	return "invalid"
+}
+
+// IsInteger reports whether t is i32 or i64.
+func (t Type) IsInteger() bool {
+	return t == I32 || t == I64
+}
+
+// IsFloat reports whether t is f32 or f64.
+func (t Type) IsFloat() bool {
+	return t == F32 || t == F64
+}
+
+// Bits returns the width of values of type t.
+func (t Type) Bits() int {
+	if t == I64 || t == F64 {
+		return 64
+	}
+	return 32
+}
+
+// Local is a parameter or a local variable of a function. Locals can be
+// assigned any number of times; the temporaries created by the lowering are
+// assigned once.
+type Local struct {
+	Name string
+	Type Type
+}
+
+func (l *Local) String() string {
+	return "%" + l.Name
+}
+
+// Value is an operand of an instruction: a local, or a constant when Local is
+// nil.
+type Value struct {
+	Local *Local
+	Type  Type
+	Bits  uint64 // the bits of a constant, integers in two's complement and floats in IEEE 754
+}
+
+// Use returns the value of a local.
+func Use(l *Local) Value {
+	return Value{Local: l, Type: l.Type}
+}
+
+// Int returns an integer constant of type t.
+func Int(t Type, value int64) Value {
+	bits := uint64(value)
+	if t == I32 {
+		bits = uint64(uint32(value))
+	}
+	return Value{Type: t, Bits: bits}
+}
+
+// Float returns a float constant of type t.
+func Float(t Type, value float64) Value {
+	if t == F32 {
+		return Value{Type: t, Bits: uint64(math.Float32bits(float32(value)))}
+	}
+	return Value{Type: t, Bits: math.Float64bits(value)}
+}
+
+// IsConst reports whether v is a constant.
+func (v Value) IsConst() bool {
+	return v.Local == nil
+}
+
+// Int returns the value of an integer constant, sign-extended from i32.
+func (v Value) Int() int64 {
+	if v.Type == I32 {
+		return int64(int32(v.Bits))
+	}
+	return int64(v.Bits)
+}
+
+// Float returns the value of a float constant.
+func (v Value) Float() float64 {
+	if v.Type == F32 {
+		return float64(math.Float32frombits(uint32(v.Bits)))
+	}
+	return math.Float64frombits(v.Bits)
+}
+
+// String renders a local by its name and a constant by its value. Floats
+// always have a fraction or an exponent, so that they cannot be mistaken for
+// integers.
+func (v Value) String() string {
+	if v.Local != nil {
+		return v.Local.String()
+	}
+	if v.Type.IsInteger() {
+		return strconv.FormatInt(v.Int(), 10)
+	}
+	text := FormatFloat(v.Float(), v.Type)
+	if !strings.ContainsAny(text, ".ein") {
+		text += ".0"
+	}
+	return text
+}
+
+// FormatFloat renders a float like the WebAssembly text format.
+func FormatFloat(value float64, t Type) string {
+	switch {
+	case math.IsNaN(value):
+		return "nan"
+	case math.IsInf(value, 1):
+		return "inf"
+	case math.IsInf(value, -1):
+		return "-inf"
+	}
+	if t == F32 {
+		return strconv.FormatFloat(value, 'g', -1, 32)
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// Signature is the type of a function: the values it takes and returns.
+type Signature struct {
+	Params  []Type
+	Results []Type
+}
+
+// Instr is an instruction. Numeric instructions are named like their
+// WebAssembly counterparts, with the type they work on in Type: i64.add is Op
+// Add and Type I64, and i64.extend_i32_s is Op ExtendI32S and Type I64.
+type Instr struct {
+	Op     Op
+	Type   Type       // the type of the operation, or of the value loaded or stored
+	Dests  []*Local   // the locals receiving the results
+	Args   []Value    // the operands
+	Offset int        // loads and stores: added to the address
+	Name   string     // calls: the function; global.get and global.set: the global
+	Sig    *Signature // call_indirect: the signature of the called function
+}
+
+// Terminator ends a block, transferring control to its successors or out of
+// the function.
+type Terminator interface {
+	Succs() []*Block
+	String() string
+}
+
+// Jump continues with another block.
+type Jump struct {
+	Target *Block
+}
+
+// Branch continues with Then when Cond, an i32, is not zero, and with Else
+// otherwise.
+type Branch struct {
+	Cond       Value
+	Then, Else *Block
+}
+
+// Switch continues with Targets[Value], or with Default when Value, an i32
+// taken as unsigned, is out of range.
+type Switch struct {
+	Value   Value
+	Targets []*Block
+	Default *Block
+}
+
+// Return returns from the function with the given values.
+type Return struct {
+	Values []Value
+}
+
+// Unreachable traps.
+type Unreachable struct{}
+
+func (t *Jump) Succs() []*Block   { return []*Block{t.Target} }
+func (t *Branch) Succs() []*Block { return []*Block{t.Then, t.Else} }
+func (t *Switch) Succs() []*Block {
+	return append(append([]*Block{}, t.Targets...), t.Default)
+}
+func (t *Return) Succs() []*Block      { return nil }
+func (t *Unreachable) Succs() []*Block { return nil }
+
+// Block is a basic block: instructions running in order, ended by a
+// terminator.
+type Block struct {
+	Index  int
+	Instrs []*Instr
+	Term   Terminator
+}
+
+func (b *Block) String() string {
+	return fmt.Sprintf("b%d", b.Index)
+}
+
+// Function is a function defined by the module.
+type Function struct {
+	Name    string
+	Params  []*Local
+	Results []Type
+	Locals  []*Local // the locals other than the parameters
+	Blocks  []*Block // the entry block first
+
+	names map[string]bool // the names of the parameters and locals
+}
+
+// NewFunction creates a function without parameters, locals or blocks.
+func NewFunction(name string, results []Type) *Function {
+	return &Function{Name: name, Results: results, names: map[string]bool{}}
+}
+
+// Signature returns the signature of the function.
+func (f *Function) Signature() *Signature {
+	params := make([]Type, len(f.Params))
+	for i, param := range f.Params {
+		params[i] = param.Type
+	}
+	return &Signature{Params: params, Results: f.Results}
+}
+
+// NewParam adds a parameter of type t.
+func (f *Function) NewParam(name string, t Type) *Local {
+	param := &Local{Name: f.unique(name), Type: t}
+	f.Params = append(f.Params, param)
+	return param
+}
+
+// NewLocal adds a local of type t. Locals live for the whole function, so a
+// name already taken gets a numeric suffix.
+func (f *Function) NewLocal(name string, t Type) *Local {
+	local := &Local{Name: f.unique(name), Type: t}
+	f.Locals = append(f.Locals, local)
+	return local
+}
+
+func (f *Function) unique(name string) string {
+	if f.names == nil {
+		f.names = map[string]bool{}
+	}
+	unique := name
+	for n := 1; f.names[unique]; n++ {
+		unique = fmt.Sprintf("%s.%d", name, n)
+	}
+	f.names[unique] = true
+	return unique
+}
+
+// NewBlock appends an empty block.
+func (f *Function) NewBlock() *Block {
+	block := &Block{Index: len(f.Blocks)}
+	f.Blocks = append(f.Blocks, block)
+	return block
+}
+
+// Renumber sets the index of every block to its position, after blocks were
+// removed or reordered.
+func (f *Function) Renumber() {
+	for i, block := range f.Blocks {
+		block.Index = i
+	}
+}
+
+// Preds returns the predecessors of every block, by index. A block branching
+// to another in several ways is listed once.
+func (f *Function) Preds() [][]*Block {
+	preds := make([][]*Block, len(f.Blocks))
+	for _, block := range f.Blocks {
+		if block.Term == nil {
+			continue
+		}
+		seen := map[*Block]bool{}
+		for _, succ := range block.Term.Succs() {
+			if !seen[succ] {
+				seen[succ] = true
+				preds[succ.Index] = append(preds[succ.Index], block)
+			}
+		}
+	}
+	return preds
+}
+
+// Reachable returns whether every block, by index, can be reached from the
+// entry block.
+func (f *Function) Reachable() []bool {
+	reachable := make([]bool, len(f.Blocks))
+	if len(f.Blocks) == 0 {
+		return reachable
+	}
+	reachable[0] = true
+	// successors come after their predecessors
+	for _, block := range f.Blocks {
+		if !reachable[block.Index] || block.Term == nil {
+			continue
+		}
+		for _, succ := range block.Term.Succs() {
+			reachable[succ.Index] = true
+		}
+	}
+	return reachable
+}
+
+// Dominators returns the immediate dominator of every reachable block but the
+// entry block, by index, and -1 for the others.
+func (f *Function) Dominators() []int {
+	idom := make([]int, len(f.Blocks))
+	for i := range idom {
+		idom[i] = -1
+	}
+	if len(f.Blocks) == 0 {
+		return idom
+	}
+	idom[0] = 0
+	// blocks come after their dominators, so a single pass in order settles
+	// every block
+	for i, preds := range f.Preds() {
+		if i == 0 {
+			continue
+		}
+		for _, pred := range preds {
+			switch {
+			case idom[pred.Index] < 0:
+			case idom[i] < 0:
+				idom[i] = pred.Index
+			default:
+				idom[i] = intersect(idom, idom[i], pred.Index)
+			}
+		}
+	}
+	idom[0] = -1
+	return idom
+}
+
+// intersect returns the closest common dominator of two blocks.
+func intersect(idom []int, a, b int) int {
+	for a != b {
+		for a > b {
+			a = idom[a]
+		}
+		for b > a {
+			b = idom[b]
+		}
+	}
+	return a
+}
+
+// Dominates reports whether every path from the entry block to block b goes
+// through block a, given the dominators of the function.
+func Dominates(idom []int, a, b int) bool {
+	for ; b > a; b = idom[b] {
+	}
+	return a == b
+}
+
+// Global is a global variable, initialized with a constant.
+type Global struct {
+	Name    string
+	Type    Type
+	Mutable bool
+	Init    Value
+}
+
+// Import is a function provided by the host.
+type Import struct {
+	Name   string // the name of the function in the module
+	Module string
+	Field  string
+	Sig    *Signature
+}
+
+// Export makes a function or a global available to the host under a name.
+// Exactly one of Function and Global is set.
+type Export struct {
+	Name     string
+	Function string
+	Global   string
+}
+
+// Module is a whole program.
+type Module struct {
+	Imports   []*Import
+	Globals   []*Global
+	Functions []*Function
+	Exports   []*Export
+
+	// Table lists the functions called through call_indirect, by their index.
+	Table []string
+
+	// Start names the function run when the module is instantiated, when
+	// there is one. It takes no parameters and returns nothing.
+	Start string
+
+	// Data holds the contents of linear memory from address 0 on. The
+	// memory is present when there is data or a function uses it.
+	Data []byte
+}
+
+// Function returns the function with the given name, or nil.
+func (m *Module) Function(name string) *Function {
+	for _, f := range m.Functions {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// Callee returns the signature of the function or the import with the given
+// name.
+func (m *Module) Callee(name string) (*Signature, bool) {
+	for _, imp := range m.Imports {
+		if imp.Name == name {
+			return imp.Sig, true
+		}
+	}
+	if f := m.Function(name); f != nil {
+		return f.Signature(), true
+	}
+	return nil, false
+}
+
+// Global returns the global with the given name, or nil.
+func (m *Module) Global(name string) *Global {
+	for _, global := range m.Globals {
+		if global.Name == name {
+			return global
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package ir
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// sample builds a small module using every kind of declaration:
+//
+//	b0: %tmp = i32.add %a, %b
+//	    branch %tmp b1 b2
+//	b1: return %tmp
+//	b2: call $log(%tmp); jump b3
+//	b3: return 0
+func sample() *Module {
+	add := NewFunction("main::add", []Type{I32})
+	a, c := add.NewParam("a", I32), add.NewParam("b", I32)
+	b := NewBuilder(add)
+	sum := b.Op(Add, I32, Use(a), Use(c))
+	then, other, join := add.NewBlock(), add.NewBlock(), add.NewBlock()
+	b.Terminate(&Branch{Cond: sum, Then: then, Else: other})
+	b.Block = then
+	b.Terminate(&Return{Values: []Value{sum}})
+	b.Block = other
+	b.Call("main::log", nil, sum)
+	b.GlobalSet("main::count", sum)
+	b.Jump(join)
+	b.Block = join
+	b.Terminate(&Return{Values: []Value{Int(I32, 0)}})
+
+	init := NewFunction("main::init", nil)
+	NewBuilder(init).Terminate(&Return{})
+
+	return &Module{
+		Imports:   []*Import{{Name: "main::log", Module: "env", Field: "log", Sig: &Signature{Params: []Type{I32}}}},
+		Globals:   []*Global{{Name: "main::count", Type: I32, Mutable: true, Init: Int(I32, 0)}},
+		Functions: []*Function{add, init},
+		Exports:   []*Export{{Name: "add", Function: "main::add"}, {Name: "count", Global: "main::count"}},
+		Table:     []string{"main::add"},
+		Start:     "main::init",
+		Data:      []byte("hi\n"),
+	}
+}
+
+func TestString(t *testing.T) {
+	want := `import $main::log = "env" "log" (i32)
+global $main::count mut i32 = 0
+table $main::add
+export "add" = $main::add
+export "count" = global $main::count
+start $main::init
+data "hi\n"
+
+func $main::add(%a i32, %b i32) -> i32
+  local %tmp i32
+b0:
+  %tmp = i32.add %a, %b
+  branch %tmp, b1, b2
+b1:
+  return %tmp
+b2:
+  call $main::log %tmp
+  global.set $main::count %tmp
+  jump b3
+b3:
+  return 0
+
+func $main::init()
+b0:
+  return
+`
+	if got := sample().String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	if err := Verify(sample()); err != nil {
+		t.Fatalf("the sample is rejected: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(m *Module)
+		err    string
+	}{
+		{"unterminated block", func(m *Module) { m.Functions[0].Blocks[3].Term = nil }, "$main::add: b3: not terminated"},
+		{"branch back", func(m *Module) { m.Functions[0].Blocks[3].Term = &Jump{Target: m.Functions[0].Blocks[0]} }, "jump b0: branch back to b0"},
+		{"branch to another function", func(m *Module) {
+			m.Functions[0].Blocks[2].Term = &Jump{Target: m.Functions[1].Blocks[0]}
+		}, "branch to a block outside of the function"},
+		{"wrong block index", func(m *Module) { m.Functions[0].Blocks[1].Index = 5 }, "block 1 has index 5"},
+		{"operand type", func(m *Module) { m.Functions[0].Blocks[0].Instrs[0].Type = I64 }, "operand 1 is i32, want i64"},
+		{"operand count", func(m *Module) { m.Functions[0].Blocks[0].Instrs[0].Op = Eqz }, "2 operands, want 1"},
+		{"result type", func(m *Module) { m.Functions[0].Locals[0].Type = I64 }, "result 1 is i32 but %tmp is i64"},
+		{"foreign local", func(m *Module) {
+			m.Functions[0].Blocks[0].Instrs[0].Args[0] = Use(&Local{Name: "x", Type: I32})
+		}, "%x is not a local of the function"},
+		{"local declared twice", func(m *Module) { f := m.Functions[0]; f.Locals = append(f.Locals, f.Params[0]) }, "local %a is declared twice"},
+		{"missing operation", func(m *Module) { m.Functions[0].Blocks[0].Instrs[0].Op = Sqrt }, "no operation sqrt on i32"},
+		{"offset of an addition", func(m *Module) { m.Functions[0].Blocks[0].Instrs[0].Offset = 4 }, "invalid offset 4"},
+		{"return type", func(m *Module) { m.Functions[0].Blocks[3].Term = &Return{Values: []Value{Float(F64, 0)}} }, "operand 1 is f64, want i32"},
+		{"missing result", func(m *Module) { m.Functions[0].Blocks[3].Term = &Return{} }, "0 operands, want 1"},
+		{"undefined callee", func(m *Module) { m.Imports = nil }, "undefined function $main::log"},
+		{"immutable global", func(m *Module) { m.Globals[0].Mutable = false }, "global $main::count is not mutable"},
+		{"undefined global", func(m *Module) { m.Globals = nil }, "undefined global $main::count"},
+		{"global initializer", func(m *Module) { m.Globals[0].Init = Int(I64, 0) }, "initializer 0 is not a constant of type i32"},
+		{"defined twice", func(m *Module) { m.Functions = append(m.Functions, m.Functions[1]) }, "function $main::init is defined twice"},
+		{"table", func(m *Module) { m.Table = []string{"missing"} }, "table: undefined function $missing"},
+		{"export", func(m *Module) { m.Exports[0].Function = "missing" }, `export "add": undefined function $missing`},
+		{"start with parameters", func(m *Module) { m.Start = "main::add" }, "start: function $main::add has the signature (i32, i32) -> i32"},
+		{"no blocks", func(m *Module) { m.Functions[1].Blocks = nil }, "$main::init: no blocks"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := sample()
+			test.change(m)
+			err := Verify(m)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("got %v, want an error containing %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestDominators(t *testing.T) {
+	f := sample().Functions[0]
+	if got := f.Dominators(); !slices.Equal(got, []int{-1, 0, 0, 2}) {
+		t.Errorf("got dominators %v", got)
+	}
+	preds := f.Preds()
+	if len(preds[0]) != 0 || len(preds[1]) != 1 || preds[3][0] != f.Blocks[2] {
+		t.Errorf("got predecessors %v", preds)
+	}
+
+	// b4 is never reached and dominates nothing
+	f.NewBlock().Term = &Jump{Target: f.Blocks[3]}
+	idom := f.Dominators()
+	if !slices.Equal(f.Reachable(), []bool{true, true, true, true, false}) || idom[4] != -1 || idom[3] != 2 {
+		t.Errorf("got dominators %v", idom)
+	}
+	if !Dominates(idom, 0, 3) || Dominates(idom, 1, 3) || !Dominates(idom, 2, 2) {
+		t.Error("wrong dominance")
+	}
+}
@@ -0,0 +1,212 @@
+package ir
+
+// Op names the operation of an instruction. Numeric and memory operations are
+// named like the WebAssembly instructions they stand for, without the type.
+type Op string
+
+const (
+	// Copy copies its operand into its destination.
+	Copy Op = "copy"
+	// Select copies its first operand when its third, an i32, is not zero,
+	// and its second one otherwise.
+	Select Op = "select"
+
+	Add      Op = "add"
+	Sub      Op = "sub"
+	Mul      Op = "mul"
+	Div      Op = "div"
+	DivS     Op = "div_s"
+	DivU     Op = "div_u"
+	RemS     Op = "rem_s"
+	RemU     Op = "rem_u"
+	And      Op = "and"
+	Or       Op = "or"
+	Xor      Op = "xor"
+	Shl      Op = "shl"
+	ShrS     Op = "shr_s"
+	ShrU     Op = "shr_u"
+	Min      Op = "min"
+	Max      Op = "max"
+	Copysign Op = "copysign"
+
+	Eq  Op = "eq"
+	Ne  Op = "ne"
+	Lt  Op = "lt"
+	LtS Op = "lt_s"
+	LtU Op = "lt_u"
+	Le  Op = "le"
+	LeS Op = "le_s"
+	LeU Op = "le_u"
+	Gt  Op = "gt"
+	GtS Op = "gt_s"
+	GtU Op = "gt_u"
+	Ge  Op = "ge"
+	GeS Op = "ge_s"
+	GeU Op = "ge_u"
+
+	Eqz       Op = "eqz"
+	Clz       Op = "clz"
+	Ctz       Op = "ctz"
+	Popcnt    Op = "popcnt"
+	Extend8S  Op = "extend8_s"
+	Extend16S Op = "extend16_s"
+	Neg       Op = "neg"
+	Abs       Op = "abs"
+	Sqrt      Op = "sqrt"
+	Ceil      Op = "ceil"
+	Floor     Op = "floor"
+	Trunc     Op = "trunc"
+	Nearest   Op = "nearest"
+
+	WrapI64      Op = "wrap_i64"
+	ExtendI32S   Op = "extend_i32_s"
+	ExtendI32U   Op = "extend_i32_u"
+	ConvertI32S  Op = "convert_i32_s"
+	ConvertI32U  Op = "convert_i32_u"
+	ConvertI64S  Op = "convert_i64_s"
+	ConvertI64U  Op = "convert_i64_u"
+	TruncSatF32S Op = "trunc_sat_f32_s"
+	TruncSatF32U Op = "trunc_sat_f32_u"
+	TruncSatF64S Op = "trunc_sat_f64_s"
+	TruncSatF64U Op = "trunc_sat_f64_u"
+	PromoteF32   Op = "promote_f32"
+	DemoteF64    Op = "demote_f64"
+
+	// reinterpret the bits of a value as a value of another type of the
+	// same width
+	ReinterpretF32 Op = "reinterpret_f32"
+	ReinterpretF64 Op = "reinterpret_f64"
+	ReinterpretI32 Op = "reinterpret_i32"
+	ReinterpretI64 Op = "reinterpret_i64"
+
+	Load    Op = "load"
+	Load8S  Op = "load8_s"
+	Load8U  Op = "load8_u"
+	Load16S Op = "load16_s"
+	Load16U Op = "load16_u"
+	Store   Op = "store"
+	Store8  Op = "store8"
+	Store16 Op = "store16"
+
+	// Call calls the function Name.
+	Call Op = "call"
+	// CallIndirect calls the function of the table at the index given by its
+	// last operand, trapping unless it has the signature Sig.
+	CallIndirect Op = "call_indirect"
+	GlobalGet    Op = "global.get"
+	GlobalSet    Op = "global.set"
+	// MemoryCopy copies as many bytes as its third operand from the address
+	// of its second operand to the address of its first.
+	MemoryCopy Op = "memory.copy"
+	// MemorySize returns the size of linear memory in pages of 64 KiB.
+	MemorySize Op = "memory.size"
+	// MemoryGrow grows linear memory by a number of pages and returns the
+	// previous size, or -1 when it cannot.
+	MemoryGrow Op = "memory.grow"
+)
+
+type class uint8
+
+const (
+	binary  class = iota + 1 // (t, t) -> t
+	compare                  // (t, t) -> i32
+	unary                    // t -> t
+	test                     // t -> i32
+	convert                  // from -> t
+	load                     // i32 -> t
+	store                    // (i32, t) ->
+)
+
+// types on which an operation applies
+const (
+	integers = 1<<I32 | 1<<I64
+	floats   = 1<<F32 | 1<<F64
+	numbers  = integers | floats
+)
+
+type opInfo struct {
+	class class
+	on    uint8 // the set of types the operation applies to
+	from  Type  // the type converted from
+}
+
+var ops = map[Op]opInfo{
+	Add: {binary, numbers, 0}, Sub: {binary, numbers, 0}, Mul: {binary, numbers, 0},
+	Div: {binary, floats, 0}, DivS: {binary, integers, 0}, DivU: {binary, integers, 0},
+	RemS: {binary, integers, 0}, RemU: {binary, integers, 0},
+	And: {binary, integers, 0}, Or: {binary, integers, 0}, Xor: {binary, integers, 0},
+	Shl: {binary, integers, 0}, ShrS: {binary, integers, 0}, ShrU: {binary, integers, 0},
+	Min: {binary, floats, 0}, Max: {binary, floats, 0}, Copysign: {binary, floats, 0},
+
+	Eq: {compare, numbers, 0}, Ne: {compare, numbers, 0},
+	Lt: {compare, floats, 0}, Le: {compare, floats, 0}, Gt: {compare, floats, 0}, Ge: {compare, floats, 0},
+	LtS: {compare, integers, 0}, LtU: {compare, integers, 0}, LeS: {compare, integers, 0}, LeU: {compare, integers, 0},
+	GtS: {compare, integers, 0}, GtU: {compare, integers, 0}, GeS: {compare, integers, 0}, GeU: {compare, integers, 0},
+
+	Eqz: {test, integers, 0},
+	Clz: {unary, integers, 0}, Ctz: {unary, integers, 0}, Popcnt: {unary, integers, 0},
+	Extend8S: {unary, integers, 0}, Extend16S: {unary, integers, 0},
+	Neg: {unary, floats, 0}, Abs: {unary, floats, 0}, Sqrt: {unary, floats, 0}, Ceil: {unary, floats, 0},
+	Floor: {unary, floats, 0}, Trunc: {unary, floats, 0}, Nearest: {unary, floats, 0},
+
+	WrapI64:    {convert, 1 << I32, I64},
+	ExtendI32S: {convert, 1 << I64, I32}, ExtendI32U: {convert, 1 << I64, I32},
+	ConvertI32S: {convert, floats, I32}, ConvertI32U: {convert, floats, I32},
+	ConvertI64S: {convert, floats, I64}, ConvertI64U: {convert, floats, I64},
+	TruncSatF32S: {convert, integers, F32}, TruncSatF32U: {convert, integers, F32},
+	TruncSatF64S: {convert, integers, F64}, TruncSatF64U: {convert, integers, F64},
+	PromoteF32: {convert, 1 << F64, F32}, DemoteF64: {convert, 1 << F32, F64},
+	ReinterpretF32: {convert, 1 << I32, F32}, ReinterpretF64: {convert, 1 << I64, F64},
+	ReinterpretI32: {convert, 1 << F32, I32}, ReinterpretI64: {convert, 1 << F64, I64},
+
+	Load: {load, numbers, 0}, Load8S: {load, integers, 0}, Load8U: {load, integers, 0},
+	Load16S: {load, integers, 0}, Load16U: {load, integers, 0},
+	Store: {store, numbers, 0}, Store8: {store, integers, 0}, Store16: {store, integers, 0},
+}
+
+// Typed reports whether op is a numeric or a memory operation, which is
+// written with its type like i32.add.
+func (op Op) Typed() bool {
+	_, ok := ops[op]
+	return ok
+}
+
+// IsMemory reports whether op loads or stores a value.
+func (op Op) IsMemory() bool {
+	info := ops[op]
+	return info.class == load || info.class == store
+}
+
+// Operands returns the types of the operands and the results of a numeric or
+// memory operation on type t. It returns false when op is not one, or does
+// not apply to t.
+func (op Op) Operands(t Type) (args []Type, results []Type, ok bool) {
+	info, ok := ops[op]
+	if !ok || info.on&(1<<t) == 0 {
+		return nil, nil, false
+	}
+	switch info.class {
+	case binary:
+		return []Type{t, t}, []Type{t}, true
+	case compare:
+		return []Type{t, t}, []Type{I32}, true
+	case unary:
+		return []Type{t}, []Type{t}, true
+	case test:
+		return []Type{t}, []Type{I32}, true
+	case convert:
+		return []Type{info.from}, []Type{t}, true
+	case load:
+		return []Type{I32}, []Type{t}, true
+	default:
+		return []Type{I32, t}, nil, true
+	}
+}
+
+// Result returns the type of the result of a numeric operation on type t.
+func (op Op) Result(t Type) Type {
+	if _, results, ok := op.Operands(t); ok && len(results) == 1 {
+		return results[0]
+	}
+	return t
+}
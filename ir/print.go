@@ -0,0 +1,171 @@
+package ir
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The text format lists the imports, globals, table, exports, start function
+// and data of a module, followed by its functions:
+//
+//	global $main::count mut i32 = 0
+//
+//	func $main::add(%a i32, %b i32) -> i32
+//	  local %tmp i32
+//	b0:
+//	  %tmp = i32.add %a, %b
+//	  return %tmp
+//
+// Locals are written with %, and functions and globals with $. Constants are
+// written by their value, typed by the instruction using them.
+
+// String renders the module in the text format.
+func (m *Module) String() string {
+	var out strings.Builder
+	for _, imp := range m.Imports {
+		fmt.Fprintf(&out, "import $%s = %q %q %s\n", imp.Name, imp.Module, imp.Field, imp.Sig)
+	}
+	for _, global := range m.Globals {
+		mutable := ""
+		if global.Mutable {
+			mutable = "mut "
+		}
+		fmt.Fprintf(&out, "global $%s %s%s = %s\n", global.Name, mutable, global.Type, global.Init)
+	}
+	if len(m.Table) > 0 {
+		names := make([]string, len(m.Table))
+		for i, name := range m.Table {
+			names[i] = "$" + name
+		}
+		fmt.Fprintf(&out, "table %s\n", strings.Join(names, " "))
+	}
+	for _, export := range m.Exports {
+		if export.Global != "" {
+			fmt.Fprintf(&out, "export %q = global $%s\n", export.Name, export.Global)
+		} else {
+			fmt.Fprintf(&out, "export %q = $%s\n", export.Name, export.Function)
+		}
+	}
+	if m.Start != "" {
+		fmt.Fprintf(&out, "start $%s\n", m.Start)
+	}
+	if len(m.Data) > 0 {
+		fmt.Fprintf(&out, "data %s\n", strconv.QuoteToASCII(string(m.Data)))
+	}
+	for _, f := range m.Functions {
+		out.WriteString("\n")
+		out.WriteString(f.String())
+	}
+	return out.String()
+}
+
+func (s *Signature) String() string {
+	params := make([]string, len(s.Params))
+	for i, t := range s.Params {
+		params[i] = t.String()
+	}
+	str := "(" + strings.Join(params, ", ") + ")"
+	return str + results(s.Results)
+}
+
+func results(types []Type) string {
+	switch len(types) {
+	case 0:
+		return ""
+	case 1:
+		return " -> " + types[0].String()
+	}
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = t.String()
+	}
+	return " -> (" + strings.Join(names, ", ") + ")"
+}
+
+// String renders the function in the text format.
+func (f *Function) String() string {
+	var out strings.Builder
+	params := make([]string, len(f.Params))
+	for i, param := range f.Params {
+		params[i] = fmt.Sprintf("%s %s", param, param.Type)
+	}
+	fmt.Fprintf(&out, "func $%s(%s)%s\n", f.Name, strings.Join(params, ", "), results(f.Results))
+	for _, local := range f.Locals {
+		fmt.Fprintf(&out, "  local %s %s\n", local, local.Type)
+	}
+	for _, block := range f.Blocks {
+		fmt.Fprintf(&out, "%s:\n", block)
+		for _, instr := range block.Instrs {
+			fmt.Fprintf(&out, "  %s\n", instr)
+		}
+		if block.Term != nil {
+			fmt.Fprintf(&out, "  %s\n", block.Term)
+		}
+	}
+	return out.String()
+}
+
+// String renders the instruction in the text format.
+func (i *Instr) String() string {
+	var out strings.Builder
+	if len(i.Dests) > 0 {
+		dests := make([]string, len(i.Dests))
+		for j, dest := range i.Dests {
+			dests[j] = dest.String()
+		}
+		out.WriteString(strings.Join(dests, ", ") + " = ")
+	}
+	switch {
+	case i.Op.Typed():
+		fmt.Fprintf(&out, "%s.%s", i.Type, i.Op)
+		if i.Offset != 0 {
+			fmt.Fprintf(&out, " offset=%d", i.Offset)
+		}
+	case i.Op == Call, i.Op == GlobalGet, i.Op == GlobalSet:
+		fmt.Fprintf(&out, "%s $%s", i.Op, i.Name)
+	case i.Op == CallIndirect:
+		fmt.Fprintf(&out, "%s %s", i.Op, i.Sig)
+	default:
+		out.WriteString(string(i.Op))
+	}
+	if len(i.Args) > 0 {
+		out.WriteString(" " + values(i.Args))
+	}
+	return out.String()
+}
+
+func values(values []Value) string {
+	strs := make([]string, len(values))
+	for i, value := range values {
+		strs[i] = value.String()
+	}
+	return strings.Join(strs, ", ")
+}
+
+func (t *Jump) String() string {
+	return "jump " + t.Target.String()
+}
+
+func (t *Branch) String() string {
+	return fmt.Sprintf("branch %s, %s, %s", t.Cond, t.Then, t.Else)
+}
+
+func (t *Switch) String() string {
+	targets := make([]string, len(t.Targets))
+	for i, target := range t.Targets {
+		targets[i] = target.String()
+	}
+	return fmt.Sprintf("switch %s [%s] %s", t.Value, strings.Join(targets, " "), t.Default)
+}
+
+func (t *Return) String() string {
+	if len(t.Values) == 0 {
+		return "return"
+	}
+	return "return " + values(t.Values)
+}
+
+func (t *Unreachable) String() string {
+	return "unreachable"
+}
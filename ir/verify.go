@@ -0,0 +1,219 @@
+package ir
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Verify checks that a module is well formed: every block of a function is
+// terminated and only branches to later blocks of the same function,
+// instructions and terminators get operands of the types they expect and
+// write to locals of the types they produce, locals belong to their function,
+// and calls, globals, the table, the exports and the start function refer to
+// what the module defines.
+func Verify(m *Module) error {
+	v := &verifier{module: m, names: map[string]bool{}}
+	for _, imp := range m.Imports {
+		v.define(imp.Name)
+	}
+	for _, f := range m.Functions {
+		v.define(f.Name)
+	}
+	for _, global := range m.Globals {
+		if !global.Init.IsConst() || global.Init.Type != global.Type {
+			v.errorf("global $%s: initializer %s is not a constant of type %s", global.Name, global.Init, global.Type)
+		}
+	}
+	for _, name := range m.Table {
+		if _, ok := m.Callee(name); !ok {
+			v.errorf("table: undefined function $%s", name)
+		}
+	}
+	for _, export := range m.Exports {
+		switch {
+		case export.Global != "":
+			if m.Global(export.Global) == nil {
+				v.errorf("export %q: undefined global $%s", export.Name, export.Global)
+			}
+		default:
+			if _, ok := m.Callee(export.Function); !ok {
+				v.errorf("export %q: undefined function $%s", export.Name, export.Function)
+			}
+		}
+	}
+	if m.Start != "" {
+		if sig, ok := m.Callee(m.Start); !ok {
+			v.errorf("start: undefined function $%s", m.Start)
+		} else if len(sig.Params) > 0 || len(sig.Results) > 0 {
+			v.errorf("start: function $%s has the signature %s", m.Start, sig)
+		}
+	}
+	for _, f := range m.Functions {
+		v.function(f)
+	}
+	return errors.Join(v.errs...)
+}
+
+type verifier struct {
+	module *Module
+	names  map[string]bool
+	errs   []error
+
+	// the function being verified
+	fn     *Function
+	locals map[*Local]bool
+	blocks map[*Block]bool
+	where  string
+}
+
+func (v *verifier) define(name string) {
+	if v.names[name] {
+		v.errorf("function $%s is defined twice", name)
+	}
+	v.names[name] = true
+}
+
+func (v *verifier) errorf(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if v.where != "" {
+		msg = v.where + ": " + msg
+	}
+	v.errs = append(v.errs, errors.New(msg))
+}
+
+func (v *verifier) function(f *Function) {
+	v.fn = f
+	v.locals = map[*Local]bool{}
+	v.blocks = map[*Block]bool{}
+	v.where = "$" + f.Name
+	defer func() { v.where = "" }()
+	for _, local := range append(append([]*Local{}, f.Params...), f.Locals...) {
+		if v.locals[local] {
+			v.errorf("local %s is declared twice", local)
+		}
+		v.locals[local] = true
+	}
+	if len(f.Blocks) == 0 {
+		v.errorf("no blocks")
+	}
+	for i, block := range f.Blocks {
+		if block.Index != i {
+			v.errorf("block %d has index %d", i, block.Index)
+		}
+		v.blocks[block] = true
+	}
+	for _, block := range f.Blocks {
+		v.where = fmt.Sprintf("$%s: %s", f.Name, block)
+		for _, instr := range block.Instrs {
+			v.instr(instr)
+		}
+		v.terminator(block)
+	}
+}
+
+func (v *verifier) instr(instr *Instr) {
+	var args, results []Type
+	switch instr.Op {
+	case Copy:
+		args, results = []Type{instr.Type}, []Type{instr.Type}
+	case Select:
+		args, results = []Type{instr.Type, instr.Type, I32}, []Type{instr.Type}
+	case Call:
+		sig, ok := v.module.Callee(instr.Name)
+		if !ok {
+			v.errorf("%s: undefined function $%s", instr, instr.Name)
+			return
+		}
+		args, results = sig.Params, sig.Results
+	case CallIndirect:
+		if instr.Sig == nil {
+			v.errorf("%s: no signature", instr)
+			return
+		}
+		args, results = append(append([]Type{}, instr.Sig.Params...), I32), instr.Sig.Results
+	case GlobalGet, GlobalSet:
+		global := v.module.Global(instr.Name)
+		if global == nil {
+			v.errorf("%s: undefined global $%s", instr, instr.Name)
+			return
+		}
+		if instr.Op == GlobalGet {
+			results = []Type{global.Type}
+		} else {
+			if !global.Mutable {
+				v.errorf("%s: global $%s is not mutable", instr, instr.Name)
+			}
+			args = []Type{global.Type}
+		}
+	case MemoryCopy:
+		args = []Type{I32, I32, I32}
+	case MemorySize:
+		results = []Type{I32}
+	case MemoryGrow:
+		args, results = []Type{I32}, []Type{I32}
+	default:
+		var ok bool
+		args, results, ok = instr.Op.Operands(instr.Type)
+		if !ok {
+			v.errorf("%s: no operation %s on %s", instr, instr.Op, instr.Type)
+			return
+		}
+	}
+	if instr.Offset < 0 || (instr.Offset != 0 && !instr.Op.IsMemory()) {
+		v.errorf("%s: invalid offset %d", instr, instr.Offset)
+	}
+	v.operands(instr.String(), instr.Args, args)
+	if len(instr.Dests) != len(results) {
+		v.errorf("%s: %d results written to %d locals", instr, len(results), len(instr.Dests))
+		return
+	}
+	for i, dest := range instr.Dests {
+		if !v.locals[dest] {
+			v.errorf("%s: %s is not a local of the function", instr, dest)
+		} else if dest.Type != results[i] {
+			v.errorf("%s: result %d is %s but %s is %s", instr, i+1, results[i], dest, dest.Type)
+		}
+	}
+}
+
+// operands checks the operands of an instruction or a terminator against the
+// types it expects.
+func (v *verifier) operands(what string, values []Value, want []Type) {
+	if len(values) != len(want) {
+		v.errorf("%s: %d operands, want %d", what, len(values), len(want))
+		return
+	}
+	for i, value := range values {
+		if value.Local != nil && !v.locals[value.Local] {
+			v.errorf("%s: %s is not a local of the function", what, value)
+		} else if value.Local != nil && value.Type != value.Local.Type {
+			v.errorf("%s: %s is used as %s", what, value, value.Type)
+		}
+		if value.Type != want[i] {
+			v.errorf("%s: operand %d is %s, want %s", what, i+1, value.Type, want[i])
+		}
+	}
+}
+
+func (v *verifier) terminator(block *Block) {
+	if block.Term == nil {
+		v.errorf("not terminated")
+		return
+	}
+	switch term := block.Term.(type) {
+	case *Branch:
+		v.operands(term.String(), []Value{term.Cond}, []Type{I32})
+	case *Switch:
+		v.operands(term.String(), []Value{term.Value}, []Type{I32})
+	case *Return:
+		v.operands(term.String(), term.Values, v.fn.Results)
+	}
+	for _, succ := range block.Term.Succs() {
+		switch {
+		case succ == nil || !v.blocks[succ]:
+			v.errorf("%s: branch to a block outside of the function", block.Term)
+		case succ.Index <= block.Index:
+			v.errorf("%s: branch back to %s", block.Term, succ)
+		}
+	}
+}
@@ -1,6 +1,11 @@
 package lexer
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+
+	"github.com/LaH-DeV/veles/source"
+)
 
 type TokenKind int
 
@@ -15,14 +20,26 @@ const (
 	INT_64
 	FLOAT_32
 	FLOAT_64
+	INT_8
+	INT_16
+	UINT_8
+	UINT_16
+	UINT_32
+	UINT_64
 	BOOL
+	STR
 
 	OPEN_PAREN
 	CLOSE_PAREN
 	OPEN_CURLY
 	CLOSE_CURLY
+	OPEN_BRACKET
+	CLOSE_BRACKET
 	DOUBLE_COLON
 	COLON
+	DOT
+	FAT_ARROW
+	ARROW
 	PLUS
 	DASH
 	SLASH
@@ -40,7 +57,26 @@ const (
 	GREATER
 	GREATER_EQUAL
 
+	AMPERSAND
+	PIPE
+	CARET
+	TILDE
+	SHIFT_LEFT
+	SHIFT_RIGHT
+	SHIFT_RIGHT_UNSIGNED
+
 	ASSIGNMENT
+	PLUS_ASSIGNMENT
+	DASH_ASSIGNMENT
+	ASTERISK_ASSIGNMENT
+	SLASH_ASSIGNMENT
+	REMAINDER_ASSIGNMENT
+	AMPERSAND_ASSIGNMENT
+	PIPE_ASSIGNMENT
+	CARET_ASSIGNMENT
+	SHIFT_LEFT_ASSIGNMENT
+	SHIFT_RIGHT_ASSIGNMENT
+	SHIFT_RIGHT_UNSIGNED_ASSIGNMENT
 	COMMA
 	SEMICOLON
 
@@ -54,12 +90,17 @@ const (
 	RETURN
 	FN
 	IF
+	ELSE
 	PUB
 	USE
 	DROP
 	LET
 	EXTERN
 	AS
+	MUT
+	STRUCT
+	ENUM
+	MATCH
 
 	TRUE
 	FALSE
@@ -89,18 +130,30 @@ var reserved_lu_vs map[string]TokenKind = map[string]TokenKind{
 	"extern": EXTERN,
 	"as":     AS,
 	"if":     IF,
+	"else":   ELSE,
+	"mut":    MUT,
+	"struct": STRUCT,
+	"enum":   ENUM,
+	"match":  MATCH,
 
 	"false": FALSE,
 	"true":  TRUE,
 }
 
 var reserved_types_vs map[string]TokenKind = map[string]TokenKind{
+	"i8":  INT_8,
+	"i16": INT_16,
 	"i32": INT_32,
 	"i64": INT_64,
+	"u8":  UINT_8,
+	"u16": UINT_16,
+	"u32": UINT_32,
+	"u64": UINT_64,
 	"f32": FLOAT_32,
 	"f64": FLOAT_64,
 
 	"bool": BOOL,
+	"str":  STR,
 }
 
 var reserved_types_wat map[string]TokenKind = map[string]TokenKind{
@@ -110,9 +163,45 @@ var reserved_types_wat map[string]TokenKind = map[string]TokenKind{
 	"f64": FLOAT_64,
 }
 
+// Keywords returns the reserved words of the language of the given file type.
+func Keywords(filetype Filetype) []string {
+	return sortedKeys(reservedWords(filetype))
+}
+
+// TypeNames returns the names of the builtin types of the given file type.
+func TypeNames(filetype Filetype) []string {
+	switch filetype {
+	case Vs:
+		return sortedKeys(reserved_types_vs)
+	case Wat:
+		return sortedKeys(reserved_types_wat)
+	}
+	return nil
+}
+
+func reservedWords(filetype Filetype) map[string]TokenKind {
+	switch filetype {
+	case Vs:
+		return reserved_lu_vs
+	case Wat:
+		return reserved_lu_wat
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]TokenKind) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 type Token struct {
 	Kind  TokenKind
 	Value string
+	Span  source.Span
 }
 
 func TokenKindString(kind TokenKind) string {
@@ -121,10 +210,14 @@ func TokenKindString(kind TokenKind) string {
 		return "eof"
 	case IF:
 		return "if"
+	case ELSE:
+		return "else"
 	case DROP:
 		return "drop"
 	case BOOL:
 		return "bool"
+	case STR:
+		return "str"
 	case FALSE:
 		return "false"
 	case TRUE:
@@ -141,6 +234,18 @@ func TokenKindString(kind TokenKind) string {
 		return "f32"
 	case FLOAT_64:
 		return "f64"
+	case INT_8:
+		return "i8"
+	case INT_16:
+		return "i16"
+	case UINT_8:
+		return "u8"
+	case UINT_16:
+		return "u16"
+	case UINT_32:
+		return "u32"
+	case UINT_64:
+		return "u64"
 	case INTEGER:
 		return "integer"
 	case FLOAT:
@@ -155,10 +260,20 @@ func TokenKindString(kind TokenKind) string {
 		return "open_curly"
 	case CLOSE_CURLY:
 		return "close_curly"
+	case OPEN_BRACKET:
+		return "open_bracket"
+	case CLOSE_BRACKET:
+		return "close_bracket"
 	case DOUBLE_COLON:
 		return "double_colon"
 	case COLON:
 		return "colon"
+	case DOT:
+		return "dot"
+	case FAT_ARROW:
+		return "fat_arrow"
+	case ARROW:
+		return "arrow"
 	case PLUS:
 		return "plus"
 	case DASH:
@@ -189,8 +304,44 @@ func TokenKindString(kind TokenKind) string {
 		return "greater"
 	case GREATER_EQUAL:
 		return "greater_equal"
+	case AMPERSAND:
+		return "ampersand"
+	case PIPE:
+		return "pipe"
+	case CARET:
+		return "caret"
+	case TILDE:
+		return "tilde"
+	case SHIFT_LEFT:
+		return "shift_left"
+	case SHIFT_RIGHT:
+		return "shift_right"
+	case SHIFT_RIGHT_UNSIGNED:
+		return "shift_right_unsigned"
 	case ASSIGNMENT:
 		return "assignment"
+	case PLUS_ASSIGNMENT:
+		return "plus_assignment"
+	case DASH_ASSIGNMENT:
+		return "dash_assignment"
+	case ASTERISK_ASSIGNMENT:
+		return "asterisk_assignment"
+	case SLASH_ASSIGNMENT:
+		return "slash_assignment"
+	case REMAINDER_ASSIGNMENT:
+		return "remainder_assignment"
+	case AMPERSAND_ASSIGNMENT:
+		return "ampersand_assignment"
+	case PIPE_ASSIGNMENT:
+		return "pipe_assignment"
+	case CARET_ASSIGNMENT:
+		return "caret_assignment"
+	case SHIFT_LEFT_ASSIGNMENT:
+		return "shift_left_assignment"
+	case SHIFT_RIGHT_ASSIGNMENT:
+		return "shift_right_assignment"
+	case SHIFT_RIGHT_UNSIGNED_ASSIGNMENT:
+		return "shift_right_unsigned_assignment"
 	case COMMA:
 		return "comma"
 	case SEMICOLON:
@@ -223,14 +374,53 @@ func TokenKindString(kind TokenKind) string {
 		return "extern"
 	case AS:
 		return "as"
+	case MUT:
+		return "mut"
+	case STRUCT:
+		return "struct"
+	case ENUM:
+		return "enum"
+	case MATCH:
+		return "match"
 	default:
 		return fmt.Sprintf("unknown(%d)", kind)
 	}
 }
 
+var compoundAssignments = map[TokenKind]TokenKind{
+	PLUS_ASSIGNMENT:                 PLUS,
+	DASH_ASSIGNMENT:                 DASH,
+	ASTERISK_ASSIGNMENT:             ASTERISK,
+	SLASH_ASSIGNMENT:                SLASH,
+	REMAINDER_ASSIGNMENT:            REMAINDER,
+	AMPERSAND_ASSIGNMENT:            AMPERSAND,
+	PIPE_ASSIGNMENT:                 PIPE,
+	CARET_ASSIGNMENT:                CARET,
+	SHIFT_LEFT_ASSIGNMENT:           SHIFT_LEFT,
+	SHIFT_RIGHT_ASSIGNMENT:          SHIFT_RIGHT,
+	SHIFT_RIGHT_UNSIGNED_ASSIGNMENT: SHIFT_RIGHT_UNSIGNED,
+}
+
+// CompoundOperator returns the binary operator of a compound assignment, like
+// PLUS for +=, and false for any other kind.
+func CompoundOperator(kind TokenKind) (TokenKind, bool) {
+	operator, ok := compoundAssignments[kind]
+	return operator, ok
+}
+
+// CompoundAssignments returns the kinds of the compound assignment operators.
+func CompoundAssignments() []TokenKind {
+	kinds := make([]TokenKind, 0, len(compoundAssignments))
+	for kind := range compoundAssignments {
+		kinds = append(kinds, kind)
+	}
+	return kinds
+}
+
 func newUniqueToken(kind TokenKind, value string) Token {
 	return Token{
-		kind, value,
+		Kind:  kind,
+		Value: value,
 	}
 }
 
@@ -0,0 +1,50 @@
+package lexer
+
+import "testing"
+
+func TestCompoundAssignments(t *testing.T) {
+	tests := []struct {
+		src      string
+		kind     TokenKind
+		operator TokenKind
+	}{
+		{"+=", PLUS_ASSIGNMENT, PLUS},
+		{"-=", DASH_ASSIGNMENT, DASH},
+		{"*=", ASTERISK_ASSIGNMENT, ASTERISK},
+		{"/=", SLASH_ASSIGNMENT, SLASH},
+		{"%=", REMAINDER_ASSIGNMENT, REMAINDER},
+		{"&=", AMPERSAND_ASSIGNMENT, AMPERSAND},
+		{"|=", PIPE_ASSIGNMENT, PIPE},
+		{"^=", CARET_ASSIGNMENT, CARET},
+		{"<<=", SHIFT_LEFT_ASSIGNMENT, SHIFT_LEFT},
+		{">>=", SHIFT_RIGHT_ASSIGNMENT, SHIFT_RIGHT},
+		{">>>=", SHIFT_RIGHT_UNSIGNED_ASSIGNMENT, SHIFT_RIGHT_UNSIGNED},
+	}
+	if len(CompoundAssignments()) != len(tests) {
+		t.Errorf("got %d compound assignments, want %d", len(CompoundAssignments()), len(tests))
+	}
+	for _, test := range tests {
+		lex := NewLexer(Vs)
+		tokens := lex.Tokenize("x " + test.src + " 1")
+		if len(tokens) != 4 || tokens[1].Kind != test.kind || len(lex.Diagnostics) > 0 {
+			t.Errorf("%s: got tokens %v", test.src, tokens)
+			continue
+		}
+		if operator, ok := CompoundOperator(tokens[1].Kind); !ok || operator != test.operator {
+			t.Errorf("%s: got operator %s", test.src, TokenKindString(operator))
+		}
+	}
+	if _, ok := CompoundOperator(ASSIGNMENT); ok {
+		t.Error("= is a compound assignment")
+	}
+
+	// the longest operator wins
+	lex := NewLexer(Vs)
+	tokens := lex.Tokenize("a >= b >> c == d")
+	kinds := []TokenKind{IDENTIFIER, GREATER_EQUAL, IDENTIFIER, SHIFT_RIGHT, IDENTIFIER, EQUAL, IDENTIFIER, EOF}
+	for i, token := range tokens {
+		if i >= len(kinds) || token.Kind != kinds[i] {
+			t.Fatalf("got tokens %v", tokens)
+		}
+	}
+}
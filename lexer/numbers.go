@@ -0,0 +1,126 @@
+package lexer
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Number is the value of a numeric literal. Integers keep their magnitude in
+// Int, floats their value in Float.
+type Number struct {
+	IsFloat bool
+	Int     uint64
+	Float   float64
+	Suffix  string // the type suffix, like "i64" in 10i64, or ""
+}
+
+var numberSuffixes = []string{"i8", "i16", "i32", "i64", "u8", "u16", "u32", "u64", "f32", "f64"}
+
+// ParseNumber parses a numeric literal: decimal, 0x hexadecimal, 0b binary
+// and 0o octal integers, decimal floats with an optional exponent, and an
+// optional type suffix. Underscores may separate digits, one at a time.
+func ParseNumber(literal string) (Number, error) {
+	var number Number
+	text := literal
+
+	base, digits := 10, "0123456789"
+	if len(text) > 1 && text[0] == '0' {
+		switch text[1] {
+		case 'x', 'X':
+			base, digits = 16, "0123456789abcdefABCDEF"
+		case 'b', 'B':
+			base, digits = 2, "01"
+		case 'o', 'O':
+			base, digits = 8, "01234567"
+		}
+		if base != 10 {
+			text = text[2:]
+		}
+	}
+
+	for _, suffix := range numberSuffixes {
+		// f is a hexadecimal digit, so hexadecimal literals only take integer suffixes
+		if base == 16 && suffix[0] == 'f' {
+			continue
+		}
+		if strings.HasSuffix(text, suffix) && len(text) > len(suffix) {
+			number.Suffix = suffix
+			text = strings.TrimSuffix(text, suffix)
+			break
+		}
+	}
+
+	mantissa, exponent := text, ""
+	if base == 10 {
+		if i := strings.IndexAny(text, "eE"); i >= 0 {
+			mantissa, exponent = text[:i], text[i+1:]
+			number.IsFloat = true
+			if exponent != "" && (exponent[0] == '+' || exponent[0] == '-') {
+				exponent = exponent[1:]
+			}
+			if err := checkDigits(exponent, digits, "exponent"); err != nil {
+				return number, err
+			}
+		}
+		if whole, fraction, found := strings.Cut(mantissa, "."); found {
+			number.IsFloat = true
+			if err := checkDigits(whole, digits, "number"); err != nil {
+				return number, err
+			}
+			if err := checkDigits(fraction, digits, "fraction"); err != nil {
+				return number, err
+			}
+		} else if err := checkDigits(mantissa, digits, "number"); err != nil {
+			return number, err
+		}
+	} else if err := checkDigits(text, digits, fmt.Sprintf("base %d number", base)); err != nil {
+		return number, err
+	}
+
+	if number.Suffix == "f32" || number.Suffix == "f64" {
+		number.IsFloat = true
+	} else if number.IsFloat && number.Suffix != "" {
+		return number, fmt.Errorf("float literal cannot have the integer suffix %s", number.Suffix)
+	}
+	if number.IsFloat && base != 10 {
+		return number, fmt.Errorf("base %d literal cannot have the float suffix %s", base, number.Suffix)
+	}
+
+	clean := strings.ReplaceAll(text, "_", "")
+	if number.IsFloat {
+		value, err := strconv.ParseFloat(clean, 64)
+		if errors.Is(err, strconv.ErrRange) {
+			return number, fmt.Errorf("float literal %s is out of range", literal)
+		}
+		number.Float = value
+		return number, err
+	}
+	value, err := strconv.ParseUint(clean, base, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		return number, fmt.Errorf("integer literal %s is too large", literal)
+	}
+	number.Int = value
+	number.Float = float64(value)
+	return number, err
+}
+
+// checkDigits reports digits outside of the base and misplaced underscores.
+func checkDigits(text string, digits string, what string) error {
+	if text == "" {
+		return fmt.Errorf("%s has no digits", what)
+	}
+	for i, r := range text {
+		if r == '_' {
+			if i == 0 || i == len(text)-1 || text[i-1] == '_' {
+				return fmt.Errorf("'_' must separate digits in %s", what)
+			}
+			continue
+		}
+		if !strings.ContainsRune(digits, r) {
+			return fmt.Errorf("invalid digit '%c' in %s", r, what)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package lexer
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/LaH-DeV/veles/diagnostics"
+)
+
+func TestParseNumber(t *testing.T) {
+	tests := []struct {
+		literal string
+		want    Number
+	}{
+		{"0", Number{}},
+		{"42", Number{Int: 42, Float: 42}},
+		{"1_000_000", Number{Int: 1000000, Float: 1000000}},
+		{"0xff", Number{Int: 255, Float: 255}},
+		{"0XdeadBEEF", Number{Int: 0xdeadbeef, Float: 0xdeadbeef}},
+		{"0b1010_1010", Number{Int: 170, Float: 170}},
+		{"0o777", Number{Int: 511, Float: 511}},
+		{"18446744073709551615", Number{Int: math.MaxUint64, Float: math.MaxUint64}},
+		{"10i64", Number{Int: 10, Float: 10, Suffix: "i64"}},
+		{"255u8", Number{Int: 255, Float: 255, Suffix: "u8"}},
+		{"0xffu16", Number{Int: 255, Float: 255, Suffix: "u16"}},
+		{"0x1f", Number{Int: 31, Float: 31}}, // f is a digit here, not a suffix
+		{"3.5", Number{IsFloat: true, Float: 3.5}},
+		{"1_000.000_1", Number{IsFloat: true, Float: 1000.0001}},
+		{"1e3", Number{IsFloat: true, Float: 1000}},
+		{"2.5E-2", Number{IsFloat: true, Float: 0.025}},
+		{"6.02e+23", Number{IsFloat: true, Float: 6.02e23}},
+		{"1f32", Number{IsFloat: true, Float: 1, Suffix: "f32"}},
+		{"0.5f64", Number{IsFloat: true, Float: 0.5, Suffix: "f64"}},
+	}
+	for _, test := range tests {
+		got, err := ParseNumber(test.literal)
+		if err != nil || got != test.want {
+			t.Errorf("ParseNumber(%s) = %+v, %v, want %+v", test.literal, got, err, test.want)
+		}
+	}
+}
+
+func TestParseNumberErrors(t *testing.T) {
+	tests := []struct {
+		literal string
+		err     string
+	}{
+		{"1__0", "'_' must separate digits in number"},
+		{"1_", "'_' must separate digits in number"},
+		{"0x_1", "'_' must separate digits in base 16 number"},
+		{"1._5", "'_' must separate digits in fraction"},
+		{"1e_5", "'_' must separate digits in exponent"},
+		{"0x", "base 16 number has no digits"},
+		{"0b102", "invalid digit '2' in base 2 number"},
+		{"0o8", "invalid digit '8' in base 8 number"},
+		{"1.", "fraction has no digits"},
+		{"1e", "exponent has no digits"},
+		{"1e+", "exponent has no digits"},
+		{"1.5i32", "float literal cannot have the integer suffix i32"},
+		{"1e3u8", "float literal cannot have the integer suffix u8"},
+		{"0b1f32", "base 2 literal cannot have the float suffix f32"},
+		{"18446744073709551616", "integer literal 18446744073709551616 is too large"},
+		{"1e400", "float literal 1e400 is out of range"},
+	}
+	for _, test := range tests {
+		_, err := ParseNumber(test.literal)
+		if err == nil || err.Error() != test.err {
+			t.Errorf("ParseNumber(%s): got error %v, want %q", test.literal, err, test.err)
+		}
+	}
+}
+
+func TestNumberTokens(t *testing.T) {
+	tests := []struct {
+		src  string
+		kind TokenKind
+		err  bool // whether E0004 is reported
+	}{
+		{"0x1F", INTEGER, false},
+		{"12u64", INTEGER, false},
+		{"1.5", FLOAT, false},
+		{"1e9", FLOAT, false},
+		{"7f32", FLOAT, false},
+		{"1__2", INTEGER, true},
+		{"0b2", INTEGER, true},
+		{"1.5u8", FLOAT, true},
+	}
+	for _, test := range tests {
+		lex := NewLexer(Vs)
+		tokens := lex.Tokenize(test.src)
+		if len(tokens) != 2 || tokens[0].Kind != test.kind || tokens[0].Value != test.src {
+			t.Errorf("%s: got tokens %v", test.src, tokens)
+			continue
+		}
+		reported := len(lex.Diagnostics) == 1 && lex.Diagnostics[0].Code.ID == "E0004" &&
+			lex.Diagnostics[0].Span.Start.Offset == 0 && lex.Diagnostics[0].Span.End.Offset == len(test.src)
+		if reported != test.err || (!test.err && len(lex.Diagnostics) > 0) {
+			t.Errorf("%s: got diagnostics %v", test.src, lex.Diagnostics)
+		}
+	}
+}
+
+func TestSuffixesExplained(t *testing.T) {
+	words := strings.FieldsFunc(diagnostics.MalformedNumber.Explanation, func(r rune) bool {
+		return r == ' ' || r == '\n' || r == ','
+	})
+	for _, suffix := range numberSuffixes {
+		if !slices.Contains(words, suffix) {
+			t.Errorf("the explanation of %s does not list the suffix %s", diagnostics.MalformedNumber.ID, suffix)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package lexer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// EscapeError describes an invalid escape sequence inside a string literal.
+// Offset and Length locate the sequence in bytes from the opening quote.
+type EscapeError struct {
+	Offset  int
+	Length  int
+	Message string
+}
+
+// Unquote returns the value of a Veles string literal, given with its quotes.
+// Invalid escape sequences are reported and left out of the value. Supported
+// escapes are \n, \t, \r, \0, \", \', \\ and \u{...} with 1 to 6 hex digits.
+func Unquote(literal string) (string, []EscapeError) {
+	var errs []EscapeError
+	var value strings.Builder
+	for i := 1; i < len(literal) && literal[i] != '"'; {
+		if literal[i] != '\\' {
+			value.WriteByte(literal[i])
+			i++
+			continue
+		}
+		start := i
+		if i+1 >= len(literal) {
+			errs = append(errs, EscapeError{Offset: start, Length: 1, Message: "unfinished escape sequence"})
+			break
+		}
+		i += 2
+		switch literal[start+1] {
+		case 'n':
+			value.WriteByte('\n')
+		case 't':
+			value.WriteByte('\t')
+		case 'r':
+			value.WriteByte('\r')
+		case '0':
+			value.WriteByte(0)
+		case '"', '\'', '\\':
+			value.WriteByte(literal[start+1])
+		case 'u':
+			end := strings.IndexByte(literal[i:], '}')
+			if !strings.HasPrefix(literal[i:], "{") || end < 0 {
+				errs = append(errs, EscapeError{Offset: start, Length: 2, Message: "expected \\u{...} with 1 to 6 hex digits"})
+				continue
+			}
+			digits := literal[i+1 : i+end]
+			i += end + 1
+			code, err := strconv.ParseUint(digits, 16, 32)
+			if err != nil || len(digits) == 0 || len(digits) > 6 || !utf8.ValidRune(rune(code)) {
+				errs = append(errs, EscapeError{Offset: start, Length: i - start, Message: fmt.Sprintf("invalid unicode escape \\u{%s}", digits)})
+				continue
+			}
+			value.WriteRune(rune(code))
+		default:
+			_, size := utf8.DecodeRuneInString(literal[start+1:])
+			i = start + 1 + size
+			errs = append(errs, EscapeError{Offset: start, Length: i - start, Message: fmt.Sprintf("unknown escape sequence %s", literal[start:i])})
+		}
+	}
+	return value.String(), errs
+}
@@ -0,0 +1,73 @@
+package lexer
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestUnquote(t *testing.T) {
+	tests := []struct {
+		literal string
+		value   string
+		errors  []EscapeError
+	}{
+		{`""`, "", nil},
+		{`"hello"`, "hello", nil},
+		{`"ż"`, "ż", nil},
+		{`"a\nb\tc\rd"`, "a\nb\tc\rd", nil},
+		{`"\0"`, "\x00", nil},
+		{`"\"\'\\"`, `"'\`, nil},
+		{`"\u{41}\u{17c}\u{1F600}"`, "Aż😀", nil},
+		{`"\u{10FFFF}"`, "\U0010FFFF", nil},
+		{`"a\qb"`, "ab", []EscapeError{{Offset: 2, Length: 2, Message: `unknown escape sequence \q`}}},
+		{`"\ż"`, "", []EscapeError{{Offset: 1, Length: 3, Message: `unknown escape sequence \ż`}}},
+		{`"\u41"`, "41", []EscapeError{{Offset: 1, Length: 2, Message: `expected \u{...} with 1 to 6 hex digits`}}},
+		{`"\u{}"`, "", []EscapeError{{Offset: 1, Length: 4, Message: `invalid unicode escape \u{}`}}},
+		{`"\u{1234567}"`, "", []EscapeError{{Offset: 1, Length: 11, Message: `invalid unicode escape \u{1234567}`}}},
+		{`"\u{D800}"`, "", []EscapeError{{Offset: 1, Length: 8, Message: `invalid unicode escape \u{D800}`}}},
+		{`"\u{xyz}"`, "", []EscapeError{{Offset: 1, Length: 7, Message: `invalid unicode escape \u{xyz}`}}},
+		{`"\x\y"`, "", []EscapeError{
+			{Offset: 1, Length: 2, Message: `unknown escape sequence \x`},
+			{Offset: 3, Length: 2, Message: `unknown escape sequence \y`},
+		}},
+		// unterminated literals are reported by the lexer, the escapes still are
+		{`"abc`, "abc", nil},
+		{`"ab\`, "ab", []EscapeError{{Offset: 3, Length: 1, Message: "unfinished escape sequence"}}},
+	}
+	for _, test := range tests {
+		value, errs := Unquote(test.literal)
+		if value != test.value || !slices.Equal(errs, test.errors) {
+			t.Errorf("Unquote(%s) = %q, %v, want %q, %v", test.literal, value, errs, test.value, test.errors)
+		}
+	}
+}
+
+func TestStringDiagnostics(t *testing.T) {
+	tests := []struct {
+		src   string
+		codes []string
+		spans [][2]int // the byte offsets of every diagnostic
+	}{
+		{`let str s = "ok\n"`, nil, nil},
+		{`let str s = "open`, []string{"E0002"}, [][2]int{{12, 17}}},
+		{"let str s = \"line\nbreak\"", []string{"E0002", "E0002"}, [][2]int{{12, 17}, {23, 24}}},
+		{`let str s = "a\qb"`, []string{"E0003"}, [][2]int{{14, 16}}},
+		{`let str s = "\u{D800}" + "\w"`, []string{"E0003", "E0003"}, [][2]int{{13, 21}, {26, 28}}},
+	}
+	for _, test := range tests {
+		lex := NewLexer(Vs)
+		tokens := lex.Tokenize(test.src)
+		codes := make([]string, 0)
+		spans := make([][2]int, 0)
+		for _, d := range lex.Diagnostics {
+			codes = append(codes, d.Code.ID)
+			spans = append(spans, [2]int{d.Span.Start.Offset, d.Span.End.Offset})
+		}
+		if !slices.Equal(codes, test.codes) || !slices.Equal(spans, test.spans) {
+			t.Errorf("%q: got %v at %v, want %v at %v", test.src, codes, spans, test.codes, test.spans)
+		}
+		if len(test.codes) == 0 && tokens[len(tokens)-2].Kind != STRING {
+			t.Errorf("%q: the string is lexed as %s", test.src, TokenKindString(tokens[len(tokens)-2].Kind))
+		}
+	}
+}
@@ -1,8 +1,11 @@
 package lexer
 
 import (
-	"fmt"
 	"regexp"
+	"unicode/utf8"
+
+	"github.com/LaH-DeV/veles/diagnostics"
+	"github.com/LaH-DeV/veles/source"
 )
 
 type Filetype int
@@ -32,9 +35,11 @@ type regexPattern struct {
 type lexer struct {
 	source string
 	pos    int
-	line   int
+	file   *source.File
 	Tokens []Token
 
+	Diagnostics []diagnostics.Diagnostic
+
 	patterns *[]regexPattern
 	keywords *map[string]TokenKind
 	types    *map[string]TokenKind
@@ -42,9 +47,11 @@ type lexer struct {
 	filetype Filetype
 }
 
-func (lex *lexer) Tokenize(source string) []Token {
-	lex.newState(source)
+func (lex *lexer) Tokenize(src string) []Token {
+	lex.newState(src)
 	for !lex.at_eof() {
+		start := lex.pos
+		pushed := len(lex.Tokens)
 		matched := false
 		for _, pattern := range *lex.patterns {
 			loc := pattern.regex.FindStringIndex(lex.remainder())
@@ -55,22 +62,27 @@ func (lex *lexer) Tokenize(source string) []Token {
 			}
 		}
 		if !matched {
-			// TODO: add diagnostics and error handling
-			// we shouldn't panic here, but instead add a diagnostic and continue
-			// the continuation will require a strategy
-			panic(fmt.Sprintf("Veles :: lexer error: unrecognized token near '%v'", lex.remainder()))
+			// skip the offending character and keep going, so that a single typo
+			// does not hide every other problem in the file
+			_, size := utf8.DecodeRuneInString(lex.remainder())
+			lex.advanceN(size)
+			lex.Diagnostics = append(lex.Diagnostics, diagnostics.Errorf(diagnostics.UnrecognizedToken, lex.file.Span(start, lex.pos), "unrecognized token '%s'", lex.source[start:lex.pos]))
+		}
+		for i := pushed; i < len(lex.Tokens); i++ {
+			lex.Tokens[i].Span = lex.file.Span(start, lex.pos)
 		}
 	}
 	lex.push(newUniqueToken(EOF, "EOF"))
+	lex.Tokens[len(lex.Tokens)-1].Span = lex.file.Span(lex.pos, lex.pos)
 	return lex.Tokens
 }
 
-func (lex *lexer) newState(source string) {
-	lex.source = source
+func (lex *lexer) newState(src string) {
+	lex.source = src
 	lex.pos = 0
-	lex.line = 1
+	lex.file = source.NewFile("", src)
 	lex.Tokens = make([]Token, 0)
-	// TODO: reset diagnostics
+	lex.Diagnostics = make([]diagnostics.Diagnostic, 0)
 }
 
 func (lex *lexer) advanceN(n int) {
@@ -115,12 +127,48 @@ func stringHandler(lex *lexer, regex *regexp.Regexp) {
 	lex.advanceN(len(stringLiteral))
 }
 
+var terminatedString = regexp.MustCompile(`^"(?:[^"\\\n]|\\.)*"$`)
+
+// vsStringHandler reports unterminated literals and invalid escape sequences,
+// the literal itself is pushed unchanged and unquoted by the parser.
+func vsStringHandler(lex *lexer, regex *regexp.Regexp) {
+	start := lex.pos
+	literal := regex.FindString(lex.remainder())
+	lex.push(newUniqueToken(STRING, literal))
+	lex.advanceN(len(literal))
+
+	if !terminatedString.MatchString(literal) {
+		lex.Diagnostics = append(lex.Diagnostics, diagnostics.Errorf(diagnostics.UnterminatedString, lex.file.Span(start, lex.pos), "string literal not terminated"))
+	}
+	_, errs := Unquote(literal)
+	for _, err := range errs {
+		lex.Diagnostics = append(lex.Diagnostics, diagnostics.Errorf(diagnostics.InvalidEscape, lex.file.Span(start+err.Offset, start+err.Offset+err.Length), "%s", err.Message))
+	}
+}
+
 func integerHandler(lex *lexer, regex *regexp.Regexp) {
 	match := regex.FindString(lex.remainder())
 	lex.push(newUniqueToken(INTEGER, match))
 	lex.advanceN(len(match))
 }
 
+// numberHandler pushes an INTEGER or a FLOAT token and reports malformed
+// literals, like misplaced underscores or digits outside of the base.
+func numberHandler(lex *lexer, regex *regexp.Regexp) {
+	start := lex.pos
+	literal := regex.FindString(lex.remainder())
+	number, err := ParseNumber(literal)
+	if number.IsFloat {
+		lex.push(newUniqueToken(FLOAT, literal))
+	} else {
+		lex.push(newUniqueToken(INTEGER, literal))
+	}
+	lex.advanceN(len(literal))
+	if err != nil {
+		lex.Diagnostics = append(lex.Diagnostics, diagnostics.Errorf(diagnostics.MalformedNumber, lex.file.Span(start, lex.pos), "%s", err))
+	}
+}
+
 func floatHandler(lex *lexer, regex *regexp.Regexp) {
 	match := regex.FindString(lex.remainder())
 	lex.push(newUniqueToken(FLOAT, match))
@@ -157,14 +205,12 @@ func commentHandler(lex *lexer, regex *regexp.Regexp) {
 	if match != nil {
 		// Advance past the entire comment.
 		lex.advanceN(match[1])
-		lex.line++
 	}
 }
 
 func baseLexer() *lexer {
 	return &lexer{
 		pos:      0,
-		line:     1,
 		Tokens:   make([]Token, 0),
 		patterns: nil,
 		keywords: nil,
@@ -187,17 +233,33 @@ func vsLexer() *lexer {
 		{regexp.MustCompile(`\n+`), newlineHandler},
 		{regexp.MustCompile(`\s+`), skipHandler},
 		{regexp.MustCompile(`\/\/.*`), commentHandler},
-		// {regexp.MustCompile(`"[^"]*"`), stringHandler},
-		// TODO float and integer :: need to change '_' to be optional and only allowed between digits (one, not multiple)
-		{regexp.MustCompile(`[0-9_]+(\.[0-9_]+)`), floatHandler},
-		{regexp.MustCompile(`[0-9_]+`), integerHandler},
+		{regexp.MustCompile(`"(?:[^"\\\n]|\\.)*"?`), vsStringHandler},
+		// numbers are matched loosely, up to the next character that cannot
+		// continue one, and validated by the handler
+		{regexp.MustCompile(`0[xXbBoO][0-9a-zA-Z_]*`), numberHandler},
+		{regexp.MustCompile(`[0-9](?:[eE][+-][0-9]|\.[0-9]|[0-9a-zA-Z_])*`), numberHandler},
 		{regexp.MustCompile(`[a-zA-Z_][a-zA-Z0-9_]*`), symbolHandler},
 		{regexp.MustCompile(`\(`), defaultHandler(OPEN_PAREN, "(")},
 		{regexp.MustCompile(`\)`), defaultHandler(CLOSE_PAREN, ")")},
 		{regexp.MustCompile(`\{`), defaultHandler(OPEN_CURLY, "{")},
 		{regexp.MustCompile(`\}`), defaultHandler(CLOSE_CURLY, "}")},
+		{regexp.MustCompile(`\[`), defaultHandler(OPEN_BRACKET, "[")},
+		{regexp.MustCompile(`\]`), defaultHandler(CLOSE_BRACKET, "]")},
 		{regexp.MustCompile(`\::`), defaultHandler(DOUBLE_COLON, "::")},
 		{regexp.MustCompile(`\:`), defaultHandler(COLON, ":")},
+		{regexp.MustCompile(`\.`), defaultHandler(DOT, ".")},
+		{regexp.MustCompile(`\->`), defaultHandler(ARROW, "->")},
+		{regexp.MustCompile(`\+=`), defaultHandler(PLUS_ASSIGNMENT, "+=")},
+		{regexp.MustCompile(`\-=`), defaultHandler(DASH_ASSIGNMENT, "-=")},
+		{regexp.MustCompile(`\*=`), defaultHandler(ASTERISK_ASSIGNMENT, "*=")},
+		{regexp.MustCompile(`\/=`), defaultHandler(SLASH_ASSIGNMENT, "/=")},
+		{regexp.MustCompile(`\%=`), defaultHandler(REMAINDER_ASSIGNMENT, "%=")},
+		{regexp.MustCompile(`\&=`), defaultHandler(AMPERSAND_ASSIGNMENT, "&=")},
+		{regexp.MustCompile(`\|=`), defaultHandler(PIPE_ASSIGNMENT, "|=")},
+		{regexp.MustCompile(`\^=`), defaultHandler(CARET_ASSIGNMENT, "^=")},
+		{regexp.MustCompile(`\<<=`), defaultHandler(SHIFT_LEFT_ASSIGNMENT, "<<=")},
+		{regexp.MustCompile(`\>>>=`), defaultHandler(SHIFT_RIGHT_UNSIGNED_ASSIGNMENT, ">>>=")},
+		{regexp.MustCompile(`\>>=`), defaultHandler(SHIFT_RIGHT_ASSIGNMENT, ">>=")},
 		{regexp.MustCompile(`\+`), defaultHandler(PLUS, "+")},
 		{regexp.MustCompile(`\-`), defaultHandler(DASH, "-")},
 		{regexp.MustCompile(`\/`), defaultHandler(SLASH, "/")},
@@ -205,10 +267,18 @@ func vsLexer() *lexer {
 		{regexp.MustCompile(`\*\*`), defaultHandler(EXPONENTIATION, "**")},
 		{regexp.MustCompile(`\*`), defaultHandler(ASTERISK, "*")},
 		{regexp.MustCompile(`\==`), defaultHandler(EQUAL, "==")},
+		{regexp.MustCompile(`\=>`), defaultHandler(FAT_ARROW, "=>")},
 		{regexp.MustCompile(`\!=`), defaultHandler(NOT_EQUAL, "!=")},
 		{regexp.MustCompile(`\!`), defaultHandler(NOT, "!")},
 		{regexp.MustCompile(`\&&`), defaultHandler(AND, "&&")},
 		{regexp.MustCompile(`\|\|`), defaultHandler(OR, "||")},
+		{regexp.MustCompile(`\&`), defaultHandler(AMPERSAND, "&")},
+		{regexp.MustCompile(`\|`), defaultHandler(PIPE, "|")},
+		{regexp.MustCompile(`\^`), defaultHandler(CARET, "^")},
+		{regexp.MustCompile(`\~`), defaultHandler(TILDE, "~")},
+		{regexp.MustCompile(`\>>>`), defaultHandler(SHIFT_RIGHT_UNSIGNED, ">>>")},
+		{regexp.MustCompile(`\>>`), defaultHandler(SHIFT_RIGHT, ">>")},
+		{regexp.MustCompile(`\<<`), defaultHandler(SHIFT_LEFT, "<<")},
 		{regexp.MustCompile(`\>=`), defaultHandler(GREATER_EQUAL, ">=")},
 		{regexp.MustCompile(`\>`), defaultHandler(GREATER, ">")},
 		{regexp.MustCompile(`\<=`), defaultHandler(LESS_EQUAL, "<=")},
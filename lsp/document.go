@@ -0,0 +1,354 @@
+package lsp
+
+import (
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/LaH-DeV/veles/ast"
+	"github.com/LaH-DeV/veles/diagnostics"
+	"github.com/LaH-DeV/veles/lexer"
+	"github.com/LaH-DeV/veles/source"
+	"github.com/LaH-DeV/veles/workspace"
+)
+
+// document is an open text document together with the result of its last analysis.
+type document struct {
+	uri      string
+	path     string
+	version  int
+	text     string
+	filetype lexer.Filetype
+
+	// file is the analysed document, nil for documents that are not Veles sources.
+	file *workspace.File
+	// source is used for position conversions and always matches text.
+	source *source.File
+	// failure describes the panic of the last analysis, if it failed.
+	failure string
+}
+
+func newDocument(uri string, version int, text string) *document {
+	return &document{
+		uri:      uri,
+		path:     uriToPath(uri),
+		version:  version,
+		text:     text,
+		filetype: filetypeOf(uri),
+		source:   source.NewFile(uriToPath(uri), text),
+	}
+}
+
+// update replaces the text of the document. The document is re-analysed by analyse.
+func (doc *document) update(version int, text string) {
+	doc.version = version
+	doc.text = text
+	doc.source = source.NewFile(doc.path, text)
+}
+
+// analyse re-lexes, re-parses and re-checks the document.
+func (doc *document) analyse(ws *workspace.Workspace) {
+	doc.file = nil
+	if doc.filetype != lexer.Vs {
+		return
+	}
+	file, err := ws.Load(doc.path)
+	if err == nil {
+		doc.file = file
+	}
+}
+
+func (doc *document) diagnostics() []diagnostics.Diagnostic {
+	if doc.file == nil {
+		return nil
+	}
+	return doc.file.Diagnostics
+}
+
+func (doc *document) program() *ast.Program {
+	if doc.file == nil {
+		return nil
+	}
+	return doc.file.Program
+}
+
+func filetypeOf(uri string) lexer.Filetype {
+	switch path.Ext(uri) {
+	case ".vs":
+		return lexer.Vs
+	case ".wat":
+		return lexer.Wat
+	}
+	return lexer.Unrecognized
+}
+
+func pathToURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+func uriToPath(uri string) string {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Scheme != "file" {
+		return uri
+	}
+	return parsed.Path
+}
+
+// toPosition converts a byte offset into a protocol position, counting the
+// character in UTF-16 code units.
+func toPosition(file *source.File, offset int) Position {
+	pos := file.Position(offset)
+	line := file.Line(pos.Line)
+	prefix := line
+	if pos.Column-1 < len(line) {
+		prefix = line[:pos.Column-1]
+	}
+	return Position{
+		Line:      pos.Line - 1,
+		Character: len(utf16.Encode([]rune(prefix))),
+	}
+}
+
+func toRange(file *source.File, span source.Span) Range {
+	return Range{
+		Start: toPosition(file, span.Start.Offset),
+		End:   toPosition(file, span.End.Offset),
+	}
+}
+
+func (doc *document) toRange(span source.Span) Range {
+	return toRange(doc.source, span)
+}
+
+// toOffset converts a protocol position back into a byte offset.
+func (doc *document) toOffset(pos Position) int {
+	line := doc.source.Line(pos.Line + 1)
+	units := 0
+	column := 0
+	for units < pos.Character && column < len(line) {
+		r, size := utf8.DecodeRuneInString(line[column:])
+		units += len(utf16.Encode([]rune{r}))
+		column += size
+	}
+	return doc.source.Offset(pos.Line+1, column+1)
+}
+
+// applyChange applies a single content change; a change without a range
+// replaces the whole document.
+func (doc *document) applyChange(text string, change TextDocumentContentChangeEvent) string {
+	if change.Range == nil {
+		return change.Text
+	}
+	start := doc.toOffset(change.Range.Start)
+	end := doc.toOffset(change.Range.End)
+	var builder strings.Builder
+	builder.WriteString(text[:start])
+	builder.WriteString(change.Text)
+	builder.WriteString(text[end:])
+	return builder.String()
+}
+
+func (doc *document) protocolDiagnostics() []Diagnostic {
+	result := make([]Diagnostic, 0)
+	if doc.failure != "" {
+		result = append(result, Diagnostic{Severity: SeverityError, Source: "veles", Message: doc.failure})
+	}
+	for _, d := range doc.diagnostics() {
+		diagnostic := Diagnostic{
+			Range:    doc.toRange(d.Span),
+			Severity: protocolSeverity(d.Severity),
+			Source:   "veles " + string(d.Stage),
+			Message:  d.Message,
+		}
+		if d.Code != nil {
+			diagnostic.Code = d.Code.ID
+		}
+		for _, label := range d.Labels {
+			diagnostic.RelatedInformation = append(diagnostic.RelatedInformation, DiagnosticRelatedInformation{
+				Location: Location{URI: doc.uri, Range: doc.toRange(label.Span)},
+				Message:  label.Message,
+			})
+		}
+		for _, note := range d.Notes {
+			diagnostic.Message += "\n" + note
+		}
+		result = append(result, diagnostic)
+	}
+	return result
+}
+
+func protocolSeverity(severity diagnostics.Severity) int {
+	switch severity {
+	case diagnostics.Warning:
+		return SeverityWarning
+	case diagnostics.Information:
+		return SeverityInformation
+	case diagnostics.Hint:
+		return SeverityHint
+	default:
+		return SeverityError
+	}
+}
+
+// symbols returns the outline of the document: functions, extern declarations,
+// variables, structs, enums and use statements.
+func (doc *document) symbols() []DocumentSymbol {
+	result := make([]DocumentSymbol, 0)
+	if doc.program() == nil {
+		return result
+	}
+	for _, stmt := range doc.program().Statements {
+		if symbol, ok := doc.symbolOf(stmt); ok {
+			result = append(result, symbol)
+		}
+	}
+	return result
+}
+
+func (doc *document) symbolOf(stmt ast.Stmt) (DocumentSymbol, bool) {
+	switch stmt := stmt.(type) {
+	case *ast.FunctionStmt:
+		children := make([]DocumentSymbol, 0)
+		for _, param := range stmt.Params {
+			children = append(children, DocumentSymbol{
+				Name:           param.ParamName,
+				Detail:         param.ParamType,
+				Kind:           SymbolVariable,
+				Range:          doc.toRange(param.Span),
+				SelectionRange: doc.toRange(param.NameSpan),
+			})
+		}
+		children = append(children, doc.localSymbols(stmt.Body)...)
+		return DocumentSymbol{
+			Name:           stmt.Identifier,
+			Detail:         signature(stmt.Params, stmt.ReturnType),
+			Kind:           SymbolFunction,
+			Range:          doc.toRange(stmt.Span),
+			SelectionRange: doc.toRange(stmt.NameSpan),
+			Children:       children,
+		}, true
+	case *ast.ExternStmt:
+		return doc.symbolOf(stmt.Statement)
+	case *ast.FunctionDeclaration:
+		return DocumentSymbol{
+			Name:           stmt.Identifier,
+			Detail:         signature(stmt.Params, stmt.ReturnType),
+			Kind:           SymbolFunction,
+			Range:          doc.toRange(stmt.Span),
+			SelectionRange: doc.toRange(stmt.NameSpan),
+		}, true
+	case *ast.StructStmt:
+		children := make([]DocumentSymbol, 0)
+		for _, field := range stmt.Fields {
+			children = append(children, DocumentSymbol{
+				Name:           field.FieldName,
+				Detail:         field.FieldType,
+				Kind:           SymbolField,
+				Range:          doc.toRange(field.Span),
+				SelectionRange: doc.toRange(field.NameSpan),
+			})
+		}
+		return DocumentSymbol{
+			Name:           stmt.Identifier,
+			Detail:         "struct",
+			Kind:           SymbolStruct,
+			Range:          doc.toRange(stmt.Span),
+			SelectionRange: doc.toRange(stmt.NameSpan),
+			Children:       children,
+		}, true
+	case *ast.EnumStmt:
+		children := make([]DocumentSymbol, 0)
+		for _, variant := range stmt.Variants {
+			children = append(children, DocumentSymbol{
+				Name:           variant.Name,
+				Detail:         variant.String(),
+				Kind:           SymbolEnumMember,
+				Range:          doc.toRange(variant.Span),
+				SelectionRange: doc.toRange(variant.NameSpan),
+			})
+		}
+		return DocumentSymbol{
+			Name:           stmt.Identifier,
+			Detail:         "enum",
+			Kind:           SymbolEnum,
+			Range:          doc.toRange(stmt.Span),
+			SelectionRange: doc.toRange(stmt.NameSpan),
+			Children:       children,
+		}, true
+	case *ast.VariableDeclarationStmt:
+		detail := stmt.VarType
+		if detail == "" && doc.file != nil && doc.file.Module != nil {
+			// the inferred type of a variable declared without one
+			if symbol := doc.file.Module.Info.Defs[stmt]; symbol != nil && symbol.Type != nil {
+				detail = symbol.Type.String()
+			}
+		}
+		return DocumentSymbol{
+			Name:           stmt.VarName,
+			Detail:         detail,
+			Kind:           SymbolVariable,
+			Range:          doc.toRange(stmt.Span),
+			SelectionRange: doc.toRange(stmt.NameSpan),
+		}, true
+	case *ast.UseStmt:
+		name := stmt.Module
+		selection := stmt.ModuleSpan
+		if len(stmt.Segments) > 0 {
+			name = stmt.Segments[len(stmt.Segments)-1]
+			selection = stmt.SegmentSpans[len(stmt.SegmentSpans)-1]
+		}
+		if len(stmt.Alias) > 0 {
+			name = stmt.Alias
+			selection = stmt.AliasSpan
+		}
+		return DocumentSymbol{
+			Name:           name,
+			Detail:         strings.TrimPrefix(stmt.String(), "use "),
+			Kind:           SymbolModule,
+			Range:          doc.toRange(stmt.Span),
+			SelectionRange: doc.toRange(selection),
+		}, true
+	}
+	return DocumentSymbol{}, false
+}
+
+// localSymbols collects the variables declared anywhere inside a function body.
+func (doc *document) localSymbols(body []ast.Stmt) []DocumentSymbol {
+	result := make([]DocumentSymbol, 0)
+	for _, stmt := range body {
+		switch stmt := stmt.(type) {
+		case *ast.VariableDeclarationStmt:
+			symbol, _ := doc.symbolOf(stmt)
+			result = append(result, symbol)
+		case *ast.ExpressionStmt:
+			// the blocks of ifs, matches and block expressions
+			ast.Inspect(stmt.Expression, func(node ast.Node) bool {
+				if block, ok := node.(*ast.BlockExpr); ok {
+					result = append(result, doc.localSymbols(block.Body)...)
+					return false
+				}
+				_, ok := node.(*ast.FunctionExpr)
+				return !ok
+			})
+		}
+	}
+	return result
+}
+
+func signature(params []ast.FunctionParameter, returnType string) string {
+	str := "("
+	for i, param := range params {
+		if i > 0 {
+			str += ", "
+		}
+		str += param.String()
+	}
+	str += ")"
+	if len(returnType) > 0 {
+		str += " " + returnType
+	}
+	return str
+}
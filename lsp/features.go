@@ -0,0 +1,204 @@
+package lsp
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/LaH-DeV/veles/checker"
+	"github.com/LaH-DeV/veles/lexer"
+	"github.com/LaH-DeV/veles/types"
+)
+
+// positionParams decodes the document and offset a position request refers to.
+// The document is nil when it is not open or could not be analysed.
+func (s *Server) positionParams(params json.RawMessage) (*document, int, error) {
+	var p TextDocumentPositionParams
+	if err := decode(params, &p); err != nil {
+		return nil, 0, err
+	}
+	doc, exists := s.documents[p.TextDocument.URI]
+	if !exists || doc.file == nil {
+		return nil, 0, nil
+	}
+	return doc, doc.toOffset(p.Position), nil
+}
+
+func handleHover(s *Server, params json.RawMessage) (any, error) {
+	doc, offset, err := s.positionParams(params)
+	if doc == nil {
+		return nil, err
+	}
+	symbol, span := doc.file.Module.SymbolAt(offset)
+	if symbol == nil {
+		return nil, nil
+	}
+
+	value := "```veles\n" + symbol.Describe() + "\n```"
+	if symbol.Kind == checker.ParamSymbol {
+		value = "```veles\n(parameter) " + symbol.Describe() + "\n```"
+	}
+	if symbol.Module != nil && symbol.Module != doc.file.Module {
+		value += "\n\nDeclared in module `" + symbol.Module.Name + "`."
+	}
+	hoverRange := doc.toRange(span)
+	return Hover{
+		Contents: MarkupContent{Kind: "markdown", Value: value},
+		Range:    &hoverRange,
+	}, nil
+}
+
+func handleCompletion(s *Server, params json.RawMessage) (any, error) {
+	doc, offset, err := s.positionParams(params)
+	if doc == nil {
+		return nil, err
+	}
+	list := CompletionList{Items: make([]CompletionItem, 0)}
+	module := doc.file.Module
+
+	// after "name::" only the exported members of the module make sense
+	if container := memberContainer(doc.file.Tokens, offset); container != "" {
+		symbol := module.Scope.Innermost(offset).Lookup(container)
+		if symbol != nil && symbol.Kind == checker.ModuleSymbol {
+			for _, member := range symbol.Target.Exports() {
+				list.Items = append(list.Items, completionItem(member))
+			}
+		}
+		return list, nil
+	}
+
+	for _, keyword := range lexer.Keywords(lexer.Vs) {
+		list.Items = append(list.Items, CompletionItem{Label: keyword, Kind: CompletionKeyword})
+	}
+	for _, name := range lexer.TypeNames(lexer.Vs) {
+		list.Items = append(list.Items, CompletionItem{Label: name, Kind: CompletionType})
+	}
+	for _, symbol := range module.Scope.Visible(offset) {
+		list.Items = append(list.Items, completionItem(symbol))
+	}
+	return list, nil
+}
+
+func completionItem(symbol *checker.Symbol) CompletionItem {
+	item := CompletionItem{
+		Label:  symbol.Name,
+		Kind:   CompletionVariable,
+		Detail: symbol.Describe(),
+	}
+	switch symbol.Kind {
+	case checker.FunctionSymbol, checker.ExternSymbol:
+		item.Kind = CompletionFunction
+	case checker.ModuleSymbol:
+		item.Kind = CompletionModule
+	case checker.StructSymbol:
+		item.Kind = CompletionStruct
+	case checker.EnumSymbol:
+		item.Kind = CompletionEnum
+	}
+	return item
+}
+
+// tokenBefore returns the index of the last token ending at or before offset,
+// ignoring newlines, or -1 when there is none.
+func tokenBefore(tokens []lexer.Token, offset int) int {
+	index := -1
+	for i, token := range tokens {
+		if token.Span.End.Offset > offset || token.Kind == lexer.EOF {
+			break
+		}
+		if token.Kind != lexer.NEWLINE {
+			index = i
+		}
+	}
+	return index
+}
+
+// memberContainer returns the module name when the cursor follows "name::",
+// optionally with a partially typed member name.
+func memberContainer(tokens []lexer.Token, offset int) string {
+	i := tokenBefore(tokens, offset)
+	if i >= 0 && tokens[i].Kind == lexer.IDENTIFIER && tokens[i].Span.End.Offset == offset {
+		i--
+	}
+	if i >= 1 && tokens[i].Kind == lexer.DOUBLE_COLON && tokens[i-1].Kind == lexer.IDENTIFIER {
+		return tokens[i-1].Value
+	}
+	return ""
+}
+
+func handleSignatureHelp(s *Server, params json.RawMessage) (any, error) {
+	doc, offset, err := s.positionParams(params)
+	if doc == nil {
+		return nil, err
+	}
+	tokens := doc.file.Tokens
+
+	// walk back to the unclosed parenthesis of the call surrounding the cursor,
+	// counting the commas that separate the preceding arguments. The commas of
+	// arguments in brackets or braces, like array and struct literals, are
+	// skipped. The cursor may be in an array literal passed as an argument, but
+	// an unclosed brace starts a block or the fields of a struct literal.
+	depth := 0
+	active := 0
+	open := -1
+	for i := tokenBefore(tokens, offset); i >= 0 && open < 0; i-- {
+		switch tokens[i].Kind {
+		case lexer.CLOSE_PAREN, lexer.CLOSE_BRACKET, lexer.CLOSE_CURLY:
+			depth++
+		case lexer.OPEN_PAREN:
+			if depth == 0 {
+				open = i
+			}
+			depth--
+		case lexer.OPEN_BRACKET:
+			if depth == 0 {
+				// the commas so far separate the elements of the array
+				active = 0
+				continue
+			}
+			depth--
+		case lexer.OPEN_CURLY:
+			if depth == 0 {
+				return nil, nil
+			}
+			depth--
+		case lexer.COMMA:
+			if depth == 0 {
+				active++
+			}
+		}
+	}
+	if open < 1 || tokens[open-1].Kind != lexer.IDENTIFIER {
+		return nil, nil
+	}
+
+	scope := doc.file.Module.Scope.Innermost(offset)
+	symbol := scope.Lookup(tokens[open-1].Value)
+	if open >= 3 && tokens[open-2].Kind == lexer.DOUBLE_COLON && tokens[open-3].Kind == lexer.IDENTIFIER {
+		container := scope.Lookup(tokens[open-3].Value)
+		symbol = nil
+		if container != nil && container.Kind == checker.ModuleSymbol {
+			symbol = container.Target.Member(tokens[open-1].Value)
+		}
+	}
+	if symbol == nil {
+		return nil, nil
+	}
+	sig, ok := symbol.Type.(*types.Signature)
+	if !ok {
+		return nil, nil
+	}
+
+	info := SignatureInformation{
+		Label:      symbol.Describe(),
+		Parameters: make([]ParameterInformation, 0, len(sig.Params)),
+	}
+	for i, param := range sig.Params {
+		info.Parameters = append(info.Parameters, ParameterInformation{
+			Label: strings.TrimSpace(param.String() + " " + sig.ParamNames[i]),
+		})
+	}
+	return SignatureHelp{
+		Signatures:      []SignatureInformation{info},
+		ActiveParameter: active,
+	}, nil
+}
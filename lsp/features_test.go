@@ -0,0 +1,167 @@
+package lsp
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+const mathURI = "file:///veles/math.vs"
+
+const mathText = "pub fn f32 :: square(f32 x) {\n    return x * x\n}\n\nfn :: hidden() {}\n"
+
+const featuresText = `use math
+
+pub fn i32 :: add(i32 a, i32 b) {
+    return a + b
+}
+
+struct P { i32 x }
+
+fn i32 :: sum([3]i32 values, i32 extra) {
+    return extra
+}
+
+fn i32 :: px(P p, i32 extra) {
+    return extra
+}
+
+fn :: run() {
+    let mut i32 total = add(1, 2)
+    let i32 s = sum([1, 2, 3], 4)
+    let i32 q = px(P { x: 1 }, 4)
+    total = add(total, 3)
+    let f32 area = math::square(2.0)
+    math::
+}
+`
+
+// position returns the position of the first occurrence of marker in text,
+// moved right by delta characters.
+func position(t *testing.T, text, marker string, delta int) Position {
+	t.Helper()
+	offset := strings.Index(text, marker)
+	if offset < 0 {
+		t.Fatalf("no %q in the text", marker)
+	}
+	offset += delta
+	line := strings.Count(text[:offset], "\n")
+	return Position{Line: line, Character: offset - strings.LastIndex(text[:offset], "\n") - 1}
+}
+
+// startFeatures opens math.vs and main.vs and waits for their diagnostics.
+func startFeatures(t *testing.T) *client {
+	t.Helper()
+	c := start(t, featuresText)
+	c.diagnostics(mainURI)
+	c.notify("textDocument/didOpen", DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: mathURI, LanguageID: "veles", Version: 1, Text: mathText},
+	})
+	c.diagnostics(mathURI)
+	return c
+}
+
+func at(pos Position) TextDocumentPositionParams {
+	return TextDocumentPositionParams{TextDocument: TextDocumentIdentifier{URI: mainURI}, Position: pos}
+}
+
+func TestHover(t *testing.T) {
+	tests := []struct {
+		name   string
+		marker string
+		delta  int
+		want   string // "" when there is no hover
+	}{
+		{"function", "add(1", 1, "```veles\npub fn i32 :: add(i32 a, i32 b)\n```"},
+		{"parameter", "a + b", 0, "```veles\n(parameter) i32 a\n```"},
+		{"local", "total = add(total", 1, "```veles\nlet mut i32 total\n```"},
+		{"imported function", "square(2", 2, "```veles\npub fn f32 :: square(f32 x)\n```\n\nDeclared in module `math`."},
+		{"module", "math::square", 0, "```veles\nmodule math\n```"},
+		{"keyword", "return a", 0, ""},
+	}
+	c := startFeatures(t)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c.t = t
+			hover := decodeResult[*Hover](t, c.request("textDocument/hover", at(position(t, featuresText, test.marker, test.delta))))
+			switch {
+			case hover == nil && test.want != "":
+				t.Errorf("no hover, want %q", test.want)
+			case hover != nil && hover.Contents.Value != test.want:
+				t.Errorf("got %q, want %q", hover.Contents.Value, test.want)
+			}
+		})
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	tests := []struct {
+		name    string
+		marker  string
+		delta   int
+		want    []string // labels that must be offered
+		exclude []string // labels that must not be offered
+	}{
+		{"in a body", "    total = add", 4, []string{"add", "run", "total", "math", "let", "i32"}, []string{"a", "area", "square"}},
+		{"in a parameter list", "a + b", 0, []string{"a", "b", "add"}, []string{"total"}},
+		{"module members", "math::\n", 6, []string{"square"}, []string{"hidden", "add", "let"}},
+		{"partial member", "math::square", 8, []string{"square"}, []string{"add"}},
+	}
+	c := startFeatures(t)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c.t = t
+			list := decodeResult[CompletionList](t, c.request("textDocument/completion", at(position(t, featuresText, test.marker, test.delta))))
+			labels := make([]string, 0, len(list.Items))
+			for _, item := range list.Items {
+				labels = append(labels, item.Label)
+			}
+			for _, label := range test.want {
+				if !slices.Contains(labels, label) {
+					t.Errorf("%s is not offered in %v", label, labels)
+				}
+			}
+			for _, label := range test.exclude {
+				if slices.Contains(labels, label) {
+					t.Errorf("%s is offered", label)
+				}
+			}
+		})
+	}
+}
+
+func TestSignatureHelp(t *testing.T) {
+	tests := []struct {
+		name   string
+		marker string
+		delta  int
+		label  string // "" when there is no help
+		active int
+	}{
+		{"first argument", "add(1, 2)", 4, "pub fn i32 :: add(i32 a, i32 b)", 0},
+		{"second argument", "add(1, 2)", 7, "pub fn i32 :: add(i32 a, i32 b)", 1},
+		{"nested call", "add(total, 3)", 6, "pub fn i32 :: add(i32 a, i32 b)", 0},
+		{"imported function", "square(2.0)", 7, "pub fn f32 :: square(f32 x)", 0},
+		{"after an array literal", "sum([1, 2, 3], 4)", 15, "fn i32 :: sum([3]i32 values, i32 extra)", 1},
+		{"in an array literal", "sum([1, 2, 3], 4)", 8, "fn i32 :: sum([3]i32 values, i32 extra)", 0},
+		{"after a struct literal", "px(P { x: 1 }, 4)", 15, "fn i32 :: px(P p, i32 extra)", 1},
+		{"in a struct literal", "px(P { x: 1 }, 4)", 10, "", 0},
+		{"outside a call", "let mut", 0, "", 0},
+	}
+	c := startFeatures(t)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c.t = t
+			help := decodeResult[*SignatureHelp](t, c.request("textDocument/signatureHelp", at(position(t, featuresText, test.marker, test.delta))))
+			if help == nil {
+				if test.label != "" {
+					t.Errorf("no help, want %q", test.label)
+				}
+				return
+			}
+			if len(help.Signatures) != 1 || help.Signatures[0].Label != test.label || help.ActiveParameter != test.active {
+				t.Errorf("got %+v, want %q with parameter %d active", help, test.label, test.active)
+			}
+		})
+	}
+}
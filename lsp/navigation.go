@@ -0,0 +1,113 @@
+package lsp
+
+import (
+	"encoding/json"
+
+	"github.com/LaH-DeV/veles/index"
+)
+
+// occurrenceAt indexes the workspace and returns the occurrence under the cursor.
+func (s *Server) occurrenceAt(params json.RawMessage) (*index.Index, *index.Occurrence, error) {
+	doc, offset, err := s.positionParams(params)
+	if doc == nil {
+		return nil, nil, err
+	}
+	files, _ := s.workspace.LoadAll()
+	ix := index.Build(files)
+	occurrence, found := ix.At(doc.file.Path, offset)
+	if !found {
+		return ix, nil, nil
+	}
+	return ix, &occurrence, nil
+}
+
+func toLocation(occurrence index.Occurrence) Location {
+	return Location{
+		URI:   pathToURI(occurrence.File.Path),
+		Range: toRange(occurrence.File.Source, occurrence.Span),
+	}
+}
+
+func handleDefinition(s *Server, params json.RawMessage) (any, error) {
+	ix, occurrence, err := s.occurrenceAt(params)
+	if occurrence == nil {
+		return nil, err
+	}
+	definition, found := ix.Definition(occurrence.Symbol)
+	if !found {
+		return nil, nil
+	}
+	return toLocation(definition), nil
+}
+
+type ReferenceParams struct {
+	TextDocumentPositionParams
+	Context struct {
+		IncludeDeclaration bool `json:"includeDeclaration"`
+	} `json:"context"`
+}
+
+func handleReferences(s *Server, params json.RawMessage) (any, error) {
+	var p ReferenceParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	ix, occurrence, err := s.occurrenceAt(params)
+	if occurrence == nil {
+		return []Location{}, err
+	}
+	locations := make([]Location, 0)
+	for _, reference := range ix.References(occurrence.Symbol, p.Context.IncludeDeclaration) {
+		locations = append(locations, toLocation(reference))
+	}
+	return locations, nil
+}
+
+type RenameParams struct {
+	TextDocumentPositionParams
+	NewName string `json:"newName"`
+}
+
+type TextEdit struct {
+	Range   Range  `json:"range"`
+	NewText string `json:"newText"`
+}
+
+type WorkspaceEdit struct {
+	Changes map[string][]TextEdit `json:"changes"`
+}
+
+func handlePrepareRename(s *Server, params json.RawMessage) (any, error) {
+	_, occurrence, err := s.occurrenceAt(params)
+	if occurrence == nil {
+		return nil, err
+	}
+	if occurrence.Text() != occurrence.Symbol.Name {
+		return nil, nil
+	}
+	return toRange(occurrence.File.Source, occurrence.Span), nil
+}
+
+func handleRename(s *Server, params json.RawMessage) (any, error) {
+	var p RenameParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	ix, occurrence, err := s.occurrenceAt(params)
+	if occurrence == nil {
+		return nil, err
+	}
+	edits, err := ix.Rename(occurrence.Symbol, p.NewName)
+	if err != nil {
+		return nil, &responseError{Code: requestFailed, Message: err.Error()}
+	}
+	result := WorkspaceEdit{Changes: make(map[string][]TextEdit)}
+	for _, edit := range edits {
+		uri := pathToURI(edit.File.Path)
+		result.Changes[uri] = append(result.Changes[uri], TextEdit{
+			Range:   toRange(edit.File.Source, edit.Span),
+			NewText: edit.NewText,
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,294 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/LaH-DeV/veles/workspace"
+)
+
+// Server is a Language Server Protocol server speaking JSON-RPC over a pair of streams,
+// usually stdin and stdout.
+type Server struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	documents   map[string]*document
+	workspace   *workspace.Workspace
+	initialized bool
+	shutdown    bool
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:        bufio.NewReader(in),
+		out:       out,
+		documents: make(map[string]*document),
+	}
+}
+
+type request struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Method  string           `json:"method"`
+	Params  json.RawMessage  `json:"params"`
+}
+
+// Run serves requests until the client sends "exit" or closes the input stream.
+func (s *Server) Run() error {
+	for {
+		body, err := readMessage(s.in)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			if err := s.replyError(nil, parseErrorCode, err.Error()); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if req.Method == "exit" {
+			return nil
+		}
+
+		if err := s.handle(&req); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(req *request) error {
+	handler, exists := requestHandlers[req.Method]
+	if req.ID == nil {
+		// notifications never receive a response, unknown ones are ignored
+		if exists && (s.initialized || req.Method == "initialize") {
+			_, err := call(handler, s, req.Params)
+			var rpcErr *responseError
+			if errors.As(err, &rpcErr) {
+				return nil
+			}
+			return err
+		}
+		return nil
+	}
+
+	if !exists {
+		return s.replyError(req.ID, methodNotFound, fmt.Sprintf("method not found: %s", req.Method))
+	}
+	if !s.initialized && req.Method != "initialize" {
+		return s.replyError(req.ID, serverNotInitialized, "server not initialized")
+	}
+	if s.shutdown {
+		return s.replyError(req.ID, invalidRequest, "server is shutting down")
+	}
+
+	result, err := call(handler, s, req.Params)
+	if err != nil {
+		var rpcErr *responseError
+		if errors.As(err, &rpcErr) {
+			return s.replyError(req.ID, rpcErr.Code, rpcErr.Message)
+		}
+		return err
+	}
+	return writeMessage(s.out, response{JSONRPC: "2.0", ID: req.ID, Result: result})
+}
+
+func (s *Server) replyError(id *json.RawMessage, code int, message string) error {
+	return writeMessage(s.out, errorResponse{
+		JSONRPC: "2.0",
+		ID:      id,
+		Error:   &responseError{Code: code, Message: message},
+	})
+}
+
+func (s *Server) notify(method string, params any) error {
+	return writeMessage(s.out, notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// handlerFunc answers a request or processes a notification. Returning a
+// *responseError replies with that error, any other error stops the server.
+type handlerFunc func(s *Server, params json.RawMessage) (any, error)
+
+var requestHandlers = map[string]handlerFunc{
+	"initialize":                  handleInitialize,
+	"initialized":                 handleIgnored,
+	"shutdown":                    handleShutdown,
+	"textDocument/didOpen":        handleDidOpen,
+	"textDocument/didChange":      handleDidChange,
+	"textDocument/didClose":       handleDidClose,
+	"textDocument/didSave":        handleIgnored,
+	"textDocument/documentSymbol": handleDocumentSymbol,
+	"textDocument/hover":          handleHover,
+	"textDocument/completion":     handleCompletion,
+	"textDocument/signatureHelp":  handleSignatureHelp,
+	"textDocument/definition":     handleDefinition,
+	"textDocument/references":     handleReferences,
+	"textDocument/prepareRename":  handlePrepareRename,
+	"textDocument/rename":         handleRename,
+}
+
+// call runs a handler, replying with an internal error when it panics rather
+// than ending the session.
+func call(handler handlerFunc, s *Server, params json.RawMessage) (result any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, &responseError{Code: internalError, Message: fmt.Sprintf("internal error: %v", r)}
+		}
+	}()
+	return handler(s, params)
+}
+
+func (e *responseError) Error() string {
+	return e.Message
+}
+
+func decode(params json.RawMessage, v any) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &responseError{Code: invalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+func handleIgnored(s *Server, params json.RawMessage) (any, error) {
+	return nil, nil
+}
+
+func handleInitialize(s *Server, params json.RawMessage) (any, error) {
+	var p InitializeParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	s.initialized = true
+	if p.RootURI != "" {
+		s.workspace = workspace.New(uriToPath(p.RootURI))
+	}
+	return InitializeResult{
+		Capabilities: ServerCapabilities{
+			TextDocumentSync:       SyncFull,
+			DocumentSymbolProvider: true,
+			HoverProvider:          true,
+			CompletionProvider: &CompletionOptions{
+				TriggerCharacters: []string{":"},
+			},
+			SignatureHelpProvider: &SignatureHelpOptions{
+				TriggerCharacters: []string{"(", ","},
+			},
+			DefinitionProvider: true,
+			ReferencesProvider: true,
+			RenameProvider:     &RenameOptions{PrepareProvider: true},
+		},
+		ServerInfo: ServerInfo{Name: "veles"},
+	}, nil
+}
+
+func handleShutdown(s *Server, params json.RawMessage) (any, error) {
+	s.shutdown = true
+	return nil, nil
+}
+
+func handleDidOpen(s *Server, params json.RawMessage) (any, error) {
+	var p DidOpenTextDocumentParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	doc := newDocument(p.TextDocument.URI, p.TextDocument.Version, p.TextDocument.Text)
+	s.documents[doc.uri] = doc
+	if s.workspace == nil {
+		s.workspace = workspace.New(filepath.Dir(doc.path))
+	}
+	s.workspace.SetOverlay(doc.path, doc.text)
+	return nil, s.analyse()
+}
+
+func handleDidChange(s *Server, params json.RawMessage) (any, error) {
+	var p DidChangeTextDocumentParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	doc, exists := s.documents[p.TextDocument.URI]
+	if !exists {
+		return nil, &responseError{Code: invalidParams, Message: "document is not open: " + p.TextDocument.URI}
+	}
+	for _, change := range p.ContentChanges {
+		// later ranged changes are relative to the text produced by the earlier ones
+		doc.update(p.TextDocument.Version, doc.applyChange(doc.text, change))
+	}
+	s.workspace.SetOverlay(doc.path, doc.text)
+	return nil, s.analyse()
+}
+
+func handleDidClose(s *Server, params json.RawMessage) (any, error) {
+	var p DidCloseTextDocumentParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	doc, exists := s.documents[p.TextDocument.URI]
+	if !exists {
+		return nil, nil
+	}
+	delete(s.documents, doc.uri)
+	s.workspace.RemoveOverlay(doc.path)
+	if err := s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         doc.uri,
+		Diagnostics: []Diagnostic{},
+	}); err != nil {
+		return nil, err
+	}
+	return nil, s.analyse()
+}
+
+// analyse re-checks every open document and publishes its diagnostics. A change to
+// one module can introduce or fix errors in the modules importing it.
+func (s *Server) analyse() error {
+	for _, doc := range s.documents {
+		s.analyseDocument(doc)
+		if err := s.publishDiagnostics(doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// analyseDocument analyses doc, recovering when the compiler panics so that a
+// bug in it cannot end the session. The document is then left without an
+// analysis, and the panic is published as one of its diagnostics.
+func (s *Server) analyseDocument(doc *document) {
+	defer func() {
+		if r := recover(); r != nil {
+			doc.file = nil
+			doc.failure = fmt.Sprintf("internal compiler error: %v", r)
+		}
+	}()
+	doc.failure = ""
+	doc.analyse(s.workspace)
+}
+
+func handleDocumentSymbol(s *Server, params json.RawMessage) (any, error) {
+	var p DocumentSymbolParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	doc, exists := s.documents[p.TextDocument.URI]
+	if !exists {
+		return []DocumentSymbol{}, nil
+	}
+	return doc.symbols(), nil
+}
+
+func (s *Server) publishDiagnostics(doc *document) error {
+	return s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         doc.uri,
+		Version:     doc.version,
+		Diagnostics: doc.protocolDiagnostics(),
+	})
+}
@@ -0,0 +1,298 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// message is any message the server sends: a response or a notification.
+type message struct {
+	ID     *json.RawMessage `json:"id"`
+	Method string           `json:"method"`
+	Params json.RawMessage  `json:"params"`
+	Result json.RawMessage  `json:"result"`
+	Error  *responseError   `json:"error"`
+}
+
+// client is a fake editor driving a Server over a pair of pipes.
+type client struct {
+	t        *testing.T
+	in       *io.PipeWriter
+	messages chan message
+	done     chan error
+	nextID   int
+}
+
+func newClient(t *testing.T) *client {
+	t.Helper()
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	c := &client{t: t, in: clientOut, messages: make(chan message, 64), done: make(chan error, 1)}
+	go func() {
+		c.done <- NewServer(serverIn, serverOut).Run()
+		serverOut.Close()
+	}()
+	go func() {
+		reader := bufio.NewReader(clientIn)
+		for {
+			body, err := readMessage(reader)
+			if err != nil {
+				close(c.messages)
+				return
+			}
+			var msg message
+			if err := json.Unmarshal(body, &msg); err != nil {
+				t.Errorf("malformed message from the server: %s", body)
+			}
+			c.messages <- msg
+		}
+	}()
+	t.Cleanup(func() { clientOut.Close() })
+	return c
+}
+
+func (c *client) send(v any) {
+	c.t.Helper()
+	if err := writeMessage(c.in, v); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *client) notify(method string, params any) {
+	c.t.Helper()
+	c.send(notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// next returns the next message of the server, failing the test when the
+// server sends nothing or stops.
+func (c *client) next() message {
+	c.t.Helper()
+	select {
+	case msg, ok := <-c.messages:
+		if !ok {
+			c.t.Fatalf("the server stopped: %v", <-c.done)
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("no message from the server")
+	}
+	return message{}
+}
+
+// request sends a request and returns the response to it, skipping the
+// notifications sent before.
+func (c *client) request(method string, params any) message {
+	c.t.Helper()
+	c.nextID++
+	id := json.RawMessage(mustMarshal(c.t, c.nextID))
+	c.send(struct {
+		JSONRPC string           `json:"jsonrpc"`
+		ID      *json.RawMessage `json:"id"`
+		Method  string           `json:"method"`
+		Params  any              `json:"params"`
+	}{"2.0", &id, method, params})
+	for {
+		msg := c.next()
+		if msg.ID != nil && string(*msg.ID) == string(id) {
+			return msg
+		}
+	}
+}
+
+// diagnostics waits for the diagnostics published for uri.
+func (c *client) diagnostics(uri string) []Diagnostic {
+	c.t.Helper()
+	for {
+		msg := c.next()
+		if msg.Method != "textDocument/publishDiagnostics" {
+			continue
+		}
+		var params PublishDiagnosticsParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			c.t.Fatal(err)
+		}
+		if params.URI == uri {
+			return params.Diagnostics
+		}
+	}
+}
+
+func mustMarshal(t *testing.T, v any) []byte {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func decodeResult[T any](t *testing.T, msg message) T {
+	t.Helper()
+	var result T
+	if msg.Error != nil {
+		t.Fatalf("request failed: %d %s", msg.Error.Code, msg.Error.Message)
+	}
+	if err := json.Unmarshal(msg.Result, &result); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+const mainURI = "file:///veles/main.vs"
+
+// start initializes a session and opens main.vs with text.
+func start(t *testing.T, text string) *client {
+	t.Helper()
+	c := newClient(t)
+	init := decodeResult[InitializeResult](t, c.request("initialize", InitializeParams{RootURI: "file:///veles"}))
+	if !init.Capabilities.DocumentSymbolProvider {
+		t.Error("the server does not announce document symbols")
+	}
+	c.notify("initialized", struct{}{})
+	c.notify("textDocument/didOpen", DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: mainURI, LanguageID: "veles", Version: 1, Text: text},
+	})
+	return c
+}
+
+func codes(diagnostics []Diagnostic) []string {
+	result := make([]string, 0, len(diagnostics))
+	for _, d := range diagnostics {
+		result = append(result, d.Code)
+	}
+	return result
+}
+
+func TestSession(t *testing.T) {
+	c := start(t, "let i32 limit = 10\n\nfn i32 :: answer(i32 x) {\n    return 42\n}\n")
+	if diagnostics := c.diagnostics(mainURI); len(diagnostics) != 0 {
+		t.Errorf("diagnostics of a valid document: %v", codes(diagnostics))
+	}
+
+	symbols := decodeResult[[]DocumentSymbol](t, c.request("textDocument/documentSymbol", DocumentSymbolParams{
+		TextDocument: TextDocumentIdentifier{URI: mainURI},
+	}))
+	if len(symbols) != 2 || symbols[0].Name != "limit" || symbols[0].Kind != SymbolVariable ||
+		symbols[1].Name != "answer" || symbols[1].Kind != SymbolFunction {
+		t.Errorf("unexpected symbols %+v", symbols)
+	}
+	if len(symbols) == 2 && len(symbols[1].Children) != 1 {
+		t.Errorf("answer has children %+v", symbols[1].Children)
+	}
+
+	if msg := c.request("shutdown", nil); msg.Error != nil {
+		t.Errorf("shutdown failed: %s", msg.Error.Message)
+	}
+	c.notify("exit", nil)
+	select {
+	case err := <-c.done:
+		if err != nil {
+			t.Errorf("Run returned %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("the server did not exit")
+	}
+}
+
+func TestDidChangeDiagnostics(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		codes []string
+	}{
+		{"valid", "fn i32 :: one() {\n    return 1\n}\n", nil},
+		{"undefined name", "fn i32 :: one() {\n    return two\n}\n", []string{"E0200"}},
+		{"mismatched types", "let i32 x = true\n", []string{"E0300"}},
+		// used to crash the server
+		{"empty parentheses", "()\n", []string{"E0101"}},
+		{"negated empty parentheses", "-()\n", []string{"E0101"}},
+		{"empty parentheses in a body", "fn :: f() {\n    -()\n}\n", []string{"E0101"}},
+	}
+	c := start(t, "")
+	c.diagnostics(mainURI)
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c.t = t
+			c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+				TextDocument:   VersionedTextDocumentIdentifier{URI: mainURI, Version: i + 2},
+				ContentChanges: []TextDocumentContentChangeEvent{{Text: test.text}},
+			})
+			got := codes(c.diagnostics(mainURI))
+			if len(got) != len(test.codes) {
+				t.Fatalf("got diagnostics %v, want %v", got, test.codes)
+			}
+			for j := range got {
+				if got[j] != test.codes[j] {
+					t.Errorf("got diagnostics %v, want %v", got, test.codes)
+				}
+			}
+		})
+	}
+}
+
+func TestNotInitialized(t *testing.T) {
+	c := newClient(t)
+	msg := c.request("textDocument/documentSymbol", DocumentSymbolParams{
+		TextDocument: TextDocumentIdentifier{URI: mainURI},
+	})
+	if msg.Error == nil || msg.Error.Code != serverNotInitialized {
+		t.Errorf("got %+v, want a serverNotInitialized error", msg.Error)
+	}
+}
+
+func TestHandlerPanic(t *testing.T) {
+	s := NewServer(nil, io.Discard)
+	panics := func(s *Server, params json.RawMessage) (any, error) { panic("boom") }
+	_, err := call(panics, s, nil)
+	var rpcErr *responseError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != internalError {
+		t.Errorf("got %v, want an internal error", err)
+	}
+}
+
+func TestAnalysisPanic(t *testing.T) {
+	// loading from a missing workspace panics, standing in for a compiler bug
+	s := NewServer(nil, io.Discard)
+	doc := newDocument(mainURI, 1, "fn :: f() {}")
+	s.documents[doc.uri] = doc
+	if err := s.analyse(); err != nil {
+		t.Fatal(err)
+	}
+	if diagnostics := doc.protocolDiagnostics(); doc.failure == "" || len(diagnostics) != 1 {
+		t.Errorf("the panic was not reported: %+v", diagnostics)
+	}
+}
+
+func TestReadMessage(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string // the body, or the error
+	}{
+		{"frame", "Content-Length: 2\r\n\r\n{}", "{}"},
+		{"other headers", "Content-Type: application/vscode-jsonrpc\r\ncontent-length: 2\r\n\r\n[]", "[]"},
+		{"missing length", "\r\n{}", "missing Content-Length header"},
+		{"malformed length", "Content-Length: two\r\n\r\n{}", `malformed Content-Length " two"`},
+		{"negative length", "Content-Length: -1\r\n\r\n{}", `malformed Content-Length " -1"`},
+		{"malformed header", "Content-Length 2\r\n\r\n{}", `malformed header "Content-Length 2"`},
+		{"oversized frame", "Content-Length: 1000000000000\r\n\r\n{}", "Content-Length 1000000000000 exceeds the limit of 67108864 bytes"},
+		{"truncated body", "Content-Length: 4\r\n\r\n{}", "unexpected EOF"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body, err := readMessage(bufio.NewReader(strings.NewReader(test.input)))
+			got := string(body)
+			if err != nil {
+				got = err.Error()
+			}
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -5,11 +5,50 @@ import (
 	"log"
 	"os"
 
+	"github.com/LaH-DeV/veles/diagnostics"
 	"github.com/LaH-DeV/veles/lexer"
+	"github.com/LaH-DeV/veles/lsp"
 	"github.com/LaH-DeV/veles/parser"
+	"github.com/LaH-DeV/veles/source"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "lsp":
+			server := lsp.NewServer(os.Stdin, os.Stdout)
+			if err := server.Run(); err != nil {
+				log.Fatalf("Veles :: lsp error: %s.", err)
+			}
+			return
+		case "refs":
+			if err := runRefs(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "rename":
+			if err := runRename(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "check":
+			if err := runCheck(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "build":
+			if err := runBuild(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "explain":
+			if err := runExplain(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+
 	config, err := setup(os.Args)
 	if err != nil {
 		log.Fatal(err)
@@ -42,4 +81,11 @@ func main() {
 	for _, stmt := range ast.Statements {
 		fmt.Println(stmt.String())
 	}
+
+	color, _ := colorEnabled("auto")
+	renderer := &diagnostics.Renderer{Color: color, DisplayPath: displayPath}
+	file := source.NewFile(config.filepath, config.source)
+	for _, diagnostic := range append(lex.Diagnostics, par.Diagnostics...) {
+		renderer.Render(os.Stderr, file, diagnostic)
+	}
 }
@@ -0,0 +1,88 @@
+package opt
+
+import (
+	"maps"
+
+	"github.com/LaH-DeV/veles/ir"
+)
+
+// copyprop reads the sources of copies in place of their destinations. A
+// local assigned once by a copy is replaced wherever the copy runs before,
+// when its source cannot change in between: a constant, or a local never
+// assigned or assigned once before the copy. Any other copy stands until its
+// source or its destination is assigned again, in its block and in the blocks
+// after it that are the only way into the next one.
+func copyprop(m *ir.Module) {
+	for _, f := range m.Functions {
+		for propagate(f) {
+		}
+	}
+}
+
+func propagate(f *ir.Function) bool {
+	idom := f.Dominators()
+	reachable := f.Reachable()
+	defs := definitions(f)
+	stable := func(value ir.Value, at site) bool {
+		if value.IsConst() {
+			return true
+		}
+		sites := defs[value.Local]
+		return len(sites) == 0 || (len(sites) == 1 && sites[0].dominates(idom, at))
+	}
+	once := map[*ir.Local]ir.Value{}
+	for local, sites := range defs {
+		if len(sites) != 1 {
+			continue
+		}
+		instr := f.Blocks[sites[0].block].Instrs[sites[0].index]
+		if instr.Op == ir.Copy && instr.Args[0].Local != local && stable(instr.Args[0], sites[0]) {
+			once[local] = instr.Args[0]
+		}
+	}
+
+	changed := false
+	preds := f.Preds()
+	ends := make([]map[*ir.Local]ir.Value, len(f.Blocks))
+	for _, block := range f.Blocks {
+		if !reachable[block.Index] {
+			continue
+		}
+		// the copies standing so far, by destination
+		copies := map[*ir.Local]ir.Value{}
+		if len(preds[block.Index]) == 1 {
+			copies = maps.Clone(ends[preds[block.Index][0].Index])
+		}
+		replace := func(value *ir.Value, at site) {
+			if value.IsConst() {
+				return
+			}
+			if source, ok := copies[value.Local]; ok {
+				*value, changed = source, true
+			} else if source, ok := once[value.Local]; ok && defs[value.Local][0].dominates(idom, at) {
+				*value, changed = source, true
+			}
+		}
+		for i, instr := range block.Instrs {
+			for j := range instr.Args {
+				replace(&instr.Args[j], site{block.Index, i})
+			}
+			for _, dest := range instr.Dests {
+				delete(copies, dest)
+				for copied, source := range copies {
+					if source.Local == dest {
+						delete(copies, copied)
+					}
+				}
+			}
+			if instr.Op == ir.Copy && instr.Args[0].Local != instr.Dests[0] {
+				copies[instr.Dests[0]] = instr.Args[0]
+			}
+		}
+		for _, value := range operands(block.Term) {
+			replace(value, site{block.Index, len(block.Instrs)})
+		}
+		ends[block.Index] = copies
+	}
+	return changed
+}
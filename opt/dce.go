@@ -0,0 +1,213 @@
+package opt
+
+import "github.com/LaH-DeV/veles/ir"
+
+// dce removes what cannot affect the program: blocks never reached,
+// instructions without side effects whose results are never read, and the
+// locals, functions and globals nothing refers to. Branches to a block that
+// only jumps go to its target instead, and a block jumping to a block it is
+// the only way into is merged with it.
+func dce(m *ir.Module) {
+	for _, f := range m.Functions {
+		removeBlocks(f)
+		removeInstrs(f)
+		removeLocals(f)
+	}
+	removeFunctions(m)
+	removeGlobals(m)
+}
+
+func removeBlocks(f *ir.Function) {
+	skip := func(block *ir.Block) *ir.Block {
+		for len(block.Instrs) == 0 {
+			jump, ok := block.Term.(*ir.Jump)
+			if !ok {
+				break
+			}
+			block = jump.Target
+		}
+		return block
+	}
+	for _, block := range f.Blocks {
+		switch term := block.Term.(type) {
+		case *ir.Jump:
+			term.Target = skip(term.Target)
+		case *ir.Branch:
+			term.Then, term.Else = skip(term.Then), skip(term.Else)
+			if term.Then == term.Else {
+				block.Term = &ir.Jump{Target: term.Then}
+			}
+		case *ir.Switch:
+			for i, target := range term.Targets {
+				term.Targets[i] = skip(target)
+			}
+			term.Default = skip(term.Default)
+		}
+	}
+
+	preds := f.Preds()
+	reachable := f.Reachable()
+	merged := map[*ir.Block]bool{}
+	for _, block := range f.Blocks {
+		if !reachable[block.Index] || merged[block] {
+			continue
+		}
+		for {
+			jump, ok := block.Term.(*ir.Jump)
+			if !ok || len(preds[jump.Target.Index]) != 1 {
+				break
+			}
+			// the merged block is left without predecessors
+			merged[jump.Target] = true
+			block.Instrs = append(block.Instrs, jump.Target.Instrs...)
+			block.Term = jump.Target.Term
+		}
+	}
+
+	reachable = f.Reachable()
+	blocks := f.Blocks[:0]
+	for _, block := range f.Blocks {
+		if reachable[block.Index] {
+			blocks = append(blocks, block)
+		}
+	}
+	f.Blocks = blocks
+	f.Renumber()
+}
+
+// effects reports whether an operation does more than compute its results,
+// or can trap.
+func effects(op ir.Op) bool {
+	switch op {
+	case ir.Store, ir.Store8, ir.Store16, ir.Call, ir.CallIndirect, ir.GlobalSet,
+		ir.MemoryCopy, ir.MemoryGrow, ir.DivS, ir.DivU, ir.RemS, ir.RemU:
+		return true
+	}
+	return op.IsMemory()
+}
+
+func removeInstrs(f *ir.Function) {
+	for {
+		uses := map[*ir.Local]int{}
+		for _, block := range f.Blocks {
+			for _, instr := range block.Instrs {
+				for _, arg := range instr.Args {
+					uses[arg.Local]++
+				}
+			}
+			for _, value := range operands(block.Term) {
+				uses[value.Local]++
+			}
+		}
+		removed := false
+		for _, block := range f.Blocks {
+			instrs := block.Instrs[:0]
+			for _, instr := range block.Instrs {
+				unused := !effects(instr.Op)
+				for _, dest := range instr.Dests {
+					unused = unused && uses[dest] == 0
+				}
+				if unused || (instr.Op == ir.Copy && instr.Args[0].Local == instr.Dests[0]) {
+					removed = true
+					continue
+				}
+				instrs = append(instrs, instr)
+			}
+			block.Instrs = instrs
+		}
+		if !removed {
+			return
+		}
+	}
+}
+
+func removeLocals(f *ir.Function) {
+	used := map[*ir.Local]bool{}
+	for _, block := range f.Blocks {
+		for _, instr := range block.Instrs {
+			for _, arg := range instr.Args {
+				used[arg.Local] = true
+			}
+			for _, dest := range instr.Dests {
+				used[dest] = true
+			}
+		}
+		for _, value := range operands(block.Term) {
+			used[value.Local] = true
+		}
+	}
+	locals := f.Locals[:0]
+	for _, local := range f.Locals {
+		if used[local] {
+			locals = append(locals, local)
+		}
+	}
+	f.Locals = locals
+}
+
+// removeFunctions removes the functions that are neither exported, in the
+// table, the start function, nor called from those.
+func removeFunctions(m *ir.Module) {
+	live := map[string]bool{}
+	var visit func(name string)
+	visit = func(name string) {
+		if live[name] {
+			return
+		}
+		live[name] = true
+		f := m.Function(name)
+		if f == nil {
+			return
+		}
+		for _, block := range f.Blocks {
+			for _, instr := range block.Instrs {
+				if instr.Op == ir.Call {
+					visit(instr.Name)
+				}
+			}
+		}
+	}
+	for _, export := range m.Exports {
+		if export.Function != "" {
+			visit(export.Function)
+		}
+	}
+	for _, name := range m.Table {
+		visit(name)
+	}
+	if m.Start != "" {
+		visit(m.Start)
+	}
+	functions := m.Functions[:0]
+	for _, f := range m.Functions {
+		if live[f.Name] {
+			functions = append(functions, f)
+		}
+	}
+	m.Functions = functions
+}
+
+func removeGlobals(m *ir.Module) {
+	used := map[string]bool{}
+	for _, export := range m.Exports {
+		if export.Global != "" {
+			used[export.Global] = true
+		}
+	}
+	for _, f := range m.Functions {
+		for _, block := range f.Blocks {
+			for _, instr := range block.Instrs {
+				if instr.Op == ir.GlobalGet || instr.Op == ir.GlobalSet {
+					used[instr.Name] = true
+				}
+			}
+		}
+	}
+	globals := m.Globals[:0]
+	for _, global := range m.Globals {
+		if used[global.Name] {
+			globals = append(globals, global)
+		}
+	}
+	m.Globals = globals
+}
@@ -0,0 +1,351 @@
+package opt
+
+import (
+	"maps"
+	"math"
+	"math/bits"
+
+	"github.com/LaH-DeV/veles/ir"
+)
+
+// fold evaluates the operations on constants at compile time, and puts the
+// constants held by locals in place of the locals: locals assigned a constant
+// once, where that assignment runs before, and locals assigned a constant
+// earlier in the block, or in the blocks leading to it that are the only way
+// into the next one. Selects on constants become copies, and branches and
+// switches on constants become jumps.
+func fold(m *ir.Module) {
+	for _, f := range m.Functions {
+		for foldFunction(f) {
+		}
+	}
+}
+
+func foldFunction(f *ir.Function) bool {
+	idom := f.Dominators()
+	reachable := f.Reachable()
+	defs := definitions(f)
+	once := map[*ir.Local]ir.Value{}
+	for local, sites := range defs {
+		if len(sites) != 1 {
+			continue
+		}
+		instr := f.Blocks[sites[0].block].Instrs[sites[0].index]
+		if instr.Op == ir.Copy && instr.Args[0].IsConst() {
+			once[local] = instr.Args[0]
+		}
+	}
+
+	changed := false
+	preds := f.Preds()
+	ends := make([]map[*ir.Local]ir.Value, len(f.Blocks))
+	for _, block := range f.Blocks {
+		if !reachable[block.Index] {
+			continue
+		}
+		// the locals known to hold a constant so far
+		held := map[*ir.Local]ir.Value{}
+		if len(preds[block.Index]) == 1 {
+			held = maps.Clone(ends[preds[block.Index][0].Index])
+		}
+		replace := func(value *ir.Value, at site) {
+			if value.IsConst() {
+				return
+			}
+			if c, ok := held[value.Local]; ok {
+				*value, changed = c, true
+			} else if c, ok := once[value.Local]; ok && defs[value.Local][0].dominates(idom, at) {
+				*value, changed = c, true
+			}
+		}
+		for i, instr := range block.Instrs {
+			for j := range instr.Args {
+				replace(&instr.Args[j], site{block.Index, i})
+			}
+			if instr.Op == ir.Select && instr.Args[2].IsConst() {
+				chosen := instr.Args[1]
+				if instr.Args[2].Bits != 0 {
+					chosen = instr.Args[0]
+				}
+				instr.Op, instr.Args = ir.Copy, []ir.Value{chosen}
+				changed = true
+			}
+			if instr.Op != ir.Copy && len(instr.Dests) == 1 {
+				if value, ok := Evaluate(instr.Op, instr.Type, instr.Args); ok {
+					instr.Op, instr.Type, instr.Args = ir.Copy, value.Type, []ir.Value{value}
+					changed = true
+				}
+			}
+			for _, dest := range instr.Dests {
+				delete(held, dest)
+			}
+			if instr.Op == ir.Copy && instr.Args[0].IsConst() {
+				held[instr.Dests[0]] = instr.Args[0]
+			}
+		}
+		for _, value := range operands(block.Term) {
+			replace(value, site{block.Index, len(block.Instrs)})
+		}
+		ends[block.Index] = held
+
+		switch term := block.Term.(type) {
+		case *ir.Branch:
+			if term.Cond.IsConst() {
+				target := term.Else
+				if term.Cond.Bits != 0 {
+					target = term.Then
+				}
+				block.Term, changed = &ir.Jump{Target: target}, true
+			}
+		case *ir.Switch:
+			if term.Value.IsConst() {
+				target := term.Default
+				if index := uint32(term.Value.Bits); int64(index) < int64(len(term.Targets)) {
+					target = term.Targets[index]
+				}
+				block.Term, changed = &ir.Jump{Target: target}, true
+			}
+		}
+	}
+	return changed
+}
+
+// Evaluate returns the result of a numeric operation on constants. It reports
+// false for operands that are not constants, for operations that are not
+// numeric and for those that would trap, which are left to run.
+func Evaluate(op ir.Op, t ir.Type, args []ir.Value) (ir.Value, bool) {
+	for _, arg := range args {
+		if !arg.IsConst() {
+			return ir.Value{}, false
+		}
+	}
+	if _, results, ok := op.Operands(t); !ok || op.IsMemory() || len(results) != 1 {
+		return ir.Value{}, false
+	}
+	switch {
+	case len(args) == 2 && t.IsInteger():
+		return integerBinary(op, t, args[0], args[1])
+	case len(args) == 2:
+		return floatBinary(op, t, args[0].Float(), args[1].Float())
+	case args[0].Type != t || op == ir.Eqz:
+		return conversion(op, t, args[0])
+	case t.IsInteger():
+		return integerUnary(op, t, args[0])
+	}
+	return floatUnary(op, t, args[0])
+}
+
+func boolean(b bool) ir.Value {
+	if b {
+		return ir.Int(ir.I32, 1)
+	}
+	return ir.Int(ir.I32, 0)
+}
+
+func integerBinary(op ir.Op, t ir.Type, x, y ir.Value) (ir.Value, bool) {
+	// signed values, sign-extended from i32, and unsigned ones
+	a, b := x.Int(), y.Int()
+	ua, ub := x.Bits, y.Bits
+	shift := ub % uint64(t.Bits())
+	var r int64
+	switch op {
+	case ir.Add:
+		r = a + b
+	case ir.Sub:
+		r = a - b
+	case ir.Mul:
+		r = a * b
+	case ir.DivS:
+		if b == 0 || (b == -1 && a == -1<<(t.Bits()-1)) {
+			return ir.Value{}, false
+		}
+		r = a / b
+	case ir.DivU:
+		if ub == 0 {
+			return ir.Value{}, false
+		}
+		r = int64(ua / ub)
+	case ir.RemS:
+		if b == 0 {
+			return ir.Value{}, false
+		}
+		r = a % b
+	case ir.RemU:
+		if ub == 0 {
+			return ir.Value{}, false
+		}
+		r = int64(ua % ub)
+	case ir.And:
+		r = a & b
+	case ir.Or:
+		r = a | b
+	case ir.Xor:
+		r = a ^ b
+	case ir.Shl:
+		r = int64(ua << shift)
+	case ir.ShrS:
+		r = a >> shift
+	case ir.ShrU:
+		r = int64(ua >> shift)
+	case ir.Eq:
+		return boolean(ua == ub), true
+	case ir.Ne:
+		return boolean(ua != ub), true
+	case ir.LtS:
+		return boolean(a < b), true
+	case ir.LtU:
+		return boolean(ua < ub), true
+	case ir.LeS:
+		return boolean(a <= b), true
+	case ir.LeU:
+		return boolean(ua <= ub), true
+	case ir.GtS:
+		return boolean(a > b), true
+	case ir.GtU:
+		return boolean(ua > ub), true
+	case ir.GeS:
+		return boolean(a >= b), true
+	case ir.GeU:
+		return boolean(ua >= ub), true
+	default:
+		return ir.Value{}, false
+	}
+	return ir.Int(t, r), true
+}
+
+func integerUnary(op ir.Op, t ir.Type, x ir.Value) (ir.Value, bool) {
+	var r int
+	switch {
+	case op == ir.Clz && t == ir.I32:
+		r = bits.LeadingZeros32(uint32(x.Bits))
+	case op == ir.Clz:
+		r = bits.LeadingZeros64(x.Bits)
+	case op == ir.Ctz && t == ir.I32:
+		r = bits.TrailingZeros32(uint32(x.Bits))
+	case op == ir.Ctz:
+		r = bits.TrailingZeros64(x.Bits)
+	case op == ir.Popcnt:
+		r = bits.OnesCount64(x.Bits)
+	case op == ir.Extend8S:
+		return ir.Int(t, int64(int8(x.Bits))), true
+	case op == ir.Extend16S:
+		return ir.Int(t, int64(int16(x.Bits))), true
+	default:
+		return ir.Value{}, false
+	}
+	return ir.Int(t, int64(r)), true
+}
+
+// floatBinary computes in float64, which rounds the results of f32
+// operations the same way as computing in float32 would.
+func floatBinary(op ir.Op, t ir.Type, a, b float64) (ir.Value, bool) {
+	var r float64
+	switch op {
+	case ir.Add:
+		r = a + b
+	case ir.Sub:
+		r = a - b
+	case ir.Mul:
+		r = a * b
+	case ir.Div:
+		r = a / b
+	case ir.Min:
+		r = math.Min(a, b)
+	case ir.Max:
+		r = math.Max(a, b)
+	case ir.Copysign:
+		r = math.Copysign(a, b)
+	case ir.Eq:
+		return boolean(a == b), true
+	case ir.Ne:
+		return boolean(a != b), true
+	case ir.Lt:
+		return boolean(a < b), true
+	case ir.Le:
+		return boolean(a <= b), true
+	case ir.Gt:
+		return boolean(a > b), true
+	case ir.Ge:
+		return boolean(a >= b), true
+	default:
+		return ir.Value{}, false
+	}
+	return ir.Float(t, r), true
+}
+
+func floatUnary(op ir.Op, t ir.Type, x ir.Value) (ir.Value, bool) {
+	sign := uint64(1) << (t.Bits() - 1)
+	switch op {
+	case ir.Neg:
+		return ir.Value{Type: t, Bits: x.Bits ^ sign}, true
+	case ir.Abs:
+		return ir.Value{Type: t, Bits: x.Bits &^ sign}, true
+	case ir.Sqrt:
+		return ir.Float(t, math.Sqrt(x.Float())), true
+	case ir.Ceil:
+		return ir.Float(t, math.Ceil(x.Float())), true
+	case ir.Floor:
+		return ir.Float(t, math.Floor(x.Float())), true
+	case ir.Trunc:
+		return ir.Float(t, math.Trunc(x.Float())), true
+	case ir.Nearest:
+		return ir.Float(t, math.RoundToEven(x.Float())), true
+	}
+	return ir.Value{}, false
+}
+
+func conversion(op ir.Op, t ir.Type, x ir.Value) (ir.Value, bool) {
+	switch op {
+	case ir.Eqz:
+		return boolean(x.Bits == 0), true
+	case ir.WrapI64, ir.ExtendI32S:
+		return ir.Int(t, x.Int()), true
+	case ir.ExtendI32U:
+		return ir.Int(t, int64(uint32(x.Bits))), true
+	case ir.ConvertI32S, ir.ConvertI64S:
+		return toFloat(t, float32(x.Int()), float64(x.Int())), true
+	case ir.ConvertI32U:
+		return toFloat(t, float32(uint32(x.Bits)), float64(uint32(x.Bits))), true
+	case ir.ConvertI64U:
+		return toFloat(t, float32(x.Bits), float64(x.Bits)), true
+	case ir.TruncSatF32S, ir.TruncSatF64S:
+		return ir.Int(t, int64(truncSat(x.Float(), t.Bits(), true))), true
+	case ir.TruncSatF32U, ir.TruncSatF64U:
+		return ir.Int(t, int64(truncSat(x.Float(), t.Bits(), false))), true
+	case ir.PromoteF32, ir.DemoteF64:
+		return ir.Float(t, x.Float()), true
+	case ir.ReinterpretF32, ir.ReinterpretF64, ir.ReinterpretI32, ir.ReinterpretI64:
+		return ir.Value{Type: t, Bits: x.Bits}, true
+	}
+	return ir.Value{}, false
+}
+
+// toFloat picks the conversion of an integer to f32 or f64. Integers are
+// converted to f32 directly, as rounding through f64 could round twice.
+func toFloat(t ir.Type, f32 float32, f64 float64) ir.Value {
+	if t == ir.F32 {
+		return ir.Value{Type: t, Bits: uint64(math.Float32bits(f32))}
+	}
+	return ir.Float(t, f64)
+}
+
+// truncSat truncates a float to an integer of the given width, saturating at
+// its bounds. NaN becomes 0.
+func truncSat(v float64, width int, signed bool) uint64 {
+	v = math.Trunc(v)
+	switch {
+	case math.IsNaN(v):
+		return 0
+	case signed && v < -math.Ldexp(1, width-1):
+		return uint64(int64(-1) << (width - 1))
+	case signed && v >= math.Ldexp(1, width-1):
+		return 1<<(width-1) - 1
+	case signed:
+		return uint64(int64(v))
+	case v <= 0:
+		return 0
+	case v >= math.Ldexp(1, width):
+		return math.MaxUint64 >> (64 - width)
+	}
+	return uint64(v)
+}
@@ -0,0 +1,115 @@
+package opt
+
+import (
+	"slices"
+
+	"github.com/LaH-DeV/veles/ir"
+)
+
+// inlineLimit is the number of instructions, terminators included, up to
+// which a function is small enough to be inlined.
+const inlineLimit = 16
+
+// inline replaces the calls to small functions by copies of their bodies.
+// The parameters of the callee become locals of the caller assigned the
+// arguments, and its returns assign the results of the call and jump to the
+// code after it. The copies are not inlined into again, so recursive
+// functions are inlined once at most.
+func inline(m *ir.Module) {
+	for _, f := range m.Functions {
+		for i := 0; i < len(f.Blocks); i++ {
+			block := f.Blocks[i]
+			for j, instr := range block.Instrs {
+				if instr.Op != ir.Call {
+					continue
+				}
+				callee := m.Function(instr.Name)
+				if callee == nil || callee == f || size(callee) > inlineLimit {
+					continue
+				}
+				// the rest of the block follows the copy of the callee
+				i += inlineCall(f, block, j, callee)
+				break
+			}
+		}
+	}
+}
+
+func size(f *ir.Function) int {
+	n := 0
+	for _, block := range f.Blocks {
+		n += len(block.Instrs) + 1
+	}
+	return n
+}
+
+// inlineCall inlines the call at instrs[index] of block, and returns the
+// number of blocks copied from the callee, which come between the block and
+// the rest of it.
+func inlineCall(f *ir.Function, block *ir.Block, index int, callee *ir.Function) int {
+	call := block.Instrs[index]
+	rest := &ir.Block{Instrs: block.Instrs[index+1:], Term: block.Term}
+
+	locals := map[*ir.Local]*ir.Local{}
+	for _, local := range append(slices.Clone(callee.Params), callee.Locals...) {
+		locals[local] = f.NewLocal(local.Name, local.Type)
+	}
+	rename := func(value ir.Value) ir.Value {
+		if value.Local != nil {
+			value.Local = locals[value.Local]
+		}
+		return value
+	}
+	blocks := map[*ir.Block]*ir.Block{}
+	copies := make([]*ir.Block, len(callee.Blocks))
+	for i, original := range callee.Blocks {
+		copies[i] = &ir.Block{}
+		blocks[original] = copies[i]
+	}
+
+	block.Instrs = block.Instrs[:index:index]
+	for i, param := range callee.Params {
+		block.Instrs = append(block.Instrs, &ir.Instr{Op: ir.Copy, Type: param.Type, Dests: []*ir.Local{locals[param]}, Args: []ir.Value{call.Args[i]}})
+	}
+	block.Term = &ir.Jump{Target: copies[0]}
+
+	for i, original := range callee.Blocks {
+		into := copies[i]
+		for _, instr := range original.Instrs {
+			clone := *instr
+			clone.Dests = make([]*ir.Local, len(instr.Dests))
+			for j, dest := range instr.Dests {
+				clone.Dests[j] = locals[dest]
+			}
+			clone.Args = make([]ir.Value, len(instr.Args))
+			for j, arg := range instr.Args {
+				clone.Args[j] = rename(arg)
+			}
+			into.Instrs = append(into.Instrs, &clone)
+		}
+		switch term := original.Term.(type) {
+		case *ir.Jump:
+			into.Term = &ir.Jump{Target: blocks[term.Target]}
+		case *ir.Branch:
+			into.Term = &ir.Branch{Cond: rename(term.Cond), Then: blocks[term.Then], Else: blocks[term.Else]}
+		case *ir.Switch:
+			targets := make([]*ir.Block, len(term.Targets))
+			for j, target := range term.Targets {
+				targets[j] = blocks[target]
+			}
+			into.Term = &ir.Switch{Value: rename(term.Value), Targets: targets, Default: blocks[term.Default]}
+		case *ir.Return:
+			for j, result := range term.Values {
+				dest := call.Dests[j]
+				into.Instrs = append(into.Instrs, &ir.Instr{Op: ir.Copy, Type: dest.Type, Dests: []*ir.Local{dest}, Args: []ir.Value{rename(result)}})
+			}
+			into.Term = &ir.Jump{Target: rest}
+		default:
+			into.Term = &ir.Unreachable{}
+		}
+	}
+
+	f.Blocks = slices.Insert(f.Blocks, block.Index+1, append(copies, rest)...)
+	f.Renumber()
+	return len(copies)
+}
@@ -0,0 +1,139 @@
+package opt
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/LaH-DeV/veles/ir"
+)
+
+// Pass is an optimization transforming a module of the IR in place.
+type Pass struct {
+	Name  string
+	Doc   string
+	Level int // the lowest optimization level running the pass
+	Run   func(m *ir.Module)
+}
+
+// Passes lists the passes in the order they run.
+var Passes = []*Pass{
+	{"inline", "inline the calls to small functions", 2, inline},
+	{"fold", "evaluate operations and branches on constants", 1, fold},
+	{"copyprop", "use the sources of copies in place of their destinations", 1, copyprop},
+	{"dce", "remove unreachable blocks, unused instructions and locals, and the functions and globals nothing refers to", 1, dce},
+}
+
+// Options select the passes run over a module.
+type Options struct {
+	Level   int      // 0 runs no pass, 1 all but inline, 2 all of them
+	Enable  []string // passes run at any level
+	Disable []string // passes never run
+
+	// Dump, when not nil, receives the module before the first pass and
+	// after every pass.
+	Dump io.Writer
+}
+
+// Lookup returns the pass with the given name, or nil.
+func Lookup(name string) *Pass {
+	for _, pass := range Passes {
+		if pass.Name == name {
+			return pass
+		}
+	}
+	return nil
+}
+
+// Names returns the names of the passes, for messages.
+func Names() string {
+	names := make([]string, len(Passes))
+	for i, pass := range Passes {
+		names[i] = pass.Name
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " or " + names[len(names)-1]
+}
+
+// Run runs the passes selected by the options over a module. Every pass must
+// leave a valid module.
+func Run(m *ir.Module, options Options) {
+	selected := func(pass *Pass) bool {
+		for _, name := range options.Disable {
+			if name == pass.Name {
+				return false
+			}
+		}
+		for _, name := range options.Enable {
+			if name == pass.Name {
+				return true
+			}
+		}
+		return pass.Level <= options.Level
+	}
+	if options.Dump != nil {
+		fmt.Fprintf(options.Dump, "=== lowered\n%s\n", m)
+	}
+	for _, pass := range Passes {
+		if !selected(pass) {
+			continue
+		}
+		pass.Run(m)
+		if err := ir.Verify(m); err != nil {
+			panic("opt: " + pass.Name + " left invalid IR: " + err.Error())
+		}
+		if options.Dump != nil {
+			fmt.Fprintf(options.Dump, "=== after %s\n%s\n", pass.Name, m)
+		}
+	}
+}
+
+// site is the position of an instruction in a function. The terminator of a
+// block is at the position after its last instruction.
+type site struct {
+	block int
+	index int
+}
+
+// dominates reports whether the instruction at a runs before the one at b on
+// every path reaching b.
+func (a site) dominates(idom []int, b site) bool {
+	if a.block == b.block {
+		return a.index < b.index
+	}
+	return ir.Dominates(idom, a.block, b.block)
+}
+
+// definitions returns where every local is assigned, in reachable blocks.
+func definitions(f *ir.Function) map[*ir.Local][]site {
+	defs := map[*ir.Local][]site{}
+	reachable := f.Reachable()
+	for _, block := range f.Blocks {
+		if !reachable[block.Index] {
+			continue
+		}
+		for i, instr := range block.Instrs {
+			for _, dest := range instr.Dests {
+				defs[dest] = append(defs[dest], site{block.Index, i})
+			}
+		}
+	}
+	return defs
+}
+
+// operands returns the operands of a terminator, which can be replaced in
+// place.
+func operands(term ir.Terminator) []*ir.Value {
+	switch term := term.(type) {
+	case *ir.Branch:
+		return []*ir.Value{&term.Cond}
+	case *ir.Switch:
+		return []*ir.Value{&term.Value}
+	case *ir.Return:
+		values := make([]*ir.Value, len(term.Values))
+		for i := range term.Values {
+			values[i] = &term.Values[i]
+		}
+		return values
+	}
+	return nil
+}
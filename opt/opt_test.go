@@ -0,0 +1,385 @@
+package opt
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/LaH-DeV/veles/ir"
+)
+
+// module returns a module of the given functions exporting the first one, so
+// that dce keeps it.
+func module(functions ...*ir.Function) *ir.Module {
+	return &ir.Module{
+		Functions: functions,
+		Exports:   []*ir.Export{{Name: "f", Function: functions[0].Name}},
+	}
+}
+
+// square builds a function returning the square of its parameter.
+func square() *ir.Function {
+	f := ir.NewFunction("main::square", []ir.Type{ir.I32})
+	x := f.NewParam("x", ir.I32)
+	b := ir.NewBuilder(f)
+	b.Terminate(&ir.Return{Values: []ir.Value{b.Op(ir.Mul, ir.I32, ir.Use(x), ir.Use(x))}})
+	return f
+}
+
+func TestPasses(t *testing.T) {
+	tests := []struct {
+		name   string
+		pass   string
+		module func() *ir.Module
+		want   string // the module after the pass
+	}{
+		{"fold arithmetic", "fold", func() *ir.Module {
+			f := ir.NewFunction("main::f", []ir.Type{ir.I32})
+			b := ir.NewBuilder(f)
+			sum := b.Op(ir.Add, ir.I32, ir.Int(ir.I32, 2), ir.Int(ir.I32, 3))
+			b.Terminate(&ir.Return{Values: []ir.Value{b.Op(ir.Mul, ir.I32, sum, ir.Int(ir.I32, 4))}})
+			return module(f)
+		}, `export "f" = $main::f
+
+func $main::f() -> i32
+  local %tmp i32
+  local %tmp.1 i32
+b0:
+  %tmp = copy 5
+  %tmp.1 = copy 20
+  return 20
+`},
+		{"fold keeps traps", "fold", func() *ir.Module {
+			f := ir.NewFunction("main::f", []ir.Type{ir.I32})
+			b := ir.NewBuilder(f)
+			b.Terminate(&ir.Return{Values: []ir.Value{b.Op(ir.DivS, ir.I32, ir.Int(ir.I32, 1), ir.Int(ir.I32, 0))}})
+			return module(f)
+		}, `export "f" = $main::f
+
+func $main::f() -> i32
+  local %tmp i32
+b0:
+  %tmp = i32.div_s 1, 0
+  return %tmp
+`},
+		{"fold branch", "fold", func() *ir.Module {
+			f := ir.NewFunction("main::f", []ir.Type{ir.I32})
+			b := ir.NewBuilder(f)
+			cond := b.Op(ir.LtS, ir.I32, ir.Int(ir.I32, 1), ir.Int(ir.I32, 2))
+			then, other := f.NewBlock(), f.NewBlock()
+			b.Terminate(&ir.Branch{Cond: cond, Then: then, Else: other})
+			b.Block = then
+			b.Terminate(&ir.Return{Values: []ir.Value{ir.Int(ir.I32, 1)}})
+			b.Block = other
+			b.Terminate(&ir.Return{Values: []ir.Value{ir.Int(ir.I32, 2)}})
+			return module(f)
+		}, `export "f" = $main::f
+
+func $main::f() -> i32
+  local %tmp i32
+b0:
+  %tmp = copy 1
+  jump b1
+b1:
+  return 1
+b2:
+  return 2
+`},
+		{"fold select", "fold", func() *ir.Module {
+			f := ir.NewFunction("main::f", []ir.Type{ir.I32})
+			x := f.NewParam("x", ir.I32)
+			b := ir.NewBuilder(f)
+			b.Terminate(&ir.Return{Values: []ir.Value{b.Select(ir.Use(x), ir.Int(ir.I32, 0), ir.Int(ir.I32, 0))}})
+			return module(f)
+		}, `export "f" = $main::f
+
+func $main::f(%x i32) -> i32
+  local %tmp i32
+b0:
+  %tmp = copy 0
+  return 0
+`},
+		{"fold local assigned once", "fold", func() *ir.Module {
+			f := ir.NewFunction("main::f", []ir.Type{ir.I32})
+			n := f.NewLocal("n", ir.I32)
+			b := ir.NewBuilder(f)
+			b.Copy(n, ir.Int(ir.I32, 6))
+			b.Terminate(&ir.Return{Values: []ir.Value{b.Op(ir.Add, ir.I32, ir.Use(n), ir.Use(n))}})
+			return module(f)
+		}, `export "f" = $main::f
+
+func $main::f() -> i32
+  local %n i32
+  local %tmp i32
+b0:
+  %n = copy 6
+  %tmp = copy 12
+  return 12
+`},
+		{"copyprop", "copyprop", func() *ir.Module {
+			f := ir.NewFunction("main::f", []ir.Type{ir.I32})
+			x := f.NewParam("x", ir.I32)
+			y := f.NewLocal("y", ir.I32)
+			b := ir.NewBuilder(f)
+			b.Copy(y, ir.Use(x))
+			b.Terminate(&ir.Return{Values: []ir.Value{b.Op(ir.Add, ir.I32, ir.Use(y), ir.Use(y))}})
+			return module(f)
+		}, `export "f" = $main::f
+
+func $main::f(%x i32) -> i32
+  local %y i32
+  local %tmp i32
+b0:
+  %y = copy %x
+  %tmp = i32.add %x, %x
+  return %tmp
+`},
+		{"copyprop stops at assignments", "copyprop", func() *ir.Module {
+			f := ir.NewFunction("main::f", []ir.Type{ir.I32})
+			x := f.NewParam("x", ir.I32)
+			y := f.NewLocal("y", ir.I32)
+			b := ir.NewBuilder(f)
+			b.Copy(y, ir.Use(x))
+			b.Copy(x, ir.Int(ir.I32, 0))
+			b.Terminate(&ir.Return{Values: []ir.Value{ir.Use(y)}})
+			return module(f)
+		}, `export "f" = $main::f
+
+func $main::f(%x i32) -> i32
+  local %y i32
+b0:
+  %y = copy %x
+  %x = copy 0
+  return %y
+`},
+		{"dce instructions and locals", "dce", func() *ir.Module {
+			f := ir.NewFunction("main::f", []ir.Type{ir.I32})
+			x := f.NewParam("x", ir.I32)
+			f.NewLocal("unused", ir.I32)
+			b := ir.NewBuilder(f)
+			b.Op(ir.Mul, ir.I32, ir.Use(x), ir.Use(x))
+			b.Op(ir.DivS, ir.I32, ir.Use(x), ir.Use(x))
+			b.Terminate(&ir.Return{Values: []ir.Value{ir.Use(x)}})
+			return module(f)
+		}, `export "f" = $main::f
+
+func $main::f(%x i32) -> i32
+  local %tmp.1 i32
+b0:
+  %tmp.1 = i32.div_s %x, %x
+  return %x
+`},
+		{"dce blocks", "dce", func() *ir.Module {
+			f := ir.NewFunction("main::f", []ir.Type{ir.I32})
+			x := f.NewParam("x", ir.I32)
+			b := ir.NewBuilder(f)
+			skip, dead, then, other := f.NewBlock(), f.NewBlock(), f.NewBlock(), f.NewBlock()
+			b.Terminate(&ir.Branch{Cond: ir.Use(x), Then: skip, Else: other})
+			b.Block = skip
+			b.Jump(then)
+			b.Block = dead
+			b.Jump(then)
+			b.Block = then
+			b.Terminate(&ir.Return{Values: []ir.Value{ir.Int(ir.I32, 1)}})
+			b.Block = other
+			b.Terminate(&ir.Return{Values: []ir.Value{ir.Int(ir.I32, 2)}})
+			return module(f)
+		}, `export "f" = $main::f
+
+func $main::f(%x i32) -> i32
+b0:
+  branch %x, b1, b2
+b1:
+  return 1
+b2:
+  return 2
+`},
+		{"dce functions and globals", "dce", func() *ir.Module {
+			f := ir.NewFunction("main::f", nil)
+			b := ir.NewBuilder(f)
+			b.Call("main::used", nil)
+			b.Terminate(&ir.Return{})
+			used := ir.NewFunction("main::used", nil)
+			b = ir.NewBuilder(used)
+			b.GlobalSet("main::set", ir.Int(ir.I32, 1))
+			b.Terminate(&ir.Return{})
+			unused := ir.NewFunction("main::unused", nil)
+			b = ir.NewBuilder(unused)
+			b.GlobalSet("main::unset", ir.Int(ir.I32, 1))
+			b.Terminate(&ir.Return{})
+			m := module(f, used, unused)
+			m.Globals = []*ir.Global{
+				{Name: "main::set", Type: ir.I32, Mutable: true, Init: ir.Int(ir.I32, 0)},
+				{Name: "main::unset", Type: ir.I32, Mutable: true, Init: ir.Int(ir.I32, 0)},
+			}
+			return m
+		}, `global $main::set mut i32 = 0
+export "f" = $main::f
+
+func $main::f()
+b0:
+  call $main::used
+  return
+
+func $main::used()
+b0:
+  global.set $main::set 1
+  return
+`},
+		{"inline", "inline", func() *ir.Module {
+			f := ir.NewFunction("main::f", []ir.Type{ir.I32})
+			x := f.NewParam("x", ir.I32)
+			b := ir.NewBuilder(f)
+			result := b.Call("main::square", []ir.Type{ir.I32}, ir.Use(x))
+			b.Terminate(&ir.Return{Values: []ir.Value{b.Op(ir.Add, ir.I32, result[0], ir.Int(ir.I32, 1))}})
+			return module(f, square())
+		}, `export "f" = $main::f
+
+func $main::f(%x i32) -> i32
+  local %tmp i32
+  local %tmp.1 i32
+  local %x.1 i32
+  local %tmp.2 i32
+b0:
+  %x.1 = copy %x
+  jump b1
+b1:
+  %tmp.2 = i32.mul %x.1, %x.1
+  %tmp = copy %tmp.2
+  jump b2
+b2:
+  %tmp.1 = i32.add %tmp, 1
+  return %tmp.1
+
+func $main::square(%x i32) -> i32
+  local %tmp i32
+b0:
+  %tmp = i32.mul %x, %x
+  return %tmp
+`},
+		{"inline recursion once", "inline", func() *ir.Module {
+			f := ir.NewFunction("main::f", nil)
+			b := ir.NewBuilder(f)
+			b.Call("main::f", nil)
+			b.Terminate(&ir.Return{})
+			g := ir.NewFunction("main::g", nil)
+			b = ir.NewBuilder(g)
+			b.Call("main::f", nil)
+			b.Terminate(&ir.Return{})
+			return module(g, f)
+		}, `export "f" = $main::g
+
+func $main::g()
+b0:
+  jump b1
+b1:
+  call $main::f
+  jump b2
+b2:
+  return
+
+func $main::f()
+b0:
+  call $main::f
+  return
+`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := test.module()
+			if err := ir.Verify(m); err != nil {
+				t.Fatalf("invalid module before %s: %v", test.pass, err)
+			}
+			Run(m, Options{Enable: []string{test.pass}})
+			if got := m.String(); got != test.want {
+				t.Errorf("got\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name string
+		op   ir.Op
+		t    ir.Type
+		args []ir.Value
+		want string // "" when the operation is not evaluated
+	}{
+		{"add", ir.Add, ir.I32, []ir.Value{ir.Int(ir.I32, 2), ir.Int(ir.I32, 3)}, "5"},
+		{"wrap around", ir.Add, ir.I32, []ir.Value{ir.Int(ir.I32, math.MaxInt32), ir.Int(ir.I32, 1)}, "-2147483648"},
+		{"unsigned division", ir.DivU, ir.I32, []ir.Value{ir.Int(ir.I32, -1), ir.Int(ir.I32, 2)}, "2147483647"},
+		{"division by zero", ir.DivS, ir.I32, []ir.Value{ir.Int(ir.I32, 1), ir.Int(ir.I32, 0)}, ""},
+		{"overflowing division", ir.DivS, ir.I64, []ir.Value{ir.Int(ir.I64, math.MinInt64), ir.Int(ir.I64, -1)}, ""},
+		{"shift by the width", ir.Shl, ir.I32, []ir.Value{ir.Int(ir.I32, 1), ir.Int(ir.I32, 33)}, "2"},
+		{"unsigned comparison", ir.LtU, ir.I32, []ir.Value{ir.Int(ir.I32, -1), ir.Int(ir.I32, 1)}, "0"},
+		{"eqz", ir.Eqz, ir.I64, []ir.Value{ir.Int(ir.I64, 0)}, "1"},
+		{"float", ir.Mul, ir.F64, []ir.Value{ir.Float(ir.F64, 1.5), ir.Float(ir.F64, 2)}, "3.0"},
+		{"float division by zero", ir.Div, ir.F64, []ir.Value{ir.Float(ir.F64, 1), ir.Float(ir.F64, 0)}, "inf"},
+		{"extend", ir.ExtendI32S, ir.I64, []ir.Value{ir.Int(ir.I32, -1)}, "-1"},
+		{"saturating truncation", ir.TruncSatF64S, ir.I32, []ir.Value{ir.Float(ir.F64, 1e10)}, "2147483647"},
+		{"reinterpret", ir.ReinterpretF32, ir.I32, []ir.Value{ir.Float(ir.F32, 1)}, "1065353216"},
+		{"not constant", ir.Add, ir.I32, []ir.Value{ir.Use(&ir.Local{Name: "x", Type: ir.I32}), ir.Int(ir.I32, 1)}, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			value, ok := Evaluate(test.op, test.t, test.args)
+			switch {
+			case !ok && test.want != "":
+				t.Errorf("not evaluated, want %s", test.want)
+			case ok && test.want == "":
+				t.Errorf("evaluated to %s", value)
+			case ok && value.String() != test.want:
+				t.Errorf("got %s, want %s", value, test.want)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name    string
+		options Options
+		want    []string // the passes run
+	}{
+		{"level 0", Options{}, nil},
+		{"level 1", Options{Level: 1}, []string{"fold", "copyprop", "dce"}},
+		{"level 2", Options{Level: 2}, []string{"inline", "fold", "copyprop", "dce"}},
+		{"enable", Options{Enable: []string{"dce", "inline"}}, []string{"inline", "dce"}},
+		{"disable", Options{Level: 2, Disable: []string{"fold"}}, []string{"inline", "copyprop", "dce"}},
+		{"disable wins", Options{Enable: []string{"dce"}, Disable: []string{"dce"}}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var dump strings.Builder
+			test.options.Dump = &dump
+			Run(module(square()), test.options)
+			var got []string
+			for _, line := range strings.Split(dump.String(), "\n") {
+				if name, ok := strings.CutPrefix(line, "=== after "); ok {
+					got = append(got, name)
+				}
+			}
+			if !strings.HasPrefix(dump.String(), "=== lowered\n") {
+				t.Errorf("the dump does not start with the lowered module:\n%s", dump.String())
+			}
+			if strings.Join(got, " ") != strings.Join(test.want, " ") {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	for _, pass := range Passes {
+		if Lookup(pass.Name) != pass {
+			t.Errorf("Lookup(%q) does not return the pass", pass.Name)
+		}
+	}
+	if pass := Lookup("unroll"); pass != nil {
+		t.Errorf("Lookup(%q) = %v, want nil", "unroll", pass)
+	}
+	if got, want := Names(), "inline, fold, copyprop or dce"; got != want {
+		t.Errorf("Names() = %q, want %q", got, want)
+	}
+}
@@ -2,19 +2,27 @@ package parser
 
 import (
 	"github.com/LaH-DeV/veles/ast"
+	"github.com/LaH-DeV/veles/diagnostics"
 	"github.com/LaH-DeV/veles/lexer"
+	"github.com/LaH-DeV/veles/source"
 )
 
 type parser struct {
 	tokens []lexer.Token
 	pos    int
+	depth  int
+
+	noStructLiterals bool
 
 	stmtLookup *map[lexer.TokenKind]stmtHandler
 	nudLookup  *map[lexer.TokenKind]nudHandler
 	ledLookup  *map[lexer.TokenKind]ledHandler
 	bpLookup   *map[lexer.TokenKind]bindingPower
+	rightAssoc *map[lexer.TokenKind]bool
 
 	filetype lexer.Filetype
+
+	Diagnostics []diagnostics.Diagnostic
 }
 
 func NewParser(filetype lexer.Filetype) *parser {
@@ -35,13 +43,19 @@ func (p *parser) ParseFile(tokens []lexer.Token, filename string) *ast.Program {
 
 	for p.hasTokens() {
 		p.skipNewlines()
-		stmt := parseStmt(p)
+		stmt := parseStmtRecover(p)
 		if stmt != nil {
 			body = append(body, stmt)
 		}
 	}
 
+	var span source.Span
+	if len(tokens) > 0 {
+		span = source.Join(tokens[0].Span, tokens[len(tokens)-1].Span)
+	}
+
 	return &ast.Program{
+		Span:       span,
 		Statements: body,
 		Filetype:   p.filetype,
 		Filename:   filename,
@@ -52,45 +66,67 @@ func vsParser() *parser {
 	p := baseParser()
 	p.filetype = lexer.Vs
 
-	p.led(lexer.ASSIGNMENT, assignment, parseAssignmentExpr)
+	p.ledRight(lexer.ASSIGNMENT, assignment, parseAssignmentExpr)
+	for _, kind := range lexer.CompoundAssignments() {
+		p.ledRight(kind, assignment, parseAssignmentExpr)
+	}
+
+	p.led(lexer.OR, logicalOr, parseBinaryExpr)
+	p.led(lexer.AND, logicalAnd, parseBinaryExpr)
 
-	p.led(lexer.GREATER, relational, parseBinaryExpr)
-	p.led(lexer.LESS, relational, parseBinaryExpr)
-	p.led(lexer.GREATER_EQUAL, relational, parseBinaryExpr)
-	p.led(lexer.LESS_EQUAL, relational, parseBinaryExpr)
-	p.led(lexer.EQUAL, relational, parseBinaryExpr)
-	p.led(lexer.NOT_EQUAL, relational, parseBinaryExpr)
+	p.led(lexer.GREATER, comparison, parseBinaryExpr)
+	p.led(lexer.LESS, comparison, parseBinaryExpr)
+	p.led(lexer.GREATER_EQUAL, comparison, parseBinaryExpr)
+	p.led(lexer.LESS_EQUAL, comparison, parseBinaryExpr)
+	p.led(lexer.EQUAL, comparison, parseBinaryExpr)
+	p.led(lexer.NOT_EQUAL, comparison, parseBinaryExpr)
 
-	p.led(lexer.AND, logical, parseBinaryExpr)
-	p.led(lexer.OR, logical, parseBinaryExpr)
+	p.led(lexer.PIPE, bitwiseOr, parseBinaryExpr)
+	p.led(lexer.CARET, bitwiseXor, parseBinaryExpr)
+	p.led(lexer.AMPERSAND, bitwiseAnd, parseBinaryExpr)
+	p.led(lexer.SHIFT_LEFT, shift, parseBinaryExpr)
+	p.led(lexer.SHIFT_RIGHT, shift, parseBinaryExpr)
+	p.led(lexer.SHIFT_RIGHT_UNSIGNED, shift, parseBinaryExpr)
 
 	p.led(lexer.PLUS, additive, parseBinaryExpr)
 	p.led(lexer.DASH, additive, parseBinaryExpr)
 	p.led(lexer.SLASH, multiplicative, parseBinaryExpr)
 	p.led(lexer.ASTERISK, multiplicative, parseBinaryExpr)
 	p.led(lexer.REMAINDER, multiplicative, parseBinaryExpr)
-	p.led(lexer.EXPONENTIATION, exponentiation, parseBinaryExpr)
+	p.ledRight(lexer.EXPONENTIATION, exponentiation, parseBinaryExpr)
+	p.led(lexer.AS, cast, parseCastExpr)
 	p.led(lexer.OPEN_PAREN, call, parseCallExpr)
 	p.led(lexer.DOUBLE_COLON, member, parseMemberExpr)
+	p.led(lexer.DOT, member, parseFieldExpr)
+	p.led(lexer.OPEN_CURLY, call, parseStructLiteralExpr)
+	p.led(lexer.OPEN_BRACKET, call, parseIndexExpr)
 
 	p.nud(lexer.FALSE, parsePrimaryExpr)
 	p.nud(lexer.TRUE, parsePrimaryExpr)
 	p.nud(lexer.INTEGER, parsePrimaryExpr)
 	p.nud(lexer.FLOAT, parsePrimaryExpr)
+	p.nud(lexer.STRING, parsePrimaryExpr)
 	p.nud(lexer.IDENTIFIER, parsePrimaryExpr)
 
 	p.nud(lexer.OPEN_PAREN, parseGroupingExpr)
+	p.nud(lexer.OPEN_BRACKET, parseArrayLiteralExpr)
+	p.nud(lexer.MATCH, parseMatchExpr)
+	p.nud(lexer.FN, parseFunctionExpr)
+	p.nud(lexer.IF, parseIfExpr)
+	p.nud(lexer.OPEN_CURLY, parseBlockExpr)
 
 	p.nud(lexer.DASH, parsePrefixExpr)
 	p.nud(lexer.NOT, parsePrefixExpr)
+	p.nud(lexer.TILDE, parsePrefixExpr)
 
 	p.stmt(lexer.USE, parseUseStmt)
 	p.stmt(lexer.RETURN, parseReturnStmt)
 	p.stmt(lexer.LET, parseVariableDeclarationStmt)
-	p.stmt(lexer.IF, parseIfStmt)
 	p.stmt(lexer.FN, parseFunctionStmt)
 	p.stmt(lexer.PUB, parsePublicStmt)
 	p.stmt(lexer.EXTERN, parseExternStmt)
+	p.stmt(lexer.STRUCT, parseStructStmt)
+	p.stmt(lexer.ENUM, parseEnumStmt)
 
 	return p
 }
@@ -110,6 +146,7 @@ func baseParser() *parser {
 		nudLookup:  &map[lexer.TokenKind]nudHandler{},
 		ledLookup:  &map[lexer.TokenKind]ledHandler{},
 		bpLookup:   &map[lexer.TokenKind]bindingPower{},
+		rightAssoc: &map[lexer.TokenKind]bool{},
 		filetype:   lexer.Unrecognized,
 	}
 	return p
@@ -118,5 +155,7 @@ func baseParser() *parser {
 func (p *parser) newState(tokens []lexer.Token) {
 	p.tokens = tokens
 	p.pos = 0
-	// TODO: reset diagnostics
+	p.depth = 0
+	p.noStructLiterals = false
+	p.Diagnostics = make([]diagnostics.Diagnostic, 0)
 }
@@ -1,11 +1,12 @@
 package parser
 
 import (
-	"fmt"
 	"strconv"
 
 	"github.com/LaH-DeV/veles/ast"
+	"github.com/LaH-DeV/veles/diagnostics"
 	"github.com/LaH-DeV/veles/lexer"
+	"github.com/LaH-DeV/veles/source"
 )
 
 func parseBinaryExpr(p *parser, left ast.Expr, bp bindingPower) ast.Expr {
@@ -13,11 +14,11 @@ func parseBinaryExpr(p *parser, left ast.Expr, bp bindingPower) ast.Expr {
 	right := parseExpr(p, bp)
 
 	if right == nil {
-		//panic(fmt.Sprintf("Veles :: Cannot create binary_expr from \"%s\"\n", lexer.TokenKindString(p.currentTokenKind())))
-		return nil
+		p.fail(diagnostics.ExpectedExpression, p.currentToken().Span, "Expected an expression after \"%s\"", operatorToken.Value)
 	}
 
-	return ast.BinaryExpr{
+	return &ast.BinaryExpr{
+		Span:     source.Join(left.Location(), (*right).Location()),
 		Left:     left,
 		Operator: operatorToken,
 		Right:    *right,
@@ -25,36 +26,39 @@ func parseBinaryExpr(p *parser, left ast.Expr, bp bindingPower) ast.Expr {
 }
 
 func parsePrimaryExpr(p *parser) ast.Expr {
+	token := p.currentToken()
 	switch p.currentTokenKind() {
-	case lexer.INTEGER:
-		integer, _ := strconv.ParseInt(p.advance().Value, 0, 64)
-		// TODO: Handle errors
-		return ast.IntegerExpr{
-			Value: integer,
+	case lexer.INTEGER, lexer.FLOAT:
+		// malformed literals were reported by the lexer
+		number, _ := lexer.ParseNumber(p.advance().Value)
+		if number.IsFloat {
+			return &ast.FloatExpr{Span: token.Span, Value: number.Float, Suffix: number.Suffix}
 		}
-	case lexer.FLOAT:
-		number, _ := strconv.ParseFloat(p.advance().Value, 64)
-		// TODO: Handle errors
-		return &ast.FloatExpr{Value: number}
+		return &ast.IntegerExpr{Span: token.Span, Value: number.Int, Suffix: number.Suffix}
+	case lexer.STRING:
+		// invalid escapes were reported by the lexer
+		value, _ := lexer.Unquote(p.advance().Value)
+		return &ast.StringExpr{Span: token.Span, Value: value}
 	case lexer.IDENTIFIER:
-		return ast.SymbolExpr{Value: p.advance().Value}
+		return &ast.SymbolExpr{Span: token.Span, Value: p.advance().Value}
 	case lexer.FALSE:
 		fallthrough
 	case lexer.TRUE:
 		value, _ := strconv.ParseBool(p.advance().Value)
 		// TODO: Handle errors
-		return ast.BooleanExpr{Value: value}
+		return &ast.BooleanExpr{Span: token.Span, Value: value}
 	default:
-		panic(fmt.Sprintf("Veles :: Cannot create primary_expr from \"%s\"\n", lexer.TokenKindString(p.currentTokenKind())))
+		p.fail(diagnostics.ExpectedExpression, token.Span, "Cannot create primary_expr from \"%s\"", lexer.TokenKindString(p.currentTokenKind()))
+		return nil
 	}
 }
 
 func parseGroupingExpr(p *parser) ast.Expr {
-	p.expect(lexer.OPEN_PAREN)
-	expr := parseExpr(p, defaultBp)
+	open := p.expect(lexer.OPEN_PAREN)
+	expr := p.structLiterals(true, func() *ast.Expr { return parseExpr(p, defaultBp) })
 	p.expect(lexer.CLOSE_PAREN)
 	if expr == nil {
-		return nil
+		p.fail(diagnostics.ExpectedExpression, p.spanFrom(open.Span.Start), "Expected an expression between \"(\" and \")\"")
 	}
 	return *expr
 }
@@ -64,28 +68,31 @@ func parsePrefixExpr(p *parser) ast.Expr {
 
 	expr := parseExpr(p, unary)
 	if expr == nil {
-		return nil // TODO
+		p.fail(diagnostics.ExpectedExpression, p.currentToken().Span, "Expected an expression after \"%s\"", operatorToken.Value)
 	}
 
-	return ast.PrefixExpr{
+	return &ast.PrefixExpr{
+		Span:     source.Join(operatorToken.Span, (*expr).Location()),
 		Operator: operatorToken,
 		Right:    *expr,
 	}
 }
 
 func parseAssignmentExpr(p *parser, left ast.Expr, bp bindingPower) ast.Expr {
-	p.advance()
+	operatorToken := p.advance()
 	if left == nil {
-		return nil // TODO
+		p.fail(diagnostics.ExpectedExpression, operatorToken.Span, "Expected an expression before \"%s\"", operatorToken.Value)
 	}
 
 	var right *ast.Expr = parseExpr(p, bp)
 	if right == nil {
-		return nil // TODO
+		p.fail(diagnostics.ExpectedExpression, p.currentToken().Span, "Expected an expression after \"%s\"", operatorToken.Value)
 	}
 
-	return ast.AssignmentExpr{
+	return &ast.AssignmentExpr{
+		Span:          source.Join(left.Location(), (*right).Location()),
 		Assigne:       left,
+		Operator:      operatorToken,
 		AssignedValue: *right,
 	}
 }
@@ -96,8 +103,6 @@ func parseExpr(p *parser, bp bindingPower) *ast.Expr {
 	nudHandler, exists := (*p.nudLookup)[p.currentTokenKind()]
 
 	if !exists {
-		// fmt.Printf("No nud handler found for token %s (%s)\n", lexer.TokenKindString(p.currentTokenKind()), p.currentToken().Value)
-		// panic(fmt.Sprintf("NUD Handler expected for token %s\n", lexer.TokenKindString(p.currentTokenKind())))
 		return nil
 	}
 
@@ -109,13 +114,10 @@ func parseExpr(p *parser, bp bindingPower) *ast.Expr {
 
 		ledHandler, exists := (*p.ledLookup)[p.currentTokenKind()]
 		if !exists {
-			// panic(fmt.Sprintf("LED Handler expected for token %s\n", lexer.TokenKindString(p.currentTokenKind())))
-			//fmt.Printf("LED Handler expected for token %s\n", lexer.TokenKindString(p.currentTokenKind()))
-			// return &expression
-			return nil
+			p.fail(diagnostics.UnexpectedToken, p.currentToken().Span, "Unexpected \"%s\" after an expression", lexer.TokenKindString(p.currentTokenKind()))
 		}
 
-		expression = ledHandler(p, expression, p.lookupBp(p.currentTokenKind()))
+		expression = ledHandler(p, expression, p.rightBp(p.currentTokenKind()))
 	}
 
 	return &expression
@@ -124,16 +126,16 @@ func parseExpr(p *parser, bp bindingPower) *ast.Expr {
 func parseCallExpr(p *parser, left ast.Expr, bp bindingPower) ast.Expr {
 	p.advance()
 	if left == nil {
-		return nil // TODO
+		p.fail(diagnostics.ExpectedExpression, p.currentToken().Span, "Expected a callee before \"(\"")
 	}
 	args := make([]ast.Expr, 0)
 	if p.currentTokenKind() != lexer.CLOSE_PAREN {
 		for {
-			expr := *parseExpr(p, defaultBp)
+			expr := p.structLiterals(true, func() *ast.Expr { return parseExpr(p, defaultBp) })
 			if expr == nil {
-				break // TODO
+				p.fail(diagnostics.ExpectedExpression, p.currentToken().Span, "Expected an argument but received \"%s\" instead", lexer.TokenKindString(p.currentTokenKind()))
 			}
-			args = append(args, expr)
+			args = append(args, *expr)
 			if p.currentTokenKind() != lexer.COMMA {
 				break
 			}
@@ -142,6 +144,7 @@ func parseCallExpr(p *parser, left ast.Expr, bp bindingPower) ast.Expr {
 	}
 	p.expect(lexer.CLOSE_PAREN)
 	return &ast.CallExpr{
+		Span:      p.spanFrom(left.Location().Start),
 		Callee:    left,
 		Arguments: args,
 	}
@@ -151,7 +154,293 @@ func parseMemberExpr(p *parser, left ast.Expr, bp bindingPower) ast.Expr {
 	p.advance()                          // Skip the DOUBLE_COLON token
 	member := p.expect(lexer.IDENTIFIER) // for now, we'll just assume that the member is an identifier
 	return &ast.MemberExpr{
-		Container: left,
-		Member:    member.Value,
+		Span:       source.Join(left.Location(), member.Span),
+		Container:  left,
+		Member:     member.Value,
+		MemberSpan: member.Span,
+	}
+}
+
+func parseFieldExpr(p *parser, left ast.Expr, bp bindingPower) ast.Expr {
+	p.advance() // Skip the DOT token
+	field := p.expectError(lexer.IDENTIFIER, "Expected a field name after \".\"")
+	return &ast.FieldExpr{
+		Span:      source.Join(left.Location(), field.Span),
+		Object:    left,
+		Field:     field.Value,
+		FieldSpan: field.Span,
+	}
+}
+
+func parseStructLiteralExpr(p *parser, left ast.Expr, bp bindingPower) ast.Expr {
+	open := p.advance()
+	switch left.(type) {
+	case *ast.SymbolExpr, *ast.MemberExpr:
+	default:
+		p.fail(diagnostics.UnexpectedToken, open.Span, "Expected a struct name before \"{\"")
+	}
+
+	fields := make([]ast.FieldValue, 0)
+	p.skipNewlines()
+	for p.currentTokenKind() != lexer.CLOSE_CURLY {
+		name := p.expectError(lexer.IDENTIFIER, "Expected a field name in struct literal")
+		p.expect(lexer.COLON)
+		value := p.structLiterals(true, func() *ast.Expr { return parseExpr(p, defaultBp) })
+		if value == nil {
+			p.fail(diagnostics.ExpectedExpression, p.currentToken().Span, "Expected a value for field \"%s\"", name.Value)
+		}
+		fields = append(fields, ast.FieldValue{
+			Span:     source.Join(name.Span, (*value).Location()),
+			Name:     name.Value,
+			NameSpan: name.Span,
+			Value:    *value,
+		})
+		p.skipNewlines()
+		if p.currentTokenKind() != lexer.COMMA {
+			break
+		}
+		p.advance()
+		p.skipNewlines()
+	}
+	p.expect(lexer.CLOSE_CURLY)
+
+	return &ast.StructLiteralExpr{
+		Span:   p.spanFrom(left.Location().Start),
+		Type:   left,
+		Fields: fields,
+	}
+}
+
+func parseIndexExpr(p *parser, left ast.Expr, bp bindingPower) ast.Expr {
+	open := p.advance()
+	index := p.structLiterals(true, func() *ast.Expr { return parseExpr(p, defaultBp) })
+	if index == nil {
+		p.fail(diagnostics.ExpectedExpression, p.currentToken().Span, "Expected an index after \"%s\"", open.Value)
+	}
+	p.expect(lexer.CLOSE_BRACKET)
+	return &ast.IndexExpr{
+		Span:   p.spanFrom(left.Location().Start),
+		Object: left,
+		Index:  *index,
+	}
+}
+
+func parseCastExpr(p *parser, left ast.Expr, bp bindingPower) ast.Expr {
+	p.advance() // AS token
+	target := parseType(p)
+	return &ast.CastExpr{
+		Span:     p.spanFrom(left.Location().Start),
+		Value:    left,
+		Type:     target.Value,
+		TypeSpan: target.Span,
+	}
+}
+
+func parseArrayLiteralExpr(p *parser) ast.Expr {
+	start := p.advance().Span.Start
+	elements := make([]ast.Expr, 0)
+	p.skipNewlines()
+	for p.currentTokenKind() != lexer.CLOSE_BRACKET {
+		element := p.structLiterals(true, func() *ast.Expr { return parseExpr(p, defaultBp) })
+		if element == nil {
+			p.fail(diagnostics.ExpectedExpression, p.currentToken().Span, "Expected an array element but received \"%s\" instead", lexer.TokenKindString(p.currentTokenKind()))
+		}
+		elements = append(elements, *element)
+		p.skipNewlines()
+		if p.currentTokenKind() != lexer.COMMA {
+			break
+		}
+		p.advance()
+		p.skipNewlines()
+	}
+	p.expect(lexer.CLOSE_BRACKET)
+	return &ast.ArrayLiteralExpr{
+		Span:     p.spanFrom(start),
+		Elements: elements,
+	}
+}
+
+func parseFunctionExpr(p *parser) ast.Expr {
+	start := p.advance().Span.Start // FN token
+	params := parseFunctionParameters(p)
+	var returnType string
+	if p.currentTokenKind() == lexer.ARROW {
+		p.advance()
+		result := parseType(p).Value
+		// the body follows the result, so a qualified name before "{" is
+		// part of the type, unlike in "fn Vec2 :: origin {"
+		for p.currentTokenKind() == lexer.DOUBLE_COLON && p.peek().Kind == lexer.IDENTIFIER {
+			p.advance()
+			result += "::" + p.advance().Value
+		}
+		returnType = result
+	}
+	body := parseBlockStmt(p)
+	return &ast.FunctionExpr{
+		Span:       p.spanFrom(start),
+		Params:     params,
+		ReturnType: returnType,
+		Body:       body,
+	}
+}
+
+func parseMatchExpr(p *parser) ast.Expr {
+	start := p.advance().Span.Start // MATCH token
+	// the "{" after the value starts the arms, not a struct literal
+	value := p.structLiterals(false, func() *ast.Expr { return parseExpr(p, defaultBp) })
+	if value == nil {
+		p.fail(diagnostics.ExpectedExpression, p.currentToken().Span, "Expected a value after \"match\"")
+	}
+	p.expect(lexer.OPEN_CURLY)
+	p.skipNewlines()
+
+	arms := make([]ast.MatchArm, 0)
+	for p.currentTokenKind() != lexer.CLOSE_CURLY {
+		pattern := parsePattern(p)
+		p.expectError(lexer.FAT_ARROW, "Expected \"=>\" after a pattern")
+		body := p.structLiterals(true, func() *ast.Expr { return parseExpr(p, defaultBp) })
+		if body == nil {
+			p.fail(diagnostics.ExpectedExpression, p.currentToken().Span, "Expected an expression after \"=>\"")
+		}
+		arms = append(arms, ast.MatchArm{
+			Span:    source.Join(pattern.Location(), (*body).Location()),
+			Pattern: pattern,
+			Body:    *body,
+		})
+		// arms are separated by commas, newlines or both
+		separated := p.currentTokenKind() == lexer.NEWLINE
+		p.skipNewlines()
+		if p.currentTokenKind() == lexer.COMMA {
+			separated = true
+			p.advance()
+			p.skipNewlines()
+		}
+		if !separated {
+			break
+		}
+	}
+	p.expect(lexer.CLOSE_CURLY)
+
+	return &ast.MatchExpr{
+		Span:  p.spanFrom(start),
+		Value: *value,
+		Arms:  arms,
+	}
+}
+
+// parsePattern parses the pattern of a match arm: _, a literal like 1, -1 or
+// true, or an enum variant like Shape::Rect(w, h).
+func parsePattern(p *parser) ast.Pattern {
+	token := p.currentToken()
+	switch token.Kind {
+	case lexer.IDENTIFIER:
+		if token.Value == "_" {
+			p.advance()
+			return &ast.WildcardPattern{Span: token.Span}
+		}
+		return parseVariantPattern(p)
+	case lexer.INTEGER, lexer.FLOAT, lexer.TRUE, lexer.FALSE:
+		value := parsePrimaryExpr(p)
+		return &ast.LiteralPattern{Span: value.Location(), Value: value}
+	case lexer.DASH:
+		p.advance()
+		if kind := p.currentTokenKind(); kind != lexer.INTEGER && kind != lexer.FLOAT {
+			p.fail(diagnostics.UnexpectedToken, p.currentToken().Span, "Expected a number after \"-\" in a pattern")
+		}
+		literal := parsePrimaryExpr(p)
+		value := &ast.PrefixExpr{
+			Span:     source.Join(token.Span, literal.Location()),
+			Operator: token,
+			Right:    literal,
+		}
+		return &ast.LiteralPattern{Span: value.Span, Value: value}
+	default:
+		p.fail(diagnostics.UnexpectedToken, token.Span, "Expected a pattern but received \"%s\" instead", lexer.TokenKindString(token.Kind))
+		return nil
+	}
+}
+
+func parseVariantPattern(p *parser) ast.Pattern {
+	first := p.advance()
+	var variant ast.Expr = &ast.SymbolExpr{Span: first.Span, Value: first.Value}
+	for p.currentTokenKind() == lexer.DOUBLE_COLON {
+		p.advance()
+		member := p.expect(lexer.IDENTIFIER)
+		variant = &ast.MemberExpr{
+			Span:       source.Join(variant.Location(), member.Span),
+			Container:  variant,
+			Member:     member.Value,
+			MemberSpan: member.Span,
+		}
+	}
+
+	pattern := &ast.VariantPattern{Variant: variant, Bindings: make([]ast.PatternBinding, 0)}
+	if p.currentTokenKind() == lexer.OPEN_PAREN {
+		pattern.Parens = true
+		p.advance()
+		for p.currentTokenKind() != lexer.CLOSE_PAREN {
+			name := p.expectError(lexer.IDENTIFIER, "Expected a name to bind in the pattern")
+			pattern.Bindings = append(pattern.Bindings, ast.PatternBinding{Span: name.Span, Name: name.Value})
+			if p.currentTokenKind() != lexer.COMMA {
+				break
+			}
+			p.advance()
+		}
+		p.expect(lexer.CLOSE_PAREN)
+	}
+	pattern.Span = p.spanFrom(first.Span.Start)
+	return pattern
+}
+
+func parseBlockExpr(p *parser) ast.Expr {
+	start := p.currentToken().Span.Start
+	var body []ast.Stmt
+	// struct literals are allowed again inside a block, even after a condition
+	p.structLiterals(true, func() *ast.Expr {
+		body = parseBlockStmt(p)
+		return nil
+	})
+	return &ast.BlockExpr{
+		Span: p.spanFrom(start),
+		Body: body,
+	}
+}
+
+// parseIfExpr parses an if with an optional else, which may start on the line
+// after the closing brace of the block before it.
+func parseIfExpr(p *parser) ast.Expr {
+	start := p.advance().Span.Start // IF token
+	// the "{" after the condition starts the block, not a struct literal
+	condition := p.structLiterals(false, func() *ast.Expr { return parseExpr(p, defaultBp) })
+	if condition == nil {
+		p.fail(diagnostics.ExpectedExpression, p.currentToken().Span, "Expected a condition after \"if\"")
+	}
+	if p.currentTokenKind() != lexer.OPEN_CURLY {
+		p.fail(diagnostics.UnexpectedToken, p.currentToken().Span, "Expected \"{\" after the condition of an if")
+	}
+	then := parseBlockExpr(p).(*ast.BlockExpr)
+
+	var otherwise ast.Expr
+	end := p.pos
+	p.skipNewlines()
+	switch {
+	case p.currentTokenKind() != lexer.ELSE:
+		p.pos = end
+	case p.peek().Kind == lexer.IF:
+		p.advance()
+		otherwise = parseIfExpr(p)
+	default:
+		p.advance()
+		if p.currentTokenKind() != lexer.OPEN_CURLY {
+			p.fail(diagnostics.UnexpectedToken, p.currentToken().Span, "Expected \"{\" or \"if\" after \"else\"")
+		}
+		otherwise = parseBlockExpr(p)
+	}
+
+	return &ast.IfExpr{
+		Span:      p.spanFrom(start),
+		Condition: *condition,
+		Then:      then,
+		Else:      otherwise,
 	}
 }
@@ -1,10 +1,10 @@
 package parser
 
 import (
-	"fmt"
-
 	"github.com/LaH-DeV/veles/ast"
+	"github.com/LaH-DeV/veles/diagnostics"
 	"github.com/LaH-DeV/veles/lexer"
+	"github.com/LaH-DeV/veles/source"
 )
 
 type stmtHandler func(p *parser) ast.Stmt
@@ -12,21 +12,61 @@ type nudHandler func(p *parser) ast.Expr
 type ledHandler func(p *parser, left ast.Expr, bp bindingPower) ast.Expr
 type bindingPower int
 
+// The precedence levels of the operators, from the loosest to the tightest.
+// Operators are left-associative unless they are registered with ledRight.
+//
+//	=                      assignment       right
+//	||                     logicalOr
+//	&&                     logicalAnd
+//	== != < <= > >=        comparison
+//	|                      bitwiseOr
+//	^                      bitwiseXor
+//	&                      bitwiseAnd
+//	<< >> >>>              shift
+//	+ -                    additive
+//	* / %                  multiplicative
+//	- ! ~ (prefix)         unary
+//	**                     exponentiation   right
+//	() ::                  call, member
+//
+// Exponentiation binds tighter than a prefix operator on its left, so -2 ** 2
+// is -(2 ** 2), and bitwise operators bind tighter than comparisons, so
+// x & mask == 0 is (x & mask) == 0.
 const (
 	defaultBp bindingPower = iota
 	comma
 	assignment
-	logical
-	relational
+	logicalOr
+	logicalAnd
+	comparison
+	bitwiseOr
+	bitwiseXor
+	bitwiseAnd
+	shift
 	additive
 	multiplicative
-	exponentiation
+	cast
 	unary
+	exponentiation
 	call
 	member
 	primary
 )
 
+// parseError aborts the statement currently being parsed. It is raised with
+// panic and recovered in parseStmtRecover, which records it as a diagnostic.
+type parseError struct {
+	diagnostic diagnostics.Diagnostic
+}
+
+func (p *parser) fail(code *diagnostics.Code, span source.Span, format string, args ...any) {
+	panic(parseError{diagnostics.Errorf(code, span, format, args...)})
+}
+
+func (p *parser) report(diagnostic diagnostics.Diagnostic) {
+	p.Diagnostics = append(p.Diagnostics, diagnostic)
+}
+
 func (p *parser) hasTokens() bool {
 	return p.pos < len(p.tokens) && p.currentTokenKind() != lexer.EOF
 }
@@ -37,10 +77,20 @@ func (p *parser) currentToken() lexer.Token {
 
 func (p *parser) advance() lexer.Token {
 	tk := p.currentToken()
-	p.pos++
+	if tk.Kind != lexer.EOF {
+		p.pos++
+	}
 	return tk
 }
 
+// spanFrom returns the span starting at start and ending with the last consumed token.
+func (p *parser) spanFrom(start source.Position) source.Span {
+	if p.pos == 0 {
+		return source.Span{Start: start, End: start}
+	}
+	return source.Span{Start: start, End: p.tokens[p.pos-1].Span.End}
+}
+
 func (p *parser) skipNewlines() {
 	for p.currentTokenKind() == lexer.NEWLINE {
 		p.advance()
@@ -48,6 +98,9 @@ func (p *parser) skipNewlines() {
 }
 
 func (p *parser) lookupBp(tokenKind lexer.TokenKind) bindingPower {
+	if tokenKind == lexer.OPEN_CURLY && p.noStructLiterals {
+		return defaultBp
+	}
 	bp, exists := (*p.bpLookup)[tokenKind]
 	if !exists {
 		return defaultBp
@@ -55,39 +108,71 @@ func (p *parser) lookupBp(tokenKind lexer.TokenKind) bindingPower {
 	return bp
 }
 
+// structLiterals runs parse with struct literals allowed or not. They are not
+// allowed where a block follows the expression, like in the condition of an
+// if statement, unless they are nested in parentheses.
+func (p *parser) structLiterals(allowed bool, parse func() *ast.Expr) *ast.Expr {
+	outer := p.noStructLiterals
+	p.noStructLiterals = !allowed
+	defer func() { p.noStructLiterals = outer }()
+	return parse()
+}
+
+// rightBp is the binding power the right operand of an infix operator is
+// parsed with. Right-associative operators use a lower one, so that an operator
+// of the same level continues the right operand: a ** b ** c is a ** (b ** c).
+func (p *parser) rightBp(tokenKind lexer.TokenKind) bindingPower {
+	bp := p.lookupBp(tokenKind)
+	if (*p.rightAssoc)[tokenKind] {
+		return bp - 1
+	}
+	return bp
+}
+
 func (p *parser) currentTokenKind() lexer.TokenKind {
 	return p.tokens[p.pos].Kind
 }
 
 func (p *parser) peek() lexer.Token {
-	return p.tokens[p.pos+1]
+	return p.peekN(1)
 }
 
-func (p *parser) expectError(expectedKind lexer.TokenKind, err any) lexer.Token {
+// peekN returns the token n positions after the current one.
+func (p *parser) peekN(n int) lexer.Token {
+	if p.pos+n >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.pos+n]
+}
+
+func (p *parser) expectError(expectedKind lexer.TokenKind, message string) lexer.Token {
 	kind := p.currentTokenKind()
 
 	if kind != expectedKind {
-		if err == nil {
-			err = fmt.Sprintf("Veles :: parser: Expected \"%s\" but received \"%s\" instead\n", lexer.TokenKindString(expectedKind), lexer.TokenKindString(kind))
+		if message == "" {
+			p.fail(diagnostics.UnexpectedToken, p.currentToken().Span, "Expected \"%s\" but received \"%s\" instead", lexer.TokenKindString(expectedKind), lexer.TokenKindString(kind))
 		}
-		panic(err)
+		p.fail(diagnostics.UnexpectedToken, p.currentToken().Span, "%s", message)
 	}
 
 	return p.advance()
 }
 
 func (p *parser) expect(expectedKind lexer.TokenKind) lexer.Token {
-	return p.expectError(expectedKind, nil)
+	return p.expectError(expectedKind, "")
 }
 
 func (p *parser) expectOneOf(expectedKind ...lexer.TokenKind) lexer.Token {
 	currentTokenKind := p.currentTokenKind()
 	if !p.currentToken().IsOneOfMany(expectedKind...) {
 		var expectedKindsString string
-		for _, kind := range expectedKind {
-			expectedKindsString += lexer.TokenKindString(kind) + ", "
+		for i, kind := range expectedKind {
+			if i > 0 {
+				expectedKindsString += ", "
+			}
+			expectedKindsString += lexer.TokenKindString(kind)
 		}
-		panic(fmt.Sprintf("Expected one of: \"%s\" but recieved \"%s\" instead\n", expectedKindsString, lexer.TokenKindString(currentTokenKind)))
+		p.fail(diagnostics.UnexpectedToken, p.currentToken().Span, "Expected one of: \"%s\" but received \"%s\" instead", expectedKindsString, lexer.TokenKindString(currentTokenKind))
 	}
 	return p.advance()
 }
@@ -97,8 +182,20 @@ func (p *parser) led(kind lexer.TokenKind, bp bindingPower, handler ledHandler)
 	(*p.ledLookup)[kind] = handler
 }
 
+// ledRight registers a right-associative infix operator.
+func (p *parser) ledRight(kind lexer.TokenKind, bp bindingPower, handler ledHandler) {
+	p.led(kind, bp, handler)
+	(*p.rightAssoc)[kind] = true
+}
+
+// nud registers a prefix handler. Tokens that only start expressions get the
+// primary binding power, so that a value directly following another value is
+// reported instead of silently ending the expression; the binding power of
+// tokens that are also infix operators, like "-", is left alone.
 func (p *parser) nud(kind lexer.TokenKind, handler nudHandler) {
-	(*p.bpLookup)[kind] = primary
+	if _, infix := (*p.ledLookup)[kind]; !infix {
+		(*p.bpLookup)[kind] = primary
+	}
 	(*p.nudLookup)[kind] = handler
 }
 
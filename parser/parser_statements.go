@@ -1,8 +1,13 @@
 package parser
 
 import (
+	"strconv"
+	"strings"
+
 	"github.com/LaH-DeV/veles/ast"
+	"github.com/LaH-DeV/veles/diagnostics"
 	"github.com/LaH-DeV/veles/lexer"
+	"github.com/LaH-DeV/veles/source"
 )
 
 func parseStmt(p *parser) ast.Stmt {
@@ -19,7 +24,47 @@ func parseStmt(p *parser) ast.Stmt {
 	return parseExpressionStmt(p)
 }
 
-func parseExpressionStmt(p *parser) *ast.ExpressionStmt {
+// parseStmtRecover parses a single statement. When the statement is malformed the
+// error is recorded as a diagnostic and the parser skips ahead to the next line,
+// so that the rest of the file can still be parsed.
+func parseStmtRecover(p *parser) (stmt ast.Stmt) {
+	start := p.pos
+
+	defer func() {
+		if r := recover(); r != nil {
+			err, ok := r.(parseError)
+			if !ok {
+				panic(r)
+			}
+			p.report(err.diagnostic)
+			p.synchronize()
+			stmt = nil
+		}
+	}()
+
+	stmt = parseStmt(p)
+
+	// a statement that consumed nothing would leave the parser stuck on the same token
+	if stmt == nil && p.pos == start && p.hasTokens() && !(p.currentTokenKind() == lexer.CLOSE_CURLY && p.depth > 0) {
+		p.fail(diagnostics.UnexpectedToken, p.currentToken().Span, "Unexpected \"%s\"", lexer.TokenKindString(p.currentTokenKind()))
+	}
+
+	return stmt
+}
+
+// synchronize skips tokens until the end of the current line, stopping before a
+// closing curly brace of the enclosing block.
+func (p *parser) synchronize() {
+	for p.hasTokens() && p.currentTokenKind() != lexer.NEWLINE {
+		if p.currentTokenKind() == lexer.CLOSE_CURLY && p.depth > 0 {
+			return
+		}
+		p.advance()
+	}
+	p.skipNewlines()
+}
+
+func parseExpressionStmt(p *parser) ast.Stmt {
 	expression := parseExpr(p, defaultBp)
 
 	p.skipNewlines()
@@ -29,6 +74,7 @@ func parseExpressionStmt(p *parser) *ast.ExpressionStmt {
 	}
 
 	return &ast.ExpressionStmt{
+		Span:       (*expression).Location(),
 		Expression: *expression,
 	}
 }
@@ -39,11 +85,14 @@ func parseFunctionParameters(p *parser) []ast.FunctionParameter {
 	var parameters []ast.FunctionParameter = make([]ast.FunctionParameter, 0)
 
 	for p.currentTokenKind() != lexer.CLOSE_PAREN {
+		start := p.currentToken().Span.Start
 		paramType := parseType(p).Value
-		paramName := p.expect(lexer.IDENTIFIER).Value
+		name := p.expect(lexer.IDENTIFIER)
 		parameters = append(parameters, ast.FunctionParameter{
-			ParamName: paramName,
+			Span:      p.spanFrom(start),
+			ParamName: name.Value,
 			ParamType: paramType,
+			NameSpan:  name.Span,
 		})
 		if p.currentTokenKind() == lexer.COMMA {
 			p.advance()
@@ -57,12 +106,14 @@ func parseFunctionParameters(p *parser) []ast.FunctionParameter {
 
 func parseBlockStmt(p *parser) []ast.Stmt {
 	p.expect(lexer.OPEN_CURLY)
+	p.depth++
+	defer func() { p.depth-- }()
 
 	var statements []ast.Stmt = make([]ast.Stmt, 0)
 
-	for p.currentTokenKind() != lexer.CLOSE_CURLY {
+	for p.currentTokenKind() != lexer.CLOSE_CURLY && p.currentTokenKind() != lexer.EOF {
 		p.skipNewlines()
-		stmt := parseStmt(p)
+		stmt := parseStmtRecover(p)
 		if stmt != nil {
 			statements = append(statements, stmt)
 		}
@@ -73,18 +124,73 @@ func parseBlockStmt(p *parser) []ast.Stmt {
 	return statements
 }
 
+// parseType parses a type name, which may be qualified with a module path like
+// geo::Vec2. The name of a function follows its return type after "::", so a
+// segment is only part of the type when it is not followed by "(", "{" or the
+// end of the line: in "fn Vec2 :: origin() {", origin is the function name.
+//
+// Array types are written [4]i32 and slice types []i32. The length of an
+// array is normalized to decimal, so that [0x4]i32 names the same type.
+// Function types are written fn(i32, i32) -> i32, or fn(i32) without a result.
 func parseType(p *parser) lexer.Token {
-	return p.expectOneOf(lexer.INT_32, lexer.INT_64, lexer.FLOAT_32, lexer.FLOAT_64, lexer.IDENTIFIER, lexer.BOOL)
+	if p.currentTokenKind() == lexer.FN {
+		start := p.advance()
+		p.expect(lexer.OPEN_PAREN)
+		params := make([]string, 0)
+		for p.currentTokenKind() != lexer.CLOSE_PAREN {
+			params = append(params, parseType(p).Value)
+			if p.currentTokenKind() != lexer.COMMA {
+				break
+			}
+			p.advance()
+		}
+		end := p.expect(lexer.CLOSE_PAREN).Span
+		value := "fn(" + strings.Join(params, ", ") + ")"
+		if p.currentTokenKind() == lexer.ARROW {
+			p.advance()
+			result := parseType(p)
+			value += " -> " + result.Value
+			end = result.Span
+		}
+		return lexer.Token{Kind: lexer.IDENTIFIER, Value: value, Span: source.Join(start.Span, end)}
+	}
+	if p.currentTokenKind() == lexer.OPEN_BRACKET {
+		open := p.advance()
+		length := ""
+		if p.currentTokenKind() != lexer.CLOSE_BRACKET {
+			token := p.expectError(lexer.INTEGER, "Expected an array length or \"]\" after \"[\"")
+			number, _ := lexer.ParseNumber(token.Value)
+			length = strconv.FormatUint(number.Int, 10)
+		}
+		p.expect(lexer.CLOSE_BRACKET)
+		elem := parseType(p)
+		return lexer.Token{
+			Kind:  lexer.IDENTIFIER,
+			Value: "[" + length + "]" + elem.Value,
+			Span:  source.Join(open.Span, elem.Span),
+		}
+	}
+	token := p.expectOneOf(lexer.INT_8, lexer.INT_16, lexer.INT_32, lexer.INT_64, lexer.UINT_8, lexer.UINT_16, lexer.UINT_32, lexer.UINT_64, lexer.FLOAT_32, lexer.FLOAT_64, lexer.IDENTIFIER, lexer.BOOL, lexer.STR)
+	if token.Kind != lexer.IDENTIFIER {
+		return token
+	}
+	for p.currentTokenKind() == lexer.DOUBLE_COLON && p.peek().Kind == lexer.IDENTIFIER {
+		switch p.peekN(2).Kind {
+		case lexer.OPEN_PAREN, lexer.OPEN_CURLY, lexer.NEWLINE, lexer.EOF:
+			return token
+		}
+		p.advance()
+		segment := p.advance()
+		token.Value += "::" + segment.Value
+		token.Span = source.Join(token.Span, segment.Span)
+	}
+	return token
 }
 
 func parseFunctionDeclaration(p *parser) ast.Stmt {
 	initialToken := p.advance()
 	var pub bool = false
-	var extern bool = false
-	if initialToken.Kind == lexer.EXTERN {
-		extern = true
-		p.advance() // Skip the FN token
-	} else if initialToken.Kind == lexer.PUB {
+	if initialToken.Kind == lexer.PUB {
 		pub = true
 		p.advance() // Skip the FN token
 	}
@@ -95,7 +201,7 @@ func parseFunctionDeclaration(p *parser) ast.Stmt {
 	}
 	p.expect(lexer.DOUBLE_COLON)
 
-	functionName := p.expectError(lexer.IDENTIFIER, "Expected an identifier for function declaration").Value
+	functionName := p.expectError(lexer.IDENTIFIER, "Expected an identifier for function declaration")
 
 	var parameters []ast.FunctionParameter
 	if p.currentTokenKind() == lexer.OPEN_PAREN {
@@ -105,9 +211,10 @@ func parseFunctionDeclaration(p *parser) ast.Stmt {
 	}
 
 	return &ast.FunctionDeclaration{
-		Extern:     extern,
+		Span:       p.spanFrom(initialToken.Span.Start),
 		Exported:   pub,
-		Identifier: functionName,
+		Identifier: functionName.Value,
+		NameSpan:   functionName.Span,
 		Params:     parameters,
 		ReturnType: returnType,
 	}
@@ -123,8 +230,10 @@ func parseFunctionStmt(p *parser) ast.Stmt {
 
 	body := parseBlockStmt(p)
 	return &ast.FunctionStmt{
+		Span:       p.spanFrom(fn.Span.Start),
 		Exported:   fn.Exported,
 		Identifier: fn.Identifier,
+		NameSpan:   fn.NameSpan,
 		Params:     fn.Params,
 		ReturnType: fn.ReturnType,
 		Body:       body,
@@ -133,6 +242,7 @@ func parseFunctionStmt(p *parser) ast.Stmt {
 
 func parseVariableDeclarationStmt(p *parser) ast.Stmt {
 	var pub bool = false
+	start := p.currentToken().Span.Start
 
 	if p.currentTokenKind() == lexer.PUB {
 		pub = true
@@ -141,37 +251,49 @@ func parseVariableDeclarationStmt(p *parser) ast.Stmt {
 	} else {
 		p.advance() // LET token
 	}
+	mutable := false
+	if p.currentTokenKind() == lexer.MUT {
+		mutable = true
+		p.advance()
+	}
 
-	varType := parseType(p).Value
-	varName := p.expect(lexer.IDENTIFIER).Value
+	// without a type, like "let x = 5", the type is inferred from the
+	// initializer; a struct type is an identifier followed by the name
+	varType := ""
+	if p.currentTokenKind() != lexer.IDENTIFIER || p.peek().Kind == lexer.IDENTIFIER || p.peek().Kind == lexer.DOUBLE_COLON {
+		varType = parseType(p).Value
+	}
+	varName := p.expect(lexer.IDENTIFIER)
+	if varType == "" && p.currentTokenKind() != lexer.ASSIGNMENT {
+		p.report(diagnostics.Errorf(diagnostics.ExpectedExpression, varName.Span, "variable %s needs a type or an initializer", varName.Value).
+			WithNote("write the type before the name, like \"let i32 %s\", or initialize it, like \"let %s = 0\"", varName.Value, varName.Value))
+	}
 
 	var expr ast.Expr = nil
 	if p.currentTokenKind() == lexer.ASSIGNMENT {
-		p.advance()
+		assignment := p.advance()
 		res := parseExpr(p, defaultBp)
-		if res != nil {
-			expr = *res
-		}
-	}
-
-	// TODO.
-	if expr == nil {
-		expr = &ast.IntegerExpr{
-			Value: 0,
+		if res == nil {
+			p.fail(diagnostics.ExpectedExpression, assignment.Span, "Expected an expression after \"=\"")
 		}
+		expr = *res
 	}
+	span := p.spanFrom(start)
 	p.skipNewlines()
 
 	return &ast.VariableDeclarationStmt{
+		Span:     span,
 		Exported: pub, // should be allowed only for unscoped variables
+		Mutable:  mutable,
 		VarType:  varType,
-		VarName:  varName,
+		VarName:  varName.Value,
+		NameSpan: varName.Span,
 		Value:    expr,
 	}
 }
 
 func parseReturnStmt(p *parser) ast.Stmt {
-	p.advance()
+	start := p.advance().Span.Start
 
 	var expr ast.Expr = nil
 	if p.currentTokenKind() != lexer.NEWLINE {
@@ -183,23 +305,26 @@ func parseReturnStmt(p *parser) ast.Stmt {
 		}
 	}
 	return &ast.ReturnStmt{
+		Span:  p.spanFrom(start),
 		Value: expr,
 	}
 }
 
 func parseUseStmt(p *parser) ast.Stmt {
-	p.advance() // Skip the USE token
+	start := p.advance().Span.Start // Skip the USE token
 
-	moduleName := p.expect(lexer.IDENTIFIER).Value
-	var alias string
+	module := p.expect(lexer.IDENTIFIER)
+	var alias lexer.Token
 
 	var segments []string = make([]string, 0)
+	var segmentSpans = make([]source.Span, 0)
 
 	if p.currentTokenKind() == lexer.DOUBLE_COLON {
 		p.advance()
 		for p.currentTokenKind() != lexer.NEWLINE && p.currentTokenKind() != lexer.CLOSE_PAREN {
-			ident := p.expect(lexer.IDENTIFIER).Value
-			segments = append(segments, ident)
+			ident := p.expect(lexer.IDENTIFIER)
+			segments = append(segments, ident.Value)
+			segmentSpans = append(segmentSpans, ident.Span)
 			if p.currentTokenKind() != lexer.DOUBLE_COLON {
 				break
 			}
@@ -209,15 +334,20 @@ func parseUseStmt(p *parser) ast.Stmt {
 
 	if p.currentTokenKind() == lexer.AS {
 		p.advance()
-		alias = p.expect(lexer.IDENTIFIER).Value
+		alias = p.expect(lexer.IDENTIFIER)
 	}
+	span := p.spanFrom(start)
 
 	p.skipNewlines()
 
 	return &ast.UseStmt{
-		Module:   moduleName,
-		Alias:    alias,
-		Segments: segments,
+		Span:         span,
+		Module:       module.Value,
+		Alias:        alias.Value,
+		Segments:     segments,
+		ModuleSpan:   module.Span,
+		AliasSpan:    alias.Span,
+		SegmentSpans: segmentSpans,
 	}
 }
 
@@ -227,43 +357,139 @@ func parsePublicStmt(p *parser) ast.Stmt {
 		return parseFunctionStmt(p)
 	case lexer.LET:
 		return parseVariableDeclarationStmt(p)
+	case lexer.STRUCT:
+		return parseStructStmt(p)
+	case lexer.ENUM:
+		return parseEnumStmt(p)
 	default:
-		p.advance()
-		// TODO: report error
+		p.fail(diagnostics.MisplacedModifier, p.currentToken().Span, "Expected \"fn\", \"let\", \"struct\" or \"enum\" after \"pub\"")
 		return nil
 	}
 }
 
-func parseExternStmt(p *parser) ast.Stmt {
-	switch p.peek().Kind {
-	case lexer.FN:
-		fn := parseFunctionDeclaration(p)
-		return &ast.ExternStmt{
-			Statement: fn,
+func parseStructStmt(p *parser) ast.Stmt {
+	start := p.currentToken().Span.Start
+	pub := false
+	if p.currentTokenKind() == lexer.PUB {
+		pub = true
+		p.advance() // PUB token
+	}
+	p.advance() // STRUCT token
+
+	name := p.expectError(lexer.IDENTIFIER, "Expected an identifier for struct declaration")
+	p.expect(lexer.OPEN_CURLY)
+	p.skipNewlines()
+
+	fields := make([]ast.StructField, 0)
+	for p.currentTokenKind() != lexer.CLOSE_CURLY {
+		fieldStart := p.currentToken().Span.Start
+		fieldType := parseType(p).Value
+		fieldName := p.expect(lexer.IDENTIFIER)
+		fields = append(fields, ast.StructField{
+			Span:      p.spanFrom(fieldStart),
+			FieldType: fieldType,
+			FieldName: fieldName.Value,
+			NameSpan:  fieldName.Span,
+		})
+		p.skipNewlines()
+		if p.currentTokenKind() != lexer.COMMA {
+			break
 		}
-	default:
 		p.advance()
-		// TODO: report error
-		return nil
+		p.skipNewlines()
+	}
+	p.expect(lexer.CLOSE_CURLY)
+	span := p.spanFrom(start)
+	p.skipNewlines()
+
+	return &ast.StructStmt{
+		Span:       span,
+		Exported:   pub,
+		Identifier: name.Value,
+		NameSpan:   name.Span,
+		Fields:     fields,
 	}
 }
 
-func parseIfStmt(p *parser) ast.Stmt {
-	p.advance() // IF token
+func parseEnumStmt(p *parser) ast.Stmt {
+	start := p.currentToken().Span.Start
+	pub := false
+	if p.currentTokenKind() == lexer.PUB {
+		pub = true
+		p.advance() // PUB token
+	}
+	p.advance() // ENUM token
 
-	var expr ast.Expr = nil
-	res := parseExpr(p, defaultBp)
-	if res == nil {
-		return nil
-	} else {
-		expr = *res
+	name := p.expectError(lexer.IDENTIFIER, "Expected an identifier for enum declaration")
+	p.expect(lexer.OPEN_CURLY)
+	p.skipNewlines()
+
+	variants := make([]ast.EnumVariant, 0)
+	for p.currentTokenKind() != lexer.CLOSE_CURLY {
+		variantStart := p.currentToken().Span.Start
+		variantName := p.expectError(lexer.IDENTIFIER, "Expected the name of an enum variant")
+		variant := ast.EnumVariant{
+			Name:       variantName.Value,
+			NameSpan:   variantName.Span,
+			Fields:     make([]string, 0),
+			FieldSpans: make([]source.Span, 0),
+		}
+		if p.currentTokenKind() == lexer.OPEN_PAREN {
+			p.advance()
+			for p.currentTokenKind() != lexer.CLOSE_PAREN {
+				fieldType := parseType(p)
+				variant.Fields = append(variant.Fields, fieldType.Value)
+				variant.FieldSpans = append(variant.FieldSpans, fieldType.Span)
+				if p.currentTokenKind() != lexer.COMMA {
+					break
+				}
+				p.advance()
+			}
+			p.expect(lexer.CLOSE_PAREN)
+		}
+		variant.Span = p.spanFrom(variantStart)
+		variants = append(variants, variant)
+		p.skipNewlines()
+		if p.currentTokenKind() != lexer.COMMA {
+			break
+		}
+		p.advance()
+		p.skipNewlines()
 	}
+	p.expect(lexer.CLOSE_CURLY)
+	span := p.spanFrom(start)
+	p.skipNewlines()
 
-	then := parseBlockStmt(p)
+	return &ast.EnumStmt{
+		Span:       span,
+		Exported:   pub,
+		Identifier: name.Value,
+		NameSpan:   name.Span,
+		Variants:   variants,
+	}
+}
 
-	return &ast.IfStmt{
-		Condition: expr,
-		Then:      then,
-		// TODO ELSE
+func parseExternStmt(p *parser) ast.Stmt {
+	initialToken := p.advance()
+	stmt := &ast.ExternStmt{}
+	// invalid escapes in the import names were reported by the lexer
+	if p.currentTokenKind() == lexer.STRING {
+		module := p.advance()
+		stmt.Module, _ = lexer.Unquote(module.Value)
+		stmt.ModuleSpan = module.Span
+		if p.currentTokenKind() == lexer.STRING {
+			field := p.advance()
+			stmt.Field, _ = lexer.Unquote(field.Value)
+			stmt.FieldSpan = field.Span
+		}
+	}
+	if p.currentTokenKind() != lexer.FN {
+		p.fail(diagnostics.MisplacedModifier, p.currentToken().Span, "Expected \"fn\" after \"extern\"")
+		return nil
 	}
+	fn := parseFunctionDeclaration(p).(*ast.FunctionDeclaration)
+	fn.Extern = true
+	fn.Span = p.spanFrom(initialToken.Span.Start)
+	stmt.Span, stmt.Statement = fn.Span, fn
+	return stmt
 }
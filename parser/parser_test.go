@@ -0,0 +1,161 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/LaH-DeV/veles/ast"
+	"github.com/LaH-DeV/veles/diagnostics"
+	"github.com/LaH-DeV/veles/lexer"
+)
+
+// parse parses a Veles source, failing the test on lexer errors.
+func parse(t *testing.T, src string) (*ast.Program, []diagnostics.Diagnostic) {
+	t.Helper()
+	lex := lexer.NewLexer(lexer.Vs)
+	tokens := lex.Tokenize(src)
+	if diagnostics.HasErrors(lex.Diagnostics) {
+		t.Fatalf("lexer errors in %q: %s", src, lex.Diagnostics[0].Message)
+	}
+	par := NewParser(lexer.Vs)
+	return par.ParseFile(tokens, "test.vs"), par.Diagnostics
+}
+
+// parseValid parses a source that must not have errors.
+func parseValid(t *testing.T, src string) *ast.Program {
+	t.Helper()
+	program, diags := parse(t, src)
+	if len(diags) > 0 {
+		t.Fatalf("errors in %q: %s", src, diags[0].Message)
+	}
+	return program
+}
+
+func TestVariableDeclaration(t *testing.T) {
+	tests := []struct {
+		src     string
+		varType string
+		value   string // "" without an initializer
+	}{
+		{"let x = 5", "", "5"},
+		{"let mut i32 total", "i32", ""},
+		{"let i32 x = 1 + 2", "i32", "(1 + 2)"},
+		{"let geo::Vec2 origin", "geo::Vec2", ""},
+		{"pub let [4]u8 bytes", "[4]u8", ""},
+	}
+	for _, test := range tests {
+		program := parseValid(t, test.src)
+		decl, ok := program.Statements[0].(*ast.VariableDeclarationStmt)
+		if !ok {
+			t.Errorf("%q: got %T", test.src, program.Statements[0])
+			continue
+		}
+		value := ""
+		if decl.Value != nil {
+			value = decl.Value.String()
+		}
+		if decl.VarType != test.varType || value != test.value {
+			t.Errorf("%q: got type %q and value %q, want %q and %q", test.src, decl.VarType, value, test.varType, test.value)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src     string
+		code    *diagnostics.Code
+		message string
+	}{
+		{"()", diagnostics.ExpectedExpression, `Expected an expression between "(" and ")"`},
+		{"-()", diagnostics.ExpectedExpression, `Expected an expression between "(" and ")"`},
+		{"fn :: f() {\n    return -()\n}", diagnostics.ExpectedExpression, `Expected an expression between "(" and ")"`},
+		{"let x", diagnostics.ExpectedExpression, "variable x needs a type or an initializer"},
+		{"let x =", diagnostics.ExpectedExpression, `Expected an expression after "="`},
+		{"let x = let i32 y = 2", diagnostics.ExpectedExpression, `Expected an expression after "="`},
+		{"fn :: f() {\n    let x =\n}", diagnostics.ExpectedExpression, `Expected an expression after "="`},
+		{"let i32 x =", diagnostics.ExpectedExpression, `Expected an expression after "="`},
+		{"let i32 x = ()", diagnostics.ExpectedExpression, `Expected an expression between "(" and ")"`},
+	}
+	for _, test := range tests {
+		_, diags := parse(t, test.src)
+		if len(diags) == 0 {
+			t.Errorf("%q: no error, want %s", test.src, test.message)
+			continue
+		}
+		if diags[0].Code != test.code || diags[0].Message != test.message {
+			t.Errorf("%q: got %s %q, want %s %q", test.src, diags[0].Code.ID, diags[0].Message, test.code.ID, test.message)
+		}
+	}
+}
+
+func TestExternStmt(t *testing.T) {
+	tests := []struct {
+		src    string
+		module string
+		field  string
+	}{
+		{"extern fn :: log(i32 value)", "env", "log"},
+		{"extern \"console\" fn :: log(i32 value)", "console", "log"},
+		{"extern \"console\" \"log\" fn :: print(i32 value)", "console", "log"},
+		{"extern \"\" \"\" fn :: empty()", "", ""},
+	}
+	for _, test := range tests {
+		program := parseValid(t, test.src)
+		extern, ok := program.Statements[0].(*ast.ExternStmt)
+		if !ok {
+			t.Errorf("%q: got %T", test.src, program.Statements[0])
+			continue
+		}
+		if module, field := extern.Import(); module != test.module || field != test.field {
+			t.Errorf("%q: imports %q %q, want %q %q", test.src, module, field, test.module, test.field)
+		}
+		if decl := extern.Statement.(*ast.FunctionDeclaration); !decl.Extern || decl.Span != extern.Span {
+			t.Errorf("%q: declaration %+v", test.src, decl)
+		}
+		if extern.String() != test.src {
+			t.Errorf("%q: printed as %q", test.src, extern.String())
+		}
+	}
+
+	_, diags := parse(t, "extern \"env\" let i32 x = 1")
+	if len(diags) != 1 || diags[0].Code != diagnostics.MisplacedModifier {
+		t.Errorf("extern before let: got %v", diags)
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	// binary expressions are printed in parentheses, prefix operators and casts are not
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"a + b * c", "(a + (b * c))"},
+		{"a - b - c", "((a - b) - c)"},
+		{"a / b % c", "((a / b) % c)"},
+		{"a << b + c", "(a << (b + c))"},
+		{"a >> b >>> c", "((a >> b) >>> c)"},
+		{"a & b << c", "(a & (b << c))"},
+		{"a | b ^ c & d", "(a | (b ^ (c & d)))"},
+		{"x & mask == 0", "((x & mask) == 0)"},
+		{"a < b == c", "((a < b) == c)"},
+		{"a || b && c", "(a || (b && c))"},
+		{"a && b || c && d", "((a && b) || (c && d))"},
+		{"a == b || c | d != e", "((a == b) || ((c | d) != e))"},
+		{"-a * b", "(-a * b)"},
+		{"~a & b", "(~a & b)"},
+		{"!a && b", "(!a && b)"},
+		{"a ** b ** c", "(a ** (b ** c))"},
+		{"-2 ** 2", "-(2 ** 2)"},
+		{"a * b ** c", "(a * (b ** c))"},
+		{"a * b as f32", "(a * b as f32)"},
+		{"a = b = c + 1", "a = b = (c + 1)"},
+		{"a += b << 2", "a += (b << 2)"},
+		{"f(a, b)(c) + 1", "(f(a, b)(c) + 1)"},
+		{"(a + b) * c", "((a + b) * c)"},
+	}
+	for _, test := range tests {
+		program := parseValid(t, test.src)
+		if got := program.Statements[0].String(); got != test.want {
+			t.Errorf("%s: got %s, want %s", test.src, got, test.want)
+		}
+	}
+}
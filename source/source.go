@@ -0,0 +1,130 @@
+package source
+
+import "sort"
+
+// Position is a location inside a source file. Line and Column are 1-based,
+// Offset is the 0-based byte offset.
+type Position struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+// Span is the half-open range [Start, End) covered by a token or a node.
+type Span struct {
+	Start Position
+	End   Position
+}
+
+func (s Span) Location() Span {
+	return s
+}
+
+func (s Span) Contains(offset int) bool {
+	return s.Start.Offset <= offset && offset <= s.End.Offset
+}
+
+func (s Span) IsZero() bool {
+	return s.Start.Line == 0
+}
+
+// Join returns the smallest span covering both a and b.
+func Join(a, b Span) Span {
+	if a.IsZero() {
+		return b
+	}
+	if b.IsZero() {
+		return a
+	}
+	span := a
+	if b.Start.Offset < span.Start.Offset {
+		span.Start = b.Start
+	}
+	if b.End.Offset > span.End.Offset {
+		span.End = b.End
+	}
+	return span
+}
+
+// File holds the text of a source file together with its line table, so that
+// byte offsets can be translated into line/column positions and back.
+type File struct {
+	Name string
+	Text string
+
+	lines []int
+}
+
+func NewFile(name string, text string) *File {
+	lines := []int{0}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			lines = append(lines, i+1)
+		}
+	}
+	return &File{
+		Name:  name,
+		Text:  text,
+		lines: lines,
+	}
+}
+
+func (f *File) Position(offset int) Position {
+	if offset > len(f.Text) {
+		offset = len(f.Text)
+	}
+	line := sort.Search(len(f.lines), func(i int) bool { return f.lines[i] > offset }) - 1
+	return Position{
+		Offset: offset,
+		Line:   line + 1,
+		Column: offset - f.lines[line] + 1,
+	}
+}
+
+func (f *File) Span(start, end int) Span {
+	return Span{Start: f.Position(start), End: f.Position(end)}
+}
+
+// Offset converts a 1-based line and column back into a byte offset, clamping
+// values that point past the end of a line or of the file.
+func (f *File) Offset(line, column int) int {
+	if line < 1 {
+		return 0
+	}
+	if line > len(f.lines) {
+		return len(f.Text)
+	}
+	start := f.lines[line-1]
+	end := len(f.Text)
+	if line < len(f.lines) {
+		end = f.lines[line] - 1
+	}
+	offset := start + column - 1
+	if offset > end {
+		return end
+	}
+	if offset < start {
+		return start
+	}
+	return offset
+}
+
+func (f *File) LineCount() int {
+	return len(f.lines)
+}
+
+// Line returns the text of the given 1-based line without its line break.
+func (f *File) Line(line int) string {
+	if line < 1 || line > len(f.lines) {
+		return ""
+	}
+	start := f.lines[line-1]
+	end := len(f.Text)
+	if line < len(f.lines) {
+		end = f.lines[line] - 1
+	}
+	if end > start && f.Text[end-1] == '\r' {
+		end--
+	}
+	return f.Text[start:end]
+}
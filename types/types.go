@@ -0,0 +1,270 @@
+package types
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Type is the semantic type of a value, as opposed to the type names written in source.
+type Type interface {
+	String() string
+}
+
+type BasicKind int
+
+const (
+	InvalidKind BasicKind = iota
+	VoidKind
+	I8Kind
+	I16Kind
+	I32Kind
+	I64Kind
+	U8Kind
+	U16Kind
+	U32Kind
+	U64Kind
+	F32Kind
+	F64Kind
+	BoolKind
+	StrKind
+)
+
+type Basic struct {
+	Kind BasicKind
+	Name string
+}
+
+func (t *Basic) String() string {
+	return t.Name
+}
+
+var (
+	Invalid = &Basic{InvalidKind, "invalid"}
+	Void    = &Basic{VoidKind, "void"}
+	I8      = &Basic{I8Kind, "i8"}
+	I16     = &Basic{I16Kind, "i16"}
+	I32     = &Basic{I32Kind, "i32"}
+	I64     = &Basic{I64Kind, "i64"}
+	U8      = &Basic{U8Kind, "u8"}
+	U16     = &Basic{U16Kind, "u16"}
+	U32     = &Basic{U32Kind, "u32"}
+	U64     = &Basic{U64Kind, "u64"}
+	F32     = &Basic{F32Kind, "f32"}
+	F64     = &Basic{F64Kind, "f64"}
+	Bool    = &Basic{BoolKind, "bool"}
+	// Str is an immutable UTF-8 string, represented by a pointer into linear
+	// memory and a length in bytes.
+	Str = &Basic{StrKind, "str"}
+)
+
+var named = map[string]Type{
+	"i8":   I8,
+	"i16":  I16,
+	"i32":  I32,
+	"i64":  I64,
+	"u8":   U8,
+	"u16":  U16,
+	"u32":  U32,
+	"u64":  U64,
+	"f32":  F32,
+	"f64":  F64,
+	"bool": Bool,
+	"str":  Str,
+}
+
+// Lookup returns the type spelled by name, or nil when there is no such type.
+func Lookup(name string) Type {
+	return named[name]
+}
+
+// Signature is the type of a function.
+type Signature struct {
+	Params     []Type
+	ParamNames []string
+	Result     Type
+}
+
+func (t *Signature) String() string {
+	var str strings.Builder
+	str.WriteString("fn(")
+	for i, param := range t.Params {
+		if i > 0 {
+			str.WriteString(", ")
+		}
+		str.WriteString(param.String())
+	}
+	str.WriteString(")")
+	if t.Result != Void {
+		str.WriteString(" -> " + t.Result.String())
+	}
+	return str.String()
+}
+
+// Struct is a named record type. Its fields are resolved after every struct of
+// the module is declared, so that structs can refer to each other.
+type Struct struct {
+	Name   string // the name as written in the declaring module
+	Fields []Field
+}
+
+type Field struct {
+	Name string
+	Type Type
+}
+
+func (t *Struct) String() string {
+	return t.Name
+}
+
+// Field returns the index of the field called name, or -1 when there is none.
+func (t *Struct) Field(name string) int {
+	for i, field := range t.Fields {
+		if field.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Enum is a type whose values are one of its variants. Variants may carry
+// values, in which case the enum is a tagged union.
+type Enum struct {
+	Name     string // the name as written in the declaring module
+	Variants []Variant
+}
+
+type Variant struct {
+	Name   string
+	Fields []Type // the types of the carried values
+}
+
+func (t *Enum) String() string {
+	return t.Name
+}
+
+// Variant returns the index of the variant called name, or -1 when there is
+// none. The index is also the tag of the variant.
+func (t *Enum) Variant(name string) int {
+	for i, variant := range t.Variants {
+		if variant.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// IsPlain reports whether no variant of the enum carries values.
+func (t *Enum) IsPlain() bool {
+	for _, variant := range t.Variants {
+		if len(variant.Fields) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Array is a fixed number of values of the same type, stored one after the
+// other.
+type Array struct {
+	Elem Type
+	Len  int
+}
+
+func (t *Array) String() string {
+	return "[" + strconv.Itoa(t.Len) + "]" + t.Elem.String()
+}
+
+// Slice is a view of a sequence of values of the same type, like the elements
+// of an array. Its length is only known at run time.
+type Slice struct {
+	Elem Type
+}
+
+func (t *Slice) String() string {
+	return "[]" + t.Elem.String()
+}
+
+func IsArray(t Type) bool {
+	_, ok := t.(*Array)
+	return ok
+}
+
+func IsSlice(t Type) bool {
+	_, ok := t.(*Slice)
+	return ok
+}
+
+func IsEnum(t Type) bool {
+	_, ok := t.(*Enum)
+	return ok
+}
+
+func IsStruct(t Type) bool {
+	_, ok := t.(*Struct)
+	return ok
+}
+
+func IsInteger(t Type) bool {
+	return IsSigned(t) || IsUnsigned(t)
+}
+
+func IsSigned(t Type) bool {
+	return t == I8 || t == I16 || t == I32 || t == I64
+}
+
+func IsUnsigned(t Type) bool {
+	return t == U8 || t == U16 || t == U32 || t == U64
+}
+
+// Bits returns the number of bits of an integer type, or 0 for other types.
+func Bits(t Type) int {
+	switch t {
+	case I8, U8:
+		return 8
+	case I16, U16:
+		return 16
+	case I32, U32:
+		return 32
+	case I64, U64:
+		return 64
+	}
+	return 0
+}
+
+func IsFloat(t Type) bool {
+	return t == F32 || t == F64
+}
+
+func IsNumeric(t Type) bool {
+	return IsInteger(t) || IsFloat(t)
+}
+
+func IsInvalid(t Type) bool {
+	return t == nil || t == Invalid
+}
+
+// Identical reports whether a and b are the same type.
+func Identical(a, b Type) bool {
+	if a == b {
+		return true
+	}
+	switch a := a.(type) {
+	case *Array:
+		b, ok := b.(*Array)
+		return ok && a.Len == b.Len && Identical(a.Elem, b.Elem)
+	case *Slice:
+		b, ok := b.(*Slice)
+		return ok && Identical(a.Elem, b.Elem)
+	}
+	sa, okA := a.(*Signature)
+	sb, okB := b.(*Signature)
+	if !okA || !okB || len(sa.Params) != len(sb.Params) || !Identical(sa.Result, sb.Result) {
+		return false
+	}
+	for i := range sa.Params {
+		if !Identical(sa.Params[i], sb.Params[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,194 @@
+package workspace
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/LaH-DeV/veles/ast"
+	"github.com/LaH-DeV/veles/checker"
+	"github.com/LaH-DeV/veles/diagnostics"
+	"github.com/LaH-DeV/veles/lexer"
+	"github.com/LaH-DeV/veles/parser"
+	"github.com/LaH-DeV/veles/source"
+)
+
+// File is a source file that went through the whole front end.
+type File struct {
+	Path    string
+	Source  *source.File
+	Tokens  []lexer.Token
+	Program *ast.Program
+	Module  *checker.Module
+
+	// Diagnostics of every stage, in the order the stages ran.
+	Diagnostics []diagnostics.Diagnostic
+}
+
+// Workspace loads the modules of a program. Module paths of use statements are
+// resolved relative to Root: "use math::constants" loads Root/math/constants.vs.
+// Loaded files are cached until they are invalidated.
+type Workspace struct {
+	Root string
+
+	overlays map[string]string
+	files    map[string]*File
+	loading  map[string]bool
+}
+
+func New(root string) *Workspace {
+	return &Workspace{
+		Root:     root,
+		overlays: make(map[string]string),
+		files:    make(map[string]*File),
+		loading:  make(map[string]bool),
+	}
+}
+
+// SetOverlay makes the workspace use text instead of the content on disk for path,
+// which is how editors provide unsaved buffers.
+func (w *Workspace) SetOverlay(path string, text string) {
+	w.overlays[filepath.Clean(path)] = text
+	w.Invalidate()
+}
+
+func (w *Workspace) RemoveOverlay(path string) {
+	delete(w.overlays, filepath.Clean(path))
+	w.Invalidate()
+}
+
+// Invalidate drops every cached file. Any change can affect the modules that
+// import the changed one, so the cache is not invalidated selectively.
+func (w *Workspace) Invalidate() {
+	w.files = make(map[string]*File)
+}
+
+// Load lexes, parses and checks the file at path.
+func (w *Workspace) Load(path string) (*File, error) {
+	path = filepath.Clean(path)
+	if file, cached := w.files[path]; cached {
+		return file, nil
+	}
+	if w.loading[path] {
+		return nil, fmt.Errorf("import cycle through %s", w.ModuleName(path))
+	}
+
+	text, err := w.read(path)
+	if err != nil {
+		return nil, err
+	}
+
+	w.loading[path] = true
+	defer delete(w.loading, path)
+
+	file := &File{
+		Path:   path,
+		Source: source.NewFile(path, text),
+	}
+
+	lex := lexer.NewLexer(lexer.Vs)
+	file.Tokens = lex.Tokenize(text)
+	file.Diagnostics = append(file.Diagnostics, lex.Diagnostics...)
+
+	par := parser.NewParser(lexer.Vs)
+	file.Program = par.ParseFile(file.Tokens, path)
+	file.Diagnostics = append(file.Diagnostics, par.Diagnostics...)
+
+	file.Module = checker.Check(file.Program, w.ModuleName(path), w)
+	file.Diagnostics = append(file.Diagnostics, file.Module.Diagnostics...)
+
+	w.files[path] = file
+	return file, nil
+}
+
+// LoadAll loads every Veles source below Root together with the open overlays.
+// Files that cannot be read are reported in the returned errors.
+func (w *Workspace) LoadAll() ([]*File, []error) {
+	paths := make(map[string]bool)
+	for path := range w.overlays {
+		paths[path] = true
+	}
+	errs := make([]error, 0)
+	err := filepath.WalkDir(w.Root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			errs = append(errs, err)
+			return nil
+		}
+		if entry.IsDir() && path != w.Root && strings.HasPrefix(entry.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if !entry.IsDir() && filepath.Ext(path) == ".vs" {
+			paths[filepath.Clean(path)] = true
+		}
+		return nil
+	})
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	sorted := make([]string, 0, len(paths))
+	for path := range paths {
+		sorted = append(sorted, path)
+	}
+	sort.Strings(sorted)
+
+	files := make([]*File, 0, len(sorted))
+	for _, path := range sorted {
+		file, err := w.Load(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		files = append(files, file)
+	}
+	return files, errs
+}
+
+// Files returns the files loaded so far, ordered by path.
+func (w *Workspace) Files() []*File {
+	files := make([]*File, 0, len(w.files))
+	for _, file := range w.files {
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files
+}
+
+func (w *Workspace) read(path string) (string, error) {
+	if text, exists := w.overlays[path]; exists {
+		return text, nil
+	}
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return string(bytes), nil
+}
+
+// Import implements checker.Importer.
+func (w *Workspace) Import(path []string) (*checker.Module, error) {
+	filename := filepath.Join(append([]string{w.Root}, path...)...) + ".vs"
+	if _, exists := w.overlays[filename]; !exists {
+		if _, err := os.Stat(filename); err != nil {
+			return nil, fmt.Errorf("no module %s", strings.Join(path, "::"))
+		}
+	}
+	file, err := w.Load(filename)
+	if err != nil {
+		return nil, err
+	}
+	return file.Module, nil
+}
+
+// ModuleName returns the name other modules use to import the file at path.
+func (w *Workspace) ModuleName(path string) string {
+	rel, err := filepath.Rel(w.Root, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		rel = filepath.Base(path)
+	}
+	rel = strings.TrimSuffix(rel, filepath.Ext(rel))
+	return strings.Join(strings.Split(filepath.ToSlash(rel), "/"), "::")
+}